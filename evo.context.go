@@ -1,7 +1,9 @@
 package evo
 
 import (
+	stderrors "errors"
 	"fmt"
+	"github.com/getevo/evo/v2/lib/db/types"
 	"github.com/getevo/evo/v2/lib/errors"
 	"net/url"
 	"reflect"
@@ -94,6 +96,15 @@ func Upgrade(ctx fiber.Ctx) *Request {
 	return &r
 }
 
+// errorStatus returns the status of an error returned by a handler: 409
+// Conflict for stale updates of versioned rows, 400 Bad Request otherwise.
+func errorStatus(err error) int {
+	if stderrors.Is(err, types.ErrStaleObject) {
+		return StatusConflict
+	}
+	return StatusBadRequest
+}
+
 func (r *Request) WriteResponse(resp ...any) {
 	if len(resp) == 0 {
 		return
@@ -126,7 +137,7 @@ func (r *Request) WriteResponse(resp ...any) {
 		case reflect.Struct, reflect.Ptr:
 			if v, ok := item.(error); ok {
 				r.Response.Success = false
-				r.Status(StatusBadRequest)
+				r.Status(errorStatus(v))
 				r.Response.Error = append(r.Response.Error, v.Error())
 				r._writeResponse(r.Response)
 				return
@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	dbpkg "github.com/getevo/evo/v2/lib/db"
+	"github.com/getevo/evo/v2/lib/db/profile"
 	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
 	evolog "github.com/getevo/evo/v2/lib/log"
 	"github.com/getevo/evo/v2/lib/settings"
 	"gorm.io/gorm"
@@ -18,6 +23,18 @@ import (
 
 var db *gorm.DB
 
+var (
+	// namedDBs holds the named connections opened so far, by lower case name.
+	namedDBs   = map[string]*gorm.DB{}
+	namedDBsMu sync.Mutex
+)
+
+// driverNames maps the Database.Type values to the name of their driver.
+var driverNames = map[string]string{
+	"mysql": "mysql", "mariadb": "mysql",
+	"postgres": "postgres", "postgresql": "postgres", "pgsql": "postgres",
+}
+
 func setupDatabase() error {
 	var err error
 	var config = DatabaseConfig{}
@@ -28,6 +45,46 @@ func setupDatabase() error {
 	if !config.Enabled {
 		return nil
 	}
+
+	if config.EncryptionKeys != "" {
+		ring, err := types.ParseKeyRing(config.EncryptionKeys, config.BlindIndexKey)
+		if err != nil {
+			return err
+		}
+		types.SetKeyRing(ring)
+	}
+
+	driver := dbpkg.GetDriver()
+	if driver == nil {
+		return fmt.Errorf("no database driver registered")
+	}
+	var cfg = gormConfig(config)
+	db, err = driver.Open(driverConfig(config, config.Server), cfg)
+	if err != nil {
+		return fmt.Errorf("unable to connect to database: %w", err)
+	}
+	if err = setupReplicas(driver, config, cfg); err != nil {
+		return err
+	}
+	dbpkg.AllowDestructiveMigration(config.AllowDestructiveMigration)
+	if config.FullTextLanguage != "" {
+		dbpkg.SetFullTextLanguage(config.FullTextLanguage)
+	}
+	dbpkg.SetPostGIS(config.PostGIS)
+
+	if config.PurgeSchedule != "" {
+		dbpkg.SchedulePurge(config.PurgeSchedule, config.PurgeBatchSize)
+	}
+
+	for _, name := range databaseConnectionNames() {
+		if _, err = openNamedDB(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gormConfig(config DatabaseConfig) *gorm.Config {
 	var logLevel logger.LogLevel
 
 	switch config.Debug {
@@ -49,16 +106,24 @@ func setupDatabase() error {
 			Colorful:      true,                      // Disable color
 		},
 	)
-	cfg := &gorm.Config{
+	var queryProfile = profile.Plugin{SlowThreshold: config.SlowQueryThreshold, Explain: config.ExplainSlowQueries}
+	if config.Debug >= 4 {
+		queryProfile.NPlusOne = config.NPlusOneThreshold
+	}
+	return &gorm.Config{
 		Logger: newLog,
+		Plugins: map[string]gorm.Plugin{
+			types.Versioning{}.Name():   types.Versioning{},
+			queryProfile.Name():         queryProfile,
+			types.BlindIndexes{}.Name(): types.BlindIndexes{},
+			types.SoftDeletes{}.Name():  types.SoftDeletes{},
+		},
 	}
+}
 
-	driver := dbpkg.GetDriver()
-	if driver == nil {
-		return fmt.Errorf("no database driver registered")
-	}
-	driverCfg := dbpkg.DriverConfig{
-		Server:   config.Server,
+func driverConfig(config DatabaseConfig, server string) dbpkg.DriverConfig {
+	return dbpkg.DriverConfig{
+		Server:   server,
 		Username: config.Username,
 		Password: config.Password,
 		Database: config.Database,
@@ -66,11 +131,130 @@ func setupDatabase() error {
 		SSLMode:  config.SSLMode,
 		Params:   config.Params,
 	}
-	db, err = driver.Open(driverCfg, cfg)
+}
+
+func poolConfig(config DatabaseConfig) dbpkg.PoolConfig {
+	return dbpkg.PoolConfig{
+		MaxOpenConns:    config.MaxOpenConns,
+		MaxIdleConns:    config.MaxIdleConns,
+		ConnMaxLifetime: config.ConnMaxLifTime,
+	}
+}
+
+// setupReplicas opens the read replicas listed in config.Replicas with the
+// credentials of the primary and routes reads of db to them.
+func setupReplicas(driver dbpkg.Driver, config DatabaseConfig, cfg *gorm.Config) error {
+	var conns = map[string]*gorm.DB{}
+	for _, server := range strings.Split(config.Replicas, ",") {
+		if server = strings.TrimSpace(server); server == "" {
+			continue
+		}
+		conn, err := driver.Open(driverConfig(config, server), cfg)
+		if err != nil {
+			return fmt.Errorf("unable to connect to database replica %s: %w", server, err)
+		}
+		if err = dbpkg.ApplyPool(conn, poolConfig(config)); err != nil {
+			return err
+		}
+		conns[server] = conn
+	}
+	if len(conns) == 0 {
+		return nil
+	}
+	replicas, err := dbpkg.NewReplicas(conns)
 	if err != nil {
-		return fmt.Errorf("unable to connect to database: %w", err)
+		return err
 	}
-	return nil
+	return db.Use(replicas)
+}
+
+// databaseConnectionNames returns the names of the connections configured
+// under Databases.<name>, found by their Server setting.
+func databaseConnectionNames() []string {
+	var names []string
+	for key := range settings.All() {
+		if name, ok := strings.CutSuffix(key, "_SERVER"); ok && strings.HasPrefix(name, "DATABASES_") {
+			names = append(names, strings.ToLower(strings.TrimPrefix(name, "DATABASES_")))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namedDatabaseConfig reads the settings of a named connection. Each field
+// is looked up by its name and by its yaml key under Databases.<name>.
+func namedDatabaseConfig(name string) (DatabaseConfig, bool) {
+	var config DatabaseConfig
+	var found bool
+	var ref = reflect.ValueOf(&config).Elem()
+	for i := 0; i < ref.NumField(); i++ {
+		var field = ref.Type().Field(i)
+		var keys = []string{field.Name}
+		if tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); tag != "" {
+			keys = append(keys, tag)
+		}
+		for _, key := range keys {
+			ok, value := settings.Has("Databases." + name + "." + key)
+			if !ok {
+				continue
+			}
+			found = true
+			var target = ref.Field(i)
+			switch {
+			case target.Type() == reflect.TypeOf(time.Duration(0)):
+				if d, err := value.Duration(); err == nil {
+					target.SetInt(int64(d))
+				}
+			case target.Kind() == reflect.Bool:
+				target.SetBool(value.Bool())
+			case target.Kind() == reflect.Int:
+				target.SetInt(int64(value.Int()))
+			default:
+				target.SetString(value.String())
+			}
+			break
+		}
+	}
+	return config, found
+}
+
+// openNamedDB opens the named connection configured under Databases.<name>
+// with the driver matching its Type, or the primary driver when Type is
+// empty, and registers its readiness check.
+func openNamedDB(name string) (*gorm.DB, error) {
+	name = strings.ToLower(name)
+	namedDBsMu.Lock()
+	defer namedDBsMu.Unlock()
+	if conn, ok := namedDBs[name]; ok {
+		return conn, nil
+	}
+
+	config, ok := namedDatabaseConfig(name)
+	if !ok {
+		return nil, fmt.Errorf("database connection %s is not configured", name)
+	}
+	var driver = dbpkg.GetDriver()
+	if config.Type != "" {
+		driver = dbpkg.FindDriver(driverNames[strings.ToLower(config.Type)])
+	}
+	if driver == nil {
+		return nil, fmt.Errorf("no database driver registered for connection %s of type '%s'", name, config.Type)
+	}
+	conn, err := driver.Open(driverConfig(config, config.Server), gormConfig(config))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to database %s: %w", name, err)
+	}
+	if err = dbpkg.ApplyPool(conn, poolConfig(config)); err != nil {
+		return nil, err
+	}
+	namedDBs[name] = conn
+	dbpkg.RegisterConnection(name, conn)
+	OnReadyCheck(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return dbpkg.PingConnection(ctx, name)
+	})
+	return conn, nil
 }
 
 // GetDBO return database object instance
@@ -92,6 +276,25 @@ func GetDB(ctx ...context.Context) *gorm.DB {
 	return GetDBO(ctx...)
 }
 
+// GetNamedDB returns the named connection configured under Databases.<name>,
+// opening it on first use, or the primary one for an empty name. It returns
+// an error for a connection that is not configured or cannot be opened:
+//
+//	conn, err := evo.GetNamedDB("analytics", ctx)
+func GetNamedDB(name string, ctx ...context.Context) (*gorm.DB, error) {
+	if name == "" {
+		return GetDBO(ctx...), nil
+	}
+	conn, err := openNamedDB(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ctx) > 0 {
+		return conn.WithContext(ctx[0]), nil
+	}
+	return conn, nil
+}
+
 type Model struct {
 	ID        uint       `json:"id" gorm:"primary_key"`
 	CreatedAt time.Time  `json:"created_at"`
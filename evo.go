@@ -1,10 +1,12 @@
 package evo
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -15,8 +17,13 @@ import (
 	"github.com/getevo/evo/v2/lib/settings"
 
 	dbo "github.com/getevo/evo/v2/lib/db"
+	"github.com/getevo/evo/v2/lib/db/profile"
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/seed"
+	"github.com/getevo/evo/v2/lib/db/types"
 	"github.com/getevo/evo/v2/lib/generic"
 	"github.com/getevo/evo/v2/lib/memo"
+	"github.com/getevo/evo/v2/lib/tenant"
 	"github.com/gofiber/fiber/v3"
 )
 
@@ -52,32 +59,30 @@ func Setup(params ...any) error {
 		log.Fatal("Unable to retrieve HTTP server configurations: ", err)
 	}
 
-	// Extract driver from params
-	var driverCount int
+	// Extract drivers from params; named connections may use another engine
+	var drivers []dbo.Driver
 	for _, p := range params {
 		if d, ok := p.(dbo.Driver); ok {
-			driverCount++
-			if driverCount > 1 {
-				return fmt.Errorf("only one database driver can be registered")
-			}
 			dbo.RegisterDriver(d)
+			drivers = append(drivers, d)
 		}
 	}
 
 	app = fiber.New(fiberConfig)
 	if settings.Get("Database.Enabled").Bool() {
-		if dbo.GetDriver() == nil {
+		if len(drivers) == 0 {
 			return fmt.Errorf("Database.Enabled is true but no driver passed to evo.Setup()")
 		}
-		// Validate that config type matches the provided driver
+		// The primary connection uses the driver matching Database.Type, or
+		// the first driver passed when the type is not a known engine
 		configType := strings.ToLower(settings.Get("Database.Type").String())
-		driverName := dbo.GetDriver().Name()
-		validNames := map[string]string{
-			"mysql": "mysql", "mariadb": "mysql",
-			"postgres": "postgres", "postgresql": "postgres", "pgsql": "postgres",
-		}
-		if expected, ok := validNames[configType]; ok && expected != driverName {
-			return fmt.Errorf("Database.Type is '%s' but driver '%s' was provided", configType, driverName)
+		dbo.RegisterDriver(drivers[0])
+		if expected, ok := driverNames[configType]; ok {
+			driver := dbo.FindDriver(expected)
+			if driver == nil {
+				return fmt.Errorf("Database.Type is '%s' but driver '%s' was provided", configType, drivers[0].Name())
+			}
+			dbo.RegisterDriver(driver)
 		}
 
 		db = GetDBO()
@@ -90,6 +95,12 @@ func Setup(params ...any) error {
 		} else {
 			log.Warning("Database is nil, skipping database settings load")
 		}
+
+		// Per-request query stats, see Database.QueryStats
+		var debug = settings.Get("Database.Debug").Int() >= 4
+		if debug || settings.Get("Database.QueryStats").Bool() {
+			app.Use(profile.Middleware(profile.MiddlewareConfig{ServerTiming: debug, Log: debug}))
+		}
 	}
 
 	memo.Register()
@@ -105,6 +116,15 @@ func Run() error {
 	if args.Exists("--migration-do") {
 
 		err := dbo.DoMigration()
+		for _, name := range dbo.ConnectionNames() {
+			if err != nil {
+				break
+			}
+			err = dbo.DoMigrationOn(name)
+		}
+		if err == nil {
+			err = tenant.Migrate(context.Background())
+		}
 
 		if err != nil {
 			log.Error("unable to perform database migrations", "error", err)
@@ -113,6 +133,60 @@ func Run() error {
 		}
 	}
 
+	if args.Exists("--migration-status") {
+		if err := dbo.PrintMigrationStatus(); err != nil {
+			log.Fatal("unable to read migration status", "error", err)
+		}
+		os.Exit(0)
+	}
+
+	if args.Exists("--migration-rollback") {
+		n := 1
+		if value := args.Get("--migration-rollback"); value != "" && !strings.HasPrefix(value, "-") {
+			var err error
+			if n, err = strconv.Atoi(value); err != nil || n < 1 {
+				log.Fatal("--migration-rollback expects a positive number of migrations", "value", value)
+			}
+		}
+		if err := dbo.RollbackMigrations(n); err != nil {
+			log.Fatal("unable to roll back migrations", "error", err)
+		}
+		log.Info("migrations rolled back successfully", "count", n)
+		os.Exit(0)
+	}
+
+	if id := args.Get("--migration-to"); id != "" {
+		if err := dbo.MigrateTo(id); err != nil {
+			log.Fatal("unable to migrate", "to", id, "error", err)
+		}
+		log.Info("migrated successfully", "to", id)
+		os.Exit(0)
+	}
+
+	if dir := args.Get("--migration-generate"); dir != "" {
+		path, err := dbo.GenerateMigrationFile(dir)
+		if err != nil {
+			log.Fatal("unable to generate migration file", "error", err)
+		}
+		if path != "" {
+			log.Info("migration file generated", "path", path)
+		}
+		os.Exit(0)
+	}
+
+	if dir := args.Get("--migration-apply"); dir != "" {
+		drift, err := dbo.ApplyMigrationFiles(dir)
+		if err != nil {
+			log.Fatal("unable to apply migration files", "error", err)
+		}
+		if len(drift) > 0 {
+			log.Warning("migration files applied, but the schema still differs from the models", "statements", len(drift))
+		} else {
+			log.Info("migration files applied successfully")
+		}
+		os.Exit(0)
+	}
+
 	if args.Exists("--migration-dry-run") {
 		dbo.DryRunMigration()
 		os.Exit(0)
@@ -123,6 +197,51 @@ func Run() error {
 		os.Exit(0)
 	}
 
+	if format := args.Get("--schema-export"); format != "" {
+		data, err := dbo.ExportSchema(format)
+		if err != nil {
+			log.Fatal("unable to export the schema", "error", err)
+		}
+		os.Stdout.Write(data)
+		os.Exit(0)
+	}
+
+	if args.Exists("--seed") {
+		var names []string
+		if value := args.Get("--seed"); value != "" && !strings.HasPrefix(value, "-") {
+			names = strings.Split(value, ",")
+		}
+		if err := seed.Run(context.Background(), GetDBO(), names...); err != nil {
+			log.Fatal("unable to seed the database", "error", err)
+		}
+		log.Info("database seeded successfully", "env", seed.Environment())
+		os.Exit(0)
+	}
+
+	if args.Exists("--encryption-rotate") {
+		batch := 500
+		if value := args.Get("--encryption-rotate"); value != "" && !strings.HasPrefix(value, "-") {
+			var err error
+			if batch, err = strconv.Atoi(value); err != nil || batch < 1 {
+				log.Fatal("--encryption-rotate expects a positive batch size", "value", value)
+			}
+		}
+		var total int64
+		for _, model := range Models() {
+			conn, err := GetNamedDB(schema.ModelConnection(model.Sample))
+			if err != nil {
+				log.Fatal("unable to rotate the encryption keys", "table", model.Table, "error", err)
+			}
+			n, err := types.RotateEncryption(context.Background(), conn, batch, model.Sample)
+			total += n
+			if err != nil {
+				log.Fatal("unable to rotate the encryption keys", "table", model.Table, "error", err)
+			}
+		}
+		log.Info("encrypted columns rotated successfully", "rows", total)
+		os.Exit(0)
+	}
+
 	// Register health check endpoints
 	registerHealthCheckEndpoints()
 
@@ -0,0 +1,25 @@
+package evo
+
+import (
+	"strconv"
+
+	"github.com/getevo/evo/v2/lib/db/history"
+	"github.com/gofiber/fiber/v3"
+)
+
+// HistoryActor returns the request user as the actor of the changes it
+// makes, see SetUserInterface. Anonymous requests have no actor.
+//
+//	evo.GetDBO().Use(&history.Plugin{})
+//	evo.GetFiber().Use(history.Middleware(evo.HistoryActor))
+func HistoryActor(c fiber.Ctx) history.Actor {
+	var user = Upgrade(c).User()
+	if user == nil || user.Anonymous() {
+		return history.Actor{}
+	}
+	var id = user.UUID()
+	if id == "" {
+		id = strconv.FormatUint(user.ID(), 10)
+	}
+	return history.Actor{ID: id, Name: user.GetFullName()}
+}
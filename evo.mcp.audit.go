@@ -0,0 +1,433 @@
+package evo
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dbpkg "github.com/getevo/evo/v2/lib/db"
+	"github.com/getevo/evo/v2/lib/db/types"
+	"github.com/getevo/evo/v2/lib/log"
+	"github.com/getevo/evo/v2/lib/mcp"
+	"github.com/getevo/evo/v2/lib/pubsub"
+	"github.com/getevo/json"
+)
+
+// Outcomes of an audited tool call.
+const (
+	MCPOutcomeSuccess     = "success"      // the tool ran and returned a result
+	MCPOutcomeError       = "error"        // the tool ran and returned a tool error
+	MCPOutcomeRateLimited = "rate_limited" // a quota was exhausted, the tool did not run
+	MCPOutcomeRejected    = "rejected"     // the tool is unknown or hidden from the caller
+)
+
+// redactedValue replaces the value of every redacted argument.
+const redactedValue = "[REDACTED]"
+
+// MCPAuditEntry records one tools/call. It doubles as the model of the
+// mcp_audit_log table written by MCPAuditDatabaseSink.
+type MCPAuditEntry struct {
+	ID   uint64    `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Time time.Time `gorm:"column:time;index" json:"time"`
+	Tool string    `gorm:"column:tool;size:128;index" json:"tool"`
+
+	// UserID and UserUUID identify the caller as resolved by UserInterface.
+	// Both are empty for an anonymous caller, who is known by IP only.
+	UserID   uint64 `gorm:"column:user_id" json:"user_id"`
+	UserUUID string `gorm:"column:user_uuid;size:64;index" json:"user_uuid"`
+	IP       string `gorm:"column:ip;size:64" json:"ip"`
+	Client   string `gorm:"column:client;size:128" json:"client"`
+
+	// Arguments are the call arguments with every field tagged
+	// `redact:"true"` or `pii:"true"` replaced by "[REDACTED]".
+	Arguments types.JSON `gorm:"column:arguments" json:"arguments"`
+
+	Duration time.Duration `gorm:"column:duration" json:"duration"`
+	Outcome  string        `gorm:"column:outcome;size:16;index" json:"outcome"`
+	Error    string        `gorm:"column:error;type:text" json:"error,omitempty"`
+}
+
+// TableName implements gorm's Tabler.
+func (MCPAuditEntry) TableName() string {
+	return "mcp_audit_log"
+}
+
+// MCPAuditSink receives every audited tool call. Record runs on the request
+// path after the tool has finished, so a slow sink delays the response; hand
+// the entry to a goroutine or a queue when that matters.
+type MCPAuditSink interface {
+	Record(entry *MCPAuditEntry) error
+}
+
+// MCPAuditLogSink writes every call to the application log.
+type MCPAuditLogSink struct{}
+
+// Record implements MCPAuditSink.
+func (MCPAuditLogSink) Record(entry *MCPAuditEntry) error {
+	log.Info("mcp tool call", "tool", entry.Tool, "outcome", entry.Outcome, "user", entry.UserUUID,
+		"ip", entry.IP, "duration", entry.Duration, "arguments", string(entry.Arguments), "error", entry.Error)
+	return nil
+}
+
+// MCPAuditDatabaseSink inserts every call into the mcp_audit_log table. The
+// table is created by the migration once the sink is added.
+type MCPAuditDatabaseSink struct{}
+
+// Record implements MCPAuditSink.
+func (MCPAuditDatabaseSink) Record(entry *MCPAuditEntry) error {
+	if db == nil {
+		return fmt.Errorf("the database is not enabled")
+	}
+	record := *entry
+	return db.Create(&record).Error
+}
+
+// MCPAuditPubSubSink publishes every call as JSON on a pub/sub topic.
+type MCPAuditPubSubSink struct {
+	Topic string
+
+	// Driver names the pub/sub driver. Empty uses the default driver.
+	Driver string
+}
+
+// Record implements MCPAuditSink.
+func (s MCPAuditPubSubSink) Record(entry *MCPAuditEntry) error {
+	if s.Driver != "" {
+		driver, ok := pubsub.Driver(s.Driver)
+		if !ok {
+			return fmt.Errorf("pub/sub driver %s is not registered", s.Driver)
+		}
+		return driver.Publish(s.Topic, entry)
+	}
+	if len(pubsub.Drivers()) == 0 {
+		return fmt.Errorf("no pub/sub driver is registered")
+	}
+	return pubsub.Publish(s.Topic, entry)
+}
+
+var mcpAuditSinks []MCPAuditSink
+
+// AddMCPAuditSink records every tools/call into the given sinks, in addition
+// to those already added.
+//
+// Example:
+//
+//	evo.AddMCPAuditSink(evo.MCPAuditDatabaseSink{}, evo.MCPAuditPubSubSink{Topic: "mcp.audit"})
+func AddMCPAuditSink(sinks ...MCPAuditSink) {
+	mcpMutex.Lock()
+	defer mcpMutex.Unlock()
+	for _, sink := range sinks {
+		if _, ok := sink.(MCPAuditDatabaseSink); ok && db != nil {
+			dbpkg.UseModel(MCPAuditEntry{})
+		}
+		mcpAuditSinks = append(mcpAuditSinks, sink)
+	}
+}
+
+// MCPRateLimit is a call quota: at most Calls calls in every window of Per.
+// A zero Calls means unlimited; a zero Per means one minute.
+type MCPRateLimit struct {
+	Calls int
+	Per   time.Duration
+}
+
+func (l MCPRateLimit) window() time.Duration {
+	if l.Per <= 0 {
+		return time.Minute
+	}
+	return l.Per
+}
+
+// mcpParseRateLimit reads a quota written as "<calls>/<duration>", for
+// example "120/1m" or "10/s". An empty string is unlimited.
+func mcpParseRateLimit(expr string) (MCPRateLimit, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return MCPRateLimit{}, nil
+	}
+	calls, per, ok := strings.Cut(expr, "/")
+	if !ok {
+		return MCPRateLimit{}, fmt.Errorf("invalid rate limit %q, expected <calls>/<duration>", expr)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(calls))
+	if err != nil || n < 0 {
+		return MCPRateLimit{}, fmt.Errorf("invalid rate limit %q: bad call count", expr)
+	}
+	per = strings.TrimSpace(per)
+	if per != "" && (per[0] < '0' || per[0] > '9') {
+		per = "1" + per
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return MCPRateLimit{}, fmt.Errorf("invalid rate limit %q: bad duration", expr)
+	}
+	return MCPRateLimit{Calls: n, Per: d}, nil
+}
+
+// mcpUserRateLimit is MCP.UserRateLimit, parsed by setupMCPAudit.
+var mcpUserRateLimit MCPRateLimit
+
+// setupMCPAudit parses the quota configuration and enables the log sink.
+// It is called from registerMCPEndpoints.
+func setupMCPAudit() {
+	limit, err := mcpParseRateLimit(mcpConfig.UserRateLimit)
+	if err != nil {
+		log.Fatalf("mcp: MCP.UserRateLimit: %v", err)
+	}
+	mcpUserRateLimit = limit
+	if mcpConfig.AuditLog {
+		AddMCPAuditSink(MCPAuditLogSink{})
+	}
+}
+
+// mcpLimiter counts calls in fixed windows keyed by tool and caller.
+type mcpLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*mcpWindow
+	swept   time.Time
+	now     func() time.Time
+}
+
+type mcpWindow struct {
+	reset time.Time
+	count int
+}
+
+type mcpQuota struct {
+	key   string
+	limit MCPRateLimit
+}
+
+var mcpLimits = newMCPLimiter()
+
+func newMCPLimiter() *mcpLimiter {
+	return &mcpLimiter{windows: map[string]*mcpWindow{}, now: time.Now}
+}
+
+// take consumes one call from every quota, or from none when any of them is
+// exhausted. In that case it returns how long until the call would pass.
+func (l *mcpLimiter) take(quotas []mcpQuota) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.swept) > time.Minute {
+		for key, w := range l.windows {
+			if !now.Before(w.reset) {
+				delete(l.windows, key)
+			}
+		}
+		l.swept = now
+	}
+
+	windows := make([]*mcpWindow, len(quotas))
+	var wait time.Duration
+	for i, quota := range quotas {
+		w := l.windows[quota.key]
+		if w == nil || !now.Before(w.reset) {
+			w = &mcpWindow{reset: now.Add(quota.limit.window())}
+			l.windows[quota.key] = w
+		}
+		if w.count >= quota.limit.Calls && w.reset.Sub(now) > wait {
+			wait = w.reset.Sub(now)
+		}
+		windows[i] = w
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	for _, w := range windows {
+		w.count++
+	}
+	return 0, true
+}
+
+// mcpRateLimited enforces the caller's quota across all tools and the tool's
+// own quotas. It returns the tool error to answer with, or nil when the call
+// may run.
+func mcpRateLimited(c *MCPContext) *mcp.CallToolResult {
+	caller := mcpCaller(c.Request)
+	var quotas []mcpQuota
+	if mcpUserRateLimit.Calls > 0 {
+		quotas = append(quotas, mcpQuota{key: "caller\x00" + caller, limit: mcpUserRateLimit})
+	}
+	if c.Tool.RateLimit.Calls > 0 {
+		quotas = append(quotas, mcpQuota{key: "tool\x00" + c.Tool.Name, limit: c.Tool.RateLimit})
+	}
+	if c.Tool.UserRateLimit.Calls > 0 {
+		quotas = append(quotas, mcpQuota{key: "tool\x00" + c.Tool.Name + "\x00" + caller, limit: c.Tool.UserRateLimit})
+	}
+	if len(quotas) == 0 {
+		return nil
+	}
+	wait, ok := mcpLimits.take(quotas)
+	if ok {
+		return nil
+	}
+	return mcpErrorResult(fmt.Sprintf("rate limit exceeded for tool %s, retry in %s",
+		c.Tool.Name, (wait + time.Second - 1).Truncate(time.Second)))
+}
+
+// mcpCaller identifies the caller for per-user quotas: the user when known,
+// the client address otherwise.
+func mcpCaller(r *Request) string {
+	user := r.User()
+	if !user.Anonymous() {
+		if uuid := user.UUID(); uuid != "" {
+			return "user:" + uuid
+		}
+		return "user:" + strconv.FormatUint(user.ID(), 10)
+	}
+	return "ip:" + r.IP()
+}
+
+// mcpAuditStart opens the audit entry of a call. It returns nil when no sink
+// is configured, and every method of the entry accepts nil.
+func mcpAuditStart(r *Request, name string, client mcp.Implementation) *MCPAuditEntry {
+	mcpMutex.RLock()
+	enabled := len(mcpAuditSinks) > 0
+	mcpMutex.RUnlock()
+	if !enabled {
+		return nil
+	}
+	entry := &MCPAuditEntry{Time: time.Now(), Tool: name, IP: r.IP(), Client: client.Name}
+	if user := r.User(); !user.Anonymous() {
+		entry.UserID = user.ID()
+		entry.UserUUID = user.UUID()
+	}
+	return entry
+}
+
+// finish completes the entry and hands it to every sink. Arguments of an
+// unknown tool are dropped, since there are no tags to redact them by.
+func (entry *MCPAuditEntry) finish(tool *MCPTool, arguments json.RawMessage, outcome string, result *mcp.CallToolResult) {
+	if entry == nil {
+		return
+	}
+	entry.Outcome = outcome
+	if tool != nil {
+		entry.Arguments = types.JSON(mcpRedact(arguments, tool.redact))
+	}
+	if result != nil && result.IsError {
+		if outcome == MCPOutcomeSuccess {
+			entry.Outcome = MCPOutcomeError
+		}
+		var messages []string
+		for _, content := range result.Content {
+			if content.Text != "" {
+				messages = append(messages, content.Text)
+			}
+		}
+		entry.Error = strings.Join(messages, "; ")
+	}
+
+	mcpMutex.RLock()
+	sinks := append([]MCPAuditSink(nil), mcpAuditSinks...)
+	mcpMutex.RUnlock()
+	for _, sink := range sinks {
+		if err := sink.Record(entry); err != nil {
+			log.Error("mcp: unable to record tool call", "tool", entry.Tool, "sink", reflect.TypeOf(sink), "error", err)
+		}
+	}
+}
+
+// mcpRedactedPaths lists the dotted JSON paths of the fields of v tagged
+// `redact:"true"` or `pii:"true"`, each prefixed with prefix. Nested structs
+// and slices of structs are followed.
+func mcpRedactedPaths(v any, prefix string) []string {
+	if v == nil {
+		return nil
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var paths []string
+	mcpCollectRedacted(t, prefix, &paths, map[reflect.Type]bool{})
+	return paths
+}
+
+func mcpCollectRedacted(t reflect.Type, prefix string, paths *[]string, seen map[reflect.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		inner := field.Type
+		for inner.Kind() == reflect.Ptr || inner.Kind() == reflect.Slice || inner.Kind() == reflect.Array {
+			inner = inner.Elem()
+		}
+		if field.Anonymous && name == "" && inner.Kind() == reflect.Struct {
+			mcpCollectRedacted(inner, prefix, paths, seen)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if field.Tag.Get("redact") == "true" || field.Tag.Get("pii") == "true" {
+			*paths = append(*paths, prefix+name)
+			continue
+		}
+		if inner.Kind() == reflect.Struct && inner != reflect.TypeOf(time.Time{}) {
+			mcpCollectRedacted(inner, prefix+name+".", paths, seen)
+		}
+	}
+}
+
+// mcpRedact returns arguments with the value at every path replaced. Arguments
+// that cannot be decoded while redaction is required are dropped entirely.
+func mcpRedact(arguments json.RawMessage, paths []string) json.RawMessage {
+	if len(paths) == 0 || len(arguments) == 0 {
+		return arguments
+	}
+	var value any
+	if err := json.Unmarshal(arguments, &value); err != nil {
+		return nil
+	}
+	for _, path := range paths {
+		mcpRedactPath(value, strings.Split(path, "."))
+	}
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+func mcpRedactPath(value any, path []string) {
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			mcpRedactPath(item, path)
+		}
+	case map[string]any:
+		child, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			if child != nil {
+				v[path[0]] = redactedValue
+			}
+			return
+		}
+		mcpRedactPath(child, path[1:])
+	}
+}
@@ -0,0 +1,266 @@
+package evo
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type memoryAuditSink struct {
+	mu      sync.Mutex
+	entries []MCPAuditEntry
+}
+
+func (s *memoryAuditSink) Record(entry *MCPAuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, *entry)
+	return nil
+}
+
+func (s *memoryAuditSink) last(t *testing.T) MCPAuditEntry {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) == 0 {
+		t.Fatal("no call was audited")
+	}
+	return s.entries[len(s.entries)-1]
+}
+
+type auditCard struct {
+	Number string `json:"number" redact:"true"`
+	Holder string `json:"holder"`
+}
+
+type auditInput struct {
+	Customer string      `json:"customer"`
+	Email    string      `json:"email" pii:"true"`
+	Cards    []auditCard `json:"cards"`
+	Fail     bool        `json:"fail"`
+}
+
+// headerUser is known by the X-User header, so that tests can act as several
+// callers from the same address.
+type headerUser struct {
+	DefaultUserInterface
+	uuid string
+}
+
+func (u headerUser) UUID() string    { return u.uuid }
+func (u headerUser) Anonymous() bool { return u.uuid == "" }
+func (u headerUser) FromRequest(r *Request) UserInterface {
+	return headerUser{uuid: r.Header("X-User")}
+}
+
+func newMCPAuditTestApp(t *testing.T, tool MCPTool) (*fiber.App, *memoryAuditSink) {
+	t.Helper()
+	a := newMCPTestApp(t)
+	previous := UserInterfaceInstance
+	t.Cleanup(func() { UserInterfaceInstance = previous })
+	SetUserInterface(headerUser{})
+
+	sink := &memoryAuditSink{}
+	AddMCPAuditSink(sink)
+	RegisterMCPTool(tool)
+	return a, sink
+}
+
+func chargeTool() MCPTool {
+	return MCPTool{
+		Name:  "charge",
+		Input: auditInput{},
+		Handler: func(c *MCPContext) any {
+			var in auditInput
+			if err := c.Bind(&in); err != nil {
+				return err
+			}
+			if in.Fail {
+				return errors.New("card declined")
+			}
+			return "charged"
+		},
+	}
+}
+
+func TestMCPAuditRecordsCallsWithRedactedArguments(t *testing.T) {
+	a, sink := newMCPAuditTestApp(t, chargeTool())
+
+	res := call(t, a, toolCall("charge", `{"customer":"ACME","email":"a@acme.test","cards":[{"number":"4111","holder":"Ann"}]}`), "X-User", "u-1")
+	if res.result["isError"] == true {
+		t.Fatalf("unexpected tool error: %s", res.body)
+	}
+	entry := sink.last(t)
+	if entry.Tool != "charge" || entry.Outcome != MCPOutcomeSuccess || entry.UserUUID != "u-1" || entry.Error != "" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if entry.Time.IsZero() || entry.Duration <= 0 {
+		t.Errorf("expected the time and duration to be recorded, got %v and %v", entry.Time, entry.Duration)
+	}
+	args := string(entry.Arguments)
+	if strings.Contains(args, "a@acme.test") || strings.Contains(args, "4111") {
+		t.Errorf("expected tagged fields to be redacted, got %s", args)
+	}
+	if !strings.Contains(args, "ACME") || !strings.Contains(args, "Ann") || strings.Count(args, redactedValue) != 2 {
+		t.Errorf("expected only tagged fields to be redacted, got %s", args)
+	}
+}
+
+func TestMCPAuditRecordsFailuresAndRejections(t *testing.T) {
+	a, sink := newMCPAuditTestApp(t, chargeTool())
+
+	call(t, a, toolCall("charge", `{"fail":true}`))
+	if entry := sink.last(t); entry.Outcome != MCPOutcomeError || entry.Error != "card declined" || entry.UserUUID != "" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	call(t, a, toolCall("missing", `{"secret":"x"}`))
+	if entry := sink.last(t); entry.Tool != "missing" || entry.Outcome != MCPOutcomeRejected || len(entry.Arguments) != 0 {
+		t.Errorf("expected a rejected call without arguments, got %+v", entry)
+	}
+}
+
+func TestMCPAuditRedactsRouteArguments(t *testing.T) {
+	type signup struct {
+		Name     string `json:"name"`
+		Password string `json:"password" redact:"true"`
+	}
+	tool := mcpRouteTool("signup", fiber.Route{Method: "POST", Path: "/signup"}, MCPRoute{Body: signup{}})
+	redacted := string(mcpRedact([]byte(`{"body":{"name":"ann","password":"hunter2"}}`), tool.redact))
+	if strings.Contains(redacted, "hunter2") || !strings.Contains(redacted, "ann") {
+		t.Errorf("expected the body password to be redacted, got %s", redacted)
+	}
+}
+
+func TestMCPToolRateLimit(t *testing.T) {
+	tool := chargeTool()
+	tool.RateLimit = MCPRateLimit{Calls: 2, Per: time.Hour}
+	a, sink := newMCPAuditTestApp(t, tool)
+
+	for i, user := range []string{"u-1", "u-2"} {
+		if res := call(t, a, toolCall("charge", `{}`), "X-User", user); res.result["isError"] == true {
+			t.Fatalf("call %d: unexpected tool error: %s", i, res.body)
+		}
+	}
+	res := call(t, a, toolCall("charge", `{}`), "X-User", "u-3")
+	if res.result["isError"] != true || !strings.Contains(res.body, "rate limit exceeded") {
+		t.Fatalf("expected the tool quota to be exhausted, got %s", res.body)
+	}
+	if entry := sink.last(t); entry.Outcome != MCPOutcomeRateLimited || entry.Duration != 0 {
+		t.Errorf("expected a rate limited entry, got %+v", entry)
+	}
+}
+
+func TestMCPUserRateLimit(t *testing.T) {
+	tool := chargeTool()
+	tool.UserRateLimit = MCPRateLimit{Calls: 1, Per: time.Hour}
+	a, _ := newMCPAuditTestApp(t, tool)
+
+	if res := call(t, a, toolCall("charge", `{}`), "X-User", "u-1"); res.result["isError"] == true {
+		t.Fatalf("unexpected tool error: %s", res.body)
+	}
+	if res := call(t, a, toolCall("charge", `{}`), "X-User", "u-1"); res.result["isError"] != true {
+		t.Errorf("expected the second call of u-1 to be limited, got %s", res.body)
+	}
+	if res := call(t, a, toolCall("charge", `{}`), "X-User", "u-2"); res.result["isError"] == true {
+		t.Errorf("expected u-2 to have its own quota, got %s", res.body)
+	}
+}
+
+func TestMCPCallerRateLimitSpansTools(t *testing.T) {
+	a, _ := newMCPAuditTestApp(t, chargeTool())
+	registerEchoTool(t)
+	mcpConfig.UserRateLimit = "1/h"
+	setupMCPAudit()
+
+	if res := call(t, a, toolCall("charge", `{}`), "X-User", "u-1"); res.result["isError"] == true {
+		t.Fatalf("unexpected tool error: %s", res.body)
+	}
+	if res := call(t, a, toolCall("echo", `{"message":"hi"}`), "X-User", "u-1"); res.result["isError"] != true {
+		t.Errorf("expected the caller quota to cover every tool, got %s", res.body)
+	}
+}
+
+func TestMCPLimiterWindowResets(t *testing.T) {
+	now := time.Now()
+	l := newMCPLimiter()
+	l.now = func() time.Time { return now }
+	quota := []mcpQuota{{key: "k", limit: MCPRateLimit{Calls: 1, Per: time.Minute}}}
+
+	if _, ok := l.take(quota); !ok {
+		t.Fatal("expected the first call to pass")
+	}
+	if wait, ok := l.take(quota); ok || wait != time.Minute {
+		t.Fatalf("expected the second call to wait a minute, got %v %v", wait, ok)
+	}
+	now = now.Add(time.Minute)
+	if _, ok := l.take(quota); !ok {
+		t.Error("expected a new window to pass")
+	}
+}
+
+func TestMCPLimiterConsumesNothingWhenAnyQuotaIsExhausted(t *testing.T) {
+	l := newMCPLimiter()
+	open := mcpQuota{key: "open", limit: MCPRateLimit{Calls: 5}}
+	full := mcpQuota{key: "full", limit: MCPRateLimit{Calls: 1}}
+	l.take([]mcpQuota{full})
+
+	if _, ok := l.take([]mcpQuota{open, full}); ok {
+		t.Fatal("expected the call to be limited")
+	}
+	if n := l.windows["open"].count; n != 0 {
+		t.Errorf("expected the open quota to be untouched, got %d", n)
+	}
+}
+
+func TestMCPParseRateLimit(t *testing.T) {
+	cases := map[string]MCPRateLimit{
+		"":        {},
+		"120/1m":  {Calls: 120, Per: time.Minute},
+		"10/s":    {Calls: 10, Per: time.Second},
+		" 5 / h ": {Calls: 5, Per: time.Hour},
+	}
+	for expr, want := range cases {
+		got, err := mcpParseRateLimit(expr)
+		if err != nil || got != want {
+			t.Errorf("%q: got %+v, %v", expr, got, err)
+		}
+	}
+	for _, expr := range []string{"10", "x/m", "10/forever", "-1/m"} {
+		if _, err := mcpParseRateLimit(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestMCPAuditDatabaseSink(t *testing.T) {
+	conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.AutoMigrate(&MCPAuditEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	previous := db
+	db = conn
+	t.Cleanup(func() { db = previous })
+
+	entry := &MCPAuditEntry{Time: time.Now(), Tool: "charge", Arguments: []byte(`{"a":1}`), Outcome: MCPOutcomeSuccess}
+	if err := (MCPAuditDatabaseSink{}).Record(entry); err != nil {
+		t.Fatal(err)
+	}
+	var stored MCPAuditEntry
+	if err := conn.First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Tool != "charge" || string(stored.Arguments) != `{"a":1}` {
+		t.Errorf("unexpected row %+v", stored)
+	}
+}
@@ -0,0 +1,215 @@
+package evo
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/getevo/evo/v2/lib/log"
+	"github.com/getevo/evo/v2/lib/mcp"
+	"github.com/getevo/evo/v2/lib/outcome"
+)
+
+// mcpValidator validates OAuth access tokens. It is nil unless
+// MCPConfig.AuthorizationServers is set.
+var mcpValidator *mcp.TokenValidator
+
+// MCPTokenUser is the User() of an MCP request authenticated with an OAuth
+// access token. It wraps whatever the application's UserInterface resolves
+// from the same request.
+//
+// The token's scopes bound what the caller may do: a permission is granted
+// only when it is also a granted scope. When the application recognises the
+// caller, the user's own permissions apply on top, so a token can narrow a
+// user's rights but never widen them.
+type MCPTokenUser struct {
+	UserInterface
+	Claims *mcp.Claims
+}
+
+// HasPermission implements UserInterface.
+func (u MCPTokenUser) HasPermission(permission string) bool {
+	if !u.Claims.HasScope(permission) {
+		return false
+	}
+	if u.UserInterface.Anonymous() {
+		return true
+	}
+	return u.UserInterface.HasPermission(permission)
+}
+
+// Anonymous implements UserInterface. A validated token always identifies a
+// subject.
+func (u MCPTokenUser) Anonymous() bool {
+	return false
+}
+
+// UUID implements UserInterface, falling back to the token subject when the
+// application does not know the caller.
+func (u MCPTokenUser) UUID() string {
+	if u.UserInterface.Anonymous() {
+		return u.Claims.Subject
+	}
+	return u.UserInterface.UUID()
+}
+
+// Attributes implements UserInterface. The token subject, client and scopes
+// are added to the application's attributes.
+func (u MCPTokenUser) Attributes() Attributes {
+	attributes := Attributes{}
+	for key, value := range u.UserInterface.Attributes() {
+		attributes[key] = value
+	}
+	attributes["sub"] = u.Claims.Subject
+	attributes["client_id"] = u.Claims.ClientID
+	attributes["scope"] = strings.Join(u.Claims.Scopes, " ")
+	return attributes
+}
+
+// Interface implements UserInterface.
+func (u MCPTokenUser) Interface() interface{} {
+	return u
+}
+
+// FromRequest implements UserInterface.
+func (u MCPTokenUser) FromRequest(request *Request) UserInterface {
+	return u
+}
+
+// setupMCPAuthorization prepares the OAuth resource server and mounts its
+// metadata document. It is called from registerMCPEndpoints.
+func setupMCPAuthorization() {
+	issuers := mcpSplit(mcpConfig.AuthorizationServers)
+	if len(issuers) == 0 {
+		return
+	}
+	if mcpConfig.Resource == "" {
+		// The audience must be fixed: deriving it from the Host header would
+		// let a token minted for another resource be replayed here.
+		log.Fatalf("mcp: MCP.Resource must be set when MCP.AuthorizationServers is configured")
+	}
+	mcpValidator = &mcp.TokenValidator{
+		Issuers:  issuers,
+		Audience: mcpConfig.Resource,
+		JWKSURL:  mcpConfig.JWKSURL,
+	}
+
+	// RFC 9728 places the document at the well-known path with the
+	// resource's own path appended. The bare path is served as well for
+	// clients that only try the root.
+	Get(mcp.WellKnownProtectedResource, mcpResourceMetadata)
+	if path := mcpResourcePath(); path != "" {
+		Get(mcp.WellKnownProtectedResource+path, mcpResourceMetadata)
+	}
+	log.Infof("mcp: accepting OAuth access tokens from %s", strings.Join(issuers, ", "))
+}
+
+// mcpResourceMetadata serves the OAuth 2.0 Protected Resource Metadata.
+func mcpResourceMetadata(r *Request) any {
+	return outcome.Json(mcp.ProtectedResourceMetadata{
+		Resource:               mcpConfig.Resource,
+		AuthorizationServers:   mcpSplit(mcpConfig.AuthorizationServers),
+		ScopesSupported:        mcpSplit(mcpConfig.Scopes),
+		BearerMethodsSupported: []string{"header"},
+		ResourceName:           mcpConfig.Name,
+	})
+}
+
+// mcpAuthenticate admits or refuses a request before any dispatch. It returns
+// nil when the request may proceed.
+//
+// The static token and OAuth may be enabled together: the static token is
+// tried first, so a trusted machine client keeps working while interactive
+// clients go through the authorization server.
+func mcpAuthenticate(r *Request) *outcome.Response {
+	if mcpConfig.Token == "" && mcpValidator == nil {
+		return nil
+	}
+	header := r.Header("Authorization")
+	if mcpConfig.Token != "" && mcpTokenAllowed(header) {
+		return nil
+	}
+	if mcpValidator == nil {
+		return outcome.Json(mcp.Failure(nil, mcp.CodeInvalidRequest,
+			"unauthorized")).Status(StatusUnauthorized).Header("WWW-Authenticate", "Bearer")
+	}
+
+	token := mcpBearer(header)
+	if token == "" {
+		return mcpChallenge(StatusUnauthorized, "", "")
+	}
+	claims, err := mcpValidator.Validate(r.Context.Context(), token)
+	if err != nil {
+		var tokenErr *mcp.TokenError
+		if !errors.As(err, &tokenErr) {
+			log.Errorf("mcp: unable to validate access token: %v", err)
+		}
+		return mcpChallenge(StatusUnauthorized, "invalid_token", "the access token is invalid")
+	}
+	for _, scope := range mcpSplit(mcpConfig.RequiredScopes) {
+		if !claims.HasScope(scope) {
+			return mcpChallenge(StatusForbidden, "insufficient_scope", "the access token lacks a required scope")
+		}
+	}
+
+	var base = UserInterfaceInstance.FromRequest(r)
+	if base == nil {
+		base = DefaultUserInterface{}
+	}
+	var user UserInterface = MCPTokenUser{UserInterface: base, Claims: claims}
+	r.UserInterface = &user
+	return nil
+}
+
+// mcpChallenge builds a 401 or 403 carrying the RFC 6750 challenge that points
+// the client at the resource metadata.
+func mcpChallenge(status int, code, description string) *outcome.Response {
+	challenge := fmt.Sprintf(`Bearer resource_metadata=%q`, mcpResourceMetadataURL())
+	if scopes := mcpSplit(mcpConfig.RequiredScopes); len(scopes) > 0 {
+		challenge += fmt.Sprintf(`, scope=%q`, strings.Join(scopes, " "))
+	}
+	if code != "" {
+		challenge += fmt.Sprintf(`, error=%q, error_description=%q`, code, description)
+	}
+	message := "unauthorized"
+	if status == StatusForbidden {
+		message = "forbidden"
+	}
+	return outcome.Json(mcp.Failure(nil, mcp.CodeInvalidRequest, message)).
+		Status(status).Header("WWW-Authenticate", challenge)
+}
+
+// mcpResourceMetadataURL is the absolute URL of the metadata document for the
+// configured resource.
+func mcpResourceMetadataURL() string {
+	u, err := url.Parse(mcpConfig.Resource)
+	if err != nil || u.Host == "" {
+		return mcp.WellKnownProtectedResource
+	}
+	return u.Scheme + "://" + u.Host + mcp.WellKnownProtectedResource + mcpResourcePath()
+}
+
+func mcpResourcePath() string {
+	u, err := url.Parse(mcpConfig.Resource)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// mcpBearer extracts the token from an Authorization header.
+func mcpBearer(header string) string {
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+// mcpSplit splits a comma or space separated configuration list.
+func mcpSplit(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
@@ -0,0 +1,190 @@
+package evo
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/mcp"
+	"github.com/getevo/json"
+	"github.com/gofiber/fiber/v3"
+)
+
+// oauthFixture is an authorization server stand-in: an RSA key published as
+// a JWKS and a signer for access tokens.
+type oauthFixture struct {
+	key  *rsa.PrivateKey
+	jwks *httptest.Server
+}
+
+func newMCPOAuthTestApp(t *testing.T) (*fiber.App, *oauthFixture) {
+	t.Helper()
+	a := newMCPTestApp(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &oauthFixture{key: key}
+	f.jwks = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "k1", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())},
+		}})
+	}))
+	t.Cleanup(f.jwks.Close)
+
+	mcpConfig.AuthorizationServers = "https://auth.example.com"
+	mcpConfig.Resource = "https://api.example.com/mcp"
+	mcpConfig.JWKSURL = f.jwks.URL
+	mcpConfig.Scopes = "invoice.read,invoice.write"
+	setupMCPAuthorization()
+	return a, f
+}
+
+func (f *oauthFixture) token(t *testing.T, scope string, change ...func(map[string]any)) string {
+	t.Helper()
+	claims := map[string]any{
+		"iss":   "https://auth.example.com",
+		"sub":   "user-7",
+		"aud":   "https://api.example.com/mcp",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": scope,
+	}
+	for _, fn := range change {
+		fn(claims)
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestMCPProtectedResourceMetadata(t *testing.T) {
+	a, _ := newMCPOAuthTestApp(t)
+
+	for _, path := range []string{mcp.WellKnownProtectedResource, mcp.WellKnownProtectedResource + "/mcp"} {
+		resp, err := a.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var metadata mcp.ProtectedResourceMetadata
+		if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if metadata.Resource != "https://api.example.com/mcp" ||
+			len(metadata.AuthorizationServers) != 1 || metadata.AuthorizationServers[0] != "https://auth.example.com" ||
+			len(metadata.ScopesSupported) != 2 {
+			t.Errorf("%s: unexpected metadata %+v", path, metadata)
+		}
+	}
+}
+
+func TestMCPOAuthChallengePointsAtMetadata(t *testing.T) {
+	a, _ := newMCPOAuthTestApp(t)
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	resp, err := a.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != nethttp.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+	want := `resource_metadata="https://api.example.com/.well-known/oauth-protected-resource/mcp"`
+	if got := resp.Header.Get("WWW-Authenticate"); !strings.HasPrefix(got, "Bearer ") || !strings.Contains(got, want) {
+		t.Errorf("unexpected challenge %q", got)
+	}
+}
+
+func TestMCPOAuthRejectsInvalidToken(t *testing.T) {
+	a, f := newMCPOAuthTestApp(t)
+	body := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+
+	for name, token := range map[string]string{
+		"expired":   f.token(t, "", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Minute).Unix() }),
+		"audience":  f.token(t, "", func(c map[string]any) { c["aud"] = "https://other.example.com/mcp" }),
+		"malformed": "abc",
+	} {
+		req := httptest.NewRequest("POST", "/mcp", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := a.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != nethttp.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, resp.StatusCode)
+		}
+		if got := resp.Header.Get("WWW-Authenticate"); !strings.Contains(got, `error="invalid_token"`) {
+			t.Errorf("%s: expected invalid_token, got %q", name, got)
+		}
+	}
+}
+
+func TestMCPOAuthScopesBecomePermissions(t *testing.T) {
+	a, f := newMCPOAuthTestApp(t)
+	registerPermissionedTools(t)
+
+	list := func(scope string) int {
+		res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+			"Authorization", "Bearer "+f.token(t, scope))
+		if res.status != nethttp.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", res.status, res.body)
+		}
+		return len(res.result["tools"].([]any))
+	}
+	if n := list("profile"); n != 1 {
+		t.Errorf("without the scope only the public tool is visible, got %d", n)
+	}
+	if n := list("profile invoice.read"); n != 2 {
+		t.Errorf("the invoice.read scope should reveal the permissioned tool, got %d", n)
+	}
+}
+
+func TestMCPOAuthScopesNarrowAKnownUser(t *testing.T) {
+	a, f := newMCPOAuthTestApp(t)
+	registerPermissionedTools(t)
+	withUser(t) // the application recognises the caller but grants nothing
+
+	res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`,
+		"Authorization", "Bearer "+f.token(t, "invoice.read"))
+	if n := len(res.result["tools"].([]any)); n != 1 {
+		t.Errorf("a scope must not grant what the user lacks, got %d tools", n)
+	}
+}
+
+func TestMCPOAuthRequiredScopes(t *testing.T) {
+	a, f := newMCPOAuthTestApp(t)
+	mcpConfig.RequiredScopes = "mcp"
+	body := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+
+	res := call(t, a, body, "Authorization", "Bearer "+f.token(t, "invoice.read"))
+	if res.status != nethttp.StatusForbidden {
+		t.Errorf("expected 403 without the required scope, got %d", res.status)
+	}
+	if res := call(t, a, body, "Authorization", "Bearer "+f.token(t, "mcp invoice.read")); res.status != nethttp.StatusOK {
+		t.Errorf("expected 200 with the required scope, got %d", res.status)
+	}
+}
+
+func TestMCPOAuthAcceptsStaticTokenToo(t *testing.T) {
+	a, _ := newMCPOAuthTestApp(t)
+	mcpConfig.Token = "machine"
+
+	if res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, "Authorization", "Bearer machine"); res.status != nethttp.StatusOK {
+		t.Errorf("the static token should still be accepted, got %d", res.status)
+	}
+}
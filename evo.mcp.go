@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/getevo/evo/v2/lib/generic"
 	"github.com/getevo/evo/v2/lib/log"
@@ -42,6 +43,33 @@ type MCPConfig struct {
 	// without an Origin header (native MCP clients send none) always pass.
 	// "*" allows any origin.
 	AllowedOrigins string `description:"Comma separated allowed Origin values, * for any" default:"" json:"allowed_origins" yaml:"allowed_origins"`
+
+	// AuthorizationServers, when set, turns the endpoint into an OAuth 2.1
+	// resource server: callers present JWT access tokens issued by one of
+	// these issuers, and the token's scopes become the caller's permissions.
+	AuthorizationServers string `description:"Comma separated OAuth issuer URLs whose access tokens are accepted" default:"" json:"authorization_servers" yaml:"authorization_servers"`
+
+	// Resource is the canonical URI of this endpoint, for example
+	// https://api.example.com/mcp. Tokens must name it in their audience.
+	// Required when AuthorizationServers is set.
+	Resource string `description:"Canonical URI of the MCP endpoint, used as the token audience" default:"" json:"resource" yaml:"resource"`
+
+	// JWKSURL overrides discovery of the issuer's signing keys.
+	JWKSURL string `description:"JWKS URL, discovered from the first issuer when empty" default:"" json:"jwks_url" yaml:"jwks_url"`
+
+	// Scopes are advertised in the protected resource metadata.
+	Scopes string `description:"Comma separated scopes advertised to clients" default:"" json:"scopes" yaml:"scopes"`
+
+	// RequiredScopes must all be granted to a token for any request to pass.
+	RequiredScopes string `description:"Comma separated scopes every access token must carry" default:"" json:"required_scopes" yaml:"required_scopes"`
+
+	// AuditLog records every tools/call in the application log. Other sinks
+	// are added with AddMCPAuditSink.
+	AuditLog bool `description:"Record every tool call in the application log" default:"false" json:"audit_log" yaml:"audit_log"`
+
+	// UserRateLimit caps the calls each caller may make across all tools,
+	// written as "<calls>/<duration>", for example "120/1m".
+	UserRateLimit string `description:"Calls each caller may make across all tools, e.g. 120/1m" default:"" json:"user_rate_limit" yaml:"user_rate_limit"`
 }
 
 // mcpConfig holds the effective configuration. Defaults are set here because
@@ -79,7 +107,7 @@ type MCPTool struct {
 	// Input is a zero value of the struct the arguments decode into, for
 	// example GetInvoiceInput{}. Its JSON Schema is derived from the `json`,
 	// `description`, `default` and `validation` tags. A nil Input means the
-	// tool takes no arguments.
+	// tool takes no arguments. A *mcp.Schema is used verbatim.
 	Input any
 
 	// Output optionally describes the result shape the same way.
@@ -98,11 +126,18 @@ type MCPTool struct {
 	Idempotent  bool
 	OpenWorld   bool
 
+	// RateLimit caps the calls of the tool by all callers together, and
+	// UserRateLimit the calls of each caller. A call over either quota is
+	// answered with a tool error without running the handler.
+	RateLimit     MCPRateLimit
+	UserRateLimit MCPRateLimit
+
 	// Handler executes the call.
 	Handler MCPToolHandler
 
 	inputSchema  *mcp.Schema
 	outputSchema *mcp.Schema
+	redact       []string // argument paths hidden from the audit log
 }
 
 var (
@@ -146,10 +181,15 @@ func RegisterMCPTool(tools ...MCPTool) {
 			log.Fatalf("mcp: tool name %q contains unsupported characters", tool.Name)
 		}
 
-		tool.inputSchema = mcp.GenerateSchema(tool.Input)
+		if schema, ok := tool.Input.(*mcp.Schema); ok && schema != nil {
+			tool.inputSchema = schema
+		} else {
+			tool.inputSchema = mcp.GenerateSchema(tool.Input)
+		}
 		if tool.Output != nil {
 			tool.outputSchema = mcp.GenerateSchema(tool.Output)
 		}
+		tool.redact = append(tool.redact, mcpRedactedPaths(tool.Input, "")...)
 
 		if _, exists := mcpTools[tool.Name]; exists {
 			log.Warningf("mcp: tool %s registered twice, replacing the earlier definition", tool.Name)
@@ -269,6 +309,10 @@ func registerMCPEndpoints() {
 	if mcpConfig.Path == "" {
 		mcpConfig.Path = "/mcp"
 	}
+	setupMCPAuthorization()
+	setupMCPAudit()
+	registerMCPRoutes()
+	registerMCPModels()
 	All(mcpConfig.Path, mcpHandler)
 	log.Infof("mcp: serving %d tools at %s", len(mcpToolOrder), mcpConfig.Path)
 }
@@ -290,9 +334,8 @@ func mcpHandler(r *Request) any {
 			"origin not allowed")).Status(StatusForbidden)
 	}
 
-	if mcpConfig.Token != "" && !mcpTokenAllowed(r.Header("Authorization")) {
-		return outcome.Json(mcp.Failure(nil, mcp.CodeInvalidRequest,
-			"unauthorized")).Status(StatusUnauthorized).Header("WWW-Authenticate", "Bearer")
+	if failure := mcpAuthenticate(r); failure != nil {
+		return failure
 	}
 
 	var req mcp.Request
@@ -493,13 +536,27 @@ func mcpCallTool(r *Request, req *mcp.Request, version, resultType string) (*mcp
 		return mcp.Failure(req.ID, mcp.CodeInvalidParams, "missing tool name"), StatusOK
 	}
 
+	var envelope struct {
+		Meta *mcp.Meta `json:"_meta"`
+	}
+	if len(req.Params) > 0 {
+		_ = json.Unmarshal(req.Params, &envelope)
+	}
+	var client mcp.Implementation
+	if envelope.Meta != nil && envelope.Meta.ClientInfo != nil {
+		client = *envelope.Meta.ClientInfo
+	}
+
 	mcpMutex.RLock()
 	tool := mcpTools[params.Name]
 	mcpMutex.RUnlock()
 
+	audit := mcpAuditStart(r, params.Name, client)
+
 	// A tool the caller may not use is reported as absent rather than
 	// forbidden, so that the endpoint does not disclose what it hides.
 	if tool == nil || !mcpPermitted(r, tool) {
+		audit.finish(tool, params.Arguments, MCPOutcomeRejected, nil)
 		return mcp.Failure(req.ID, mcp.CodeInvalidParams,
 			fmt.Sprintf("Unknown tool: %s", params.Name)), StatusOK
 	}
@@ -508,6 +565,7 @@ func mcpCallTool(r *Request, req *mcp.Request, version, resultType string) (*mcp
 		Request:   r,
 		Tool:      tool,
 		Arguments: params.Arguments,
+		Client:    client,
 		Version:   version,
 		RequestID: req.ID,
 		Ctx:       context.Background(),
@@ -515,17 +573,19 @@ func mcpCallTool(r *Request, req *mcp.Request, version, resultType string) (*mcp
 	if r.Context != nil {
 		c.Ctx = r.Context.Context()
 	}
-	var envelope struct {
-		Meta *mcp.Meta `json:"_meta"`
-	}
-	if len(req.Params) > 0 {
-		_ = json.Unmarshal(req.Params, &envelope)
-	}
-	if envelope.Meta != nil && envelope.Meta.ClientInfo != nil {
-		c.Client = *envelope.Meta.ClientInfo
+
+	if result := mcpRateLimited(c); result != nil {
+		audit.finish(tool, params.Arguments, MCPOutcomeRateLimited, result)
+		result.ResultType = resultType
+		return mcp.Result(req.ID, result), StatusOK
 	}
 
+	started := time.Now()
 	result := mcpInvoke(c)
+	if audit != nil {
+		audit.Duration = time.Since(started)
+	}
+	audit.finish(tool, params.Arguments, MCPOutcomeSuccess, result)
 	result.ResultType = resultType
 	return mcp.Result(req.ID, result), StatusOK
 }
@@ -610,10 +670,9 @@ func mcpOriginAllowed(origin string) bool {
 // mcpTokenAllowed compares the Authorization header against the configured
 // bearer token in constant time.
 func mcpTokenAllowed(header string) bool {
-	const prefix = "bearer "
-	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+	presented := mcpBearer(header)
+	if presented == "" {
 		return false
 	}
-	presented := strings.TrimSpace(header[len(prefix):])
 	return subtle.ConstantTimeCompare([]byte(presented), []byte(mcpConfig.Token)) == 1
 }
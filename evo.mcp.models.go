@@ -0,0 +1,556 @@
+package evo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
+	"github.com/getevo/evo/v2/lib/log"
+	"github.com/getevo/evo/v2/lib/mcp"
+	"github.com/getevo/json"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	gormschema "gorm.io/gorm/schema"
+)
+
+// MCPModel configures the read-only query tools generated for a model.
+type MCPModel struct {
+	// Name is the suffix of the tool names: list_<name>, get_<name> and
+	// count_<name>. It defaults to the table name.
+	Name string
+
+	// Description tells the model what the records are. It is prepended to
+	// the generated description of every tool.
+	Description string
+
+	// Columns is an allow list of column names. When empty, every column is
+	// exposed except those tagged `pii:"true"` or `json:"-"`, which are never
+	// exposed even when listed. get_<name> is only generated when the
+	// primary key is exposed.
+	Columns []string
+
+	// Permission gates all three tools exactly as MCPTool.Permission does.
+	Permission string
+
+	// MaxLimit caps the page size of list_<name>. It defaults to 100.
+	MaxLimit int
+
+	// Quotas, as MCPTool.RateLimit and MCPTool.UserRateLimit, applied to each
+	// of the three tools separately.
+	RateLimit     MCPRateLimit
+	UserRateLimit MCPRateLimit
+}
+
+type mcpModelRegistration struct {
+	model   any
+	options MCPModel
+}
+
+var mcpModels []mcpModelRegistration
+
+// mcpModelTools holds what the generated tools of one model need at call time.
+type mcpModelTools struct {
+	name    string
+	table   string
+	typ     reflect.Type
+	options MCPModel
+	fields  []*gormschema.Field          // exposed, in declaration order
+	byKey   map[string]*gormschema.Field // exposed, by JSON name
+	keys    []*gormschema.Field          // primary key
+	blind   map[string]*gormschema.Field // blind index, by encrypted field name
+	related []string                     // where the exposed foreign keys lead
+}
+
+// RegisterMCPModel generates read-only MCP tools for a GORM model:
+// list_<name> with typed filters, sorting and paging, get_<name> by primary
+// key, and count_<name>. Queries are built from the model schema with
+// parameterised clauses; no argument is ever interpolated into SQL.
+//
+// Encrypted columns can only be filtered on through their blind index, and
+// the foreign keys of models registered with db.UseModel are described as
+// pointing to the get tool of the model they reference.
+//
+// The tools are created when the server starts, once the database is open.
+//
+// Example:
+//
+//	evo.RegisterMCPModel(Invoice{}, evo.MCPModel{
+//	    Description: "Invoices issued to customers",
+//	    Permission:  "invoice.read",
+//	})
+func RegisterMCPModel(model any, options ...MCPModel) {
+	var opts MCPModel
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	mcpMutex.Lock()
+	defer mcpMutex.Unlock()
+	mcpModels = append(mcpModels, mcpModelRegistration{model: model, options: opts})
+}
+
+// registerMCPModels turns every registered model into tools. It runs from
+// registerMCPEndpoints.
+func registerMCPModels() {
+	mcpMutex.RLock()
+	models := append([]mcpModelRegistration(nil), mcpModels...)
+	mcpMutex.RUnlock()
+	if len(models) == 0 {
+		return
+	}
+	if db == nil {
+		log.Warning("mcp: models were registered for MCP but the database is not enabled")
+		return
+	}
+
+	var all []*mcpModelTools
+	for _, registration := range models {
+		tools, err := newMCPModelTools(registration.model, registration.options)
+		if err != nil {
+			log.Error("mcp: unable to expose model", "model", reflect.TypeOf(registration.model), "error", err)
+			continue
+		}
+		all = append(all, tools)
+	}
+	for _, tools := range all {
+		tools.relate(all)
+		if tools.lookup() {
+			RegisterMCPTool(tools.list(), tools.get(), tools.count())
+		} else {
+			RegisterMCPTool(tools.list(), tools.count())
+		}
+	}
+}
+
+func newMCPModelTools(model any, options MCPModel) (*mcpModelTools, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	s := stmt.Schema
+
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	t := &mcpModelTools{name: options.Name, table: s.Table, typ: typ, options: options, byKey: map[string]*gormschema.Field{}, blind: map[string]*gormschema.Field{}}
+	if t.name == "" {
+		t.name = s.Table
+	}
+	if t.options.MaxLimit <= 0 {
+		t.options.MaxLimit = 100
+	}
+
+	allowed := map[string]bool{}
+	for _, column := range options.Columns {
+		allowed[column] = true
+	}
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.Tag.Get("pii") == "true" || mcpJSONName(field) == "-" {
+			continue
+		}
+		if len(allowed) > 0 && !allowed[field.DBName] {
+			continue
+		}
+		t.fields = append(t.fields, field)
+		t.byKey[mcpJSONName(field)] = field
+	}
+	for _, field := range s.Fields {
+		if name, ok := field.TagSettings["BLIND_INDEX"]; ok {
+			if source := s.LookUpField(name); source != nil {
+				t.blind[source.Name] = field
+			}
+		}
+	}
+	t.keys = s.PrimaryFields
+	if len(t.keys) == 0 {
+		return nil, fmt.Errorf("model %s has no primary key", s.Name)
+	}
+	return t, nil
+}
+
+// lookup reports whether the whole primary key is exposed, which get_<name>
+// looks records up by.
+func (t *mcpModelTools) lookup() bool {
+	for _, key := range t.keys {
+		if t.byKey[mcpJSONName(key)] != key {
+			return false
+		}
+	}
+	return true
+}
+
+// relate describes the exposed columns referencing the primary key of
+// another exposed model, from the join constraints db.UseModel read from
+// the database.
+func (t *mcpModelTools) relate(all []*mcpModelTools) {
+	model := schema.Find(reflect.New(t.typ).Elem().Interface())
+	if model == nil {
+		return
+	}
+	for _, field := range t.fields {
+		for table, join := range model.Joins {
+			if join[0] != field.DBName {
+				continue
+			}
+			for _, other := range all {
+				if other.table == table && other.lookup() && len(other.keys) == 1 && other.keys[0].DBName == join[1] {
+					t.related = append(t.related, fmt.Sprintf("%s is the %s of a %s record, see get_%s.",
+						mcpJSONName(field), mcpJSONName(other.keys[0]), other.name, other.name))
+				}
+			}
+		}
+	}
+}
+
+// mcpEncrypted reports whether field is a types.Encrypted column, whose
+// stored value is a ciphertext.
+func mcpEncrypted(field *gormschema.Field) bool {
+	_, ok := reflect.New(field.IndirectFieldType).Interface().(interface{ Ciphertext() (string, error) })
+	return ok
+}
+
+// filterable reports whether field can be compared to a plaintext: any
+// column but an encrypted one without a blind index.
+func (t *mcpModelTools) filterable(field *gormschema.Field) bool {
+	return !mcpEncrypted(field) || t.blind[field.Name] != nil
+}
+
+// mcpJSONName is the key a field is marshalled under.
+func mcpJSONName(field *gormschema.Field) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// mcpFieldSchema maps a column onto a JSON Schema type.
+func mcpFieldSchema(field *gormschema.Field) *mcp.Schema {
+	switch field.DataType {
+	case gormschema.Bool:
+		return &mcp.Schema{Type: "boolean"}
+	case gormschema.Int, gormschema.Uint:
+		return &mcp.Schema{Type: "integer"}
+	case gormschema.Float:
+		return &mcp.Schema{Type: "number"}
+	case gormschema.Time:
+		return &mcp.Schema{Type: "string", Format: "date-time"}
+	}
+	return &mcp.Schema{Type: "string"}
+}
+
+func mcpOrderable(field *gormschema.Field) bool {
+	switch field.DataType {
+	case gormschema.Int, gormschema.Uint, gormschema.Float, gormschema.Time:
+		return true
+	}
+	return false
+}
+
+func (t *mcpModelTools) describe(what string) string {
+	if len(t.related) > 0 {
+		what += " " + strings.Join(t.related, " ")
+	}
+	if t.options.Description == "" {
+		return what
+	}
+	return strings.TrimSuffix(t.options.Description, ".") + ". " + what
+}
+
+// filterSchema is the input shared by list and count.
+func (t *mcpModelTools) filterSchema() *mcp.Schema {
+	deny := false
+	filter := &mcp.Schema{Type: "object", Description: "equality filters; an array matches any of its values", Properties: map[string]*mcp.Schema{}, AdditionalProperties: &deny}
+	lower := &mcp.Schema{Type: "object", Description: "inclusive lower bounds", Properties: map[string]*mcp.Schema{}, AdditionalProperties: &deny}
+	upper := &mcp.Schema{Type: "object", Description: "inclusive upper bounds", Properties: map[string]*mcp.Schema{}, AdditionalProperties: &deny}
+	for _, field := range t.fields {
+		if !t.filterable(field) {
+			continue
+		}
+		key := mcpJSONName(field)
+		filter.Properties[key] = mcpFieldSchema(field)
+		if mcpOrderable(field) {
+			lower.Properties[key] = mcpFieldSchema(field)
+			upper.Properties[key] = mcpFieldSchema(field)
+		}
+	}
+	schema := &mcp.Schema{Type: "object", Properties: map[string]*mcp.Schema{"filter": filter}, AdditionalProperties: &deny}
+	if len(lower.Properties) > 0 {
+		schema.Properties["min"] = lower
+		schema.Properties["max"] = upper
+	}
+	return schema
+}
+
+func (t *mcpModelTools) list() MCPTool {
+	schema := t.filterSchema()
+	var sorts []any
+	for _, field := range t.fields {
+		if !mcpEncrypted(field) {
+			sorts = append(sorts, mcpJSONName(field), "-"+mcpJSONName(field))
+		}
+	}
+	minimum, maximum, zero := 1.0, float64(t.options.MaxLimit), 0.0
+	schema.Properties["sort"] = &mcp.Schema{Type: "string", Description: "field to sort by, prefixed with - for descending", Enum: sorts}
+	schema.Properties["limit"] = &mcp.Schema{Type: "integer", Minimum: &minimum, Maximum: &maximum, Default: min(20, t.options.MaxLimit)}
+	schema.Properties["offset"] = &mcp.Schema{Type: "integer", Minimum: &zero, Default: 0}
+
+	return MCPTool{
+		Name:          "list_" + t.name,
+		Description:   t.describe(fmt.Sprintf("List %s records matching the filters, at most %d per call.", t.name, t.options.MaxLimit)),
+		Input:         schema,
+		Permission:    t.options.Permission,
+		RateLimit:     t.options.RateLimit,
+		UserRateLimit: t.options.UserRateLimit,
+		ReadOnly:      true,
+		Idempotent:    true,
+		Handler: func(c *MCPContext) any {
+			var in struct {
+				Filter map[string]json.RawMessage `json:"filter"`
+				Min    map[string]json.RawMessage `json:"min"`
+				Max    map[string]json.RawMessage `json:"max"`
+				Sort   string                     `json:"sort"`
+				Limit  int                        `json:"limit"`
+				Offset int                        `json:"offset"`
+			}
+			if err := c.Bind(&in); err != nil {
+				return err
+			}
+			tx, err := t.query(c, in.Filter, in.Min, in.Max)
+			if err != nil {
+				return err
+			}
+			if in.Sort != "" {
+				field := t.byKey[strings.TrimPrefix(in.Sort, "-")]
+				if field == nil || mcpEncrypted(field) {
+					return fmt.Errorf("invalid arguments: cannot sort by %s", in.Sort)
+				}
+				tx = tx.Order(clause.OrderByColumn{
+					Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+					Desc:   strings.HasPrefix(in.Sort, "-"),
+				})
+			}
+			if in.Limit <= 0 {
+				in.Limit = min(20, t.options.MaxLimit)
+			}
+			if in.Limit > t.options.MaxLimit {
+				in.Limit = t.options.MaxLimit
+			}
+			if in.Offset < 0 {
+				in.Offset = 0
+			}
+
+			rows := reflect.New(reflect.SliceOf(t.typ))
+			if err := tx.Limit(in.Limit).Offset(in.Offset).Find(rows.Interface()).Error; err != nil {
+				log.Error("mcp: model query failed", "tool", c.Tool.Name, "error", err)
+				return fmt.Errorf("query failed")
+			}
+			items := make([]map[string]any, 0, rows.Elem().Len())
+			for i := 0; i < rows.Elem().Len(); i++ {
+				items = append(items, t.project(rows.Elem().Index(i).Interface()))
+			}
+			return map[string]any{"items": items, "limit": in.Limit, "offset": in.Offset}
+		},
+	}
+}
+
+func (t *mcpModelTools) get() MCPTool {
+	deny := false
+	schema := &mcp.Schema{Type: "object", Properties: map[string]*mcp.Schema{}, AdditionalProperties: &deny}
+	for _, key := range t.keys {
+		schema.Properties[mcpJSONName(key)] = mcpFieldSchema(key)
+		schema.Required = append(schema.Required, mcpJSONName(key))
+	}
+
+	return MCPTool{
+		Name:          "get_" + t.name,
+		Description:   t.describe(fmt.Sprintf("Fetch one %s record by its primary key.", t.name)),
+		Input:         schema,
+		Permission:    t.options.Permission,
+		RateLimit:     t.options.RateLimit,
+		UserRateLimit: t.options.UserRateLimit,
+		ReadOnly:      true,
+		Idempotent:    true,
+		Handler: func(c *MCPContext) any {
+			var in map[string]json.RawMessage
+			if len(c.Arguments) > 0 {
+				if err := json.Unmarshal(c.Arguments, &in); err != nil {
+					return fmt.Errorf("invalid arguments: %w", err)
+				}
+			}
+			tx := GetDBO(c.Ctx).Model(reflect.New(t.typ).Interface())
+			for _, key := range t.keys {
+				raw, ok := in[mcpJSONName(key)]
+				if !ok {
+					return fmt.Errorf("invalid arguments: %s is required", mcpJSONName(key))
+				}
+				var value any
+				if err := json.Unmarshal(raw, &value); err != nil || value == nil {
+					return fmt.Errorf("invalid arguments: %s must be a scalar", mcpJSONName(key))
+				}
+				tx = tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: key.DBName}, Value: value})
+			}
+			row := reflect.New(t.typ)
+			if err := tx.Take(row.Interface()).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return fmt.Errorf("%s not found", t.name)
+				}
+				log.Error("mcp: model query failed", "tool", c.Tool.Name, "error", err)
+				return fmt.Errorf("query failed")
+			}
+			return t.project(row.Elem().Interface())
+		},
+	}
+}
+
+func (t *mcpModelTools) count() MCPTool {
+	return MCPTool{
+		Name:          "count_" + t.name,
+		Description:   t.describe(fmt.Sprintf("Count %s records matching the filters.", t.name)),
+		Input:         t.filterSchema(),
+		Permission:    t.options.Permission,
+		RateLimit:     t.options.RateLimit,
+		UserRateLimit: t.options.UserRateLimit,
+		ReadOnly:      true,
+		Idempotent:    true,
+		Handler: func(c *MCPContext) any {
+			var in struct {
+				Filter map[string]json.RawMessage `json:"filter"`
+				Min    map[string]json.RawMessage `json:"min"`
+				Max    map[string]json.RawMessage `json:"max"`
+			}
+			if err := c.Bind(&in); err != nil {
+				return err
+			}
+			tx, err := t.query(c, in.Filter, in.Min, in.Max)
+			if err != nil {
+				return err
+			}
+			var n int64
+			if err := tx.Count(&n).Error; err != nil {
+				log.Error("mcp: model query failed", "tool", c.Tool.Name, "error", err)
+				return fmt.Errorf("query failed")
+			}
+			return map[string]int64{"count": n}
+		},
+	}
+}
+
+// query builds the filtered query shared by list and count. Every key is
+// resolved against the exposed fields, so an argument can only ever name a
+// column the model allows. An encrypted field is compared through its blind
+// index.
+func (t *mcpModelTools) query(c *MCPContext, filter, lower, upper map[string]json.RawMessage) (*gorm.DB, error) {
+	tx := GetDBO(c.Ctx).Model(reflect.New(t.typ).Interface())
+	resolve := func(key string, raw json.RawMessage) (clause.Column, any, error) {
+		field := t.byKey[key]
+		if field == nil {
+			return clause.Column{}, nil, fmt.Errorf("invalid arguments: unknown field %s", key)
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return clause.Column{}, nil, fmt.Errorf("invalid arguments: %s: %w", key, err)
+		}
+		if mcpEncrypted(field) {
+			index := t.blind[field.Name]
+			if index == nil {
+				return clause.Column{}, nil, fmt.Errorf("invalid arguments: %s is encrypted and cannot be filtered on", key)
+			}
+			value, err := mcpBlindIndex(value)
+			if err != nil {
+				log.Error("mcp: unable to compute a blind index", "field", key, "error", err)
+				return clause.Column{}, nil, fmt.Errorf("query failed")
+			}
+			return clause.Column{Table: clause.CurrentTable, Name: index.DBName}, value, nil
+		}
+		return clause.Column{Table: clause.CurrentTable, Name: field.DBName}, value, nil
+	}
+	// bound decodes a min or max into the type of its field, which must be
+	// orderable.
+	bound := func(key string, raw json.RawMessage) (clause.Column, any, error) {
+		field := t.byKey[key]
+		if field == nil || !mcpOrderable(field) {
+			return clause.Column{}, nil, fmt.Errorf("invalid arguments: %s has no bounds", key)
+		}
+		value := reflect.New(field.IndirectFieldType)
+		if string(raw) == "null" {
+			return clause.Column{}, nil, fmt.Errorf("invalid arguments: %s: a bound cannot be null", key)
+		}
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return clause.Column{}, nil, fmt.Errorf("invalid arguments: %s: %w", key, err)
+		}
+		return clause.Column{Table: clause.CurrentTable, Name: field.DBName}, value.Elem().Interface(), nil
+	}
+
+	for key, raw := range filter {
+		column, value, err := resolve(key, raw)
+		if err != nil {
+			return nil, err
+		}
+		switch v := value.(type) {
+		case []any:
+			tx = tx.Where(clause.IN{Column: column, Values: v})
+		case map[string]any:
+			return nil, fmt.Errorf("invalid arguments: %s must be a scalar or an array", key)
+		default:
+			tx = tx.Where(clause.Eq{Column: column, Value: v})
+		}
+	}
+	for key, raw := range lower {
+		column, value, err := bound(key, raw)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where(clause.Gte{Column: column, Value: value})
+	}
+	for key, raw := range upper {
+		column, value, err := bound(key, raw)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where(clause.Lte{Column: column, Value: value})
+	}
+	return tx, nil
+}
+
+// mcpBlindIndex returns the blind index of a filter value, or of each value
+// of an array.
+func mcpBlindIndex(value any) (any, error) {
+	switch v := value.(type) {
+	case []any:
+		indexes := make([]any, len(v))
+		for i := range v {
+			index, err := types.BlindIndexOf(v[i])
+			if err != nil {
+				return nil, err
+			}
+			indexes[i] = index
+		}
+		return indexes, nil
+	case nil, map[string]any:
+		return value, nil
+	}
+	return types.BlindIndexOf(value)
+}
+
+// project renders a record with only the exposed fields, using the model's
+// own JSON encoding so custom types keep their format.
+func (t *mcpModelTools) project(record any) map[string]any {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return map[string]any{}
+	}
+	var all map[string]any
+	_ = json.Unmarshal(raw, &all)
+	out := make(map[string]any, len(t.fields))
+	for _, field := range t.fields {
+		key := mcpJSONName(field)
+		if value, ok := all[key]; ok {
+			out[key] = value
+		}
+	}
+	return out
+}
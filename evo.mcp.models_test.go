@@ -0,0 +1,260 @@
+package evo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type mcpInvoice struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Customer  string    `json:"customer"`
+	Amount    float64   `json:"amount"`
+	Paid      bool      `json:"paid"`
+	Email     string    `json:"email" pii:"true"`
+	Internal  string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (mcpInvoice) TableName() string { return "invoices" }
+
+// newMCPModelsTestApp opens an in-memory database with a few invoices and
+// exposes the model.
+func newMCPModelsTestApp(t *testing.T, options ...MCPModel) *fiber.App {
+	t.Helper()
+	a := newMCPTestApp(t)
+
+	conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.AutoMigrate(&mcpInvoice{}); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	conn.Create([]mcpInvoice{
+		{Customer: "acme", Amount: 100, Paid: true, Email: "a@acme.test", CreatedAt: base},
+		{Customer: "acme", Amount: 250, Paid: false, Email: "a@acme.test", CreatedAt: base.AddDate(0, 1, 0)},
+		{Customer: "globex", Amount: 75, Paid: false, Email: "g@globex.test", CreatedAt: base.AddDate(0, 2, 0)},
+	})
+
+	previous := db
+	db = conn
+	t.Cleanup(func() { db = previous })
+
+	RegisterMCPModel(mcpInvoice{}, options...)
+	registerMCPModels()
+	return a
+}
+
+func toolCall(name, arguments string) string {
+	return `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + name + `","arguments":` + arguments + `}}`
+}
+
+func TestMCPModelToolsAreGenerated(t *testing.T) {
+	a := newMCPModelsTestApp(t)
+
+	res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	var names []string
+	for _, item := range res.result["tools"].([]any) {
+		tool := item.(map[string]any)
+		names = append(names, tool["name"].(string))
+		if tool["annotations"].(map[string]any)["readOnlyHint"] != true {
+			t.Errorf("%s should be read-only", tool["name"])
+		}
+	}
+	if strings.Join(names, ",") != "list_invoices,get_invoices,count_invoices" {
+		t.Errorf("unexpected tools %v", names)
+	}
+	if strings.Contains(res.body, `"email"`) || strings.Contains(res.body, "Internal") {
+		t.Errorf("hidden fields must not appear in any schema: %s", res.body)
+	}
+}
+
+func TestMCPModelList(t *testing.T) {
+	a := newMCPModelsTestApp(t)
+
+	res := call(t, a, toolCall("list_invoices", `{"filter":{"customer":"acme"},"min":{"amount":150},"sort":"-amount"}`))
+	items := res.result["structuredContent"].(map[string]any)["items"].([]any)
+	if len(items) != 1 || items[0].(map[string]any)["amount"] != float64(250) {
+		t.Fatalf("unexpected items %s", res.body)
+	}
+	if _, ok := items[0].(map[string]any)["email"]; ok {
+		t.Error("a pii field must not be returned")
+	}
+
+	res = call(t, a, toolCall("list_invoices", `{"min":{"created_at":"2026-01-15T00:00:00Z"},"max":{"amount":100}}`))
+	items = res.result["structuredContent"].(map[string]any)["items"].([]any)
+	if len(items) != 1 || items[0].(map[string]any)["customer"] != "globex" {
+		t.Errorf("expected the invoice of globex, got %s", res.body)
+	}
+
+	res = call(t, a, toolCall("list_invoices", `{"filter":{"customer":["acme","globex"]},"sort":"amount","limit":2}`))
+	items = res.result["structuredContent"].(map[string]any)["items"].([]any)
+	if len(items) != 2 || items[0].(map[string]any)["amount"] != float64(75) {
+		t.Errorf("expected the two cheapest invoices, got %s", res.body)
+	}
+}
+
+func TestMCPModelListRejectsUnknownFields(t *testing.T) {
+	a := newMCPModelsTestApp(t)
+
+	for _, args := range []string{
+		`{"filter":{"email":"a@acme.test"}}`,
+		`{"filter":{"customer = 'x' OR 1=1 --":"x"}}`,
+		`{"sort":"email"}`,
+		`{"min":{"customer":"a"}}`,
+		`{"max":{"amount":"1e9"}}`,
+		`{"min":{"created_at":"yesterday"}}`,
+	} {
+		res := call(t, a, toolCall("list_invoices", args))
+		if res.result["isError"] != true {
+			t.Errorf("%s: expected a tool error, got %s", args, res.body)
+		}
+	}
+}
+
+func TestMCPModelGetAndCount(t *testing.T) {
+	a := newMCPModelsTestApp(t)
+
+	res := call(t, a, toolCall("get_invoices", `{"id":2}`))
+	if res.result["structuredContent"].(map[string]any)["customer"] != "acme" {
+		t.Errorf("unexpected record %s", res.body)
+	}
+	res = call(t, a, toolCall("get_invoices", `{"id":99}`))
+	if res.result["isError"] != true {
+		t.Errorf("a missing record should be a tool error, got %s", res.body)
+	}
+
+	res = call(t, a, toolCall("count_invoices", `{"filter":{"paid":false}}`))
+	if res.result["structuredContent"].(map[string]any)["count"] != float64(2) {
+		t.Errorf("unexpected count %s", res.body)
+	}
+}
+
+func TestMCPModelOptions(t *testing.T) {
+	a := newMCPModelsTestApp(t, MCPModel{Name: "bills", Columns: []string{"id", "amount", "email"}, Permission: "invoice.read", MaxLimit: 1})
+	withUser(t, "invoice.read")
+
+	res := call(t, a, toolCall("list_bills", `{"limit":50}`))
+	out := res.result["structuredContent"].(map[string]any)
+	items := out["items"].([]any)
+	if len(items) != 1 || out["limit"] != float64(1) {
+		t.Errorf("the limit should be capped, got %s", res.body)
+	}
+	row := items[0].(map[string]any)
+	if _, ok := row["customer"]; ok || len(row) != 2 {
+		t.Errorf("only allow-listed, non-pii columns should be returned, got %v", row)
+	}
+
+	withUser(t)
+	res = call(t, a, toolCall("list_bills", `{}`))
+	if res.err == nil {
+		t.Errorf("the tool should be hidden without the permission, got %s", res.body)
+	}
+}
+
+func TestMCPModelGetNeedsAnExposedKey(t *testing.T) {
+	a := newMCPModelsTestApp(t, MCPModel{Columns: []string{"customer", "amount"}})
+
+	res := call(t, a, toolCall("get_invoices", `{"id":1}`))
+	if res.err == nil {
+		t.Errorf("get_invoices should not exist when the primary key is not exposed, got %s", res.body)
+	}
+	res = call(t, a, toolCall("count_invoices", `{"filter":{"id":1}}`))
+	if res.result["isError"] != true {
+		t.Errorf("the primary key should not be filterable either, got %s", res.body)
+	}
+}
+
+type mcpCustomer struct {
+	ID       uint                    `gorm:"primaryKey" json:"id"`
+	Email    types.Encrypted[string] `json:"email"`
+	EmailIdx types.BlindIndex        `gorm:"blind_index:Email" json:"-"`
+	Phone    types.Encrypted[string] `json:"phone"`
+}
+
+func (mcpCustomer) TableName() string { return "customers" }
+
+func TestMCPModelEncryptedFilters(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	ring, err := types.ParseKeyRing("k1:"+key, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types.SetKeyRing(ring)
+	t.Cleanup(func() { types.SetKeyRing(nil) })
+
+	a := newMCPModelsTestApp(t)
+	if err := db.Use(types.BlindIndexes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&mcpCustomer{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create([]mcpCustomer{
+		{Email: types.NewEncrypted("a@acme.test"), Phone: types.NewEncrypted("555-0100")},
+		{Email: types.NewEncrypted("g@globex.test"), Phone: types.NewEncrypted("555-0199")},
+	})
+	RegisterMCPModel(mcpCustomer{})
+	registerMCPModels()
+
+	res := call(t, a, toolCall("list_customers", `{"filter":{"email":"g@globex.test"}}`))
+	items := res.result["structuredContent"].(map[string]any)["items"].([]any)
+	if len(items) != 1 || items[0].(map[string]any)["id"] != float64(2) {
+		t.Errorf("expected the customer found through the blind index, got %s", res.body)
+	}
+	res = call(t, a, toolCall("count_customers", `{"filter":{"email":["a@acme.test","g@globex.test"]}}`))
+	if res.result["structuredContent"].(map[string]any)["count"] != float64(2) {
+		t.Errorf("unexpected count %s", res.body)
+	}
+
+	for _, args := range []string{`{"filter":{"phone":"555-0100"}}`, `{"sort":"email"}`} {
+		res = call(t, a, toolCall("list_customers", args))
+		if res.result["isError"] != true {
+			t.Errorf("%s: expected a tool error, got %s", args, res.body)
+		}
+	}
+}
+
+type mcpOrder struct {
+	ID         uint `gorm:"primaryKey" json:"id"`
+	CustomerID uint `json:"customer_id"`
+}
+
+func (mcpOrder) TableName() string { return "orders" }
+
+func TestMCPModelDescribesJoins(t *testing.T) {
+	a := newMCPModelsTestApp(t)
+	if err := db.AutoMigrate(&mcpCustomer{}, &mcpOrder{}); err != nil {
+		t.Fatal(err)
+	}
+	// the join constraint db.UseModel reads from the database
+	previous := schema.Models
+	schema.Models = append(append([]schema.Model(nil), previous...), schema.Model{
+		Value: reflect.ValueOf(mcpOrder{}), Table: "orders", Joins: map[string][]string{"customers": {"customer_id", "id"}},
+	})
+	t.Cleanup(func() { schema.Models = previous })
+	RegisterMCPModel(mcpCustomer{})
+	RegisterMCPModel(mcpOrder{})
+	registerMCPModels()
+
+	res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	for _, item := range res.result["tools"].([]any) {
+		tool := item.(map[string]any)
+		related := strings.Contains(tool["description"].(string), "customer_id is the id of a customers record, see get_customers.")
+		if related != strings.HasSuffix(tool["name"].(string), "_orders") {
+			t.Errorf("unexpected description of %s: %s", tool["name"], tool["description"])
+		}
+	}
+}
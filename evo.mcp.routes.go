@@ -0,0 +1,358 @@
+package evo
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/getevo/evo/v2/lib/log"
+	"github.com/getevo/evo/v2/lib/mcp"
+	"github.com/getevo/json"
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+)
+
+// MCPRoute describes how an HTTP route is offered as an MCP tool. Every field
+// is optional: without any, the tool is named after the route and takes its
+// path parameters plus a free-form query (GET) or body (other methods).
+type MCPRoute struct {
+	// Name overrides the tool name, which otherwise comes from the route name
+	// or, for an unnamed route, from its method and path. Ignored when the
+	// options apply to a whole group.
+	Name string
+
+	// Title and Description are shown to the client. Description defaults to
+	// the method and path, so set it for anything a model should use well.
+	Title       string
+	Description string
+
+	// Query and Body are zero values of the structs the route reads from the
+	// query string and the JSON body, for example ListInvoicesQuery{}. Their
+	// schemas and audit redaction are derived from struct tags exactly as
+	// MCPTool.Input's are.
+	Query any
+	Body  any
+
+	// Permission gates the tool exactly as MCPTool.Permission does. The route's
+	// own middleware still runs on every call.
+	Permission string
+
+	// Behavioural hints. GET routes are always hinted ReadOnly.
+	ReadOnly    bool
+	Destructive bool
+	Idempotent  bool
+	OpenWorld   bool
+
+	// Quotas, as MCPTool.RateLimit and MCPTool.UserRateLimit. On a group
+	// they apply to each route's tool separately.
+	RateLimit     MCPRateLimit
+	UserRateLimit MCPRateLimit
+}
+
+// mcpExposure is one opt-in recorded by ExposeMCPRoute or group.ExposeMCP.
+type mcpExposure struct {
+	method  string // empty matches every method
+	path    string
+	group   bool // path is a prefix covering every route below it
+	options MCPRoute
+}
+
+var mcpExposures []mcpExposure
+
+// mcpUserLocal carries the caller of an MCP tool into the request synthesized
+// for a route, so that User() there is the same user.
+type mcpUserLocal struct{}
+
+// mcpParamPattern matches a path parameter with its optional constraint and
+// optional marker, for example ":id", ":id?" or ":id<int>".
+var mcpParamPattern = regexp.MustCompile(`:([A-Za-z0-9_.\-]+)(<[^>]*>)?(\?)?`)
+
+var mcpNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// ExposeMCPRoute offers an HTTP route as an MCP tool. method and path must be
+// exactly what the route was registered with, for example "GET" and
+// "/invoices/:id". The tools are created when the server starts, so the call
+// may come before or after the route is registered.
+//
+// Example:
+//
+//	evo.Get("/invoices/:id", getInvoice).Name("invoices.get")
+//	evo.ExposeMCPRoute("GET", "/invoices/:id", evo.MCPRoute{
+//	    Description: "Fetch an invoice by its identifier",
+//	})
+func ExposeMCPRoute(method, path string, options ...MCPRoute) {
+	var opts MCPRoute
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	mcpMutex.Lock()
+	defer mcpMutex.Unlock()
+	mcpExposures = append(mcpExposures, mcpExposure{method: strings.ToUpper(method), path: path, options: opts})
+}
+
+// ExposeMCP offers every route of the group, present and future, as an MCP
+// tool. Options apply to all of them except Name.
+func (grp *group) ExposeMCP(options ...MCPRoute) *group {
+	var opts MCPRoute
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	opts.Name = ""
+	prefix := ""
+	if g, ok := (*grp.app).(*fiber.Group); ok {
+		prefix = g.Prefix
+	}
+	mcpMutex.Lock()
+	defer mcpMutex.Unlock()
+	mcpExposures = append(mcpExposures, mcpExposure{path: strings.TrimSuffix(prefix, "/"), group: true, options: opts})
+	return grp
+}
+
+// registerMCPRoutes turns every exposed route into a tool. It runs from
+// registerMCPEndpoints, once all applications have registered their routes.
+func registerMCPRoutes() {
+	mcpMutex.RLock()
+	exposures := append([]mcpExposure(nil), mcpExposures...)
+	mcpMutex.RUnlock()
+	if len(exposures) == 0 || app == nil {
+		return
+	}
+
+	used := map[string]bool{}
+	for _, tool := range MCPTools() {
+		used[tool.Name] = true
+	}
+	for _, route := range app.GetRoutes(true) {
+		exposure := mcpMatchExposure(exposures, route)
+		if exposure == nil {
+			continue
+		}
+		switch route.Method {
+		case fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace, fiber.MethodConnect:
+			continue
+		}
+		if route.Path == mcpConfig.Path || strings.HasPrefix(route.Path, mcp.WellKnownProtectedResource) {
+			continue
+		}
+		if strings.ContainsAny(route.Path, "*+") {
+			log.Debugf("mcp: route %s %s has a wildcard and cannot be exposed", route.Method, route.Path)
+			continue
+		}
+
+		name := mcpRouteToolName(route, exposure.options, used)
+		used[name] = true
+		RegisterMCPTool(mcpRouteTool(name, route, exposure.options))
+	}
+}
+
+// mcpMatchExposure picks the opt-in that covers the route. One naming the
+// route exactly wins over a group covering it.
+func mcpMatchExposure(exposures []mcpExposure, route fiber.Route) *mcpExposure {
+	var match *mcpExposure
+	for i := range exposures {
+		e := &exposures[i]
+		if e.method != "" && e.method != route.Method {
+			continue
+		}
+		if !e.group && e.path == route.Path {
+			return e
+		}
+		if e.group && match == nil && (e.path == "" || route.Path == e.path || strings.HasPrefix(route.Path, e.path+"/")) {
+			match = e
+		}
+	}
+	return match
+}
+
+// mcpRouteToolName derives a unique tool name: the explicit option, then the
+// route name, then method and path, e.g. "get_invoices_id".
+func mcpRouteToolName(route fiber.Route, options MCPRoute, used map[string]bool) string {
+	name := options.Name
+	if name == "" {
+		name = strings.Trim(route.Name, ".")
+	}
+	if name == "" || used[name] {
+		derived := strings.ToLower(route.Method) + "_" + mcpParamPattern.ReplaceAllString(route.Path, "$1")
+		name = strings.Trim(mcpNameUnsafe.ReplaceAllString(derived, "_"), "_")
+	}
+	for base, i := name, 2; used[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	return name
+}
+
+// mcpRouteTool builds the tool definition of one route.
+func mcpRouteTool(name string, route fiber.Route, options MCPRoute) MCPTool {
+	deny := false
+	schema := &mcp.Schema{Type: "object", Properties: map[string]*mcp.Schema{}, AdditionalProperties: &deny}
+	for _, match := range mcpParamPattern.FindAllStringSubmatch(route.Path, -1) {
+		schema.Properties[match[1]] = &mcp.Schema{Type: "string", Description: "path parameter"}
+		if match[3] == "" {
+			schema.Required = append(schema.Required, match[1])
+		}
+	}
+
+	if options.Query != nil {
+		schema.Properties["query"] = mcp.GenerateSchema(options.Query)
+	} else if route.Method == fiber.MethodGet {
+		schema.Properties["query"] = &mcp.Schema{Type: "object"}
+	}
+	if schema.Properties["query"] != nil && schema.Properties["query"].Description == "" {
+		schema.Properties["query"].Description = "query string parameters"
+	}
+
+	if options.Body != nil {
+		schema.Properties["body"] = mcp.GenerateSchema(options.Body)
+		schema.Required = append(schema.Required, "body")
+	} else if route.Method != fiber.MethodGet && route.Method != fiber.MethodDelete {
+		schema.Properties["body"] = &mcp.Schema{Type: "object"}
+	}
+	if schema.Properties["body"] != nil && schema.Properties["body"].Description == "" {
+		schema.Properties["body"].Description = "JSON request body"
+	}
+
+	description := options.Description
+	if description == "" {
+		description = fmt.Sprintf("Calls %s %s", route.Method, route.Path)
+	}
+	return MCPTool{
+		Name:          name,
+		Title:         options.Title,
+		Description:   description,
+		Input:         schema,
+		Permission:    options.Permission,
+		ReadOnly:      options.ReadOnly || route.Method == fiber.MethodGet,
+		Destructive:   options.Destructive,
+		Idempotent:    options.Idempotent,
+		OpenWorld:     options.OpenWorld,
+		RateLimit:     options.RateLimit,
+		UserRateLimit: options.UserRateLimit,
+		Handler:       mcpRouteHandler(route.Method, route.Path),
+		redact:        append(mcpRedactedPaths(options.Query, "query."), mcpRedactedPaths(options.Body, "body.")...),
+	}
+}
+
+// mcpRouteHandler calls the route in-process. The request goes through the
+// whole application handler, so middleware, authentication and the route's
+// own handlers run exactly as they would for an HTTP client.
+func mcpRouteHandler(method, path string) MCPToolHandler {
+	return func(c *MCPContext) any {
+		var args map[string]json.RawMessage
+		if len(c.Arguments) > 0 {
+			if err := json.Unmarshal(c.Arguments, &args); err != nil {
+				return fmt.Errorf("invalid arguments: %w", err)
+			}
+		}
+
+		var missing []string
+		target := mcpParamPattern.ReplaceAllStringFunc(path, func(param string) string {
+			match := mcpParamPattern.FindStringSubmatch(param)
+			var value any
+			if raw, ok := args[match[1]]; ok {
+				_ = json.Unmarshal(raw, &value)
+			}
+			if value == nil {
+				if match[3] == "" {
+					missing = append(missing, match[1])
+				}
+				return ""
+			}
+			return url.PathEscape(fmt.Sprint(value))
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("invalid arguments: missing path parameter %s", strings.Join(missing, ", "))
+		}
+		target = strings.ReplaceAll(target, "//", "/")
+
+		var query map[string]any
+		if raw, ok := args["query"]; ok {
+			if err := json.Unmarshal(raw, &query); err != nil {
+				return fmt.Errorf("invalid arguments: query must be an object")
+			}
+		}
+		values := url.Values{}
+		for key, value := range query {
+			switch v := value.(type) {
+			case nil:
+			case []any:
+				for _, item := range v {
+					values.Add(key, fmt.Sprint(item))
+				}
+			default:
+				values.Set(key, fmt.Sprint(v))
+			}
+		}
+		if encoded := values.Encode(); encoded != "" {
+			target += "?" + encoded
+		}
+
+		var req fasthttp.Request
+		// The caller's headers travel with the call, so that cookie or token
+		// based authentication in the route's middleware sees the same caller.
+		for key, value := range c.Context.Request().Header.All() {
+			switch strings.ToLower(string(key)) {
+			case "content-type", "content-length", "accept", "accept-encoding", "mcp-protocol-version", "mcp-method", "mcp-name", "mcp-session-id":
+				continue
+			}
+			req.Header.AddBytesKV(key, value)
+		}
+		req.Header.SetMethod(method)
+		req.Header.Set("Accept", "application/json")
+		req.SetRequestURI(target)
+		req.SetHost(c.Hostname())
+		if body, ok := args["body"]; ok && string(body) != "null" {
+			req.Header.SetContentType(fiber.MIMEApplicationJSON)
+			req.SetBody(body)
+		}
+
+		var ctx fasthttp.RequestCtx
+		ctx.Init(&req, c.Context.RequestCtx().RemoteAddr(), nil)
+		ctx.SetUserValue(mcpUserLocal{}, c.User())
+		app.Handler()(&ctx)
+
+		return mcpRouteResult(ctx.Response.StatusCode(), string(ctx.Response.Header.ContentType()), ctx.Response.Body())
+	}
+}
+
+// mcpRouteResult maps an HTTP response onto a tool result. The standard
+// {success, errors, data} envelope is unwrapped: data becomes the result and
+// errors become a tool execution error.
+func mcpRouteResult(status int, contentType string, body []byte) any {
+	failed := status >= 400
+	if !strings.Contains(contentType, "json") {
+		if failed {
+			if len(body) == 0 {
+				return fmt.Errorf("request failed with status %d", status)
+			}
+			return fmt.Errorf("%s", body)
+		}
+		return string(body)
+	}
+
+	var envelope struct {
+		Success *bool           `json:"success"`
+		Errors  []string        `json:"errors"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Success != nil {
+		if failed || !*envelope.Success {
+			if len(envelope.Errors) == 0 {
+				return fmt.Errorf("request failed with status %d", status)
+			}
+			return fmt.Errorf("%s", strings.Join(envelope.Errors, "; "))
+		}
+		body = envelope.Data
+	}
+
+	if failed {
+		return fmt.Errorf("%s", body)
+	}
+	var value any
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &value); err != nil {
+			return string(body)
+		}
+	}
+	return value
+}
@@ -0,0 +1,176 @@
+package evo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type invoiceQuery struct {
+	Status string `json:"status" description:"filter by status"`
+}
+
+type invoiceBody struct {
+	Amount int `json:"amount" validation:"required"`
+}
+
+// newMCPRoutesTestApp registers a small invoice API, exposes it and builds the
+// tools the way Run() does.
+func newMCPRoutesTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	a := newMCPTestApp(t)
+
+	api := Group("/api").Name("invoices")
+	api.Get("/invoices/:id", func(r *Request) any {
+		if r.Param("id").String() == "404" {
+			return fmt.Errorf("invoice not found")
+		}
+		return map[string]any{"id": r.Param("id").String(), "status": r.Query("status").String(), "user": r.User().UUID()}
+	}).Name("get")
+	api.Post("/invoices", func(r *Request) any {
+		var body invoiceBody
+		if err := r.BodyParser(&body); err != nil {
+			return err
+		}
+		return map[string]int{"created": body.Amount}
+	})
+	api.ExposeMCP()
+	Get("/health/raw", func(r *Request) any { return []byte("ok") })
+	ExposeMCPRoute("GET", "/health/raw", MCPRoute{Name: "raw", Description: "Raw text"})
+	Get("/hidden", func(r *Request) any { return "hidden" })
+
+	ExposeMCPRoute("GET", "/api/invoices/:id", MCPRoute{Description: "Fetch an invoice", Query: invoiceQuery{}})
+	registerMCPRoutes()
+	return a
+}
+
+func TestMCPRoutesAreListed(t *testing.T) {
+	a := newMCPRoutesTestApp(t)
+
+	res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	tools := map[string]map[string]any{}
+	for _, item := range res.result["tools"].([]any) {
+		tool := item.(map[string]any)
+		tools[tool["name"].(string)] = tool
+	}
+	if len(tools) != 3 {
+		t.Fatalf("expected three tools, got %s", res.body)
+	}
+
+	get := tools["invoices.get"]
+	if get == nil {
+		t.Fatalf("the named route should keep its name, got %v", tools)
+	}
+	if get["description"] != "Fetch an invoice" {
+		t.Errorf("an exact opt-in should win over the group, got %v", get["description"])
+	}
+	if get["annotations"].(map[string]any)["readOnlyHint"] != true {
+		t.Error("a GET route should be hinted read-only")
+	}
+	schema := get["inputSchema"].(map[string]any)
+	if fmt.Sprint(schema["required"]) != "[id]" {
+		t.Errorf("expected the path parameter to be required, got %v", schema["required"])
+	}
+	query := schema["properties"].(map[string]any)["query"].(map[string]any)
+	if _, ok := query["properties"].(map[string]any)["status"]; !ok {
+		t.Errorf("expected the query schema from the struct, got %v", query)
+	}
+
+	post := tools["post_api_invoices"]
+	if post == nil {
+		t.Fatalf("an unnamed route should be named after method and path, got %v", tools)
+	}
+	if _, ok := post["annotations"]; ok {
+		t.Error("a POST route should carry no read-only hint")
+	}
+	if _, ok := tools["get_hidden"]; ok {
+		t.Error("a route that was not opted in must not be exposed")
+	}
+}
+
+func TestMCPRouteCallUnwrapsEnvelope(t *testing.T) {
+	a := newMCPRoutesTestApp(t)
+	withUser(t)
+
+	res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"invoices.get","arguments":{"id":"7","query":{"status":"paid"}}}}`)
+	if res.err != nil || res.result["isError"] == true {
+		t.Fatalf("expected success, got %s", res.body)
+	}
+	structured := res.result["structuredContent"].(map[string]any)
+	if structured["id"] != "7" || structured["status"] != "paid" {
+		t.Errorf("unexpected structured content %v", structured)
+	}
+}
+
+func TestMCPRouteCallCarriesCaller(t *testing.T) {
+	a := newMCPRoutesTestApp(t)
+	previous := UserInterfaceInstance
+	t.Cleanup(func() { UserInterfaceInstance = previous })
+	calls := 0
+	SetUserInterface(countingUser{calls: &calls})
+
+	res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"invoices.get","arguments":{"id":"1"}}}`)
+	if res.result["structuredContent"].(map[string]any)["user"] != "u-1" {
+		t.Errorf("the route should see the MCP caller, got %s", res.body)
+	}
+	if calls != 1 {
+		t.Errorf("the caller should be resolved once, on the MCP endpoint, got %d", calls)
+	}
+}
+
+func TestMCPRouteCallErrorIsToolError(t *testing.T) {
+	a := newMCPRoutesTestApp(t)
+
+	res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"invoices.get","arguments":{"id":"404"}}}`)
+	if res.result["isError"] != true {
+		t.Fatalf("expected a tool error, got %s", res.body)
+	}
+	if text := res.result["content"].([]any)[0].(map[string]any)["text"]; text != "invoice not found" {
+		t.Errorf("expected the envelope error, got %v", text)
+	}
+
+	res = call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"invoices.get","arguments":{}}}`)
+	if res.result["isError"] != true || !strings.Contains(res.body, "missing path parameter id") {
+		t.Errorf("expected a missing parameter error, got %s", res.body)
+	}
+}
+
+func TestMCPRouteCallSendsBody(t *testing.T) {
+	a := newMCPRoutesTestApp(t)
+
+	res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"post_api_invoices","arguments":{"body":{"amount":12}}}}`)
+	if res.result["structuredContent"].(map[string]any)["created"] != float64(12) {
+		t.Errorf("unexpected result %s", res.body)
+	}
+}
+
+func TestMCPRouteCallTextResponse(t *testing.T) {
+	a := newMCPRoutesTestApp(t)
+
+	res := call(t, a, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"raw"}}`)
+	if text := res.result["content"].([]any)[0].(map[string]any)["text"]; text != "ok" {
+		t.Errorf("expected the raw body as text, got %s", res.body)
+	}
+}
+
+func TestMCPRouteToolNamesAreUnique(t *testing.T) {
+	used := map[string]bool{"get_users_id": true}
+	name := mcpRouteToolName(fiber.Route{Method: "GET", Path: "/users/:id<int>"}, MCPRoute{}, used)
+	if name != "get_users_id_2" {
+		t.Errorf("expected a suffixed name, got %s", name)
+	}
+}
+
+type countingUser struct {
+	DefaultUserInterface
+	calls *int
+}
+
+func (u countingUser) UUID() string    { return "u-1" }
+func (u countingUser) Anonymous() bool { return false }
+func (u countingUser) FromRequest(r *Request) UserInterface {
+	*u.calls++
+	return u
+}
@@ -1,6 +1,7 @@
 package evo
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	nethttp "net/http" // aliased: the package already has an `http` config var
@@ -22,16 +23,20 @@ func newMCPTestApp(t *testing.T) *fiber.App {
 
 	a := newTestApp()
 
-	previousConfig := mcpConfig
+	previousConfig, previousValidator := mcpConfig, mcpValidator
+	mcpValidator = nil
 	mcpMutex.Lock()
-	previousTools, previousOrder := mcpTools, mcpToolOrder
-	mcpTools, mcpToolOrder = map[string]*MCPTool{}, nil
+	previousTools, previousOrder, previousExposures, previousModels := mcpTools, mcpToolOrder, mcpExposures, mcpModels
+	mcpTools, mcpToolOrder, mcpExposures, mcpModels = map[string]*MCPTool{}, nil, nil, nil
+	previousSinks, previousLimits, previousUserLimit := mcpAuditSinks, mcpLimits, mcpUserRateLimit
+	mcpAuditSinks, mcpLimits, mcpUserRateLimit = nil, newMCPLimiter(), MCPRateLimit{}
 	mcpMutex.Unlock()
 
 	t.Cleanup(func() {
-		mcpConfig = previousConfig
+		mcpConfig, mcpValidator = previousConfig, previousValidator
 		mcpMutex.Lock()
-		mcpTools, mcpToolOrder = previousTools, previousOrder
+		mcpTools, mcpToolOrder, mcpExposures, mcpModels = previousTools, previousOrder, previousExposures, previousModels
+		mcpAuditSinks, mcpLimits, mcpUserRateLimit = previousSinks, previousLimits, previousUserLimit
 		mcpMutex.Unlock()
 	})
 
@@ -948,3 +953,70 @@ func TestRegisterMCPEndpointsMountsConfiguredPath(t *testing.T) {
 		t.Errorf("expected the endpoint at the configured path, got %d", res.status)
 	}
 }
+
+// --- client round trip -------------------------------------------------------
+
+// fiberDoer routes the MCP client's HTTP requests through app.Test so the
+// client can reach the endpoint without a listening socket.
+type fiberDoer struct{ app *fiber.App }
+
+func (d fiberDoer) Do(req *nethttp.Request) (*nethttp.Response, error) {
+	return d.app.Test(req)
+}
+
+func TestMCPClientRoundTrip(t *testing.T) {
+	a := newMCPTestApp(t)
+	mcpConfig.Token = "s3cret"
+	registerEchoTool(t)
+
+	client := mcp.NewHTTPClient("http://evo.test/mcp", mcp.ClientConfig{
+		Token:      "s3cret",
+		HTTPClient: fiberDoer{app: a},
+	})
+	if err := client.Connect(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if client.Version != mcp.LatestVersion {
+		t.Errorf("expected %s, got %s", mcp.LatestVersion, client.Version)
+	}
+	if client.ServerInfo == nil || client.ServerInfo.Name != "test-server" {
+		t.Errorf("unexpected server info %+v", client.ServerInfo)
+	}
+
+	tools, err := client.ListTools(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 1 || tools[0].Name != "echo" {
+		t.Fatalf("expected the echo tool, got %+v", tools)
+	}
+
+	var out struct {
+		Echoed string `json:"echoed"`
+		Times  int    `json:"times"`
+	}
+	if err := client.CallToolInto(t.Context(), "echo", echoInput{Message: "hi", Times: 2}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Echoed != "hi hi" || out.Times != 2 {
+		t.Errorf("unexpected result %+v", out)
+	}
+
+	_, err = client.CallTool(t.Context(), "echo", echoInput{Times: 1})
+	var toolErr *mcp.ToolError
+	if !errors.As(err, &toolErr) {
+		t.Errorf("a validation failure should surface as a tool error, got %v", err)
+	}
+}
+
+func TestMCPClientRejectedWithoutToken(t *testing.T) {
+	a := newMCPTestApp(t)
+	mcpConfig.Token = "s3cret"
+
+	client := mcp.NewHTTPClient("http://evo.test/mcp", mcp.ClientConfig{HTTPClient: fiberDoer{app: a}})
+	err := client.Connect(t.Context())
+	var statusErr *mcp.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != nethttp.StatusUnauthorized {
+		t.Errorf("expected a 401 status error, got %v", err)
+	}
+}
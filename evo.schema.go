@@ -0,0 +1,37 @@
+package evo
+
+import (
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/outcome"
+	"github.com/gofiber/fiber/v3"
+)
+
+// ServeSchemaExport serves the schema of the registered models at path, in
+// the format given by the format query parameter: mermaid, dbml, json or
+// markdown, the default. handlers run first, to restrict access:
+//
+//	evo.ServeSchemaExport("/docs/schema", adminOnly) // /docs/schema?format=mermaid
+func ServeSchemaExport(path string, handlers ...Handler) fiber.Router {
+	return Get(path, append(handlers, schemaExportHandler)...)
+}
+
+func schemaExportHandler(r *Request) any {
+	var format = r.Query("format").String()
+	if format == "" {
+		format = "markdown"
+	}
+	data, err := schema.Export(GetDBO(), format)
+	if err != nil {
+		return outcome.BadRequest(err.Error())
+	}
+	var response = outcome.Text(string(data))
+	switch format {
+	case "json":
+		response.ContentType = fiber.MIMEApplicationJSONCharsetUTF8
+	case "markdown", "md":
+		response.ContentType = "text/markdown; charset=utf-8"
+	default:
+		response.ContentType = fiber.MIMETextPlainCharsetUTF8
+	}
+	return response
+}
@@ -0,0 +1,22 @@
+package evo
+
+import (
+	"github.com/getevo/evo/v2/lib/tenant"
+	"github.com/gofiber/fiber/v3"
+)
+
+// TenantFromUser returns a tenant resolver reading the tenant from an
+// attribute of the request user, see SetUserInterface.
+//
+//	tenant.Setup(evo.GetDBO(), tenant.Config{
+//	    Resolvers: []tenant.Resolver{evo.TenantFromUser("tenant_id")},
+//	})
+func TenantFromUser(attribute string) tenant.Resolver {
+	return func(c fiber.Ctx) (string, error) {
+		var user = Upgrade(c).User()
+		if user == nil || user.Anonymous() {
+			return "", nil
+		}
+		return user.Attributes().Get(attribute).String(), nil
+	}
+}
@@ -4,6 +4,14 @@ import "github.com/getevo/evo/v2/lib/generic"
 
 func (r *Request) User() UserInterface {
 	if r.UserInterface == nil {
+		// A request synthesized for an MCP route tool carries the caller
+		// that was already resolved on the MCP endpoint.
+		if r.Context != nil {
+			if user, ok := r.Context.Locals(mcpUserLocal{}).(UserInterface); ok {
+				r.UserInterface = &user
+				return user
+			}
+		}
 		var user = (UserInterfaceInstance).FromRequest(r)
 		if user == nil {
 			user = DefaultUserInterface{}
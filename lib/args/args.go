@@ -1,8 +1,11 @@
 package args
 
-import "os"
+import (
+	"os"
+	"strings"
+)
 
-// Get get value of argument
+// Get get value of argument, passed either as "--name value" or "--name=value"
 //
 //	@param sw
 //	@return string
@@ -13,17 +16,20 @@ func Get(sw string) string {
 				return os.Args[i+1]
 			}
 		}
+		if value, ok := strings.CutPrefix(os.Args[i], sw+"="); ok {
+			return value
+		}
 	}
 	return ""
 }
 
-// Exists check if argument has been passed to app
+// Exists check if argument has been passed to app, with or without "=value"
 //
 //	@param sw
 //	@return bool
 func Exists(sw string) bool {
 	for i := 0; i < len(os.Args); i++ {
-		if os.Args[i] == sw {
+		if os.Args[i] == sw || strings.HasPrefix(os.Args[i], sw+"=") {
 			return true
 		}
 	}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"gorm.io/gorm"
+)
+
+var (
+	// connections holds the named connections beside the primary one.
+	connections   = map[string]*gorm.DB{}
+	connectionsMu sync.RWMutex
+)
+
+// PoolConfig holds the connection pool limits of a connection. Zero values
+// keep the database/sql defaults.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// ApplyPool applies the pool limits to the connection pool of conn.
+func ApplyPool(conn *gorm.DB, pool PoolConfig) error {
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	if pool.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	return nil
+}
+
+// RegisterConnection registers conn as the named connection name, so that
+// GetConnection returns it and its models are migrated on it.
+func RegisterConnection(name string, conn *gorm.DB) {
+	connectionsMu.Lock()
+	connections[name] = conn
+	connectionsMu.Unlock()
+	schema.RegisterConnection(name, conn)
+}
+
+// GetConnection returns the named connection, or nil if it is not registered.
+func GetConnection(name string) *gorm.DB {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+	return connections[name]
+}
+
+// ConnectionNames returns the names of the registered connections, sorted.
+func ConnectionNames() []string {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+	var names = make([]string, 0, len(connections))
+	for name := range connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UseModelOn registers models that live on the named connection. They are
+// migrated on that connection only.
+func UseModelOn(name string, models ...any) {
+	schema.SetModelConnection(name, models...)
+	if conn := GetConnection(name); conn != nil {
+		schema.UseModel(conn, models...)
+		return
+	}
+	UseModel(models...)
+}
+
+// DoMigrationOn migrates the models and versioned migrations of the named
+// connection.
+func DoMigrationOn(name string) error {
+	conn := GetConnection(name)
+	if conn == nil {
+		return fmt.Errorf("database connection %s is not registered", name)
+	}
+	return schema.DoMigration(conn)
+}
+
+// PingConnection checks the named connection, for health checks.
+func PingConnection(ctx context.Context, name string) error {
+	conn := GetConnection(name)
+	if conn == nil {
+		return fmt.Errorf("database connection %s is not registered", name)
+	}
+	if err := Ping(ctx, conn); err != nil {
+		return fmt.Errorf("database connection %s: %w", name, err)
+	}
+	return nil
+}
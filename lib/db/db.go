@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -212,6 +213,12 @@ func Delete(value any, conds ...any) (tx *gorm.DB) {
 	return db.Delete(value, conds...)
 }
 
+// Restore undeletes the soft-deleted rows of value matching its primary key and conds, and the children soft
+// deleted with them. See types.Restore.
+func Restore(value any, conds ...any) (tx *gorm.DB) {
+	return types.Restore(db, value, conds...)
+}
+
 func Count(count *int64) (tx *gorm.DB) {
 	return db.Count(count)
 }
@@ -511,6 +518,16 @@ func Unscoped() (tx *gorm.DB) {
 	return db.Unscoped()
 }
 
+// WithTrashed includes the soft-deleted rows in the query.
+func WithTrashed() (tx *gorm.DB) {
+	return db.Scopes(types.WithTrashed)
+}
+
+// OnlyTrashed limits the query to the soft-deleted rows.
+func OnlyTrashed() (tx *gorm.DB) {
+	return db.Scopes(types.OnlyTrashed)
+}
+
 func Raw(sql string, values ...any) (tx *gorm.DB) {
 	return db.Raw(sql, values...)
 }
@@ -531,6 +548,68 @@ func DoMigration() error {
 	return schema.DoMigration(db)
 }
 
+// RegisterMigration registers a hand-written migration that runs after the
+// model diff. Use schema.RegisterVersionedMigration for the other options.
+func RegisterMigration(id string, up, down func(tx *gorm.DB) error) {
+	schema.RegisterMigration(id, up, down)
+}
+
+// MigrationStatus reports the state of every versioned migration.
+func MigrationStatus() ([]schema.MigrationState, error) {
+	return schema.MigrationStatus(db)
+}
+
+// PrintMigrationStatus prints the state of every versioned migration.
+func PrintMigrationStatus() error {
+	return schema.PrintMigrationStatus(db)
+}
+
+// RollbackMigrations reverts the last n applied versioned migrations.
+func RollbackMigrations(n int) error {
+	return schema.RollbackMigrations(db, n)
+}
+
+// MigrateTo applies or rolls back versioned migrations until exactly those
+// up to and including id are applied.
+func MigrateTo(id string) error {
+	return schema.MigrateTo(db, id)
+}
+
+// MigrationRisks classifies the statements the model diff would execute.
+func MigrationRisks() []schema.StatementRisk {
+	return schema.MigrationRisks(db)
+}
+
+// AllowDestructiveMigration lets DoMigration execute destructive and
+// data-loss statements, like the --migration-allow-destructive flag.
+func AllowDestructiveMigration(allow bool) {
+	schema.AllowDestructiveMigration(allow)
+}
+
+// SetFullTextLanguage sets the text search configuration of the PostgreSQL
+// full-text indexes, see schema.SetFullTextLanguage.
+func SetFullTextLanguage(language string) {
+	schema.SetFullTextLanguage(language)
+}
+
+// SetPostGIS makes the point columns PostGIS geography columns on
+// PostgreSQL, see schema.SetPostGIS.
+func SetPostGIS(enabled bool) {
+	schema.SetPostGIS(enabled)
+}
+
+// GenerateMigrationFile writes the pending migration script to a new
+// timestamped .sql file in dir and returns its path.
+func GenerateMigrationFile(dir string) (string, error) {
+	return schema.GenerateMigrationFile(db, dir)
+}
+
+// ApplyMigrationFiles applies the .sql files of dir that were not applied yet
+// and returns the model diff statements still needed afterwards.
+func ApplyMigrationFiles(dir string) ([]string, error) {
+	return schema.ApplyMigrationFiles(db, dir)
+}
+
 func DryRunMigration() []string {
 	return schema.DryRunMigration(db)
 }
@@ -539,6 +618,12 @@ func DumpSchema() []string {
 	return schema.DumpSchema(db)
 }
 
+// ExportSchema renders the registered models as mermaid, dbml, markdown or
+// json, see schema.Export.
+func ExportSchema(format string) ([]byte, error) {
+	return schema.Export(db, format)
+}
+
 func Models() []schema.Model {
 	return schema.Models
 }
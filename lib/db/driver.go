@@ -25,8 +25,18 @@ type DriverConfig struct {
 
 var registeredDriver Driver
 
+// drivers holds every registered driver by name, for named connections
+// using another engine than the primary one.
+var drivers = map[string]Driver{}
+
 // RegisterDriver sets the active database driver.
-func RegisterDriver(d Driver) { registeredDriver = d }
+func RegisterDriver(d Driver) {
+	registeredDriver = d
+	drivers[d.Name()] = d
+}
 
 // GetDriver returns the currently registered driver, or nil.
 func GetDriver() Driver { return registeredDriver }
+
+// FindDriver returns the registered driver with the given name, or nil.
+func FindDriver(name string) Driver { return drivers[name] }
@@ -0,0 +1,116 @@
+// Package history records who changed what on business records. Models opt
+// in by embedding history.Tracked, or by implementing TrackHistory() bool,
+// and every create, update, delete and soft delete of them through GORM is
+// written to the model_history table with the changed columns, the actor and
+// the request it came from.
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/db/types"
+	"github.com/gofiber/fiber/v3"
+)
+
+// Event is the kind of change a Record describes.
+type Event string
+
+const (
+	Created     Event = "create"
+	Updated     Event = "update"
+	Deleted     Event = "delete"
+	SoftDeleted Event = "soft_delete"
+	Restored    Event = "restore"
+)
+
+// Record is one change of a tracked row. Before and After hold the changed
+// columns as a JSON object; a create only has After and a hard delete only
+// has Before, each with every column.
+type Record struct {
+	ID        uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Table     string     `gorm:"column:table_name;size:64;index:idx_model_history_entity" json:"table"`
+	EntityID  string     `gorm:"column:entity_id;size:191;index:idx_model_history_entity" json:"entity_id"`
+	Event     Event      `gorm:"column:event;size:16" json:"event"`
+	Before    types.JSON `gorm:"column:before" json:"before,omitempty"`
+	After     types.JSON `gorm:"column:after" json:"after,omitempty"`
+	ActorID   string     `gorm:"column:actor_id;size:64;index" json:"actor_id,omitempty"`
+	ActorName string     `gorm:"column:actor_name;size:255" json:"actor_name,omitempty"`
+	RequestID string     `gorm:"column:request_id;size:64" json:"request_id,omitempty"`
+	CreatedAt time.Time  `gorm:"column:created_at;index" json:"created_at"`
+}
+
+// TableName implements gorm's Tabler.
+func (Record) TableName() string {
+	return "model_history"
+}
+
+// Changes returns the changed columns as column -> [before, after].
+func (r Record) Changes() map[string][2]json.RawMessage {
+	var before, after map[string]json.RawMessage
+	_ = json.Unmarshal(r.Before, &before)
+	_ = json.Unmarshal(r.After, &after)
+	var changes = map[string][2]json.RawMessage{}
+	for column, value := range before {
+		changes[column] = [2]json.RawMessage{value, after[column]}
+	}
+	for column, value := range after {
+		if _, ok := changes[column]; !ok {
+			changes[column] = [2]json.RawMessage{nil, value}
+		}
+	}
+	return changes
+}
+
+// Tracked opts a model into history when embedded. Columns tagged
+// `history:"-"` are left out of the records, for secrets.
+type Tracked struct{}
+
+// TrackHistory implements the opt-in interface.
+func (Tracked) TrackHistory() bool {
+	return true
+}
+
+// Actor is who made a change.
+type Actor struct {
+	ID   string
+	Name string
+}
+
+type actorKey struct{}
+type requestKey struct{}
+type restoreKey struct{}
+
+// WithActor returns a copy of ctx whose changes are attributed to actor.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// WithRequestID returns a copy of ctx whose changes carry the request id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestKey{}, id)
+}
+
+func actorOf(ctx context.Context) (Actor, string) {
+	if ctx == nil {
+		return Actor{}, ""
+	}
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	requestID, _ := ctx.Value(requestKey{}).(string)
+	return actor, requestID
+}
+
+// Middleware puts the actor returned by resolve and the request id on the
+// context of every request, for the records of the changes it makes.
+// Handlers pass c.Context() to the database.
+func Middleware(resolve func(c fiber.Ctx) Actor) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var ctx = WithActor(c.Context(), resolve(c))
+		if id := c.RequestID(); id != "" {
+			ctx = WithRequestID(ctx, id)
+		}
+		c.SetContext(ctx)
+		return c.Next()
+	}
+}
@@ -0,0 +1,280 @@
+package history_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/getevo/evo/v2/lib/db/history"
+	"github.com/getevo/evo/v2/lib/db/types"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type article struct {
+	ID     uint   `gorm:"primaryKey;autoIncrement"`
+	Title  string `gorm:"column:title"`
+	Body   string `gorm:"column:body"`
+	Secret string `gorm:"column:secret" history:"-"`
+	history.Tracked
+	types.SoftDelete
+}
+
+type note struct {
+	ID   uint `gorm:"primaryKey;autoIncrement"`
+	Text string
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "history.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.Use(&history.Plugin{}); err != nil {
+		t.Fatalf("plugin: %v", err)
+	}
+	if err = db.AutoMigrate(&article{}, &note{}, &history.Record{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func timeline(t *testing.T, db *gorm.DB, id uint) []history.Record {
+	t.Helper()
+	records, err := history.Timeline(db, &article{}, id)
+	if err != nil {
+		t.Fatalf("timeline: %v", err)
+	}
+	return records
+}
+
+func column(t *testing.T, data types.JSON, name string) any {
+	t.Helper()
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return values[name]
+}
+
+func TestRecordsChanges(t *testing.T) {
+	db := openDB(t)
+	ctx := history.WithRequestID(history.WithActor(context.Background(), history.Actor{ID: "7", Name: "alice"}), "req-1")
+
+	a := article{Title: "draft", Body: "text", Secret: "s1"}
+	if err := db.WithContext(ctx).Create(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithContext(ctx).Model(&a).Updates(map[string]any{"title": "final", "secret": "s2"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithContext(ctx).Delete(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&note{Text: "untracked"})
+
+	records := timeline(t, db, a.ID)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %+v", records)
+	}
+	created, updated, deleted := records[0], records[1], records[2]
+	if created.Event != history.Created || column(t, created.After, "title") != "draft" || created.Before != nil {
+		t.Errorf("unexpected create record %+v", created)
+	}
+	if column(t, created.After, "secret") != nil {
+		t.Errorf("excluded column recorded: %s", created.After)
+	}
+	if created.ActorID != "7" || created.ActorName != "alice" || created.RequestID != "req-1" {
+		t.Errorf("actor not recorded: %+v", created)
+	}
+	if updated.Event != history.Updated || column(t, updated.Before, "title") != "draft" || column(t, updated.After, "title") != "final" {
+		t.Errorf("unexpected update record %+v", updated)
+	}
+	if changes := updated.Changes(); len(changes) != 1 {
+		t.Errorf("expected only the title to change, got %v", changes)
+	}
+	if deleted.Event != history.SoftDeleted || column(t, deleted.After, "deleted") != true {
+		t.Errorf("unexpected soft delete record %+v", deleted)
+	}
+
+	var count int64
+	db.Model(&history.Record{}).Where("table_name = ?", "notes").Count(&count)
+	if count != 0 {
+		t.Errorf("untracked model recorded %d changes", count)
+	}
+}
+
+func TestHardDeleteAndRestore(t *testing.T) {
+	db := openDB(t)
+
+	a := article{Title: "v1", Body: "one"}
+	db.Create(&a)
+	db.Model(&a).Update("title", "v2")
+	db.Model(&a).Update("body", "two")
+	if err := db.Unscoped().Delete(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	records := timeline(t, db, a.ID)
+	if last := records[len(records)-1]; last.Event != history.Deleted || column(t, last.Before, "body") != "two" {
+		t.Fatalf("unexpected delete record %+v", last)
+	}
+
+	// Back to the state right after the first update.
+	if err := history.Restore(db, &article{}, records[1].ID); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	var got article
+	if err := db.First(&got, a.ID).Error; err != nil {
+		t.Fatalf("restored row: %v", err)
+	}
+	if got.Title != "v2" || got.Body != "one" {
+		t.Errorf("expected v2/one, got %s/%s", got.Title, got.Body)
+	}
+
+	db.Model(&got).Update("title", "v3")
+	records = timeline(t, db, a.ID)
+	if err := history.Restore(db, &article{}, records[0].ID); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	db.First(&got, a.ID)
+	if got.Title != "v1" || got.Body != "one" {
+		t.Errorf("expected v1/one, got %s/%s", got.Title, got.Body)
+	}
+	records = timeline(t, db, a.ID)
+	if last := records[len(records)-1]; last.Event != history.Restored {
+		t.Errorf("expected a restore record, got %+v", last)
+	}
+}
+
+func TestRestoreSoftDeleted(t *testing.T) {
+	db := openDB(t)
+
+	a := article{Title: "kept"}
+	db.Create(&a)
+	db.Delete(&a)
+	if err := db.First(&article{}, a.ID).Error; err == nil {
+		t.Fatal("expected the row to be soft deleted")
+	}
+	records := timeline(t, db, a.ID)
+	if err := history.Restore(db, &article{}, records[0].ID); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if err := db.First(&article{}, a.ID).Error; err != nil {
+		t.Errorf("expected the row back, got %v", err)
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	db := openDB(t)
+
+	a := article{Title: "gone"}
+	db.Create(&a)
+	db.Unscoped().Delete(&a)
+	records := timeline(t, db, a.ID)
+	if err := history.Restore(db, &article{}, records[1].ID); err != history.ErrNothingToRestore {
+		t.Errorf("expected ErrNothingToRestore, got %v", err)
+	}
+	if err := history.Restore(db, &note{}, records[0].ID); err == nil {
+		t.Error("expected an error for another model")
+	}
+}
+
+func TestFailedChangeIsNotRecorded(t *testing.T) {
+	db := openDB(t)
+
+	a := article{Title: "tx"}
+	_ = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&a).Error; err != nil {
+			return err
+		}
+		return gorm.ErrInvalidData
+	})
+	var count int64
+	db.Model(&history.Record{}).Count(&count)
+	if count != 0 {
+		t.Errorf("rolled back change left %d records", count)
+	}
+}
+
+type account struct {
+	ID       uint `gorm:"primaryKey;autoIncrement"`
+	Name     string
+	Password types.Encrypted[string]
+	history.Tracked
+}
+
+func TestRestoreEncrypted(t *testing.T) {
+	ring, err := types.ParseKeyRing("k1:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)), "")
+	if err != nil {
+		t.Fatalf("key ring: %v", err)
+	}
+	types.SetKeyRing(ring)
+	t.Cleanup(func() { types.SetKeyRing(nil) })
+	db := openDB(t)
+	if err = db.AutoMigrate(&account{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	a := account{Name: "ann", Password: types.NewEncrypted("hunter2")}
+	db.Create(&a)
+	var loaded account
+	db.Take(&loaded, a.ID)
+	loaded.Name = "ann b"
+	db.Save(&loaded)
+	db.Model(&loaded).Update("password", types.NewEncrypted("swordfish"))
+
+	records, err := history.Timeline(db, &account{}, a.ID)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d, %v", len(records), err)
+	}
+	if _, changed := records[1].Changes()["password"]; changed {
+		t.Error("an unchanged password was recorded as changed")
+	}
+	if stored := column(t, records[0].After, "password"); stored == nil || stored == "hunter2" {
+		t.Errorf("expected the ciphertext of the password, got %v", stored)
+	}
+	if err = history.Restore(db, &account{}, records[1].ID); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	db.Take(&loaded, a.ID)
+	if loaded.Password.Val != "hunter2" || loaded.Name != "ann b" {
+		t.Errorf("expected the password back, got %q, %q", loaded.Name, loaded.Password.Val)
+	}
+}
+
+type setting struct {
+	Scope string `gorm:"primaryKey"`
+	Name  string `gorm:"primaryKey"`
+	Value string
+	history.Tracked
+}
+
+func TestRestoreKeyWithComma(t *testing.T) {
+	db := openDB(t)
+	if err := db.AutoMigrate(&setting{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	s := setting{Scope: `eu,west\1`, Name: "theme", Value: "dark"}
+	db.Create(&s)
+	db.Model(&s).Update("value", "light")
+	records, err := history.Timeline(db, &setting{}, s.Scope, s.Name)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d, %v", len(records), err)
+	}
+	if err = history.Restore(db, &setting{}, records[0].ID); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	var loaded setting
+	db.Take(&loaded, "scope = ? AND name = ?", s.Scope, s.Name)
+	if loaded.Value != "dark" {
+		t.Errorf("expected dark, got %q", loaded.Value)
+	}
+}
@@ -0,0 +1,369 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/db"
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	gschema "gorm.io/gorm/schema"
+)
+
+// Plugin records the changes of the tracked models. Register it with
+// db.Use(&history.Plugin{}); it also registers Record for migration.
+type Plugin struct{}
+
+// Name implements gorm.Plugin.
+func (Plugin) Name() string {
+	return "evo:history"
+}
+
+// Initialize implements gorm.Plugin.
+func (p Plugin) Initialize(conn *gorm.DB) error {
+	schema.UseModel(conn, Record{})
+	var callbacks = conn.Callback()
+	var steps = []struct {
+		name     string
+		register func(name string, fn func(*gorm.DB)) error
+		fn       func(*gorm.DB)
+	}{
+		{"evo:history_create", callbacks.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register, recordCreate},
+		{"evo:history_before_update", callbacks.Update().After("gorm:begin_transaction").Before("gorm:update").Register, loadBefore},
+		{"evo:history_update", callbacks.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register, recordUpdate},
+		{"evo:history_before_delete", callbacks.Delete().After("gorm:begin_transaction").Before("gorm:delete").Register, loadBefore},
+		{"evo:history_delete", callbacks.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register, recordDelete},
+	}
+	for _, step := range steps {
+		if err := step.register(step.name, step.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const beforeKey = "evo:history_before"
+
+// snapshot is the JSON encoded value of each tracked column of a row.
+type snapshot map[string]json.RawMessage
+
+// row is a loaded row: its primary key values and its snapshot.
+type row struct {
+	key    []any
+	values snapshot
+}
+
+// trackedModels caches whether each parsed model opted in.
+var trackedModels sync.Map
+
+func tracked(stmt *gorm.Statement) bool {
+	if stmt.Schema == nil || len(stmt.Schema.PrimaryFields) == 0 {
+		return false
+	}
+	v, ok := trackedModels.Load(stmt.Schema)
+	if !ok {
+		obj, is := reflect.New(stmt.Schema.ModelType).Interface().(interface{ TrackHistory() bool })
+		v = is && obj.TrackHistory()
+		trackedModels.Store(stmt.Schema, v)
+	}
+	return v.(bool)
+}
+
+// columns returns the fields whose values are recorded.
+func columns(s *gschema.Schema) []*gschema.Field {
+	var fields []*gschema.Field
+	for _, field := range s.Fields {
+		if field.DBName == "" || !field.Readable || field.Tag.Get("history") == "-" {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// primaryKey returns the primary key values of a row.
+func primaryKey(stmt *gorm.Statement, rv reflect.Value) []any {
+	var key = make([]any, len(stmt.Schema.PrimaryFields))
+	for i, field := range stmt.Schema.PrimaryFields {
+		key[i], _ = field.ValueOf(stmt.Context, rv)
+	}
+	return key
+}
+
+// entityID joins the primary key values of a row with commas, escaping
+// the commas and backslashes of the values with a backslash.
+func entityID(key []any) string {
+	var parts = make([]string, len(key))
+	for i, value := range key {
+		parts[i] = idEscaper.Replace(fmt.Sprint(value))
+	}
+	return strings.Join(parts, ",")
+}
+
+var idEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`)
+
+// splitEntityID returns the primary key values joined by entityID.
+func splitEntityID(id string) []string {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(id); i++ {
+		switch {
+		case id[i] == '\\' && i+1 < len(id):
+			i++
+			part.WriteByte(id[i])
+		case id[i] == ',':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(id[i])
+		}
+	}
+	return append(parts, part.String())
+}
+
+// sealedValue is a column recorded by its ciphertext, such as
+// types.Encrypted, which marshals to JSON as null.
+type sealedValue interface {
+	Ciphertext() (string, error)
+}
+
+func takeSnapshot(stmt *gorm.Statement, rv reflect.Value) (snapshot, error) {
+	var snap = snapshot{}
+	for _, field := range columns(stmt.Schema) {
+		value, _ := field.ValueOf(stmt.Context, rv)
+		if sealed, ok := value.(sealedValue); ok {
+			var err error
+			if value, err = sealed.Ciphertext(); err != nil {
+				return nil, fmt.Errorf("history: column %s: %w", field.DBName, err)
+			}
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("history: column %s: %w", field.DBName, err)
+		}
+		snap[field.DBName] = data
+	}
+	return snap, nil
+}
+
+// rows calls fn for each struct of a reflected value.
+func rows(rv reflect.Value, fn func(reflect.Value)) {
+	switch rv = reflect.Indirect(rv); rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			fn(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		fn(rv)
+	}
+}
+
+// load reads the rows the statement applies to, keyed by entity id, on the
+// connection of the statement so it sees the uncommitted changes.
+func load(tx *gorm.DB, where []clause.Expression, unscoped bool) (map[string]row, error) {
+	var stmt = tx.Statement
+	var query = db.UsePrimary(tx.Session(&gorm.Session{NewDB: true, SkipHooks: true})).Table(stmt.Table)
+	if unscoped {
+		query = query.Unscoped()
+	}
+	if len(where) > 0 {
+		query.Statement.AddClause(clause.Where{Exprs: where})
+	}
+	var dest = reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	if err := query.Find(dest.Interface()).Error; err != nil {
+		return nil, err
+	}
+	var result = map[string]row{}
+	var err error
+	rows(dest, func(rv reflect.Value) {
+		if err != nil {
+			return
+		}
+		var snap snapshot
+		if snap, err = takeSnapshot(stmt, rv); err == nil {
+			var key = primaryKey(stmt, rv)
+			result[entityID(key)] = row{key: key, values: snap}
+		}
+	})
+	return result, err
+}
+
+// conditions returns the WHERE of the statement, plus the primary keys of
+// its model and destination like the update and delete callbacks add them.
+func conditions(stmt *gorm.Statement) []clause.Expression {
+	var exprs []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			exprs = append(exprs, where.Exprs...)
+		}
+	}
+	var targets = []reflect.Value{stmt.ReflectValue}
+	if stmt.Model != nil && stmt.Dest != stmt.Model {
+		targets = append(targets, reflect.ValueOf(stmt.Model))
+	}
+	for _, target := range targets {
+		_, queryValues := gschema.GetIdentityFieldValuesMap(stmt.Context, target, stmt.Schema.PrimaryFields)
+		column, values := gschema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			exprs = append(exprs, clause.IN{Column: column, Values: values})
+		}
+	}
+	return exprs
+}
+
+// loadBefore keeps the rows an update or delete is about to change.
+func loadBefore(tx *gorm.DB) {
+	if tx.Error != nil || !tracked(tx.Statement) {
+		return
+	}
+	var where = conditions(tx.Statement)
+	if len(where) == 0 && !tx.AllowGlobalUpdate {
+		return
+	}
+	before, err := load(tx, where, tx.Statement.Unscoped)
+	if err != nil {
+		tx.AddError(err)
+		return
+	}
+	tx.InstanceSet(beforeKey, before)
+}
+
+func before(tx *gorm.DB) map[string]row {
+	v, ok := tx.InstanceGet(beforeKey)
+	if !ok {
+		return nil
+	}
+	return v.(map[string]row)
+}
+
+// reload reads the rows loaded before the statement again, deleted or not.
+func reload(tx *gorm.DB, prev map[string]row) (map[string]row, error) {
+	var fields = tx.Statement.Schema.PrimaryFields
+	var values = make([]any, 0, len(prev))
+	for _, r := range prev {
+		if len(r.key) == 1 {
+			values = append(values, r.key[0])
+		} else {
+			values = append(values, r.key)
+		}
+	}
+	var column any = clause.Column{Table: clause.CurrentTable, Name: fields[0].DBName}
+	if len(fields) > 1 {
+		var cols = make([]clause.Column, len(fields))
+		for i, field := range fields {
+			cols[i] = clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+		}
+		column = cols
+	}
+	return load(tx, []clause.Expression{clause.IN{Column: column, Values: values}}, true)
+}
+
+func recordCreate(tx *gorm.DB) {
+	if tx.Error != nil || !tracked(tx.Statement) {
+		return
+	}
+	var records []Record
+	rows(tx.Statement.ReflectValue, func(rv reflect.Value) {
+		snap, err := takeSnapshot(tx.Statement, rv)
+		if err != nil {
+			tx.AddError(err)
+			return
+		}
+		records = append(records, newRecord(tx, entityID(primaryKey(tx.Statement, rv)), Created, nil, snap))
+	})
+	save(tx, records)
+}
+
+func recordUpdate(tx *gorm.DB) {
+	if tx.Error != nil || !tracked(tx.Statement) {
+		return
+	}
+	var event = Updated
+	if restoring(tx.Statement.Context) {
+		event = Restored
+	}
+	recordChanges(tx, event)
+}
+
+func recordDelete(tx *gorm.DB) {
+	if tx.Error != nil || !tracked(tx.Statement) {
+		return
+	}
+	if len(tx.Statement.Schema.DeleteClauses) > 0 && !tx.Statement.Unscoped {
+		recordChanges(tx, SoftDeleted)
+		return
+	}
+	var records []Record
+	for id, r := range before(tx) {
+		records = append(records, newRecord(tx, id, Deleted, r.values, nil))
+	}
+	save(tx, records)
+}
+
+// recordChanges records the columns that differ between the before
+// snapshots and the rows as they are now.
+func recordChanges(tx *gorm.DB, event Event) {
+	var prev = before(tx)
+	if len(prev) == 0 {
+		return
+	}
+	next, err := reload(tx, prev)
+	if err != nil {
+		tx.AddError(err)
+		return
+	}
+	var records []Record
+	for id, old := range prev {
+		var current, ok = next[id]
+		if !ok {
+			continue
+		}
+		var from, to = snapshot{}, snapshot{}
+		for column, value := range old.values {
+			if !bytes.Equal(value, current.values[column]) {
+				from[column], to[column] = value, current.values[column]
+			}
+		}
+		if len(to) > 0 {
+			records = append(records, newRecord(tx, id, event, from, to))
+		}
+	}
+	save(tx, records)
+}
+
+func newRecord(tx *gorm.DB, id string, event Event, from, to snapshot) Record {
+	var actor, requestID = actorOf(tx.Statement.Context)
+	var record = Record{
+		Table:     tx.Statement.Table,
+		EntityID:  id,
+		Event:     event,
+		ActorID:   actor.ID,
+		ActorName: actor.Name,
+		RequestID: requestID,
+		CreatedAt: time.Now(),
+	}
+	if from != nil {
+		record.Before, _ = json.Marshal(from)
+	}
+	if to != nil {
+		record.After, _ = json.Marshal(to)
+	}
+	return record
+}
+
+// save writes the records on the connection of the statement, so they are
+// part of its transaction.
+func save(tx *gorm.DB, records []Record) {
+	if len(records) == 0 || tx.Error != nil {
+		return
+	}
+	if err := tx.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Create(&records).Error; err != nil {
+		tx.AddError(fmt.Errorf("history: %w", err))
+	}
+}
@@ -0,0 +1,177 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrWrongModel is returned by Restore for a record of another table than
+	// the one of the model.
+	ErrWrongModel = errors.New("history: record belongs to another model")
+
+	// ErrNothingToRestore is returned by Restore for a record after which the
+	// row did not exist, such as a hard delete.
+	ErrNothingToRestore = errors.New("history: row did not exist after that change")
+)
+
+// Timeline returns the changes of the row of model with the given primary
+// key, oldest first. Composite keys are given in the order of the fields.
+func Timeline(tx *gorm.DB, model any, id ...any) ([]Record, error) {
+	stmt, err := parse(tx, model)
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	err = tx.Session(&gorm.Session{NewDB: true}).Where("table_name = ? AND entity_id = ?", stmt.Table, entityID(id)).Order("id").Find(&records).Error
+	return records, err
+}
+
+// Restore brings the row changed by the record back to its state right
+// after that change, undoing the later changes. model is a value of the
+// model of the row. The restore is itself recorded, as a restore event, or
+// as a create when the row had been hard deleted since.
+func Restore(tx *gorm.DB, model any, recordID uint64) error {
+	stmt, err := parse(tx, model)
+	if err != nil {
+		return err
+	}
+	tx = tx.Session(&gorm.Session{NewDB: true})
+	var record Record
+	if err = tx.Take(&record, recordID).Error; err != nil {
+		return err
+	}
+	if record.Table != stmt.Table {
+		return fmt.Errorf("%w: record %d is on %s, not %s", ErrWrongModel, recordID, record.Table, stmt.Table)
+	}
+	var key = splitEntityID(record.EntityID)
+	if len(key) != len(stmt.Schema.PrimaryFields) {
+		return fmt.Errorf("history: entity id %q does not match the primary key of %s", record.EntityID, stmt.Table)
+	}
+
+	var current = reflect.New(stmt.Schema.ModelType)
+	var query = tx.Unscoped()
+	for i, field := range stmt.Schema.PrimaryFields {
+		query = query.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: key[i]})
+	}
+	err = query.Take(current.Interface()).Error
+	var exists = err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	var state snapshot
+	if exists {
+		if state, err = takeSnapshot(stmt, current.Elem()); err != nil {
+			return err
+		}
+	}
+
+	var later []Record
+	err = tx.Where("table_name = ? AND entity_id = ? AND id > ?", record.Table, record.EntityID, record.ID).Order("id DESC").Find(&later).Error
+	if err != nil {
+		return err
+	}
+	for _, change := range later {
+		state, err = undo(state, change)
+		if err != nil {
+			return err
+		}
+	}
+	if state == nil {
+		return ErrNothingToRestore
+	}
+
+	var target = reflect.New(stmt.Schema.ModelType)
+	for i, field := range stmt.Schema.PrimaryFields {
+		if err = field.Set(stmt.Context, target.Elem(), key[i]); err != nil {
+			return err
+		}
+	}
+	var selected []string
+	for _, field := range columns(stmt.Schema) {
+		data, ok := state[field.DBName]
+		if !ok {
+			continue
+		}
+		var value = reflect.New(field.FieldType)
+		if err = decode(data, value.Interface()); err != nil {
+			return fmt.Errorf("history: column %s: %w", field.DBName, err)
+		}
+		if err = field.Set(stmt.Context, target.Elem(), value.Elem().Interface()); err != nil {
+			return err
+		}
+		selected = append(selected, field.DBName)
+	}
+
+	var save = tx.WithContext(context.WithValue(tx.Statement.Context, restoreKey{}, true)).Unscoped()
+	if !exists {
+		return save.Create(target.Interface()).Error
+	}
+	return save.Model(target.Interface()).Select(selected).Updates(target.Interface()).Error
+}
+
+// decode sets dest to a recorded column value, scanning the ciphertext of
+// the columns recorded by it.
+func decode(data json.RawMessage, dest any) error {
+	scanner, ok := dest.(sql.Scanner)
+	if _, sealed := dest.(sealedValue); !ok || !sealed {
+		return json.Unmarshal(data, dest)
+	}
+	var ciphertext *string
+	if err := json.Unmarshal(data, &ciphertext); err != nil {
+		return err
+	}
+	if ciphertext == nil {
+		return scanner.Scan(nil)
+	}
+	return scanner.Scan(*ciphertext)
+}
+
+// undo returns the state of a row before the change, given its state after.
+func undo(state snapshot, change Record) (snapshot, error) {
+	switch change.Event {
+	case Created:
+		return nil, nil
+	case Deleted:
+		state = nil
+	}
+	var before snapshot
+	if len(change.Before) > 0 {
+		if err := json.Unmarshal(change.Before, &before); err != nil {
+			return nil, fmt.Errorf("history: record %d: %w", change.ID, err)
+		}
+	}
+	if state == nil {
+		state = snapshot{}
+	}
+	for column, value := range before {
+		state[column] = value
+	}
+	return state, nil
+}
+
+func restoring(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, _ := ctx.Value(restoreKey{}).(bool)
+	return v
+}
+
+func parse(tx *gorm.DB, model any) (*gorm.Statement, error) {
+	var stmt = &gorm.Statement{DB: tx, Context: tx.Statement.Context}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	if len(stmt.Schema.PrimaryFields) == 0 {
+		return nil, fmt.Errorf("history: %s has no primary key", stmt.Table)
+	}
+	return stmt, nil
+}
@@ -0,0 +1,542 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/log"
+	"gorm.io/gorm"
+)
+
+// LockKeepAlive is how often a held lock checks that the database still
+// holds it, and renews it on the databases using the lock table.
+var LockKeepAlive = 5 * time.Second
+
+// LockTable is the table holding the locks on the databases without
+// advisory locks.
+const LockTable = "evo_locks"
+
+// ErrLockTimeout is returned by Lock when the lock is still held by another
+// session at the end of the timeout.
+var ErrLockTimeout = errors.New("lock not acquired before the timeout")
+
+// errLockLost is reported when the database no longer holds the lock.
+var errLockLost = errors.New("lock is no longer held")
+
+// DistributedLock is a lock held in the database, shared by every instance
+// of the application using the same name. It is held until Release, or
+// until the session holding it is lost.
+type DistributedLock struct {
+	name     string
+	backend  lockBackend
+	interval time.Duration
+	mu       sync.Mutex
+	released bool
+	lost     chan struct{}
+	stop     chan struct{}
+}
+
+// lockBackend holds a lock of one kind of database.
+type lockBackend interface {
+	// tryAcquire takes the lock if it is free.
+	tryAcquire(ctx context.Context) (bool, error)
+	// acquire waits up to timeout for the lock, forever when timeout <= 0.
+	acquire(ctx context.Context, timeout time.Duration) (bool, error)
+	// check returns an error once the lock is no longer held.
+	check(ctx context.Context) error
+	// release gives the lock up and frees the session.
+	release(ctx context.Context) error
+	// close frees the session of a lock that was not acquired or was lost.
+	close()
+}
+
+// Lock waits up to timeout for the lock name, or until ctx is done when
+// timeout is zero, and returns ErrLockTimeout when another instance still
+// holds it:
+//
+//	lock, err := db.Lock(ctx, "invoices:send", 10*time.Second)
+//	if err != nil {
+//	    return err
+//	}
+//	defer lock.Release()
+//
+// MySQL uses GET_LOCK and PostgreSQL a session advisory lock, both held by a
+// dedicated connection and released by the database if it is lost. The
+// other databases use a row of the evo_locks table, renewed every
+// LockKeepAlive and taken over once it expired.
+func Lock(ctx context.Context, name string, timeout time.Duration) (*DistributedLock, error) {
+	return LockOn(ctx, db, name, timeout)
+}
+
+// TryLock takes the lock name if it is free, and returns false without
+// waiting when another instance holds it.
+func TryLock(ctx context.Context, name string) (*DistributedLock, bool, error) {
+	return TryLockOn(ctx, db, name)
+}
+
+// LockOn is Lock on the database of conn.
+func LockOn(ctx context.Context, conn *gorm.DB, name string, timeout time.Duration) (*DistributedLock, error) {
+	backend, err := newLockBackend(ctx, conn, name)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := backend.acquire(ctx, timeout)
+	if err == nil && !ok {
+		err = ErrLockTimeout
+	}
+	if err != nil {
+		backend.close()
+		return nil, fmt.Errorf("lock %s: %w", name, err)
+	}
+	return newDistributedLock(name, backend), nil
+}
+
+// TryLockOn is TryLock on the database of conn.
+func TryLockOn(ctx context.Context, conn *gorm.DB, name string) (*DistributedLock, bool, error) {
+	backend, err := newLockBackend(ctx, conn, name)
+	if err != nil {
+		return nil, false, err
+	}
+	ok, err := backend.tryAcquire(ctx)
+	if err != nil || !ok {
+		backend.close()
+		if err != nil {
+			err = fmt.Errorf("lock %s: %w", name, err)
+		}
+		return nil, false, err
+	}
+	return newDistributedLock(name, backend), true, nil
+}
+
+func newLockBackend(ctx context.Context, conn *gorm.DB, name string) (lockBackend, error) {
+	switch conn.Dialector.Name() {
+	case "mysql", "postgres":
+		pool, err := conn.DB()
+		if err != nil {
+			return nil, err
+		}
+		// session locks belong to the connection that took them
+		c, err := pool.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if conn.Dialector.Name() == "mysql" {
+			// lock names are limited to 64 characters
+			return &mysqlLock{conn: c, key: schema.SafeIndexName(name, 64)}, nil
+		}
+		var h = fnv.New64a()
+		h.Write([]byte(name))
+		return &pgLock{conn: c, key: int64(h.Sum64())}, nil
+	}
+	var owner = make([]byte, 16)
+	if _, err := rand.Read(owner); err != nil {
+		return nil, err
+	}
+	return &tableLock{db: UsePrimary(conn.Session(&gorm.Session{NewDB: true})), name: name, owner: hex.EncodeToString(owner), interval: LockKeepAlive}, nil
+}
+
+func newDistributedLock(name string, backend lockBackend) *DistributedLock {
+	var l = &DistributedLock{name: name, backend: backend, interval: LockKeepAlive, lost: make(chan struct{}), stop: make(chan struct{})}
+	go l.keepAlive()
+	return l
+}
+
+// Name returns the name of the lock.
+func (l *DistributedLock) Name() string {
+	return l.name
+}
+
+// Lost returns a channel closed when the lock was lost without being
+// released, for example because the connection holding it was closed.
+func (l *DistributedLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release gives the lock up. Releasing a lock twice, or a lost lock, does
+// nothing.
+func (l *DistributedLock) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return nil
+	}
+	l.released = true
+	close(l.stop)
+	ctx, cancel := context.WithTimeout(context.Background(), l.interval)
+	defer cancel()
+	return l.backend.release(ctx)
+}
+
+func (l *DistributedLock) keepAlive() {
+	var ticker = time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if !l.alive() {
+				return
+			}
+		}
+	}
+}
+
+// alive checks the lock is still held, and marks it lost otherwise.
+func (l *DistributedLock) alive() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.interval)
+	defer cancel()
+	if err := l.backend.check(ctx); err != nil {
+		log.Warning("distributed lock lost", "name", l.name, "error", err)
+		l.released = true
+		l.backend.close()
+		close(l.lost)
+		return false
+	}
+	return true
+}
+
+// mysqlLock is a MySQL GET_LOCK lock.
+type mysqlLock struct {
+	conn *sql.Conn
+	key  string
+}
+
+func (m *mysqlLock) getLock(ctx context.Context, seconds int64) (bool, error) {
+	var result sql.NullInt64
+	if err := m.conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", m.key, seconds).Scan(&result); err != nil {
+		return false, err
+	}
+	if !result.Valid {
+		return false, errors.New("GET_LOCK failed")
+	}
+	return result.Int64 == 1, nil
+}
+
+func (m *mysqlLock) tryAcquire(ctx context.Context) (bool, error) {
+	return m.getLock(ctx, 0)
+}
+
+func (m *mysqlLock) acquire(ctx context.Context, timeout time.Duration) (bool, error) {
+	// a negative timeout waits forever
+	var seconds = int64(-1)
+	if timeout > 0 {
+		seconds = int64(math.Ceil(timeout.Seconds()))
+	}
+	return m.getLock(ctx, seconds)
+}
+
+func (m *mysqlLock) check(ctx context.Context) error {
+	var owned sql.NullInt64
+	if err := m.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", m.key).Scan(&owned); err != nil {
+		return err
+	}
+	if owned.Int64 != 1 {
+		return errLockLost
+	}
+	return nil
+}
+
+func (m *mysqlLock) release(ctx context.Context) error {
+	defer m.close()
+	_, err := m.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", m.key)
+	return err
+}
+
+func (m *mysqlLock) close() {
+	m.conn.Close()
+}
+
+// pgLock is a PostgreSQL session advisory lock on the hash of its name.
+type pgLock struct {
+	conn *sql.Conn
+	key  int64
+}
+
+func (p *pgLock) tryAcquire(ctx context.Context) (bool, error) {
+	var ok bool
+	err := p.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", p.key).Scan(&ok)
+	return ok, err
+}
+
+func (p *pgLock) acquire(ctx context.Context, timeout time.Duration) (bool, error) {
+	if timeout > 0 {
+		if _, err := p.conn.ExecContext(ctx, fmt.Sprintf("SET lock_timeout = %d", max(timeout.Milliseconds(), 1))); err != nil {
+			return false, err
+		}
+		defer p.conn.ExecContext(context.Background(), "RESET lock_timeout")
+	}
+	if _, err := p.conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", p.key); err != nil {
+		var state interface{ SQLState() string }
+		if errors.As(err, &state) && state.SQLState() == "55P03" {
+			// lock_not_available
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (p *pgLock) check(ctx context.Context) error {
+	// a bigint key is stored as its high and low 32 bits
+	var held bool
+	err := p.conn.QueryRowContext(ctx, `SELECT EXISTS (
+		SELECT 1 FROM pg_locks
+		WHERE locktype = 'advisory' AND granted AND pid = pg_backend_pid()
+		  AND ((classid::bigint << 32) | objid::bigint) = $1)`, p.key).Scan(&held)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return errLockLost
+	}
+	return nil
+}
+
+func (p *pgLock) release(ctx context.Context) error {
+	defer p.close()
+	_, err := p.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", p.key)
+	return err
+}
+
+func (p *pgLock) close() {
+	p.conn.Close()
+}
+
+// lockRow is a lock of the lock table.
+type lockRow struct {
+	Name      string    `gorm:"column:name;primaryKey;size:191"`
+	Owner     string    `gorm:"column:owner;size:32"`
+	ExpiresAt time.Time `gorm:"column:expires_at"`
+}
+
+func (lockRow) TableName() string {
+	return LockTable
+}
+
+var lockTables sync.Map
+
+// tableLock is a row of the lock table, leased for three LockKeepAlive
+// periods and renewed while held.
+type tableLock struct {
+	db       *gorm.DB
+	name     string
+	owner    string
+	interval time.Duration
+}
+
+func (t *tableLock) lease() time.Time {
+	return time.Now().UTC().Add(3 * t.interval)
+}
+
+func (t *tableLock) tryAcquire(ctx context.Context) (bool, error) {
+	var tx = t.db.WithContext(ctx)
+	if pool, err := tx.DB(); err == nil {
+		if _, created := lockTables.Load(pool); !created {
+			if err := tx.Migrator().AutoMigrate(&lockRow{}); err != nil {
+				return false, err
+			}
+			lockTables.Store(pool, true)
+		}
+	}
+	// take over a lease its owner failed to renew
+	if err := tx.Where("name = ? AND expires_at < ?", t.name, time.Now().UTC()).Delete(&lockRow{}).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Create(&lockRow{Name: t.name, Owner: t.owner, ExpiresAt: t.lease()}).Error; err != nil {
+		var count int64
+		if tx.Model(&lockRow{}).Where("name = ?", t.name).Count(&count); count > 0 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (t *tableLock) acquire(ctx context.Context, timeout time.Duration) (bool, error) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		var timer = time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	var poll = min(t.interval/10, 500*time.Millisecond)
+	for {
+		if ok, err := t.tryAcquire(ctx); ok || err != nil {
+			return ok, err
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-deadline:
+			return false, nil
+		case <-time.After(poll):
+		}
+	}
+}
+
+func (t *tableLock) check(ctx context.Context) error {
+	var tx = t.db.WithContext(ctx).Model(&lockRow{}).Where("name = ? AND owner = ?", t.name, t.owner).Update("expires_at", t.lease())
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected != 1 {
+		return errLockLost
+	}
+	return nil
+}
+
+func (t *tableLock) release(ctx context.Context) error {
+	return t.db.WithContext(ctx).Where("name = ? AND owner = ?", t.name, t.owner).Delete(&lockRow{}).Error
+}
+
+func (t *tableLock) close() {}
+
+// Election elects one leader among the instances of the application
+// running it with the same name, see LeaderElection.
+type Election struct {
+	// RetryInterval is how often a follower tries to become the leader,
+	// LockKeepAlive by default.
+	RetryInterval time.Duration
+
+	conn    *gorm.DB
+	name    string
+	mu      sync.Mutex
+	elected []func(ctx context.Context)
+	revoked []func()
+	leader  bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// LeaderElection returns the election of the leader among the instances
+// using name. The leader holds the lock name until it stops or its session
+// is lost, when another instance takes over:
+//
+//	db.LeaderElection("scheduler").
+//	    OnElected(func(ctx context.Context) { go runScheduler(ctx) }).
+//	    OnRevoked(func() { log.Warning("no longer the scheduler") }).
+//	    Start(ctx)
+func LeaderElection(name string) *Election {
+	return LeaderElectionOn(db, name)
+}
+
+// LeaderElectionOn is LeaderElection on the database of conn.
+func LeaderElectionOn(conn *gorm.DB, name string) *Election {
+	return &Election{conn: conn, name: name}
+}
+
+// OnElected registers fn to run when the instance becomes the leader. The
+// context is cancelled when it stops being the leader; fn must not block.
+func (e *Election) OnElected(fn func(ctx context.Context)) *Election {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.elected = append(e.elected, fn)
+	return e
+}
+
+// OnRevoked registers fn to run when the instance stops being the leader.
+func (e *Election) OnRevoked(fn func()) *Election {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.revoked = append(e.revoked, fn)
+	return e
+}
+
+// IsLeader reports whether the instance is currently the leader.
+func (e *Election) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Start runs the election in the background until ctx is done or Stop.
+// Starting a running election does nothing.
+func (e *Election) Start(ctx context.Context) *Election {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done != nil {
+		return e
+	}
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+	go e.run(ctx, e.done)
+	return e
+}
+
+// Stop gives the leadership up and ends the election.
+func (e *Election) Stop() {
+	e.mu.Lock()
+	var cancel, done = e.cancel, e.done
+	e.cancel, e.done = nil, nil
+	e.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+func (e *Election) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	for {
+		lock, ok, err := TryLockOn(ctx, e.conn, e.name)
+		if err != nil && ctx.Err() == nil {
+			log.Error("leader election failed", "name", e.name, "error", err)
+		}
+		if ok {
+			e.lead(ctx, lock)
+		}
+		var retry = e.RetryInterval
+		if retry <= 0 {
+			retry = LockKeepAlive
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// lead keeps the leadership until the lock is lost or ctx is done.
+func (e *Election) lead(ctx context.Context, lock *DistributedLock) {
+	var leaderCtx, cancel = context.WithCancel(ctx)
+	e.mu.Lock()
+	e.leader = true
+	var elected, revoked = append([]func(context.Context){}, e.elected...), append([]func(){}, e.revoked...)
+	e.mu.Unlock()
+	log.Info("elected leader", "name", e.name)
+	for _, fn := range elected {
+		fn(leaderCtx)
+	}
+
+	select {
+	case <-lock.Lost():
+	case <-ctx.Done():
+	}
+	cancel()
+	if err := lock.Release(); err != nil {
+		log.Error("failed to release the leadership", "name", e.name, "error", err)
+	}
+	e.mu.Lock()
+	e.leader = false
+	e.mu.Unlock()
+	log.Info("leadership revoked", "name", e.name)
+	for _, fn := range revoked {
+		fn()
+	}
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openLockTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "lock.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keepAlive := LockKeepAlive
+	LockKeepAlive = 50 * time.Millisecond
+	t.Cleanup(func() { LockKeepAlive = keepAlive })
+	return conn
+}
+
+func TestTryLock(t *testing.T) {
+	conn := openLockTestDB(t)
+	ctx := context.Background()
+
+	lock, ok, err := TryLockOn(ctx, conn, "report")
+	if err != nil || !ok {
+		t.Fatalf("expected the lock, got %t, %v", ok, err)
+	}
+	if _, ok, _ := TryLockOn(ctx, conn, "report"); ok {
+		t.Fatal("expected the held lock to be refused")
+	}
+	if other, ok, _ := TryLockOn(ctx, conn, "invoices"); !ok {
+		t.Fatal("expected another name to be free")
+	} else {
+		other.Release()
+	}
+
+	// the lease is renewed while held
+	time.Sleep(5 * LockKeepAlive)
+	if _, ok, _ := TryLockOn(ctx, conn, "report"); ok {
+		t.Fatal("expected the renewed lock to be refused")
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("expected a second release to do nothing, got %v", err)
+	}
+	again, ok, _ := TryLockOn(ctx, conn, "report")
+	if !ok {
+		t.Fatal("expected the released lock to be free")
+	}
+	again.Release()
+}
+
+func TestLockTimeout(t *testing.T) {
+	conn := openLockTestDB(t)
+	ctx := context.Background()
+
+	held, err := LockOn(ctx, conn, "report", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LockOn(ctx, conn, "report", 100*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected ErrLockTimeout, got %v", err)
+	}
+
+	time.AfterFunc(100*time.Millisecond, func() { held.Release() })
+	lock, err := LockOn(ctx, conn, "report", 2*time.Second)
+	if err != nil {
+		t.Fatalf("expected the lock once released, got %v", err)
+	}
+	lock.Release()
+}
+
+func TestLockLost(t *testing.T) {
+	conn := openLockTestDB(t)
+	lock, _, err := TryLockOn(context.Background(), conn, "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Exec("DELETE FROM " + LockTable)
+
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("expected the lock to be lost")
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("expected releasing a lost lock to do nothing, got %v", err)
+	}
+
+	// an expired lease is taken over
+	conn.Exec("INSERT INTO "+LockTable+" (name, owner, expires_at) VALUES (?, ?, ?)", "stale", "gone", time.Now().UTC().Add(-time.Minute))
+	if stale, ok, _ := TryLockOn(context.Background(), conn, "stale"); !ok {
+		t.Fatal("expected the expired lock to be taken over")
+	} else {
+		stale.Release()
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	conn := openLockTestDB(t)
+	ctx := context.Background()
+
+	var elected, revoked atomic.Int32
+	var leaderCtx atomic.Value
+	newElection := func() *Election {
+		e := LeaderElectionOn(conn, "scheduler")
+		e.RetryInterval = 20 * time.Millisecond
+		return e.OnElected(func(ctx context.Context) {
+			elected.Add(1)
+			leaderCtx.Store(ctx)
+		}).OnRevoked(func() { revoked.Add(1) })
+	}
+	first, second := newElection().Start(ctx), newElection().Start(ctx)
+	t.Cleanup(func() { first.Stop(); second.Stop() })
+
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out")
+			}
+		}
+	}
+	waitFor(func() bool { return first.IsLeader() || second.IsLeader() })
+	time.Sleep(100 * time.Millisecond)
+	if first.IsLeader() == second.IsLeader() || elected.Load() != 1 {
+		t.Fatalf("expected exactly one leader, got %t, %t after %d elections", first.IsLeader(), second.IsLeader(), elected.Load())
+	}
+
+	leader, follower := first, second
+	if second.IsLeader() {
+		leader, follower = second, first
+	}
+	firstCtx := leaderCtx.Load().(context.Context)
+	leader.Stop()
+	if revoked.Load() != 1 || firstCtx.Err() == nil {
+		t.Fatal("expected the stopped leader revoked and its context cancelled")
+	}
+	waitFor(follower.IsLeader)
+	if elected.Load() != 2 {
+		t.Errorf("expected the follower elected, got %d elections", elected.Load())
+	}
+}
@@ -0,0 +1,191 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/log"
+	"gorm.io/gorm"
+)
+
+// Plugin times every statement of a connection and adds it to the stats of
+// its context. Register it with db.Use, and Middleware on the application.
+type Plugin struct {
+	// SlowThreshold marks the statements slower than that as slow. 0
+	// disables it.
+	SlowThreshold time.Duration
+
+	// Explain logs the EXPLAIN plan of the slow SELECT statements.
+	Explain bool
+
+	// NPlusOne warns when the same statement, its values aside, runs that
+	// many times in one request, with the place it is called from. 0
+	// disables the detection.
+	NPlusOne int
+}
+
+const startKey = "evo:profile_start"
+
+type explainKey struct{}
+
+// Name implements gorm.Plugin.
+func (Plugin) Name() string {
+	return "evo:profile"
+}
+
+// Initialize implements gorm.Plugin.
+func (p Plugin) Initialize(db *gorm.DB) error {
+	var callbacks = db.Callback()
+	var steps = []struct {
+		name     string
+		register func(name string, fn func(*gorm.DB)) error
+		fn       func(*gorm.DB)
+	}{
+		{"evo:profile_start", callbacks.Create().Before("*").Register, start},
+		{"evo:profile_record", callbacks.Create().After("*").Register, p.record},
+		{"evo:profile_start", callbacks.Query().Before("*").Register, start},
+		{"evo:profile_record", callbacks.Query().After("*").Register, p.record},
+		{"evo:profile_start", callbacks.Update().Before("*").Register, start},
+		{"evo:profile_record", callbacks.Update().After("*").Register, p.record},
+		{"evo:profile_start", callbacks.Delete().Before("*").Register, start},
+		{"evo:profile_record", callbacks.Delete().After("*").Register, p.record},
+		{"evo:profile_start", callbacks.Row().Before("*").Register, start},
+		{"evo:profile_record", callbacks.Row().After("*").Register, p.record},
+		{"evo:profile_start", callbacks.Raw().Before("*").Register, start},
+		{"evo:profile_record", callbacks.Raw().After("*").Register, p.record},
+	}
+	for _, step := range steps {
+		if err := step.register(step.name, step.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func (p Plugin) record(db *gorm.DB) {
+	value, ok := db.InstanceGet(startKey)
+	if !ok {
+		return
+	}
+	var duration = time.Since(value.(time.Time))
+	var ctx = db.Statement.Context
+	if ctx == nil || ctx.Value(explainKey{}) != nil {
+		return
+	}
+	var sql = db.Statement.SQL.String()
+	if sql == "" {
+		return
+	}
+	var slow = p.SlowThreshold > 0 && duration >= p.SlowThreshold
+	var stats = FromContext(ctx)
+	if stats == nil && !(slow && p.Explain) {
+		return
+	}
+
+	var q = Query{SQL: sql, Duration: duration, Rows: db.Statement.RowsAffected, Caller: caller()}
+	if stats != nil {
+		var normalized = Normalize(sql)
+		if n := stats.record(q, normalized); p.NPlusOne > 0 && n >= p.NPlusOne && stats.report(normalized) {
+			log.Warning("possible N+1 query: the same statement ran repeatedly in one request",
+				"count", n, "sql", normalized, "caller", q.Caller)
+		}
+	}
+	if slow && p.Explain && db.Error == nil {
+		if plan := explain(db, sql); plan != "" {
+			log.Warning("slow query", "duration", duration, "sql", sql, "caller", q.Caller, "plan", plan)
+		}
+	}
+}
+
+// explain returns the plan of a SELECT statement, one row per line.
+func explain(db *gorm.DB, sql string) string {
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(sql)), "SELECT") {
+		return ""
+	}
+	var prefix = "EXPLAIN "
+	if db.Dialector.Name() == "sqlite" {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+	var ctx = context.WithValue(db.Statement.Context, explainKey{}, true)
+	rows, err := db.Session(&gorm.Session{NewDB: true, Context: ctx}).Raw(prefix+sql, db.Statement.Vars...).Rows()
+	if err != nil {
+		return ""
+	}
+	defer rows.Close()
+	columns, _ := rows.Columns()
+	var lines []string
+	for rows.Next() {
+		var values = make([]any, len(columns))
+		var pointers = make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if rows.Scan(pointers...) != nil {
+			return ""
+		}
+		var cells = make([]string, len(values))
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			cells[i] = strings.TrimSpace(toString(v))
+		}
+		lines = append(lines, strings.Join(cells, " | "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func toString(v any) string {
+	if v == nil {
+		return "NULL"
+	}
+	return fmt.Sprint(v)
+}
+
+var (
+	normalizeStrings      = regexp.MustCompile(`'(?:[^']|'')*'`)
+	normalizePlaceholders = regexp.MustCompile(`\$\d+|@p\d+`)
+	normalizeNumbers      = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	normalizeLists        = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	normalizeSpaces       = regexp.MustCompile(`\s+`)
+)
+
+// Normalize returns sql with its values replaced by ?, and lists of values
+// collapsed, so that the same statement run with other values normalizes
+// to the same string.
+func Normalize(sql string) string {
+	sql = normalizeStrings.ReplaceAllString(sql, "?")
+	sql = normalizePlaceholders.ReplaceAllString(sql, "?")
+	sql = normalizeNumbers.ReplaceAllString(sql, "?")
+	sql = normalizeLists.ReplaceAllString(sql, "(?)")
+	return strings.TrimSpace(normalizeSpaces.ReplaceAllString(sql, " "))
+}
+
+// caller returns the file and line of the application code that ran the
+// statement, skipping GORM and the evo database wrappers.
+func caller() string {
+	var pcs [32]uintptr
+	var n = runtime.Callers(3, pcs[:])
+	var frames = runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		var internal = strings.HasPrefix(frame.Function, "gorm.io/") ||
+			strings.HasPrefix(frame.Function, "github.com/getevo/evo/v2/lib/db") ||
+			strings.HasPrefix(frame.Function, "runtime.")
+		if !internal || strings.HasSuffix(frame.File, "_test.go") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Package profile measures the database work of each request: the number of
+// statements, the time spent in the database and the slowest statements. It
+// can log the EXPLAIN plan of slow queries, warn about N+1 patterns (the
+// same statement repeated in a loop) and report the database time in a
+// Server-Timing header.
+package profile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/log"
+	"github.com/gofiber/fiber/v3"
+)
+
+// Query is a statement run during a request.
+type Query struct {
+	SQL      string        `json:"sql"`
+	Duration time.Duration `json:"duration"`
+	Rows     int64         `json:"rows"`
+	Caller   string        `json:"caller"`
+}
+
+// Repeat is a statement run several times during a request, the usual
+// sign of an N+1 pattern.
+type Repeat struct {
+	SQL    string        `json:"sql"`
+	Count  int           `json:"count"`
+	Total  time.Duration `json:"total"`
+	Caller string        `json:"caller"`
+}
+
+// Stats collects the statements of a request, or of any context carrying
+// it. It is safe for concurrent use.
+type Stats struct {
+	mu       sync.Mutex
+	keep     int
+	count    int
+	total    time.Duration
+	slowest  []Query
+	repeats  map[string]*Repeat
+	reported map[string]bool
+}
+
+// NewStats returns stats keeping the slowest keep statements, 5 when keep
+// is 0.
+func NewStats(keep int) *Stats {
+	if keep <= 0 {
+		keep = 5
+	}
+	return &Stats{keep: keep, repeats: map[string]*Repeat{}, reported: map[string]bool{}}
+}
+
+type statsKey struct{}
+
+// WithStats returns a context collecting the statements run with it.
+func WithStats(ctx context.Context, stats *Stats) context.Context {
+	return context.WithValue(ctx, statsKey{}, stats)
+}
+
+// FromContext returns the stats carried by ctx, or nil.
+func FromContext(ctx context.Context) *Stats {
+	if ctx == nil {
+		return nil
+	}
+	stats, _ := ctx.Value(statsKey{}).(*Stats)
+	return stats
+}
+
+// record adds a statement and returns how many times its normalized form
+// has run so far.
+func (s *Stats) record(q Query, normalized string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.total += q.Duration
+
+	var i = sort.Search(len(s.slowest), func(i int) bool { return s.slowest[i].Duration < q.Duration })
+	if i < s.keep {
+		s.slowest = append(s.slowest, Query{})
+		copy(s.slowest[i+1:], s.slowest[i:])
+		s.slowest[i] = q
+		if len(s.slowest) > s.keep {
+			s.slowest = s.slowest[:s.keep]
+		}
+	}
+
+	var repeat, ok = s.repeats[normalized]
+	if !ok {
+		repeat = &Repeat{SQL: normalized, Caller: q.Caller}
+		s.repeats[normalized] = repeat
+	}
+	repeat.Count++
+	repeat.Total += q.Duration
+	return repeat.Count
+}
+
+// report reports whether the N+1 warning of a statement is due, once.
+func (s *Stats) report(normalized string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reported[normalized] {
+		return false
+	}
+	s.reported[normalized] = true
+	return true
+}
+
+// Count returns the number of statements.
+func (s *Stats) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Duration returns the time spent in the database.
+func (s *Stats) Duration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// Slowest returns the slowest statements, slowest first.
+func (s *Stats) Slowest() []Query {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Query(nil), s.slowest...)
+}
+
+// Repeated returns the statements run at least min times, most repeated
+// first.
+func (s *Stats) Repeated(min int) []Repeat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []Repeat
+	for _, repeat := range s.repeats {
+		if repeat.Count >= min {
+			result = append(result, *repeat)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].SQL < result[j].SQL
+	})
+	return result
+}
+
+// MiddlewareConfig configures Middleware.
+type MiddlewareConfig struct {
+	// Slowest is the number of slowest statements kept per request, 5 by
+	// default.
+	Slowest int
+
+	// ServerTiming adds a Server-Timing header with the database time and
+	// the number of statements, for the browser developer tools.
+	ServerTiming bool
+
+	// Log logs the stats of each request that ran statements, at debug
+	// level.
+	Log bool
+}
+
+// Middleware collects the stats of each request on its context, so that
+// the statements run with evo.GetDB(r.Context()) are counted.
+func Middleware(config MiddlewareConfig) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var stats = NewStats(config.Slowest)
+		var parent = c.Context()
+		c.SetContext(WithStats(parent, stats))
+		err := c.Next()
+		c.SetContext(parent)
+
+		var count = stats.Count()
+		if config.ServerTiming {
+			c.Append(fiber.HeaderServerTiming, ServerTiming(stats))
+		}
+		if config.Log && count > 0 {
+			var params = []any{"method", c.Method(), "path", c.Path(), "queries", count, "duration", stats.Duration()}
+			if slowest := stats.Slowest(); len(slowest) > 0 {
+				params = append(params, "slowest", slowest[0].SQL, "slowest_duration", slowest[0].Duration)
+			}
+			log.Debug("request database stats", params...)
+		}
+		return err
+	}
+}
+
+// ServerTiming returns the Server-Timing metric of stats, such as
+// db;dur=12.5;desc="4 queries".
+func ServerTiming(stats *Stats) string {
+	var count = stats.Count()
+	var unit = "queries"
+	if count == 1 {
+		unit = "query"
+	}
+	return fmt.Sprintf(`db;dur=%.3f;desc="%d %s"`, float64(stats.Duration().Microseconds())/1000, count, unit)
+}
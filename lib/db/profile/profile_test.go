@@ -0,0 +1,166 @@
+package profile_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/db/profile"
+	"github.com/getevo/evo/v2/lib/log"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type item struct {
+	ID     uint `gorm:"primaryKey"`
+	Name   string
+	Parent uint
+}
+
+func openDB(t *testing.T, plugin profile.Plugin) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "profile.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.AutoMigrate(&item{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err = db.Use(plugin); err != nil {
+		t.Fatalf("use: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		db.Create(&item{Name: "item", Parent: uint(i % 2)})
+	}
+	return db
+}
+
+// captureLog collects the warnings logged during the test.
+func captureLog(t *testing.T) func() []*log.Entry {
+	var mu sync.Mutex
+	var entries []*log.Entry
+	log.SetWriters(func(e *log.Entry) {
+		mu.Lock()
+		entries = append(entries, e)
+		mu.Unlock()
+	})
+	t.Cleanup(func() { log.SetWriters(log.StdWriter) })
+	return func() []*log.Entry {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*log.Entry(nil), entries...)
+	}
+}
+
+func field(e *log.Entry, key string) string {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			if s, ok := f.Value.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func TestNormalize(t *testing.T) {
+	var cases = map[string]string{
+		"SELECT * FROM items WHERE id = 3":                       "SELECT * FROM items WHERE id = ?",
+		"SELECT * FROM items WHERE name = 'it''s'  AND t1.x = 2": "SELECT * FROM items WHERE name = ? AND t1.x = ?",
+		`SELECT * FROM "items" WHERE "id" IN ($1,$2,$3)`:         `SELECT * FROM "items" WHERE "id" IN (?)`,
+		"SELECT * FROM items WHERE id IN (?, ?) LIMIT 10":        "SELECT * FROM items WHERE id IN (?) LIMIT ?",
+	}
+	for sql, want := range cases {
+		if got := profile.Normalize(sql); got != want {
+			t.Errorf("%s: expected %q, got %q", sql, want, got)
+		}
+	}
+}
+
+func TestStatsAndNPlusOne(t *testing.T) {
+	db := openDB(t, profile.Plugin{NPlusOne: 3})
+	entries := captureLog(t)
+
+	var stats = profile.NewStats(2)
+	var ctx = profile.WithStats(context.Background(), stats)
+	var parents []item
+	db.WithContext(ctx).Find(&parents)
+	for _, parent := range parents {
+		var children []item
+		db.WithContext(ctx).Where("parent = ?", parent.ID).Find(&children)
+	}
+	db.WithContext(ctx).Model(&item{}).Where("id = ?", 1).Update("name", "first")
+	db.Find(&parents) // without stats
+
+	if stats.Count() != 7 || stats.Duration() <= 0 {
+		t.Errorf("expected 7 statements, got %d in %s", stats.Count(), stats.Duration())
+	}
+	if slowest := stats.Slowest(); len(slowest) != 2 || slowest[0].Duration < slowest[1].Duration {
+		t.Errorf("expected the 2 slowest statements, slowest first, got %+v", slowest)
+	}
+	repeated := stats.Repeated(2)
+	if len(repeated) != 1 || repeated[0].Count != 5 || !strings.Contains(repeated[0].SQL, "parent = ?") {
+		t.Fatalf("expected the child query repeated 5 times, got %+v", repeated)
+	}
+	if !strings.HasSuffix(strings.Split(repeated[0].Caller, ":")[0], "profile_test.go") {
+		t.Errorf("expected the caller in the test, got %q", repeated[0].Caller)
+	}
+
+	var warnings []*log.Entry
+	for _, e := range entries() {
+		if strings.Contains(e.Message, "N+1") {
+			warnings = append(warnings, e)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(field(warnings[0], "caller"), "profile_test.go") {
+		t.Errorf("expected a single N+1 warning with the caller, got %+v", warnings)
+	}
+}
+
+func TestExplainSlowQueries(t *testing.T) {
+	db := openDB(t, profile.Plugin{SlowThreshold: time.Nanosecond, Explain: true})
+	entries := captureLog(t)
+
+	var items []item
+	db.Where("name = ?", "item").Find(&items)
+	var plans int
+	for _, e := range entries() {
+		if e.Message == "slow query" {
+			plans++
+			if !strings.Contains(field(e, "plan"), "items") {
+				t.Errorf("expected the plan of the query, got %q", field(e, "plan"))
+			}
+		}
+	}
+	if plans != 1 {
+		t.Errorf("expected one slow query with its plan, got %d", plans)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	db := openDB(t, profile.Plugin{})
+	var app = fiber.New()
+	app.Use(profile.Middleware(profile.MiddlewareConfig{ServerTiming: true}))
+	app.Get("/", func(c fiber.Ctx) error {
+		var items []item
+		db.WithContext(c.Context()).Find(&items)
+		return c.SendString("ok")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header = resp.Header.Get("Server-Timing")
+	if !strings.HasPrefix(header, "db;dur=") || !strings.HasSuffix(header, `desc="1 query"`) {
+		t.Errorf("unexpected Server-Timing header %q", header)
+	}
+}
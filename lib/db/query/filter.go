@@ -0,0 +1,130 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	gschema "gorm.io/gorm/schema"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func parseTime(raw string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", time.DateOnly} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", raw)
+}
+
+func newFilter(field *gschema.Field, op Operator, raw string) (Filter, error) {
+	var filter = Filter{Field: field, Operator: op}
+	var parts []string
+	switch op {
+	case Eq, Ne, Gt, Gte, Lt, Lte:
+		parts = []string{raw}
+	case In:
+		parts = strings.Split(raw, ",")
+	case Between:
+		parts = strings.Split(raw, ",")
+		if len(parts) != 2 {
+			return filter, fmt.Errorf("%w: between on %s takes two values", ErrInvalidQuery, field.DBName)
+		}
+	case Like:
+		// Matched as a substring, with the wildcards of the value escaped.
+		filter.Values = []any{"%" + likeEscaper.Replace(raw) + "%"}
+		return filter, nil
+	case Null:
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, fmt.Errorf("%w: null on %s takes true or false", ErrInvalidQuery, field.DBName)
+		}
+		filter.Values = []any{isNull}
+		return filter, nil
+	default:
+		return filter, fmt.Errorf("%w: unknown operator %q", ErrInvalidQuery, op)
+	}
+	for _, part := range parts {
+		v, err := value(field, strings.TrimSpace(part))
+		if err != nil {
+			return filter, err
+		}
+		filter.Values = append(filter.Values, v)
+	}
+	return filter, nil
+}
+
+// likeEscaper escapes the LIKE wildcards with '!', an escape character
+// spelled the same in every dialect.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// Expression returns the condition of the filter.
+func (f Filter) Expression() clause.Expression {
+	var column = clause.Column{Table: clause.CurrentTable, Name: f.Field.DBName}
+	switch f.Operator {
+	case Ne:
+		return clause.Neq{Column: column, Value: f.Values[0]}
+	case Gt:
+		return clause.Gt{Column: column, Value: f.Values[0]}
+	case Gte:
+		return clause.Gte{Column: column, Value: f.Values[0]}
+	case Lt:
+		return clause.Lt{Column: column, Value: f.Values[0]}
+	case Lte:
+		return clause.Lte{Column: column, Value: f.Values[0]}
+	case In:
+		return clause.IN{Column: column, Values: f.Values}
+	case Like:
+		return clause.Expr{SQL: "? LIKE ? ESCAPE '!'", Vars: []any{column, f.Values[0]}}
+	case Null:
+		if f.Values[0].(bool) {
+			return clause.Eq{Column: column, Value: nil}
+		}
+		return clause.Neq{Column: column, Value: nil}
+	case Between:
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []any{column, f.Values[0], f.Values[1]}}
+	}
+	return clause.Eq{Column: column, Value: f.Values[0]}
+}
+
+// Where is the scope applying the filters.
+func (q *Query) Where(db *gorm.DB) *gorm.DB {
+	if len(q.Filters) == 0 {
+		return db
+	}
+	var exprs = make([]clause.Expression, len(q.Filters))
+	for i, filter := range q.Filters {
+		exprs[i] = filter.Expression()
+	}
+	return db.Where(clause.And(exprs...))
+}
+
+// Order is the scope applying the sort.
+func (q *Query) Order(db *gorm.DB) *gorm.DB {
+	var columns = make([]clause.OrderByColumn, len(q.Sort))
+	for i, sort := range q.Sort {
+		columns[i] = clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: sort.Field.DBName}, Desc: sort.Desc}
+	}
+	return db.Clauses(clause.OrderBy{Columns: columns})
+}
+
+// Scope applies the filters, the sort and the page of the query, for
+// callers building their own response:
+//
+//	db.Scopes(q.Scope).Find(&orders)
+func (q *Query) Scope(db *gorm.DB) *gorm.DB {
+	db = q.Order(q.Where(db)).Limit(q.Limit)
+	if q.Page > 0 {
+		return db.Offset((q.Page - 1) * q.Limit)
+	}
+	if after, _ := q.decodeCursor(); after != nil {
+		db = db.Where(after)
+	}
+	return db
+}
@@ -0,0 +1,145 @@
+package query
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Page is the envelope of a page of results. NextCursor is set in keyset
+// mode while more rows follow; Total when the count was requested.
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	Page       int    `json:"page,omitempty"`
+	Limit      int    `json:"limit"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// Paginate runs the query on db, which may carry conditions of its own,
+// and returns a page of T, the model the query was parsed for.
+func Paginate[T any](db *gorm.DB, q *Query) (*Page[T], error) {
+	var page = &Page[T]{Data: []T{}, Page: q.Page, Limit: q.Limit}
+	if q.Count {
+		var total int64
+		if err := db.Session(&gorm.Session{}).Model(new(T)).Scopes(q.Where).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	var tx = db.Session(&gorm.Session{}).Scopes(q.Where, q.Order).Limit(q.Limit + 1)
+	if q.Page > 0 {
+		tx = tx.Offset((q.Page - 1) * q.Limit)
+	} else if q.Cursor != "" {
+		after, err := q.decodeCursor()
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where(after)
+	}
+	if err := tx.Find(&page.Data).Error; err != nil {
+		return nil, err
+	}
+	if len(page.Data) > q.Limit {
+		page.Data, page.HasMore = page.Data[:q.Limit], true
+		if q.Page == 0 {
+			cursor, err := q.encodeCursor(reflect.ValueOf(&page.Data[q.Limit-1]).Elem())
+			if err != nil {
+				return nil, err
+			}
+			page.NextCursor = cursor
+		}
+	}
+	return page, nil
+}
+
+// cursor is the position after a row: the values of its sort columns, and
+// the sort they belong to.
+type cursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+func (q *Query) sortKey() string {
+	var parts = make([]string, len(q.Sort))
+	for i, sort := range q.Sort {
+		parts[i] = sort.Field.DBName
+		if sort.Desc {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (q *Query) encodeCursor(row reflect.Value) (string, error) {
+	var c = cursor{Sort: q.sortKey()}
+	for _, sort := range q.Sort {
+		v, _ := sort.Field.ValueOf(context.Background(), row)
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, data)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the condition selecting the rows after the cursor,
+// or nil without cursor.
+func (q *Query) decodeCursor() (clause.Expression, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil || c.Sort != q.sortKey() || len(c.Values) != len(q.Sort) {
+		return nil, fmt.Errorf("%w: cursor does not match the query", ErrInvalidQuery)
+	}
+	var values = make([]any, len(q.Sort))
+	for i, sort := range q.Sort {
+		var v = reflect.New(sort.Field.FieldType)
+		if err = json.Unmarshal(c.Values[i], v.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: cursor does not match the query", ErrInvalidQuery)
+		}
+		values[i] = v.Elem().Interface()
+	}
+
+	// (a > x) OR (a = x AND b > y) OR ..., with < for descending columns.
+	var alternatives []clause.Expression
+	for i, sort := range q.Sort {
+		var exprs []clause.Expression
+		for j := 0; j < i; j++ {
+			exprs = append(exprs, clause.Eq{Column: column(q.Sort[j]), Value: values[j]})
+		}
+		if sort.Desc {
+			exprs = append(exprs, clause.Lt{Column: column(sort), Value: values[i]})
+		} else {
+			exprs = append(exprs, clause.Gt{Column: column(sort), Value: values[i]})
+		}
+		alternatives = append(alternatives, clause.And(exprs...))
+	}
+	if len(alternatives) == 1 {
+		// A single OR condition would be joined to the others with OR.
+		return alternatives[0], nil
+	}
+	return clause.Or(alternatives...), nil
+}
+
+func column(sort Sort) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: sort.Field.DBName}
+}
@@ -0,0 +1,292 @@
+// Package query turns the query string of list endpoints into GORM scopes:
+// whitelisted filters with typed operators, sorting, and offset or keyset
+// (cursor) pagination returned in a standard page envelope.
+//
+//	GET /orders?filter[status][in]=paid,shipped&sort=-created_at&limit=50
+//
+//	q, err := query.FromRequest(r.Context, &Order{})
+//	if err != nil {
+//	    return err
+//	}
+//	return query.Paginate[Order](evo.GetDB(r.Context.Context()), q)
+package query
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/gofiber/fiber/v3"
+	gschema "gorm.io/gorm/schema"
+)
+
+// ErrInvalidQuery is returned for query strings naming unknown or disallowed
+// fields, unknown operators or malformed values.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Options restricts and configures the parsing of a query string.
+type Options struct {
+	// Filterable and Sortable whitelist the fields by column, field or JSON
+	// name. Empty lists allow every field exposed in JSON.
+	Filterable []string
+	Sortable   []string
+
+	// DefaultSort applies when the query has no sort, such as "-created_at".
+	// The primary key is always appended as a tie-breaker.
+	DefaultSort string
+
+	// Limit is the page size when the query has none, 20 by default.
+	// MaxLimit caps the requested size, 100 by default.
+	Limit    int
+	MaxLimit int
+
+	// Count adds the total number of matching rows to every page. Clients
+	// can also ask for it with count=true.
+	Count bool
+}
+
+// Operator is a filter operator.
+type Operator string
+
+const (
+	Eq      Operator = "eq"
+	Ne      Operator = "ne"
+	Gt      Operator = "gt"
+	Gte     Operator = "gte"
+	Lt      Operator = "lt"
+	Lte     Operator = "lte"
+	In      Operator = "in"
+	Like    Operator = "like"
+	Null    Operator = "null"
+	Between Operator = "between"
+)
+
+// Filter is a condition on one field.
+type Filter struct {
+	Field    *gschema.Field
+	Operator Operator
+	Values   []any
+}
+
+// Sort orders by one field.
+type Sort struct {
+	Field *gschema.Field
+	Desc  bool
+}
+
+// Query is a parsed query string.
+type Query struct {
+	Schema  *gschema.Schema
+	Filters []Filter
+	Sort    []Sort
+	Limit   int
+
+	// Page is the 1-based page of offset pagination; 0 selects keyset
+	// pagination, continuing after Cursor.
+	Page   int
+	Cursor string
+	Count  bool
+}
+
+var filterKey = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([a-z]+)\])?$`)
+
+// FromRequest parses the query string of the request.
+func FromRequest(c fiber.Ctx, model any, options ...Options) (*Query, error) {
+	return Parse(model, string(c.Request().URI().QueryString()), options...)
+}
+
+// Parse parses a raw query string for the model:
+//
+//	filter[<field>][<operator>]=<value>  operators: eq (default), ne, gt, gte,
+//	                                     lt, lte, in (a,b), like, null
+//	                                     (true/false), between (a,b)
+//	sort=-created_at,name                "-" sorts descending
+//	limit=50
+//	page=2                               offset pagination
+//	cursor=<next_cursor>                 keyset pagination
+//	count=true                           include the total
+func Parse(model any, raw string, options ...Options) (*Query, error) {
+	var opts Options
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 20
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = 100
+	}
+	s, err := parseSchema(model)
+	if err != nil {
+		return nil, err
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	var q = &Query{Schema: s, Limit: opts.Limit, Count: opts.Count}
+	var filterable, sortable = whitelist(s, opts.Filterable), whitelist(s, opts.Sortable)
+	for key, vals := range values {
+		switch key {
+		case "sort", "limit", "page", "cursor", "count":
+			continue
+		}
+		match := filterKey.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		field, ok := filterable[match[1]]
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot filter by %q", ErrInvalidQuery, match[1])
+		}
+		var op = Operator(match[2])
+		if op == "" {
+			op = Eq
+		}
+		for _, v := range vals {
+			filter, err := newFilter(field, op, v)
+			if err != nil {
+				return nil, err
+			}
+			q.Filters = append(q.Filters, filter)
+		}
+	}
+
+	var sort = values.Get("sort")
+	if sort == "" {
+		sort = opts.DefaultSort
+	}
+	for _, name := range strings.Split(sort, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		var desc bool
+		if name, desc = strings.CutPrefix(name, "-"); !desc {
+			name = strings.TrimPrefix(name, "+")
+		}
+		field, ok := sortable[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, name)
+		}
+		q.Sort = append(q.Sort, Sort{Field: field, Desc: desc})
+	}
+	for _, field := range s.PrimaryFields {
+		if !q.sorted(field) {
+			q.Sort = append(q.Sort, Sort{Field: field})
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 {
+			return nil, fmt.Errorf("%w: limit must be a positive number", ErrInvalidQuery)
+		}
+	}
+	q.Limit = min(q.Limit, opts.MaxLimit)
+	if v := values.Get("page"); v != "" {
+		if q.Page, err = strconv.Atoi(v); err != nil || q.Page < 1 {
+			return nil, fmt.Errorf("%w: page must be a positive number", ErrInvalidQuery)
+		}
+	}
+	q.Cursor = values.Get("cursor")
+	if q.Page > 0 && q.Cursor != "" {
+		return nil, fmt.Errorf("%w: page and cursor are exclusive", ErrInvalidQuery)
+	}
+	if q.Cursor != "" {
+		if _, err = q.decodeCursor(); err != nil {
+			return nil, err
+		}
+	}
+	if v := values.Get("count"); v != "" {
+		q.Count, _ = strconv.ParseBool(v)
+	}
+	return q, nil
+}
+
+func (q *Query) sorted(field *gschema.Field) bool {
+	for _, sort := range q.Sort {
+		if sort.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+var cache sync.Map
+
+// parseSchema returns the schema of a registered model, see db.UseModel, or
+// parses it with the default naming strategy.
+func parseSchema(model any) (*gschema.Schema, error) {
+	if m := schema.Find(model); m != nil && m.Schema != nil {
+		return m.Schema, nil
+	}
+	return gschema.Parse(model, &cache, gschema.NamingStrategy{})
+}
+
+// whitelist maps the column, field and JSON names of the fields exposed in
+// JSON, restricted to allowed when given, to their fields.
+func whitelist(s *gschema.Schema, allowed []string) map[string]*gschema.Field {
+	var names = map[string]*gschema.Field{}
+	for _, field := range s.Fields {
+		if field.DBName == "" || !field.Readable {
+			continue
+		}
+		var jsonName, _, _ = strings.Cut(field.Tag.Get("json"), ",")
+		if jsonName == "-" {
+			continue
+		}
+		var aliases = []string{field.DBName, field.Name}
+		if jsonName != "" {
+			aliases = append(aliases, jsonName)
+		}
+		if len(allowed) > 0 && !contains(allowed, aliases) {
+			continue
+		}
+		for _, alias := range aliases {
+			names[alias] = field
+		}
+	}
+	return names
+}
+
+func contains(list []string, names []string) bool {
+	for _, item := range list {
+		for _, name := range names {
+			if item == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// value converts a query string value to the type of the field.
+func value(field *gschema.Field, raw string) (any, error) {
+	var t = field.IndirectFieldType
+	var v any
+	var err error
+	switch {
+	case t == timeType:
+		v, err = parseTime(raw)
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		v, err = strconv.ParseInt(raw, 10, 64)
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		v, err = strconv.ParseUint(raw, 10, 64)
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		v, err = strconv.ParseFloat(raw, 64)
+	case t.Kind() == reflect.Bool:
+		v, err = strconv.ParseBool(raw)
+	default:
+		v = raw
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid value %q for %s", ErrInvalidQuery, raw, field.DBName)
+	}
+	return v, nil
+}
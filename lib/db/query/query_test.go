@@ -0,0 +1,196 @@
+package query_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/db/query"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type order struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Status    string    `json:"status"`
+	Customer  string    `json:"customer_name"`
+	Amount    int       `json:"amount"`
+	Note      *string   `json:"note"`
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "query.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.AutoMigrate(&order{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var note = "gift"
+	for i := 1; i <= 10; i++ {
+		o := order{Status: "paid", Customer: fmt.Sprintf("customer_%d", i), Amount: i * 10, CreatedAt: start.AddDate(0, 0, i/2)}
+		if i%3 == 0 {
+			o.Status, o.Note = "shipped", &note
+		}
+		db.Create(&o)
+	}
+	return db
+}
+
+func list(t *testing.T, db *gorm.DB, raw string, options ...query.Options) *query.Page[order] {
+	t.Helper()
+	q, err := query.Parse(&order{}, raw, options...)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+	page, err := query.Paginate[order](db, q)
+	if err != nil {
+		t.Fatalf("paginate %q: %v", raw, err)
+	}
+	return page
+}
+
+func ids(page *query.Page[order]) []uint {
+	var result []uint
+	for _, o := range page.Data {
+		result = append(result, o.ID)
+	}
+	return result
+}
+
+func TestFilters(t *testing.T) {
+	db := openDB(t)
+
+	var cases = map[string][]uint{
+		"filter[status]=shipped":                                  {3, 6, 9},
+		"filter[status][ne]=paid&filter[amount][gt]=30":           {6, 9},
+		"filter[amount][gte]=90":                                  {9, 10},
+		"filter[amount][lt]=20":                                   {1},
+		"filter[amount][lte]=20":                                  {1, 2},
+		"filter[id][in]=2,4,7":                                    {2, 4, 7},
+		"filter[customer_name][like]=r_1":                         {1, 10},
+		"filter[note][null]=false":                                {3, 6, 9},
+		"filter[amount][between]=20,40":                           {2, 3, 4},
+		"filter[created_at][gte]=2024-01-05":                      {8, 9, 10},
+		"filter[Status]=paid&filter[amount][in]=10,30,50":         {1, 5},
+		"filter[customer][like]=customer_1&filter[amount][lt]=50": {1},
+	}
+	for raw, want := range cases {
+		got := ids(list(t, db, raw))
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: expected %v, got %v", raw, want, got)
+		}
+	}
+}
+
+func TestLikeEscapesWildcards(t *testing.T) {
+	db := openDB(t)
+	if got := ids(list(t, db, "filter[customer][like]=%25")); len(got) != 0 {
+		t.Errorf("expected %% to match literally, got %v", got)
+	}
+}
+
+func TestInvalidQueries(t *testing.T) {
+	for _, raw := range []string{
+		"filter[secret]=x",
+		"filter[unknown]=x",
+		"filter[status][regex]=x",
+		"filter[amount]=ten",
+		"filter[amount][between]=1",
+		"filter[note][null]=maybe",
+		"sort=secret",
+		"limit=0",
+		"page=-1",
+		"page=2&cursor=abc",
+		"cursor=not-a-cursor",
+	} {
+		if _, err := query.Parse(&order{}, raw); !errors.Is(err, query.ErrInvalidQuery) {
+			t.Errorf("%s: expected ErrInvalidQuery, got %v", raw, err)
+		}
+	}
+	if _, err := query.Parse(&order{}, "filter[amount]=1", query.Options{Filterable: []string{"status"}}); !errors.Is(err, query.ErrInvalidQuery) {
+		t.Errorf("expected the whitelist to reject amount, got %v", err)
+	}
+	if _, err := query.Parse(&order{}, "sort=customer_name", query.Options{Sortable: []string{"customer"}}); err != nil {
+		t.Errorf("expected the JSON name of a whitelisted field to sort, got %v", err)
+	}
+}
+
+func TestOffsetPagination(t *testing.T) {
+	db := openDB(t)
+
+	page := list(t, db, "sort=-amount&limit=4&page=2&count=true")
+	if fmt.Sprint(ids(page)) != "[6 5 4 3]" || !page.HasMore || page.NextCursor != "" {
+		t.Errorf("unexpected page %+v", page)
+	}
+	if page.Total == nil || *page.Total != 10 {
+		t.Errorf("expected total 10, got %v", page.Total)
+	}
+	page = list(t, db, "sort=-amount&limit=4&page=3")
+	if fmt.Sprint(ids(page)) != "[2 1]" || page.HasMore || page.Total != nil {
+		t.Errorf("unexpected last page %+v", page)
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	db := openDB(t)
+
+	// created_at repeats, so the id breaks the ties across pages.
+	var seen []uint
+	var raw = "filter[status]=paid&sort=-created_at&limit=3"
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination does not end")
+		}
+		page := list(t, db, raw)
+		seen = append(seen, ids(page)...)
+		if page.NextCursor == "" {
+			if page.HasMore {
+				t.Error("more rows without a cursor")
+			}
+			break
+		}
+		raw = "filter[status]=paid&sort=-created_at&limit=3&cursor=" + page.NextCursor
+	}
+	if fmt.Sprint(seen) != "[10 8 7 4 5 2 1]" {
+		t.Errorf("unexpected rows across pages %v", seen)
+	}
+
+	first := list(t, db, "sort=amount&limit=2")
+	if _, err := query.Parse(&order{}, "sort=-amount&cursor="+first.NextCursor); !errors.Is(err, query.ErrInvalidQuery) {
+		t.Errorf("expected a cursor of another sort to be rejected, got %v", err)
+	}
+}
+
+func TestDefaultsAndScope(t *testing.T) {
+	db := openDB(t)
+
+	page := list(t, db, "", query.Options{DefaultSort: "-id", Limit: 2, MaxLimit: 5})
+	if fmt.Sprint(ids(page)) != "[10 9]" {
+		t.Errorf("unexpected default page %v", ids(page))
+	}
+	if page = list(t, db, "limit=50", query.Options{MaxLimit: 5}); len(page.Data) != 5 {
+		t.Errorf("expected the limit capped to 5, got %d", len(page.Data))
+	}
+
+	q, err := query.Parse(&order{}, "filter[status]=shipped&sort=-id&limit=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orders []order
+	if err = db.Where("amount > ?", 30).Scopes(q.Scope).Find(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 || orders[0].ID != 9 || orders[1].ID != 6 {
+		t.Errorf("unexpected scoped rows %+v", orders)
+	}
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/log"
+	"gorm.io/gorm"
+)
+
+// primaryKey is the gorm setting that keeps a query on the primary.
+const primaryKey = "evo:primary"
+
+// ReplicaCheckInterval is how often the replicas are pinged to find out
+// which of them can serve reads.
+var ReplicaCheckInterval = 10 * time.Second
+
+// replica is a read-only connection of the primary.
+type replica struct {
+	server  string
+	pool    *sql.DB
+	healthy atomic.Bool
+}
+
+// Replicas is a gorm plugin that sends reads to healthy read replicas in
+// turn and leaves everything else on the primary. Reads inside a
+// transaction or a db.Connection, locking reads and queries marked with
+// Primary stay on the primary, as do all reads while no replica is healthy.
+type Replicas struct {
+	replicas []*replica
+	next     atomic.Uint64
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewReplicas returns the plugin for the given replica connections, keyed
+// by server for the logs.
+func NewReplicas(conns map[string]*gorm.DB) (*Replicas, error) {
+	var r = &Replicas{stop: make(chan struct{})}
+	for server, conn := range conns {
+		pool, err := conn.DB()
+		if err != nil {
+			return nil, err
+		}
+		r.replicas = append(r.replicas, &replica{server: server, pool: pool})
+	}
+	return r, nil
+}
+
+// Name implements gorm.Plugin.
+func (r *Replicas) Name() string {
+	return "evo:replicas"
+}
+
+// Initialize implements gorm.Plugin. It checks the replicas once, then
+// every ReplicaCheckInterval until Close.
+func (r *Replicas) Initialize(db *gorm.DB) error {
+	r.check()
+	go func() {
+		var ticker = time.NewTicker(ReplicaCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.check()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+
+	if err := db.Callback().Query().Before("gorm:query").Register("evo:replica_read", r.read); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("evo:replica_release", r.release); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("evo:replica_read", r.read); err != nil {
+		return err
+	}
+	return db.Callback().Row().After("gorm:row").Register("evo:replica_release", r.release)
+}
+
+// Close stops the health checks and closes the replica connections.
+func (r *Replicas) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	var err error
+	for _, rep := range r.replicas {
+		if e := rep.pool.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Healthy returns the servers of the replicas currently serving reads.
+func (r *Replicas) Healthy() []string {
+	var servers []string
+	for _, rep := range r.replicas {
+		if rep.healthy.Load() {
+			servers = append(servers, rep.server)
+		}
+	}
+	return servers
+}
+
+func (r *Replicas) check() {
+	for _, rep := range r.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), ReplicaCheckInterval)
+		err := rep.pool.PingContext(ctx)
+		cancel()
+		if healthy := err == nil; rep.healthy.Swap(healthy) != healthy {
+			if healthy {
+				log.Info("database replica is healthy", "server", rep.server)
+			} else {
+				log.Warning("database replica is unhealthy, reads fall back to the primary", "server", rep.server, "error", err)
+			}
+		}
+	}
+}
+
+// pick returns the next healthy replica, or nil when there is none.
+func (r *Replicas) pick() *sql.DB {
+	var n = len(r.replicas)
+	var start = r.next.Add(1)
+	for i := 0; i < n; i++ {
+		if rep := r.replicas[(start+uint64(i))%uint64(n)]; rep.healthy.Load() {
+			return rep.pool
+		}
+	}
+	return nil
+}
+
+func (r *Replicas) read(tx *gorm.DB) {
+	// a transaction or a pinned connection replaces the pool
+	if tx.Error != nil || tx.Statement.ConnPool != tx.Config.ConnPool {
+		return
+	}
+	if _, ok := tx.Get(primaryKey); ok {
+		return
+	}
+	if _, ok := tx.Statement.Clauses["FOR"]; ok {
+		return
+	}
+	if query := tx.Statement.SQL.String(); strings.TrimSpace(query) != "" && !isSelect(query) {
+		return
+	}
+	if pool := r.pick(); pool != nil {
+		tx.Statement.ConnPool = pool
+	}
+}
+
+// release puts the statement back on the primary so that a chain reused
+// for a write after a read does not write to a replica.
+func (r *Replicas) release(tx *gorm.DB) {
+	for _, rep := range r.replicas {
+		if tx.Statement.ConnPool == rep.pool {
+			tx.Statement.ConnPool = tx.Config.ConnPool
+			return
+		}
+	}
+}
+
+// isSelect reports whether a raw query is a plain read. WITH queries are
+// left on the primary as PostgreSQL allows writes in them.
+func isSelect(query string) bool {
+	var upper = strings.ToUpper(strings.TrimLeft(query, "( \t\r\n"))
+	if !strings.HasPrefix(upper, "SELECT") {
+		return false
+	}
+	return !strings.Contains(upper, " FOR UPDATE") && !strings.Contains(upper, " FOR SHARE") &&
+		!strings.Contains(upper, "LOCK IN SHARE MODE")
+}
+
+// Primary returns a session whose reads go to the primary, for reading a
+// row right after writing it.
+func Primary() *gorm.DB {
+	return UsePrimary(db)
+}
+
+// UsePrimary keeps the reads of tx on the primary.
+func UsePrimary(tx *gorm.DB) *gorm.DB {
+	return tx.Set(primaryKey, true)
+}
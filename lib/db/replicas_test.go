@@ -0,0 +1,109 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type replicaItem struct {
+	ID   int
+	Name string
+}
+
+func openReplicaTestDB(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name+".db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.AutoMigrate(&replicaItem{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Create(&replicaItem{ID: 1, Name: name}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestReplicasRouteReads(t *testing.T) {
+	primary := openReplicaTestDB(t, "primary")
+	replicas, err := NewReplicas(map[string]*gorm.DB{"replica": openReplicaTestDB(t, "replica")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Use(replicas); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { replicas.Close() })
+
+	name := func(tx *gorm.DB) string {
+		var item replicaItem
+		if err := tx.First(&item, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		return item.Name
+	}
+
+	if got := name(primary); got != "replica" {
+		t.Errorf("expected First to read from the replica, got %s", got)
+	}
+	var count int64
+	primary.Model(&replicaItem{}).Where("name = ?", "replica").Count(&count)
+	if count != 1 {
+		t.Errorf("expected Count to read from the replica, got %d", count)
+	}
+	var raw string
+	primary.Raw("SELECT name FROM replica_items WHERE id = 1").Scan(&raw)
+	if raw != "replica" {
+		t.Errorf("expected a raw SELECT to read from the replica, got %s", raw)
+	}
+	if got := name(UsePrimary(primary)); got != "primary" {
+		t.Errorf("expected UsePrimary to read from the primary, got %s", got)
+	}
+	primary.Transaction(func(tx *gorm.DB) error {
+		if got := name(tx); got != "primary" {
+			t.Errorf("expected a transaction to read from the primary, got %s", got)
+		}
+		return nil
+	})
+
+	// writes after a read on the same chain stay on the primary
+	tx := primary.Where("id = ?", 1)
+	var item replicaItem
+	tx.Find(&item)
+	if err := tx.Exec("UPDATE replica_items SET name = ? WHERE id = 1", "updated").Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := name(UsePrimary(primary)); got != "updated" {
+		t.Errorf("expected the update to reach the primary, got %s", got)
+	}
+
+	// reads fall back to the primary once no replica is healthy
+	replicas.replicas[0].pool.Close()
+	replicas.check()
+	if len(replicas.Healthy()) != 0 {
+		t.Fatal("expected the closed replica to be unhealthy")
+	}
+	if got := name(primary); got != "updated" {
+		t.Errorf("expected reads to fall back to the primary, got %s", got)
+	}
+}
+
+func TestIsSelect(t *testing.T) {
+	for query, want := range map[string]bool{
+		"SELECT * FROM users":                            true,
+		" (select 1)":                                    true,
+		"SELECT * FROM users FOR UPDATE":                 false,
+		"select * from users lock in share mode":         false,
+		"WITH x AS (DELETE FROM t RETURNING *) SELECT 1": false,
+		"UPDATE users SET name = 'a' RETURNING id":       false,
+	} {
+		if got := isSelect(query); got != want {
+			t.Errorf("isSelect(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package schema
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Check is a CHECK constraint of a table, from the check tag of a field:
+//
+//	Price    float64   `gorm:"check:price >= 0"`                      // chk_<table>_price
+//	EndsAt   time.Time `gorm:"check:chk_period,ends_at > starts_at"` // named
+type Check struct {
+	Name       string
+	Expression string
+}
+
+// Checks is a slice of Check with helper methods.
+type Checks []Check
+
+// Find returns a pointer to the check with the given name, or nil.
+func (list Checks) Find(name string) *Check {
+	for idx := range list {
+		if strings.EqualFold(list[idx].Name, name) {
+			return &list[idx]
+		}
+	}
+	return nil
+}
+
+// ParseChecks returns the CHECK constraints of the model of stmt, sorted by
+// name, with names of at most maxLen characters.
+func ParseChecks(stmt *gorm.Statement, maxLen int) Checks {
+	var checks Checks
+	for name, check := range stmt.Schema.ParseCheckConstraints() {
+		if check.Field != nil && check.Field.IgnoreMigration {
+			continue
+		}
+		checks = append(checks, Check{Name: SafeIndexName(name, maxLen), Expression: strings.TrimSpace(check.Constraint)})
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+	return checks
+}
+
+// ManagedCheck reports whether a CHECK constraint found in the database was
+// created from a check tag, and may be dropped once the tag is removed. The
+// constraints named otherwise, such as the JSON checks of MariaDB, are left
+// alone.
+func ManagedCheck(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), "chk_")
+}
+
+var (
+	normalizeIntroducers = regexp.MustCompile(`(^|[^a-z0-9_])_[a-z0-9]+'`)
+	normalizeCasts       = regexp.MustCompile(`::"?[a-z_][a-z0-9_]*"?(?: varying| precision| without time zone| with time zone)?(?:\[\])*`)
+	normalizeQualifiers  = regexp.MustCompile(`(^|[^a-z0-9_$'])[a-z_][a-z0-9_$]*\.`)
+	normalizeAliases     = regexp.MustCompile(`([a-z0-9_$]+)\s+as\s+([a-z0-9_$]+)`)
+	normalizeNoise       = regexp.MustCompile(`[\s()` + "`" + `"]+`)
+)
+
+// NormalizeExpression returns expr in a form comparable with the one the
+// database reports for a CHECK constraint, a generated column or a view,
+// which it rewrites: lower case, without quotes, parentheses, spaces,
+// casts, charset introducers, table qualifiers and aliases repeating the
+// column name. Two expressions normalizing to the same string are deemed
+// equal, so that migrations do not recreate them on every run.
+func NormalizeExpression(expr string) string {
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	expr = strings.TrimSuffix(expr, ";")
+	expr = normalizeIntroducers.ReplaceAllString(expr, "$1'")
+	expr = normalizeCasts.ReplaceAllString(expr, "")
+	expr = strings.NewReplacer("`", "", `"`, "").Replace(expr)
+	for {
+		var next = normalizeQualifiers.ReplaceAllString(expr, "$1")
+		if next == expr {
+			break
+		}
+		expr = next
+	}
+	expr = normalizeAliases.ReplaceAllStringFunc(expr, func(s string) string {
+		var m = normalizeAliases.FindStringSubmatch(s)
+		if m[1] == m[2] {
+			return m[1]
+		}
+		return s
+	})
+	expr = strings.ReplaceAll(expr, "!=", "<>")
+	return normalizeNoise.ReplaceAllString(expr, "")
+}
@@ -0,0 +1,109 @@
+package schema
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type checkedProduct struct {
+	ID     uint
+	Price  float64 `gorm:"check:price >= 0"`
+	Starts int
+	Ends   int    `gorm:"check:chk_period,ends > starts"`
+	Total  string `gorm:"->;generated:price * 2;stored"`
+}
+
+type activeProduct struct {
+	ID uint
+}
+
+func (activeProduct) ViewDefinition() string {
+	return "SELECT id FROM checked_products WHERE price > 0;"
+}
+
+type productTotals struct{}
+
+func (productTotals) ViewDefinition() string { return "SELECT count(*) AS total FROM checked_products" }
+func (productTotals) Materialized() bool     { return true }
+
+func TestNormalizeExpression(t *testing.T) {
+	equal := [][2]string{
+		{"price >= 0", "(`price` >= 0)"},
+		{"status IN ('draft', 'published')", "(`status` in (_utf8mb4'draft',_utf8mb4'published'))"},
+		{"price >= 0", "((price)::numeric >= (0)::numeric)"},
+		{"ends > starts", `("ends" > "starts")`},
+		{"price != 0", "price <> 0"},
+		{
+			"SELECT id, email FROM users WHERE deleted_at IS NULL;",
+			"select `app`.`users`.`id` AS `id`,`app`.`users`.`email` AS `email` from `app`.`users` where (`app`.`users`.`deleted_at` is null)",
+		},
+	}
+	for _, pair := range equal {
+		if a, b := NormalizeExpression(pair[0]), NormalizeExpression(pair[1]); a != b {
+			t.Errorf("expected %q and %q equal, got %q and %q", pair[0], pair[1], a, b)
+		}
+	}
+
+	different := [][2]string{
+		{"price >= 0", "price > 0"},
+		{"price >= 0.5", "price >= 5"},
+		{"SELECT id AS user_id FROM users", "SELECT id FROM users"},
+	}
+	for _, pair := range different {
+		if NormalizeExpression(pair[0]) == NormalizeExpression(pair[1]) {
+			t.Errorf("expected %q and %q different", pair[0], pair[1])
+		}
+	}
+}
+
+func TestParseChecks(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&checkedProduct{}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	checks := ParseChecks(stmt, 64)
+	if len(checks) != 2 {
+		t.Fatalf("expected 2 checks, got %+v", checks)
+	}
+	if checks[0] != (Check{Name: "chk_checked_products_price", Expression: "price >= 0"}) || checks[1] != (Check{Name: "chk_period", Expression: "ends > starts"}) {
+		t.Errorf("unexpected checks %+v", checks)
+	}
+	if checks.Find("CHK_PERIOD") == nil || checks.Find("chk_missing") != nil {
+		t.Error("expected Find to match names case-insensitively")
+	}
+	if got := ParseChecks(stmt, 16); len(got[0].Name) > 16 {
+		t.Errorf("expected names of at most 16 characters, got %q", got[0].Name)
+	}
+
+	if !ManagedCheck("chk_period") || ManagedCheck("json_valid_data") {
+		t.Error("expected only chk_ constraints managed")
+	}
+}
+
+func TestViewOf(t *testing.T) {
+	definition, materialized, ok := ViewOf(&activeProduct{})
+	if !ok || materialized || definition != "SELECT id FROM checked_products WHERE price > 0" {
+		t.Errorf("unexpected view %q, %t, %t", definition, materialized, ok)
+	}
+	if _, materialized, ok = ViewOf(productTotals{}); !ok || !materialized {
+		t.Error("expected a materialized view")
+	}
+	if _, _, ok = ViewOf(&checkedProduct{}); ok {
+		t.Error("expected a table model not to be a view")
+	}
+
+	if ViewComment(definition, false) == ViewComment(definition, true) {
+		t.Error("expected the comment to change with the kind of view")
+	}
+	if ViewComment(definition, false) != ViewComment(definition, false) {
+		t.Error("expected the comment to be deterministic")
+	}
+}
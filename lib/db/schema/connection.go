@@ -0,0 +1,147 @@
+package schema
+
+import (
+	"database/sql"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// connections maps the connection pool of each named connection to its
+	// name. The primary connection is not listed.
+	connections   = map[gorm.ConnPool]string{}
+	connectionsMu sync.RWMutex
+
+	// modelConnections maps model types to the named connection they are
+	// migrated on.
+	modelConnections   = map[reflect.Type]string{}
+	modelConnectionsMu sync.RWMutex
+)
+
+// RegisterConnection marks db as the named connection name. Every session
+// derived from db shares its connection pool, so migrations run on any of
+// them only consider the models and versioned migrations of that connection.
+func RegisterConnection(name string, db *gorm.DB) {
+	connectionsMu.Lock()
+	connections[db.Config.ConnPool] = name
+	connectionsMu.Unlock()
+}
+
+// ConnectionName returns the name db was registered with, or an empty string
+// for the primary connection.
+func ConnectionName(db *gorm.DB) string {
+	if db == nil {
+		return ""
+	}
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+	return connections[db.Config.ConnPool]
+}
+
+// SetModelConnection migrates models on the named connection instead of the
+// primary one. A model may also implement Connection() string.
+func SetModelConnection(name string, models ...any) {
+	modelConnectionsMu.Lock()
+	defer modelConnectionsMu.Unlock()
+	for _, model := range models {
+		modelConnections[modelType(model)] = name
+	}
+}
+
+// ModelConnection returns the connection model is migrated on, or an empty
+// string for the primary connection.
+func ModelConnection(model any) string {
+	if obj, ok := model.(interface{ Connection() string }); ok {
+		return obj.Connection()
+	}
+	modelConnectionsMu.RLock()
+	defer modelConnectionsMu.RUnlock()
+	return modelConnections[modelType(model)]
+}
+
+func modelType(model any) reflect.Type {
+	var t = reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// connectionModels returns the registered models migrated on db, limited
+// to the ones kept by the filter of OnlyModels.
+func connectionModels(db *gorm.DB) []any {
+	var name = ConnectionName(db)
+	var keep, _ = db.Get(modelsKey)
+	var filter, _ = keep.(func(model any) bool)
+	var models []any
+	for _, model := range migrations {
+		if ModelConnection(model) == name && (filter == nil || filter(model)) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// modelsKey is the gorm setting holding the model filter set by OnlyModels.
+const modelsKey = "evo:models"
+
+// OnlyModels returns a session of db whose migrations only cover the
+// registered models keep returns true for.
+func OnlyModels(db *gorm.DB, keep func(model any) bool) *gorm.DB {
+	return db.Set(modelsKey, keep).Session(&gorm.Session{})
+}
+
+// connectionVersioned returns the versioned migrations that run on db.
+func connectionVersioned(db *gorm.DB) []VersionedMigration {
+	var name = ConnectionName(db)
+	var result []VersionedMigration
+	for _, m := range versioned {
+		if m.Connection == name {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// dialectFor returns the dialect of db. A named connection may use another
+// engine than the primary one, so its dialect comes from the registry.
+func dialectFor(db *gorm.DB) Dialect {
+	if ConnectionName(db) != "" {
+		if d, ok := dialectRegistry[db.Dialector.Name()]; ok {
+			return d
+		}
+	}
+	if d := GetDialect(); d != nil {
+		return d
+	}
+	return InitDialect(db)
+}
+
+// schemaKey is the gorm setting holding the database schema set by InSchema.
+const schemaKey = "evo:schema"
+
+// InSchema returns a session of db whose migrations introspect the given
+// database schema instead of the configured one. The statements themselves
+// are unqualified, so db must also resolve them there, for example through
+// the PostgreSQL search_path of a pinned connection.
+func InSchema(db *gorm.DB, name string) *gorm.DB {
+	return db.Set(schemaKey, name).Session(&gorm.Session{})
+}
+
+// SchemaOf returns the database schema set on db with InSchema.
+func SchemaOf(db *gorm.DB) (string, bool) {
+	if v, ok := db.Get(schemaKey); ok {
+		name, ok := v.(string)
+		return name, ok && name != ""
+	}
+	return "", false
+}
+
+// pinned reports whether db already runs on a single connection, such as a
+// session on the connection of a db.Connection callback.
+func pinned(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(*sql.Conn)
+	return ok
+}
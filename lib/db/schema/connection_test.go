@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type primaryModel struct{ ID int }
+
+type analyticsEvent struct{ ID int }
+
+type archiveRecord struct{ ID int }
+
+func (archiveRecord) Connection() string { return "archive" }
+
+func TestConnectionModels(t *testing.T) {
+	db, _ := newVersionedTestDB(t)
+	analytics, _ := newVersionedTestDB(t)
+	RegisterConnection("analytics", analytics)
+
+	migrations = []any{&primaryModel{}, &analyticsEvent{}, archiveRecord{}}
+	SetModelConnection("analytics", analyticsEvent{})
+
+	if got := ConnectionName(db); got != "" {
+		t.Errorf("expected the primary connection, got %q", got)
+	}
+	if got := ConnectionName(analytics.Session(&gorm.Session{}).Debug()); got != "analytics" {
+		t.Errorf("expected sessions to keep the connection name, got %q", got)
+	}
+	if got := connectionModels(db); len(got) != 1 || got[0] != migrations[0] {
+		t.Errorf("expected only the primary model on the primary connection, got %v", got)
+	}
+	if got := connectionModels(analytics); len(got) != 1 || got[0] != migrations[1] {
+		t.Errorf("expected only the analytics model on the analytics connection, got %v", got)
+	}
+	only := OnlyModels(db, func(model any) bool { return false })
+	if got := connectionModels(only); len(got) != 0 {
+		t.Errorf("expected the filter of OnlyModels applied, got %v", got)
+	}
+	if got := ModelConnection(&archiveRecord{}); got != "archive" {
+		t.Errorf("expected the Connection() method to win, got %q", got)
+	}
+}
+
+func TestVersionedMigrationsRunOnTheirConnection(t *testing.T) {
+	db, _ := newVersionedTestDB(t)
+	analytics, _ := newVersionedTestDB(t)
+	RegisterConnection("analytics", analytics)
+
+	RegisterMigration("001_primary", exec("CREATE TABLE primary_only (id INT)"), nil)
+	RegisterVersionedMigration(VersionedMigration{ID: "002_analytics", Connection: "analytics", Up: exec("CREATE TABLE analytics_only (id INT)")})
+
+	if err := DoMigration(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := DoMigration(analytics); err != nil {
+		t.Fatal(err)
+	}
+	for conn, tables := range map[*gorm.DB][2]string{db: {"primary_only", "analytics_only"}, analytics: {"analytics_only", "primary_only"}} {
+		if !conn.Migrator().HasTable(tables[0]) {
+			t.Errorf("expected %s to be created", tables[0])
+		}
+		if conn.Migrator().HasTable(tables[1]) {
+			t.Errorf("expected %s to be created on the other connection only", tables[1])
+		}
+	}
+}
+
+func TestDoMigrationOnPinnedConnection(t *testing.T) {
+	db, d := newVersionedTestDB(t)
+	RegisterMigration("001_pinned", exec("CREATE TABLE pinned (id INT)"), nil)
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	session := db.Session(&gorm.Session{})
+	session.Statement.ConnPool = conn
+	session = InSchema(session, "tenant_acme")
+
+	if name, ok := SchemaOf(session); !ok || name != "tenant_acme" {
+		t.Errorf("expected the session schema, got %q", name)
+	}
+	if err := DoMigration(session); err != nil {
+		t.Fatal(err)
+	}
+	if d.locks != 1 || d.unlocks != 1 {
+		t.Errorf("expected the lock on the pinned connection, got %d/%d", d.locks, d.unlocks)
+	}
+	if !db.Migrator().HasTable("pinned") {
+		t.Error("expected the migration to run on the pinned connection")
+	}
+}
@@ -0,0 +1,573 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getevo/json"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrUnknownExportFormat is returned by Export for an unsupported format.
+var ErrUnknownExportFormat = errors.New("unknown schema export format")
+
+// ExportFormats lists the formats supported by Export.
+var ExportFormats = []string{"mermaid", "dbml", "markdown", "json"}
+
+// Relation types.
+const (
+	ManyToOne  = "many_to_one"
+	OneToOne   = "one_to_one"
+	ManyToMany = "many_to_many"
+)
+
+// Table describes the table of a registered model for documentation.
+type Table struct {
+	Name        string
+	Model       string
+	Description string
+	PrimaryKey  []string
+	Columns     Columns
+	Indexes     Indexes
+}
+
+// Relation is a reference from a column of Table to a column of
+// ReferencedTable. Many-to-many relations go through the Through table.
+type Relation struct {
+	Table            string
+	Column           string
+	ReferencedTable  string
+	ReferencedColumn string
+	Type             string
+	Through          string
+}
+
+// Describe returns the tables of the models registered on db, sorted by
+// name, and the relations between them: the GORM associations, the fk tags
+// and, when the dialect can read them, the foreign keys of the database.
+//
+// Column descriptions come from the comment setting of the gorm tag or the
+// description tag; table descriptions from a TableDescription() string
+// method on the model.
+func Describe(db *gorm.DB) ([]Table, []Relation) {
+	var tables []Table
+	var found []Relation
+	for _, el := range connectionModels(db) {
+		ref := reflect.ValueOf(el)
+		for ref.Kind() == reflect.Ptr {
+			ref = ref.Elem()
+		}
+		if ref.Kind() != reflect.Struct {
+			continue
+		}
+		stmt := db.Session(&gorm.Session{NewDB: true}).Model(el).Statement
+		if err := stmt.Parse(el); err != nil || stmt.Schema == nil {
+			continue
+		}
+		var table = describeTable(stmt)
+		table.Model = ref.Type().Name()
+		if model := Find(el); model != nil {
+			table.Model = model.Name
+		}
+		if obj, ok := el.(interface{ TableDescription() string }); ok {
+			table.Description = obj.TableDescription()
+		}
+		tables = append(tables, table)
+
+		for _, column := range table.Columns {
+			if column.ForeignKey == "" {
+				continue
+			}
+			referencedTable, referencedColumn, _ := strings.Cut(column.ForeignKey, ".")
+			found = append(found, Relation{Table: table.Name, Column: column.Name, ReferencedTable: referencedTable, ReferencedColumn: referencedColumn, Type: ManyToOne})
+		}
+		for _, relation := range stmt.Schema.Relationships.Relations {
+			found = append(found, describeRelation(relation)...)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+
+	var known = map[string]bool{}
+	var primaryKeys = map[string]string{}
+	for _, table := range tables {
+		known[table.Name] = true
+		if len(table.PrimaryKey) == 1 {
+			primaryKeys[table.Name] = table.PrimaryKey[0]
+		}
+	}
+	if d := dialectFor(db); d != nil && len(tables) > 0 {
+		for _, constraint := range d.GetJoinConstraints(db, d.GetCurrentDatabase(db)) {
+			if known[constraint.Table] {
+				found = append(found, Relation{Table: constraint.Table, Column: constraint.Column, ReferencedTable: constraint.ReferencedTable, ReferencedColumn: constraint.ReferencedColumn, Type: ManyToOne})
+			}
+		}
+	}
+
+	var relations []Relation
+	var seen = map[Relation]int{}
+	for _, r := range found {
+		// fk tags may name the referenced table only.
+		if r.ReferencedColumn == "" && r.Type != ManyToMany {
+			r.ReferencedColumn = primaryKeys[r.ReferencedTable]
+		}
+		var key = r
+		key.Type = ""
+		if i, ok := seen[key]; ok {
+			// A has-one seen from the other side is a belongs-to.
+			if r.Type == OneToOne {
+				relations[i].Type = OneToOne
+			}
+			continue
+		}
+		seen[key] = len(relations)
+		relations = append(relations, r)
+	}
+
+	sort.SliceStable(relations, func(i, j int) bool {
+		if relations[i].Table != relations[j].Table {
+			return relations[i].Table < relations[j].Table
+		}
+		return relations[i].Column < relations[j].Column
+	})
+	return tables, relations
+}
+
+// describeTable returns the columns and indexes of a parsed model, the way
+// the migration dialects read them, with the column type of db's dialect.
+func describeTable(stmt *gorm.Statement) Table {
+	var table = Table{Name: stmt.Table}
+	for _, field := range stmt.Schema.Fields {
+		if field.IgnoreMigration || field.DBName == "" {
+			continue
+		}
+		var column = Column{
+			Name:          field.DBName,
+			Type:          columnType(stmt.Dialector.DataTypeOf(field)),
+			Size:          field.Size,
+			Scale:         field.Scale,
+			Precision:     field.Precision,
+			Default:       field.DefaultValue,
+			AutoIncrement: field.AutoIncrement,
+			PrimaryKey:    field.PrimaryKey,
+			Unique:        field.Unique,
+			Comment:       field.Comment,
+			ForeignKey:    field.TagSettings["FK"],
+		}
+		if column.Comment == "" {
+			column.Comment = field.Tag.Get("description")
+		}
+		if _, ok := field.TagSettings["FULLTEXT"]; ok {
+			column.FullText = true
+		}
+		_, nullable := field.TagSettings["NULLABLE"]
+		if (field.FieldType.Kind() == reflect.Ptr || nullable) && !field.NotNull && !field.PrimaryKey {
+			column.Nullable = true
+		}
+
+		var r = field.IndirectFieldType
+		for r.Kind() == reflect.Ptr {
+			r = r.Elem()
+		}
+		var ref = reflect.New(r)
+		if obj, ok := ref.Interface().(interface{ ColumnDefinition(column *Column) }); ok {
+			obj.ColumnDefinition(&column)
+		} else if obj, ok := ref.Elem().Interface().(interface{ ColumnDefinition(column *Column) }); ok {
+			obj.ColumnDefinition(&column)
+		}
+		column.Default = TrimQuotes(column.Default)
+
+		table.Columns = append(table.Columns, column)
+		if column.PrimaryKey {
+			table.PrimaryKey = append(table.PrimaryKey, column.Name)
+		}
+		if column.Unique {
+			table.Indexes = append(table.Indexes, Index{
+				Name:    "idx_unique_" + table.Name + "_" + column.Name,
+				Unique:  true,
+				Columns: Columns{column},
+			})
+		}
+	}
+
+	for _, index := range stmt.Schema.ParseIndexes() {
+		var idx = Index{Name: index.Name, Unique: index.Class == "UNIQUE", FullText: index.Class == "FULLTEXT"}
+		for _, option := range index.Fields {
+			if column := table.Columns.Find(option.DBName); column != nil {
+				idx.Columns = append(idx.Columns, *column)
+			}
+		}
+		if len(idx.Columns) == 0 {
+			continue
+		}
+		if idx.Unique && len(idx.Columns) == 1 {
+			table.Columns.Find(idx.Columns[0].Name).Unique = true
+		}
+		table.Indexes = append(table.Indexes, idx)
+	}
+	return table
+}
+
+// columnType drops the column options some dialects return with the type.
+func columnType(datatype string) string {
+	for _, option := range []string{" AUTO_INCREMENT", " auto_increment", " AUTOINCREMENT", " PRIMARY KEY", " NOT NULL"} {
+		datatype = strings.ReplaceAll(datatype, option, "")
+	}
+	return strings.TrimSpace(datatype)
+}
+
+// describeRelation returns the references of a GORM association, from the
+// table holding the foreign key.
+func describeRelation(relation *schema.Relationship) []Relation {
+	var result []Relation
+	switch relation.Type {
+	case schema.BelongsTo, schema.HasOne, schema.HasMany:
+		var kind = ManyToOne
+		if relation.Type == schema.HasOne {
+			kind = OneToOne
+		}
+		for _, reference := range relation.References {
+			if reference.PrimaryKey == nil || reference.ForeignKey == nil {
+				continue
+			}
+			result = append(result, Relation{
+				Table:            reference.ForeignKey.Schema.Table,
+				Column:           reference.ForeignKey.DBName,
+				ReferencedTable:  reference.PrimaryKey.Schema.Table,
+				ReferencedColumn: reference.PrimaryKey.DBName,
+				Type:             kind,
+			})
+		}
+	case schema.Many2Many:
+		if relation.JoinTable == nil {
+			return nil
+		}
+		var a, b = relation.Schema.Table, relation.FieldSchema.Table
+		if a > b {
+			a, b = b, a
+		}
+		result = append(result, Relation{Table: a, ReferencedTable: b, Type: ManyToMany, Through: relation.JoinTable.Table})
+	}
+	return result
+}
+
+// Export renders the schema of the models registered on db in format:
+// "mermaid" for an ER diagram, "dbml" for dbdiagram.io and similar tools,
+// "markdown" for a data dictionary preceded by the diagram, or "json".
+func Export(db *gorm.DB, format string) ([]byte, error) {
+	tables, relations := Describe(db)
+	switch strings.ToLower(format) {
+	case "mermaid":
+		return []byte(exportMermaid(tables, relations)), nil
+	case "dbml":
+		return []byte(exportDBML(tables, relations)), nil
+	case "markdown", "md":
+		return []byte(exportMarkdown(tables, relations)), nil
+	case "json":
+		return exportJSON(tables, relations)
+	}
+	return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownExportFormat, format, strings.Join(ExportFormats, ", "))
+}
+
+var mermaidInvalid = regexp.MustCompile(`[^A-Za-z0-9_\-\[\]()]`)
+
+func exportMermaid(tables []Table, relations []Relation) string {
+	var sb strings.Builder
+	sb.WriteString("erDiagram\n")
+	var foreign = foreignColumns(relations)
+	for _, table := range tables {
+		fmt.Fprintf(&sb, "    %s {\n", mermaidName(table.Name))
+		for _, column := range table.Columns {
+			var keys []string
+			if column.PrimaryKey {
+				keys = append(keys, "PK")
+			}
+			if foreign[table.Name+"."+column.Name] {
+				keys = append(keys, "FK")
+			}
+			if column.Unique {
+				keys = append(keys, "UK")
+			}
+			var typ = mermaidInvalid.ReplaceAllString(column.Type, "_")
+			if typ == "" {
+				typ = "unknown"
+			}
+			fmt.Fprintf(&sb, "        %s %s", typ, mermaidName(column.Name))
+			if len(keys) > 0 {
+				sb.WriteString(" " + strings.Join(keys, ", "))
+			}
+			if column.Comment != "" {
+				sb.WriteString(" " + strconv.Quote(strings.ReplaceAll(column.Comment, `"`, "'")))
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("    }\n")
+	}
+	var nullable = nullableColumns(tables)
+	for _, r := range relations {
+		var link, label string
+		switch r.Type {
+		case ManyToMany:
+			link, label = "}o--o{", r.Through
+		case OneToOne:
+			link, label = "|o--||", r.Column
+		default:
+			link, label = "}o--||", r.Column
+		}
+		if r.Type != ManyToMany && nullable[r.Table+"."+r.Column] {
+			link = strings.Replace(link, "||", "o|", 1)
+		}
+		fmt.Fprintf(&sb, "    %s %s %s : %s\n", mermaidName(r.Table), link, mermaidName(r.ReferencedTable), strconv.Quote(label))
+	}
+	return sb.String()
+}
+
+func mermaidName(name string) string {
+	return mermaidInvalid.ReplaceAllString(name, "_")
+}
+
+func exportDBML(tables []Table, relations []Relation) string {
+	var sb strings.Builder
+	for i, table := range tables {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "Table %s {\n", dbmlName(table.Name))
+		for _, column := range table.Columns {
+			var settings []string
+			if column.PrimaryKey {
+				settings = append(settings, "pk")
+			}
+			if column.AutoIncrement {
+				settings = append(settings, "increment")
+			}
+			if column.Unique {
+				settings = append(settings, "unique")
+			}
+			if !column.Nullable && !column.PrimaryKey {
+				settings = append(settings, "not null")
+			}
+			if column.Default != "" && !strings.EqualFold(column.Default, "NULL") {
+				settings = append(settings, "default: "+dbmlDefault(column.Default))
+			}
+			if column.Comment != "" {
+				settings = append(settings, "note: "+dbmlString(column.Comment))
+			}
+			fmt.Fprintf(&sb, "  %s %s", dbmlName(column.Name), dbmlName(column.Type))
+			if len(settings) > 0 {
+				sb.WriteString(" [" + strings.Join(settings, ", ") + "]")
+			}
+			sb.WriteString("\n")
+		}
+		var indexes []string
+		for _, index := range table.Indexes {
+			var names = index.Columns.Keys()
+			if len(names) == 1 && index.Unique {
+				continue // written as a column setting
+			}
+			var target = dbmlName(names[0])
+			if len(names) > 1 {
+				target = "(" + strings.Join(names, ", ") + ")"
+			}
+			var settings = []string{"name: " + dbmlString(index.Name)}
+			if index.Unique {
+				settings = append([]string{"unique"}, settings...)
+			}
+			indexes = append(indexes, fmt.Sprintf("    %s [%s]\n", target, strings.Join(settings, ", ")))
+		}
+		if len(indexes) > 0 {
+			sb.WriteString("\n  indexes {\n" + strings.Join(indexes, "") + "  }\n")
+		}
+		if table.Description != "" {
+			sb.WriteString("\n  Note: " + dbmlString(table.Description) + "\n")
+		}
+		sb.WriteString("}\n")
+	}
+	if len(relations) > 0 {
+		sb.WriteString("\n")
+	}
+	for _, r := range relations {
+		switch r.Type {
+		case ManyToMany:
+			fmt.Fprintf(&sb, "// %s and %s are related through %s\n", r.Table, r.ReferencedTable, r.Through)
+		case OneToOne:
+			fmt.Fprintf(&sb, "Ref: %s.%s - %s.%s\n", dbmlName(r.Table), dbmlName(r.Column), dbmlName(r.ReferencedTable), dbmlName(r.ReferencedColumn))
+		default:
+			fmt.Fprintf(&sb, "Ref: %s.%s > %s.%s\n", dbmlName(r.Table), dbmlName(r.Column), dbmlName(r.ReferencedTable), dbmlName(r.ReferencedColumn))
+		}
+	}
+	return sb.String()
+}
+
+var dbmlPlain = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\([0-9, ]*\))?$`)
+
+func dbmlName(name string) string {
+	if dbmlPlain.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+func dbmlString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`, "\n", " ").Replace(s) + "'"
+}
+
+func dbmlDefault(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	switch strings.ToLower(value) {
+	case "true", "false", "null":
+		return strings.ToLower(value)
+	}
+	if strings.Contains(value, "(") || strings.HasPrefix(strings.ToUpper(value), "CURRENT_") {
+		return "`" + value + "`"
+	}
+	return dbmlString(value)
+}
+
+func exportMarkdown(tables []Table, relations []Relation) string {
+	var sb strings.Builder
+	sb.WriteString("# Data dictionary\n\n")
+	sb.WriteString("```mermaid\n" + exportMermaid(tables, relations) + "```\n")
+
+	var outgoing = map[string][]Relation{}
+	for _, r := range relations {
+		outgoing[r.Table] = append(outgoing[r.Table], r)
+	}
+	for _, table := range tables {
+		fmt.Fprintf(&sb, "\n## %s\n\n", table.Name)
+		if table.Description != "" {
+			sb.WriteString(table.Description + "\n\n")
+		}
+		fmt.Fprintf(&sb, "Model `%s`.\n\n", table.Model)
+		sb.WriteString("| Column | Type | Nullable | Default | Key | Description |\n|---|---|---|---|---|---|\n")
+		for _, column := range table.Columns {
+			var keys []string
+			if column.PrimaryKey {
+				keys = append(keys, "PK")
+			}
+			if column.Unique {
+				keys = append(keys, "unique")
+			}
+			if column.AutoIncrement {
+				keys = append(keys, "auto increment")
+			}
+			var nullable = "no"
+			if column.Nullable {
+				nullable = "yes"
+			}
+			fmt.Fprintf(&sb, "| `%s` | %s | %s | %s | %s | %s |\n", column.Name, markdownCell(column.Type), nullable,
+				markdownCell(column.Default), strings.Join(keys, ", "), markdownCell(column.Comment))
+		}
+		if len(table.Indexes) > 0 {
+			sb.WriteString("\n**Indexes**\n\n| Name | Columns | Unique |\n|---|---|---|\n")
+			for _, index := range table.Indexes {
+				var unique = "no"
+				if index.Unique {
+					unique = "yes"
+				}
+				fmt.Fprintf(&sb, "| `%s` | %s | %s |\n", index.Name, strings.Join(index.Columns.Keys(), ", "), unique)
+			}
+		}
+		if len(outgoing[table.Name]) > 0 {
+			sb.WriteString("\n**References**\n\n")
+			for _, r := range outgoing[table.Name] {
+				if r.Type == ManyToMany {
+					fmt.Fprintf(&sb, "- many to many with [%s](#%s) through `%s`\n", r.ReferencedTable, r.ReferencedTable, r.Through)
+					continue
+				}
+				fmt.Fprintf(&sb, "- `%s` → [%s](#%s).`%s` (%s)\n", r.Column, r.ReferencedTable, r.ReferencedTable, r.ReferencedColumn, strings.ReplaceAll(r.Type, "_", " "))
+			}
+		}
+	}
+	return sb.String()
+}
+
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+func exportJSON(tables []Table, relations []Relation) ([]byte, error) {
+	type column struct {
+		Name          string `json:"name"`
+		Type          string `json:"type"`
+		Nullable      bool   `json:"nullable"`
+		PrimaryKey    bool   `json:"primary_key,omitempty"`
+		AutoIncrement bool   `json:"auto_increment,omitempty"`
+		Unique        bool   `json:"unique,omitempty"`
+		Default       string `json:"default,omitempty"`
+		Description   string `json:"description,omitempty"`
+	}
+	type index struct {
+		Name     string   `json:"name"`
+		Columns  []string `json:"columns"`
+		Unique   bool     `json:"unique,omitempty"`
+		FullText bool     `json:"full_text,omitempty"`
+	}
+	type table struct {
+		Name        string   `json:"name"`
+		Model       string   `json:"model"`
+		Description string   `json:"description,omitempty"`
+		PrimaryKey  []string `json:"primary_key"`
+		Columns     []column `json:"columns"`
+		Indexes     []index  `json:"indexes"`
+	}
+	type relation struct {
+		Table            string `json:"table"`
+		Column           string `json:"column,omitempty"`
+		ReferencedTable  string `json:"referenced_table"`
+		ReferencedColumn string `json:"referenced_column,omitempty"`
+		Type             string `json:"type"`
+		Through          string `json:"through,omitempty"`
+	}
+	var document = struct {
+		Tables    []table    `json:"tables"`
+		Relations []relation `json:"relations"`
+	}{Tables: []table{}, Relations: []relation{}}
+
+	for _, t := range tables {
+		var out = table{Name: t.Name, Model: t.Model, Description: t.Description, PrimaryKey: t.PrimaryKey, Columns: []column{}, Indexes: []index{}}
+		for _, c := range t.Columns {
+			out.Columns = append(out.Columns, column{
+				Name: c.Name, Type: c.Type, Nullable: c.Nullable, PrimaryKey: c.PrimaryKey,
+				AutoIncrement: c.AutoIncrement, Unique: c.Unique, Default: c.Default, Description: c.Comment,
+			})
+		}
+		for _, i := range t.Indexes {
+			out.Indexes = append(out.Indexes, index{Name: i.Name, Columns: i.Columns.Keys(), Unique: i.Unique, FullText: i.FullText})
+		}
+		document.Tables = append(document.Tables, out)
+	}
+	for _, r := range relations {
+		document.Relations = append(document.Relations, relation(r))
+	}
+	return json.MarshalIndent(document, "", "  ")
+}
+
+func foreignColumns(relations []Relation) map[string]bool {
+	var result = map[string]bool{}
+	for _, r := range relations {
+		if r.Column != "" {
+			result[r.Table+"."+r.Column] = true
+		}
+	}
+	return result
+}
+
+func nullableColumns(tables []Table) map[string]bool {
+	var result = map[string]bool{}
+	for _, table := range tables {
+		for _, column := range table.Columns {
+			if column.Nullable {
+				result[table.Name+"."+column.Name] = true
+			}
+		}
+	}
+	return result
+}
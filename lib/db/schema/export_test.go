@@ -0,0 +1,134 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/getevo/json"
+)
+
+type exportAuthor struct {
+	ID      uint   `gorm:"primaryKey;autoIncrement"`
+	Email   string `gorm:"uniqueIndex;size:255;comment:Login of the author"`
+	Profile exportProfile
+	Tags    []exportTag `gorm:"many2many:export_author_tags"`
+}
+
+func (exportAuthor) TableDescription() string { return "People writing posts." }
+
+type exportProfile struct {
+	ID             uint `gorm:"primaryKey"`
+	ExportAuthorID uint
+	Bio            *string `description:"Shown on the author page"`
+}
+
+type exportPost struct {
+	ID       uint   `gorm:"primaryKey"`
+	Title    string `gorm:"index:idx_title_status"`
+	Status   string `gorm:"index:idx_title_status;default:draft"`
+	AuthorID uint
+	Author   exportAuthor
+	TopicID  *uint `gorm:"fk:export_topics"`
+}
+
+type exportTag struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+type exportTopic struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func TestExport(t *testing.T) {
+	db, _ := newVersionedTestDB(t)
+	SetDialect(nil) // the test dialect cannot read foreign keys
+	migrations = []any{exportAuthor{}, exportProfile{}, exportPost{}, exportTag{}, exportTopic{}}
+
+	tables, relations := Describe(db)
+	if len(tables) != 5 || tables[0].Name != "export_authors" || tables[0].Description != "People writing posts." {
+		t.Fatalf("unexpected tables %+v", tables)
+	}
+	var posts = tables[1]
+	if posts.Name != "export_posts" || posts.Columns.Find("topic_id") == nil || !posts.Columns.Find("topic_id").Nullable {
+		t.Fatalf("unexpected posts table %+v", posts)
+	}
+	if c := posts.Columns.Find("status"); c.Default != "draft" || c.Nullable {
+		t.Errorf("unexpected status column %+v", c)
+	}
+	if idx := posts.Indexes.Find("idx_title_status"); idx == nil || len(idx.Columns) != 2 {
+		t.Errorf("expected the composite index, got %+v", posts.Indexes)
+	}
+
+	var got []string
+	for _, r := range relations {
+		got = append(got, r.Table+"."+r.Column+">"+r.ReferencedTable+"."+r.ReferencedColumn+":"+r.Type+r.Through)
+	}
+	var want = []string{
+		"export_authors.>export_tags.:many_to_manyexport_author_tags",
+		"export_posts.author_id>export_authors.id:many_to_one",
+		"export_posts.topic_id>export_topics.id:many_to_one",
+		"export_profiles.export_author_id>export_authors.id:one_to_one",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected relations\n%s", strings.Join(got, "\n"))
+	}
+
+	mermaid, _ := Export(db, "mermaid")
+	for _, line := range []string{
+		"erDiagram",
+		`text email UK "Login of the author"`,
+		`export_posts }o--o| export_topics : "topic_id"`,
+		`export_profiles |o--|| export_authors : "export_author_id"`,
+		`export_authors }o--o{ export_tags : "export_author_tags"`,
+	} {
+		if !strings.Contains(string(mermaid), line) {
+			t.Errorf("mermaid output misses %q:\n%s", line, mermaid)
+		}
+	}
+
+	dbml, _ := Export(db, "dbml")
+	for _, line := range []string{
+		"Table export_posts {",
+		"status text [not null, default: 'draft']",
+		"(title, status) [name: 'idx_title_status']",
+		"Note: 'People writing posts.'",
+		"Ref: export_posts.author_id > export_authors.id",
+		"Ref: export_profiles.export_author_id - export_authors.id",
+	} {
+		if !strings.Contains(string(dbml), line) {
+			t.Errorf("dbml output misses %q:\n%s", line, dbml)
+		}
+	}
+
+	markdown, _ := Export(db, "markdown")
+	for _, line := range []string{
+		"```mermaid",
+		"## export_profiles",
+		"| `bio` | text | yes |  |  | Shown on the author page |",
+		"- `author_id` → [export_authors](#export_authors).`id` (many to one)",
+	} {
+		if !strings.Contains(string(markdown), line) {
+			t.Errorf("markdown output misses %q:\n%s", line, markdown)
+		}
+	}
+
+	data, err := Export(db, "json")
+	var document struct {
+		Tables []struct {
+			Name    string `json:"name"`
+			Columns []struct {
+				Name string `json:"name"`
+			} `json:"columns"`
+		} `json:"tables"`
+		Relations []map[string]any `json:"relations"`
+	}
+	if err != nil || json.Unmarshal(data, &document) != nil || len(document.Tables) != 5 || len(document.Relations) != 4 {
+		t.Errorf("unexpected json output %s, %v", data, err)
+	}
+
+	if _, err = Export(db, "svg"); !errors.Is(err, ErrUnknownExportFormat) {
+		t.Errorf("expected ErrUnknownExportFormat, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"strings"
+)
+
+// SetFullTextLanguage sets the text search configuration of the PostgreSQL
+// full-text columns, english by default. MySQL ignores it.
+func SetFullTextLanguage(language string) {
+	SetConfig("fulltext_language", language)
+}
+
+// FullTextLanguage returns the text search configuration of the PostgreSQL
+// full-text columns.
+func FullTextLanguage() string {
+	return GetConfigDefault("fulltext_language", "english")
+}
+
+// FullTextIndex returns the full-text index of the columns tagged fulltext,
+// named ft_<table>, or nil when there are none.
+func FullTextIndex(table string, columns Columns, maxLen int) *Index {
+	var index = Index{Name: SafeIndexName("ft_"+table, maxLen), FullText: true}
+	for _, column := range columns {
+		if column.FullText {
+			index.Columns = append(index.Columns, column)
+		}
+	}
+	if len(index.Columns) == 0 {
+		return nil
+	}
+	return &index
+}
+
+// SearchVectorColumn returns the name of the generated tsvector column
+// PostgreSQL indexes the full-text index of columns on.
+func SearchVectorColumn(columns []string) string {
+	return SafeIndexName("tsv_"+strings.Join(columns, "_"), 63)
+}
+
+// SearchVectorExpression returns the expression computing the tsvector of
+// columns, each of them quoted with quote.
+func SearchVectorExpression(language string, columns []string, quote func(string) string) string {
+	var parts = make([]string, len(columns))
+	for i, column := range columns {
+		parts[i] = "coalesce(" + quote(column) + "::text, '')"
+	}
+	return "to_tsvector(" + QuoteLiteral(language) + "::regconfig, " + strings.Join(parts, " || ' ' || ") + ")"
+}
+
+// QuoteLiteral returns s as a SQL string literal.
+func QuoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -22,20 +22,28 @@ var migrations []any
 // ResetMigrations clears the registered migrations and models (used for testing).
 func ResetMigrations() {
 	migrations = nil
+	versioned = nil
 	Models = nil
 	database = ""
+	modelConnectionsMu.Lock()
+	modelConnections = map[reflect.Type]string{}
+	modelConnectionsMu.Unlock()
 }
 
 const null = "NULL"
 
 func GetMigrationScript(db *gorm.DB) []string {
+	var queries, _ = migrationScript(db)
+	return queries
+}
+
+// migrationScript generates the migration script along with the
+// classification of the statements generated from the model diff.
+func migrationScript(db *gorm.DB) ([]string, []StatementRisk) {
 	var queries []string
 
 	// Initialize dialect if needed
-	d := GetDialect()
-	if d == nil {
-		d = InitDialect(db)
-	}
+	d := dialectFor(db)
 
 	// Get current database
 	var database = d.GetCurrentDatabase(db)
@@ -43,7 +51,7 @@ func GetMigrationScript(db *gorm.DB) []string {
 	// Parse all registered models into GORM statements
 	var stmts []*gorm.Statement
 	var modelSlice []any
-	for _, el := range migrations {
+	for _, el := range connectionModels(db) {
 		var ref = reflect.ValueOf(el)
 		for {
 			if ref.Kind() == reflect.Ptr {
@@ -91,7 +99,12 @@ func GetMigrationScript(db *gorm.DB) []string {
 			tableName := stmts[idx].Schema.Table
 			var currentVersion = "0.0.0"
 			if result.TableExists[tableName] {
-				currentVersion = d.GetTableVersion(db, database, tableName)
+				// a table renamed by this migration is still known by its old name
+				if from, ok := result.RenamedFrom[tableName]; ok {
+					currentVersion = d.GetTableVersion(db, database, from)
+				} else {
+					currentVersion = d.GetTableVersion(db, database, tableName)
+				}
 			}
 			var buff []string
 			var ptr = "0.0.0"
@@ -119,7 +132,7 @@ func GetMigrationScript(db *gorm.DB) []string {
 	}
 
 	queries = append(queries, result.Tail...)
-	return queries
+	return queries, ClassifyStatements(append(append([]string{}, result.Queries...), result.Tail...))
 }
 
 // ComputeSchemaHash builds a deterministic hash from all registered GORM models.
@@ -133,7 +146,7 @@ func ComputeSchemaHash(db *gorm.DB) string {
 	}
 	var entries []tableEntry
 
-	for _, el := range migrations {
+	for _, el := range connectionModels(db) {
 		ref := reflect.ValueOf(el)
 		for ref.Kind() == reflect.Ptr {
 			ref = ref.Elem()
@@ -180,6 +193,12 @@ func ComputeSchemaHash(db *gorm.DB) string {
 				f.Size, f.Precision, f.Scale,
 				notNull, f.DefaultValue,
 			)
+			// tags the migration reads beyond the column type
+			for _, tag := range []string{"CHECK", "GENERATED", "STORED", "FULLTEXT"} {
+				if v, ok := f.TagSettings[tag]; ok {
+					line += "|" + tag + "=" + v
+				}
+			}
 			fields = append(fields, fieldInfo{dbName: f.DBName, line: line})
 		}
 		sort.Slice(fields, func(i, j int) bool {
@@ -191,6 +210,9 @@ func ComputeSchemaHash(db *gorm.DB) string {
 			buf.WriteString(fi.line)
 			buf.WriteByte('\n')
 		}
+		if definition, materialized, ok := ViewOf(stmt.Model); ok {
+			buf.WriteString(tableName + "|view|" + ViewComment(definition, materialized) + "\n")
+		}
 		entries = append(entries, tableEntry{tableName: tableName, canonical: buf.String()})
 	}
 
@@ -210,13 +232,13 @@ func ComputeSchemaHash(db *gorm.DB) string {
 // canSkipMigration checks if a successful migration with the same hash already exists.
 func canSkipMigration(db *gorm.DB, hash string) bool {
 	var id int64
-	db.Raw("SELECT id FROM schema_migration WHERE hash = ? AND status = 'success' ORDER BY id DESC LIMIT 1", hash).Scan(&id)
+	db.Raw("SELECT id FROM schema_migration WHERE hash = ? AND status = 'success' AND migration_id IS NULL ORDER BY id DESC LIMIT 1", hash).Scan(&id)
 	return id > 0
 }
 
 // recordMigration inserts a row into the schema_migration history table.
 func recordMigration(db *gorm.DB, hash, status string, executedQueries int, errorMessage string) {
-	d := GetDialect()
+	d := dialectFor(db)
 	now := time.Now().Format("2006-01-02 15:04:05")
 	var errMsg *string
 	if errorMessage != "" {
@@ -235,25 +257,24 @@ func recordMigration(db *gorm.DB, hash, status string, executedQueries int, erro
 	}
 }
 
+// DoMigration brings the database up to date: versioned migrations marked
+// BeforeModels, then the model diff, then the remaining versioned migrations.
+// The advisory lock is held throughout.
 func DoMigration(db *gorm.DB) error {
-	d := GetDialect()
-	if d == nil {
-		d = InitDialect(db)
-	}
-
-	// Bootstrap the history table
-	if err := d.BootstrapHistoryTable(db); err != nil {
-		log.Error("failed to bootstrap schema_migration table", "error", err)
-		return err
-	}
-
-	// Acquire advisory lock
-	if err := d.AcquireMigrationLock(db); err != nil {
-		log.Error("failed to acquire migration lock", "error", err)
-		return err
-	}
-	defer d.ReleaseMigrationLock(db)
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		if err := runVersioned(conn, true); err != nil {
+			return err
+		}
+		if err := migrateModels(conn); err != nil {
+			return err
+		}
+		return runVersioned(conn, false)
+	})
+}
 
+// migrateModels applies the model diff, unless the schema hash shows nothing
+// changed since the last successful run.
+func migrateModels(db *gorm.DB) error {
 	// Compute schema hash and check if we can skip
 	hash := ComputeSchemaHash(db)
 	if !args.Exists("--migration-force") && canSkipMigration(db, hash) {
@@ -262,13 +283,26 @@ func DoMigration(db *gorm.DB) error {
 	}
 
 	// Get migration queries
-	migrationQueries := GetMigrationScript(db)
+	migrationQueries, risks := migrationScript(db)
 	if len(migrationQueries) == 0 {
 		recordMigration(db, hash, "success", 0, "")
 		log.Info("no migration queries needed, recorded hash: " + hash)
 		return nil
 	}
 
+	// Refuse to drop or rewrite data unless explicitly allowed
+	if blocked := blockedStatements(risks); len(blocked) > 0 {
+		if !destructiveAllowed() {
+			for _, r := range blocked {
+				log.Error("refusing "+r.Risk.String()+" migration statement", "reason", r.Reason, "query", r.Query)
+			}
+			return fmt.Errorf("%w: %d statement(s), pass --migration-allow-destructive to execute them", ErrDestructiveMigration, len(blocked))
+		}
+		for _, r := range blocked {
+			log.Warning("executing "+r.Risk.String()+" migration statement", "reason", r.Reason, "query", r.Query)
+		}
+	}
+
 	// Execute
 	for _, fn := range OnBeforeMigration {
 		fn(db)
@@ -308,8 +342,9 @@ func DoMigration(db *gorm.DB) error {
 }
 
 // DryRunMigration prints the DDL that would be executed without actually running it.
+// A risk report of the model diff statements follows the script.
 func DryRunMigration(db *gorm.DB) []string {
-	queries := GetMigrationScript(db)
+	queries, risks := migrationScript(db)
 	if len(queries) == 0 {
 		fmt.Println("-- No migration queries to execute.")
 		return nil
@@ -319,21 +354,20 @@ func DryRunMigration(db *gorm.DB) []string {
 	for _, q := range queries {
 		fmt.Println(q)
 	}
+	fmt.Println()
+	PrintRiskReport(risks)
 	return queries
 }
 
 // DumpSchema prints the full CREATE TABLE DDL for all registered models
 // by passing an empty database name so the dialect sees no existing tables.
 func DumpSchema(db *gorm.DB) []string {
-	d := GetDialect()
-	if d == nil {
-		d = InitDialect(db)
-	}
+	d := dialectFor(db)
 
 	// Parse all registered models
 	var stmts []*gorm.Statement
 	var modelSlice []any
-	for _, el := range migrations {
+	for _, el := range connectionModels(db) {
 		ref := reflect.ValueOf(el)
 		for ref.Kind() == reflect.Ptr {
 			ref = ref.Elem()
@@ -0,0 +1,325 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/getevo/evo/v2/lib/args"
+	"gorm.io/gorm"
+)
+
+// Risk classifies what a migration statement may do to a live database.
+type Risk int
+
+const (
+	// RiskSafe statements neither lose data nor hold long locks.
+	RiskSafe Risk = iota
+	// RiskLockHeavy statements keep the data but may rewrite or scan the
+	// table while blocking writes.
+	RiskLockHeavy
+	// RiskDestructive statements may change or reject existing values, such
+	// as narrowing a type or adding NOT NULL.
+	RiskDestructive
+	// RiskDataLoss statements remove stored data, such as dropping a column.
+	RiskDataLoss
+)
+
+func (r Risk) String() string {
+	switch r {
+	case RiskLockHeavy:
+		return "lock-heavy"
+	case RiskDestructive:
+		return "destructive"
+	case RiskDataLoss:
+		return "data-loss"
+	}
+	return "safe"
+}
+
+// StatementRisk is the classification of one migration statement.
+type StatementRisk struct {
+	Query  string
+	Risk   Risk
+	Reason string
+}
+
+// ErrDestructiveMigration is returned by DoMigration when the model diff
+// contains destructive or data-loss statements and they were not allowed.
+var ErrDestructiveMigration = errors.New("migration contains destructive statements")
+
+// AllowDestructiveMigration lets DoMigration execute destructive and
+// data-loss statements, like the --migration-allow-destructive flag.
+func AllowDestructiveMigration(allow bool) {
+	SetConfig("allow_destructive_migration", strconv.FormatBool(allow))
+}
+
+func destructiveAllowed() bool {
+	return args.Exists("--migration-allow-destructive") || GetConfigDefault("allow_destructive_migration", "false") == "true"
+}
+
+var (
+	riskTableExpr    = regexp.MustCompile("(?i)^(?:ALTER TABLE|CREATE TABLE(?: IF NOT EXISTS)?|DROP TABLE(?: IF EXISTS)?|TRUNCATE(?: TABLE)?|RENAME TABLE|DELETE FROM)\\s+([`\"\\w.]+)")
+	riskIndexExpr    = regexp.MustCompile("(?i)^CREATE (?:UNIQUE |FULLTEXT )?INDEX(?: CONCURRENTLY)?(?: IF NOT EXISTS)?\\s+\\S+\\s+ON\\s+([`\"\\w.]+)")
+	riskColumnExpr   = regexp.MustCompile("(?i)(?:MODIFY COLUMN|ALTER COLUMN)\\s+[`\"]?([^`\"\\s]+)")
+	riskTypeExpr     = regexp.MustCompile(`^--\s*column (\S+) type does not match\. new:(.*) old:(.*)$`)
+	riskNullableExpr = regexp.MustCompile(`^--\s*column (\S+) nullable does not match\. new:(\w+) old:(\w+)`)
+	riskPositionExpr = regexp.MustCompile(`^--\s*column (\S+) position does not match`)
+	riskDropExpr     = regexp.MustCompile("(?i) DROP COLUMN\\s+[`\"]?([^`\"\\s;]+)")
+	riskComputedExpr = regexp.MustCompile(`^--\s*column (\S+) generated expression does not match`)
+)
+
+// ClassifyStatements classifies the statements of a generated migration.
+// Comment lines are skipped; the comments the generators write in front of a
+// statement are used to tell a widening type change from a narrowing one.
+// Statements on tables created by the same script are always safe.
+func ClassifyStatements(queries []string) []StatementRisk {
+	var result []StatementRisk
+	var created = map[string]bool{}
+	var context []string
+	var afterStatement bool
+	for _, query := range queries {
+		query = strings.TrimSpace(query)
+		if query == "" {
+			continue
+		}
+		if strings.HasPrefix(query, "--") {
+			if afterStatement {
+				context = nil
+				afterStatement = false
+			}
+			context = append(context, query)
+			continue
+		}
+		afterStatement = true
+
+		var upper = strings.ToUpper(strings.Join(strings.Fields(query), " "))
+		var table = riskTarget(query)
+		if strings.HasPrefix(upper, "CREATE TABLE") {
+			created[table] = true
+		}
+		var risk, reason = RiskSafe, ""
+		if table == "" || !created[table] {
+			risk, reason = classifyStatement(upper, query, context)
+		}
+		result = append(result, StatementRisk{Query: query, Risk: risk, Reason: reason})
+	}
+	return result
+}
+
+// riskTarget returns the unquoted name of the table a statement works on.
+func riskTarget(query string) string {
+	var m = riskIndexExpr.FindStringSubmatch(query)
+	if m == nil {
+		m = riskTableExpr.FindStringSubmatch(query)
+	}
+	if m == nil {
+		return ""
+	}
+	return strings.NewReplacer("`", "", `"`, "").Replace(m[1])
+}
+
+func classifyStatement(upper, query string, context []string) (Risk, string) {
+	switch {
+	case strings.HasPrefix(upper, "DROP TABLE"):
+		return RiskDataLoss, "drops the table"
+	case strings.HasPrefix(upper, "TRUNCATE"):
+		return RiskDataLoss, "deletes every row"
+	case strings.HasPrefix(upper, "DELETE FROM") && !strings.Contains(upper, " WHERE "):
+		return RiskDataLoss, "deletes every row"
+	case strings.Contains(upper, " DROP COLUMN "):
+		if m := riskDropExpr.FindStringSubmatch(query); m != nil {
+			for _, comment := range context {
+				if c := riskComputedExpr.FindStringSubmatch(comment); c != nil && c[1] == m[1] {
+					return RiskLockHeavy, fmt.Sprintf("recreates the generated column %s", m[1])
+				}
+			}
+		}
+		return RiskDataLoss, "drops the column"
+	case strings.Contains(upper, " SET NOT NULL"):
+		return RiskDestructive, "adds NOT NULL; existing NULL values make it fail"
+	case strings.Contains(upper, " MODIFY COLUMN ") || (strings.Contains(upper, " ALTER COLUMN ") && strings.Contains(upper, " TYPE ")):
+		return classifyColumnChange(upper, query, context)
+	case strings.Contains(upper, " FOREIGN KEY ") && strings.Contains(upper, " ADD CONSTRAINT "):
+		if strings.Contains(upper, " NOT VALID") {
+			return RiskSafe, ""
+		}
+		return RiskLockHeavy, "checks every existing row while locking both tables"
+	case strings.Contains(upper, " ADD PRIMARY KEY"), strings.Contains(upper, " DROP PRIMARY KEY"):
+		return RiskLockHeavy, "rebuilds the primary key"
+	case strings.Contains(upper, " ADD CONSTRAINT ") && strings.Contains(upper, " CHECK ("):
+		if strings.Contains(upper, " NOT VALID") {
+			return RiskSafe, ""
+		}
+		return RiskLockHeavy, "checks every existing row while locking the table"
+	case strings.Contains(upper, " ADD ") && strings.Contains(upper, " GENERATED ALWAYS AS ") && strings.Contains(upper, " STORED"):
+		return RiskLockHeavy, "computes the stored column while rewriting the table"
+	case strings.HasPrefix(upper, "CREATE INDEX"), strings.HasPrefix(upper, "CREATE UNIQUE INDEX"), strings.HasPrefix(upper, "CREATE FULLTEXT INDEX"):
+		if strings.Contains(upper, " CONCURRENTLY ") {
+			return RiskSafe, ""
+		}
+		return RiskLockHeavy, "builds an index on an existing table"
+	case strings.Contains(upper, " ENGINE="), strings.Contains(upper, " DEFAULT CHARACTER SET "):
+		return RiskLockHeavy, "rebuilds the table"
+	}
+	return RiskSafe, ""
+}
+
+// classifyColumnChange classifies MODIFY COLUMN and ALTER COLUMN ... TYPE
+// using the generator comments about the same column.
+func classifyColumnChange(upper, query string, context []string) (Risk, string) {
+	var column string
+	if m := riskColumnExpr.FindStringSubmatch(query); m != nil {
+		column = m[1]
+	}
+	var risk, reason = RiskSafe, ""
+	if strings.Contains(upper, " ALTER COLUMN ") {
+		// PostgreSQL rewrites the table for most type changes
+		risk, reason = RiskLockHeavy, "rewrites the table"
+	}
+	for _, comment := range context {
+		if m := riskTypeExpr.FindStringSubmatch(comment); m != nil && m[1] == column {
+			if narrowing(strings.TrimSpace(m[3]), strings.TrimSpace(m[2])) {
+				return RiskDestructive, fmt.Sprintf("changes type of %s from %s to %s; values may be truncated or fail to convert", column, m[3], m[2])
+			}
+			risk, reason = RiskLockHeavy, fmt.Sprintf("changes type of %s from %s to %s and rewrites the table", column, m[3], m[2])
+		}
+		if m := riskNullableExpr.FindStringSubmatch(comment); m != nil && m[1] == column && m[2] == "false" && m[3] == "true" {
+			return RiskDestructive, fmt.Sprintf("adds NOT NULL to %s; existing NULL values are rejected or replaced", column)
+		}
+		if m := riskPositionExpr.FindStringSubmatch(comment); m != nil && m[1] == column && risk == RiskSafe {
+			risk, reason = RiskLockHeavy, fmt.Sprintf("moves %s and rebuilds the table", column)
+		}
+	}
+	return risk, reason
+}
+
+// typeRank places a column type in a family of mutually convertible types,
+// ordered by how much they can hold.
+type typeRank struct {
+	family string
+	width  int64
+}
+
+var typeRanks = map[string]typeRank{
+	"bool": {"int", 1}, "boolean": {"int", 1}, "tinyint": {"int", 1},
+	"smallint": {"int", 2}, "int2": {"int", 2}, "mediumint": {"int", 3},
+	"int": {"int", 4}, "integer": {"int", 4}, "int4": {"int", 4}, "serial": {"int", 4},
+	"bigint": {"int", 8}, "int8": {"int", 8}, "bigserial": {"int", 8},
+	"real": {"float", 4}, "float4": {"float", 4},
+	"float": {"float", 8}, "double": {"float", 8}, "double precision": {"float", 8}, "float8": {"float", 8},
+	"char": {"string", 0}, "character": {"string", 0}, "varchar": {"string", 0}, "character varying": {"string", 0},
+	"tinytext": {"string", 255}, "text": {"string", 65535}, "mediumtext": {"string", 16777215}, "longtext": {"string", 4294967295},
+	"date": {"time", 1}, "time": {"time", 1}, "datetime": {"time", 2}, "timestamp": {"time", 2}, "timestamptz": {"time", 2},
+	"decimal": {"decimal", 0}, "numeric": {"decimal", 0},
+}
+
+// narrowing reports whether changing a column from one type to another may
+// lose or reject existing values.
+func narrowing(from, to string) bool {
+	from, to = strings.ToLower(from), strings.ToLower(to)
+	if from == to {
+		return false
+	}
+	if strings.HasPrefix(from, "enum(") || strings.HasPrefix(to, "enum(") {
+		if !strings.HasPrefix(from, "enum(") || !strings.HasPrefix(to, "enum(") {
+			return true
+		}
+		var values = enumValues(to)
+		for _, v := range enumValues(from) {
+			if !slices.Contains(values, v) {
+				return true
+			}
+		}
+		return false
+	}
+	fromFamily, fromWidth, fromScale := typeWidth(from)
+	toFamily, toWidth, toScale := typeWidth(to)
+	if fromFamily == "" || fromFamily != toFamily {
+		return true
+	}
+	return toWidth < fromWidth || toScale < fromScale
+}
+
+// typeWidth splits a column type into its family and size, for example
+// varchar(100) is ("string", 100, 0) and decimal(10,2) is ("decimal", 10, 2).
+func typeWidth(t string) (string, int64, int64) {
+	t = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(t), "unsigned"))
+	var base, params, _ = strings.Cut(t, "(")
+	base = strings.TrimSpace(base)
+	var rank, ok = typeRanks[base]
+	if !ok {
+		return base, 0, 0
+	}
+	var parts = strings.Split(strings.TrimSuffix(params, ")"), ",")
+	switch rank.family {
+	case "string":
+		if rank.width == 0 {
+			rank.width, _ = strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+		}
+		return rank.family, rank.width, 0
+	case "decimal":
+		var scale int64
+		rank.width, _ = strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+		if len(parts) > 1 {
+			scale, _ = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		}
+		return rank.family, rank.width, scale
+	}
+	// tinyint(1) is MySQL's boolean, any other tinyint holds a byte
+	if base == "tinyint" && strings.TrimSpace(parts[0]) != "1" {
+		rank.width = 2
+	}
+	return rank.family, rank.width, 0
+}
+
+func enumValues(t string) []string {
+	var inner = strings.TrimSuffix(strings.TrimPrefix(t, "enum("), ")")
+	var values []string
+	for _, v := range strings.Split(inner, ",") {
+		values = append(values, strings.Trim(strings.TrimSpace(v), `'"`))
+	}
+	return values
+}
+
+// blockedStatements returns the destructive and data-loss statements.
+func blockedStatements(risks []StatementRisk) []StatementRisk {
+	var result []StatementRisk
+	for _, r := range risks {
+		if r.Risk >= RiskDestructive {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// MigrationRisks classifies the statements the model diff would execute.
+// Version migrations declared with Migration() and registered versioned
+// migrations are written by hand and are not classified.
+func MigrationRisks(db *gorm.DB) []StatementRisk {
+	var _, risks = migrationScript(db)
+	return risks
+}
+
+// PrintRiskReport prints a summary of the classified statements followed by
+// every statement that is not safe, as SQL comments.
+func PrintRiskReport(risks []StatementRisk) {
+	var counts = map[Risk]int{}
+	for _, r := range risks {
+		counts[r.Risk]++
+	}
+	fmt.Printf("-- Risk report: %d statements, %d safe, %d lock-heavy, %d destructive, %d data-loss\n",
+		len(risks), counts[RiskSafe], counts[RiskLockHeavy], counts[RiskDestructive], counts[RiskDataLoss])
+	for _, r := range risks {
+		if r.Risk == RiskSafe {
+			continue
+		}
+		fmt.Printf("-- [%s] %s\n--     %s\n", r.Risk, r.Reason, strings.ReplaceAll(r.Query, "\n", " "))
+	}
+	if len(blockedStatements(risks)) > 0 && !destructiveAllowed() {
+		fmt.Println("-- --migration-do refuses destructive and data-loss statements; pass --migration-allow-destructive to run them.")
+	}
+}
@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyStatements(t *testing.T) {
+	risks := ClassifyStatements([]string{
+		"\r\n\r\n-- Migrate Model: app.Post(posts)",
+		"CREATE TABLE IF NOT EXISTS `posts`(`id` bigint(20) NOT NULL);",
+		"CREATE INDEX `idx_posts_id` ON `posts` (`id`);",
+		"\r\n\r\n-- Migrate Model: app.User(users)",
+		"-- column name type does not match. new:varchar(100) old:varchar(255)",
+		"ALTER TABLE `users` MODIFY COLUMN `name` varchar(100) NOT NULL;",
+		"-- column bio type does not match. new:longtext old:text",
+		"ALTER TABLE `users` MODIFY COLUMN `bio` longtext NULL;",
+		"-- column email nullable does not match. new:false old:true",
+		"ALTER TABLE `users` MODIFY COLUMN `email` varchar(255) NOT NULL;",
+		"ALTER TABLE `users` DROP COLUMN `legacy`;",
+		"CREATE INDEX `idx_users_email` ON `users` (`email`);",
+		`CREATE INDEX CONCURRENTLY "idx_users_name" ON "users" ("name");`,
+		`ALTER TABLE "users" ADD CONSTRAINT "fk_1" FOREIGN KEY ("team_id") REFERENCES "teams"("id") ON DELETE CASCADE ON UPDATE CASCADE NOT VALID;`,
+		`ALTER TABLE "users" VALIDATE CONSTRAINT "fk_1";`,
+		`ALTER TABLE "users" ALTER COLUMN "age" SET NOT NULL;`,
+		`COMMENT ON COLUMN "users"."age" IS 'years';`,
+		"CREATE FULLTEXT INDEX `ft_users` ON `users` (`bio`);",
+		`ALTER TABLE "users" ADD COLUMN "tsv_bio" tsvector GENERATED ALWAYS AS (to_tsvector('english'::regconfig, coalesce("bio"::text, ''))) STORED;`,
+		"-- column total generated expression does not match. new:price * qty old:price",
+		"ALTER TABLE `users` DROP COLUMN `total`;",
+		"ALTER TABLE `users` ADD `total` decimal(10,2) GENERATED ALWAYS AS (price * qty) STORED NULL AFTER `qty`;",
+		"ALTER TABLE `users` ADD `label` varchar(255) GENERATED ALWAYS AS (upper(name)) VIRTUAL NULL;",
+		"-- column legacy becomes generated. new:price",
+		"ALTER TABLE `users` DROP COLUMN `legacy`;",
+		"ALTER TABLE `users` ADD CONSTRAINT `chk_users_age` CHECK (age >= 0);",
+		`ALTER TABLE "users" ADD CONSTRAINT "chk_users_age" CHECK (age >= 0) NOT VALID;`,
+		`ALTER TABLE "users" VALIDATE CONSTRAINT "chk_users_age";`,
+		"CREATE OR REPLACE VIEW `active_users` AS SELECT id FROM users;",
+		`DROP MATERIALIZED VIEW IF EXISTS "user_totals";`,
+	})
+
+	want := []Risk{
+		RiskSafe, RiskSafe, // on a table created by the script
+		RiskDestructive, RiskLockHeavy, RiskDestructive, RiskDataLoss, RiskLockHeavy,
+		RiskSafe, RiskSafe, RiskSafe, RiskDestructive, RiskSafe,
+		RiskLockHeavy, RiskLockHeavy,
+		RiskLockHeavy, RiskLockHeavy, RiskSafe, RiskDataLoss,
+		RiskLockHeavy, RiskSafe, RiskSafe, RiskSafe, RiskSafe,
+	}
+	if len(risks) != len(want) {
+		t.Fatalf("expected %d statements, got %d: %+v", len(want), len(risks), risks)
+	}
+	for i, r := range risks {
+		if r.Risk != want[i] {
+			t.Errorf("%s: expected %s, got %s (%s)", r.Query, want[i], r.Risk, r.Reason)
+		}
+	}
+}
+
+func TestNarrowing(t *testing.T) {
+	cases := map[[2]string]bool{
+		{"varchar(255)", "varchar(100)"}:           true,
+		{"varchar(100)", "varchar(255)"}:           false,
+		{"varchar(255)", "text"}:                   false,
+		{"text", "varchar(255)"}:                   true,
+		{"bigint(20)", "int(11)"}:                  true,
+		{"int", "bigint"}:                          false,
+		{"tinyint(1)", "tinyint(4)"}:               false,
+		{"decimal(10,2)", "decimal(12,2)"}:         false,
+		{"decimal(10,4)", "decimal(12,2)"}:         true,
+		{"timestamp", "date"}:                      true,
+		{"varchar(20)", "int"}:                     true,
+		{"enum('a','b')", "enum('a','b','c')"}:     false,
+		{"enum('a','b','c')", "enum('a','c')"}:     true,
+		{"double precision", "real"}:               true,
+		{"bigint unsigned", "bigint(20) unsigned"}: false,
+	}
+	for c, want := range cases {
+		if got := narrowing(c[0], c[1]); got != want {
+			t.Errorf("%s -> %s: expected %t, got %t", c[0], c[1], want, got)
+		}
+	}
+}
+
+func TestDoMigrationRefusesDestructiveStatements(t *testing.T) {
+	db, d := newVersionedTestDB(t)
+	if err := db.Exec("CREATE TABLE notes (id INTEGER PRIMARY KEY, legacy TEXT)").Error; err != nil {
+		t.Fatal(err)
+	}
+	d.result = MigrationResult{Queries: []string{`ALTER TABLE "notes" DROP COLUMN "legacy";`}}
+	t.Cleanup(func() { AllowDestructiveMigration(false) })
+
+	if err := DoMigration(db); !errors.Is(err, ErrDestructiveMigration) {
+		t.Fatalf("expected the migration to be refused, got %v", err)
+	}
+	var columns int64
+	db.Raw("SELECT COUNT(*) FROM pragma_table_info('notes')").Scan(&columns)
+	if columns != 2 {
+		t.Fatalf("expected the column to be kept, found %d columns", columns)
+	}
+
+	AllowDestructiveMigration(true)
+	if err := DoMigration(db); err != nil {
+		t.Fatal(err)
+	}
+	db.Raw("SELECT COUNT(*) FROM pragma_table_info('notes')").Scan(&columns)
+	if columns != 1 {
+		t.Errorf("expected the column to be dropped, found %d columns", columns)
+	}
+}
@@ -129,6 +129,9 @@ func UseModel(db *gorm.DB, values ...any) {
 			}
 		}
 		for _, constraint := range constraints {
+			if constraint.Table != model.Table {
+				continue
+			}
 			model.Joins[constraint.ReferencedTable] = []string{constraint.Column, constraint.ReferencedColumn}
 		}
 
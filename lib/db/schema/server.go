@@ -0,0 +1,43 @@
+package schema
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/getevo/evo/v2/lib/version"
+)
+
+var serverVersionPattern = regexp.MustCompile(`^\d+(\.\d+)*`)
+
+// SetMySQLServer records the engine and version of the MySQL or MariaDB
+// server from its VERSION(), such as 8.0.36 or 10.4.32-MariaDB-log.
+func SetMySQLServer(serverVersion string) {
+	serverVersion = strings.ToLower(strings.TrimSpace(serverVersion))
+	var engine = "mysql"
+	if strings.Contains(serverVersion, "mariadb") {
+		engine = "mariadb"
+		// MariaDB prefixes its version for old replication clients
+		serverVersion = strings.TrimPrefix(serverVersion, "5.5.5-")
+	}
+	SetConfig("mysql_engine", engine)
+	SetConfig("mysql_version", serverVersionPattern.FindString(serverVersion))
+}
+
+// MySQLAtLeast reports whether the server is at least version mysql on
+// MySQL, or version mariadb on MariaDB; an empty version means the feature
+// does not exist on that engine. A server whose version was not recorded is
+// assumed to be recent.
+func MySQLAtLeast(mysql, mariadb string) bool {
+	var current, _ = GetConfig("mysql_version")
+	var want = mysql
+	if engine, _ := GetConfig("mysql_engine"); engine == "mariadb" {
+		want = mariadb
+	}
+	if want == "" {
+		return false
+	}
+	if current == "" {
+		return true
+	}
+	return version.Compare(current, want, ">=")
+}
@@ -0,0 +1,31 @@
+package schema
+
+import "testing"
+
+func TestMySQLAtLeast(t *testing.T) {
+	defer SetConfig("mysql_version", "")
+	defer SetConfig("mysql_engine", "mysql")
+
+	for _, tt := range []struct {
+		server string
+		want   bool
+	}{
+		{"8.0.36", true},
+		{"8.0.0-log", true},
+		{"5.7.44-log", false},
+		{"10.5.2-MariaDB", true},
+		{"5.5.5-10.11.6-MariaDB-1:10.11.6+maria~ubu2204", true},
+		{"10.4.32-MariaDB-log", false},
+		{"", true},
+	} {
+		SetMySQLServer(tt.server)
+		if got := MySQLAtLeast("8.0", "10.5.2"); got != tt.want {
+			t.Errorf("%q: expected %t, got %t", tt.server, tt.want, got)
+		}
+	}
+
+	SetMySQLServer("11.4.2-MariaDB")
+	if MySQLAtLeast("8.0.3", "") {
+		t.Error("expected a MySQL-only feature to be missing on MariaDB")
+	}
+}
@@ -0,0 +1,23 @@
+package schema
+
+import (
+	"strconv"
+)
+
+// SetPostGIS makes the point columns PostGIS geography(Point,4326) columns on
+// PostgreSQL instead of plain point columns. The postgis extension must be
+// installed in the database. MySQL ignores it.
+func SetPostGIS(enabled bool) {
+	SetConfig("postgis", strconv.FormatBool(enabled))
+}
+
+// PostGIS reports whether the point columns are PostGIS geography columns.
+func PostGIS() bool {
+	return GetConfigDefault("postgis", "false") == "true"
+}
+
+// SpatialIndex returns the spatial index of a column tagged spatial, named
+// idx_spatial_<name>.
+func SpatialIndex(name string, column Column, maxLen int) Index {
+	return Index{Name: SafeIndexName("idx_spatial_"+name, maxLen), Spatial: true, Columns: Columns{column}}
+}
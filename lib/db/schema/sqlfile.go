@@ -0,0 +1,373 @@
+package schema
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/log"
+	"gorm.io/gorm"
+)
+
+// sqlFileSuffix marks the schema_migration rows of applied migration files;
+// their migration_id is the file name.
+const sqlFileSuffix = ".sql"
+
+// GenerateMigrationFile writes the current migration script to a new file in
+// dir, named after the UTC time so that files sort in the order they were
+// generated, for review before it is applied with ApplyMigrationFiles. The
+// header carries the checksum of the statements and the risk report. It
+// returns the path of the file, or an empty string when the database is
+// already up to date.
+func GenerateMigrationFile(db *gorm.DB, dir string) (string, error) {
+	queries, risks := migrationScript(db)
+	if !hasStatements(queries) {
+		log.Info("schema is up to date, no migration file generated")
+		return "", nil
+	}
+
+	var body strings.Builder
+	for _, query := range queries {
+		query = strings.TrimSpace(strings.ReplaceAll(query, "\r\n", "\n"))
+		if query == "" {
+			continue
+		}
+		if strings.HasPrefix(query, "-- Migrate") {
+			body.WriteString("\n")
+		}
+		if !strings.HasPrefix(query, "--") && !strings.HasSuffix(query, ";") {
+			query += ";"
+		}
+		body.WriteString(query + "\n")
+	}
+
+	var content = strings.TrimLeft(body.String(), "\n")
+	var now = time.Now().UTC()
+	var header strings.Builder
+	header.WriteString("-- evo migration generated at " + now.Format(time.RFC3339) + "\n")
+	header.WriteString("-- checksum: " + Generate32CharHash(content) + "\n")
+	for _, r := range risks {
+		if r.Risk != RiskSafe {
+			header.WriteString(fmt.Sprintf("-- [%s] %s: %s\n", r.Risk, r.Reason, strings.ReplaceAll(r.Query, "\n", " ")))
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	var path = filepath.Join(dir, now.Format("20060102150405")+"_schema"+sqlFileSuffix)
+	if err := os.WriteFile(path, []byte(header.String()+"\n"+content), 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func hasStatements(queries []string) bool {
+	for _, query := range queries {
+		if query = strings.TrimSpace(query); query != "" && !strings.HasPrefix(query, "--") {
+			return true
+		}
+	}
+	return false
+}
+
+// migrationFile is a .sql file found in the migration directory.
+type migrationFile struct {
+	Name     string
+	Content  string
+	Checksum string
+}
+
+func readMigrationFiles(dir string) ([]migrationFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []migrationFile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), sqlFileSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var content = strings.ReplaceAll(string(data), "\r\n", "\n")
+		files = append(files, migrationFile{Name: entry.Name(), Content: content, Checksum: Generate32CharHash(content)})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// appliedMigrationFiles returns the checksum of every migration file
+// recorded as applied, by file name.
+func appliedMigrationFiles(db *gorm.DB) (map[string]string, error) {
+	var records []struct {
+		MigrationID string
+		Hash        string
+	}
+	err := db.Raw("SELECT migration_id, hash FROM schema_migration WHERE migration_id LIKE ? AND status = 'success' ORDER BY id", "%"+sqlFileSuffix).
+		Scan(&records).Error
+	var applied = map[string]string{}
+	for _, record := range records {
+		applied[record.MigrationID] = record.Hash
+	}
+	return applied, err
+}
+
+// failedMigrationFiles returns the number of statements that stayed applied
+// when each migration file last failed, by file name.
+func failedMigrationFiles(db *gorm.DB) (map[string]int, error) {
+	var records []struct {
+		MigrationID     string
+		ExecutedQueries int
+	}
+	err := db.Raw("SELECT migration_id, executed_queries FROM schema_migration WHERE migration_id LIKE ? AND status = 'failed' ORDER BY id", "%"+sqlFileSuffix).
+		Scan(&records).Error
+	var failed = map[string]int{}
+	for _, record := range records {
+		failed[record.MigrationID] = record.ExecutedQueries
+	}
+	return failed, err
+}
+
+// ApplyMigrationFiles applies the .sql files of dir that were not applied
+// yet, in file name order, and records each in schema_migration with its
+// checksum. Nothing is applied when an already applied file has changed
+// since. A failing file stops the run. Each file runs in a transaction, so
+// a failure leaves nothing of it applied, except on MySQL, which cannot
+// roll back DDL, and for files with CREATE or DROP INDEX CONCURRENTLY,
+// which PostgreSQL refuses in a transaction. There the statements before
+// the failure stay applied and are recorded, and the next run resumes the
+// file after them.
+//
+// Once the files are applied the live schema is compared with the models:
+// the model diff statements still needed to match them are returned as
+// drift.
+func ApplyMigrationFiles(db *gorm.DB, dir string) ([]string, error) {
+	files, err := readMigrationFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var drift []string
+	err = withMigrationLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedMigrationFiles(conn)
+		if err != nil {
+			return err
+		}
+		failed, err := failedMigrationFiles(conn)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if checksum, ok := applied[file.Name]; ok && checksum != file.Checksum {
+				return fmt.Errorf("migration file %s changed after it was applied (checksum %s, applied %s)", file.Name, file.Checksum, checksum)
+			}
+		}
+		for _, file := range files {
+			if _, ok := applied[file.Name]; ok {
+				continue
+			}
+			if err := applyMigrationFile(conn, file, failed[file.Name]); err != nil {
+				return err
+			}
+		}
+
+		var _, risks = migrationScript(conn)
+		for _, r := range risks {
+			drift = append(drift, r.Query)
+		}
+		if len(drift) == 0 {
+			// let --migration-do skip the diff until the models change
+			recordMigration(conn, ComputeSchemaHash(conn), "success", 0, "")
+		}
+		return nil
+	})
+	for _, query := range drift {
+		log.Warning("schema drift: the live schema does not match the models", "missing", query)
+	}
+	return drift, err
+}
+
+// applyMigrationFile runs the statements of file, skipping the first done
+// ones that stayed applied when it last failed outside a transaction.
+func applyMigrationFile(conn *gorm.DB, file migrationFile, done int) error {
+	log.Info("applying migration file", "file", file.Name)
+	if header, ok := fileChecksum(file.Content); ok && header != Generate32CharHash(fileBody(file.Content)) {
+		log.Warning("migration file was edited after it was generated", "file", file.Name)
+	}
+	var d = dialectFor(conn)
+	var mysql = d != nil && d.Name() == "mysql"
+	var statements = splitStatements(file.Content, mysql)
+	var transactional = !mysql && !hasConcurrently(statements)
+
+	var executed int
+	var run = func(tx *gorm.DB) error {
+		for ; executed < len(statements); executed++ {
+			if err := tx.Exec(statements[executed]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var err error
+	if transactional {
+		err = conn.Transaction(run)
+	} else {
+		if done > 0 && done < len(statements) {
+			log.Info("resuming migration file", "file", file.Name, "statement", done+1)
+			executed = done
+		}
+		err = run(conn)
+	}
+	if err != nil {
+		var message = fmt.Sprintf("statement %d: %s", executed+1, err)
+		if transactional {
+			// rolled back with the transaction
+			executed = 0
+		}
+		if recordErr := recordMigrationFile(conn, file, "failed", executed, message); recordErr != nil {
+			log.Error("failed to record migration history", "error", recordErr)
+		}
+		return fmt.Errorf("migration file %s: %s", file.Name, message)
+	}
+	return recordMigrationFile(conn, file, "success", len(statements), "")
+}
+
+// hasConcurrently reports whether one of statements builds or drops an index
+// concurrently, which PostgreSQL refuses inside a transaction.
+func hasConcurrently(statements []string) bool {
+	for _, statement := range statements {
+		if strings.Contains(strings.ToUpper(statement), " CONCURRENTLY ") {
+			return true
+		}
+	}
+	return false
+}
+
+func recordMigrationFile(db *gorm.DB, file migrationFile, status string, executed int, errorMessage string) error {
+	var errMsg *string
+	if errorMessage != "" {
+		errMsg = &errorMessage
+	}
+	return db.Exec("INSERT INTO schema_migration (hash, status, executed_queries, error_message, migration_id, created_at) VALUES (?,?,?,?,?,?)",
+		file.Checksum, status, executed, errMsg, file.Name, time.Now().Format("2006-01-02 15:04:05")).Error
+}
+
+// fileChecksum returns the checksum written in the header of a generated file.
+func fileChecksum(content string) (string, bool) {
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		if checksum, ok := strings.CutPrefix(line, "-- checksum: "); ok {
+			return strings.TrimSpace(checksum), true
+		}
+	}
+	return "", false
+}
+
+// fileBody returns what follows the header of a generated file, which ends
+// at the first blank line.
+func fileBody(content string) string {
+	var _, body, _ = strings.Cut(content, "\n\n")
+	return body
+}
+
+// splitStatements splits a SQL script on the semicolons that end its
+// statements, ignoring those inside quotes, dollar-quoted bodies and
+// comments. Comments are dropped. With backslashEscapes, as on MySQL, a
+// backslash escapes the next character of a quoted string.
+func splitStatements(script string, backslashEscapes bool) []string {
+	var statements []string
+	var current strings.Builder
+	flush := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+	for i := 0; i < len(script); i++ {
+		var c = script[i]
+		switch {
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+				current.WriteByte('\n')
+			} else {
+				i = len(script)
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(script)
+			}
+		case c == '\'' || c == '"' || c == '`':
+			var end = quoteEnd(script[i+1:], c, backslashEscapes && c != '`')
+			if end < 0 {
+				current.WriteString(script[i:])
+				i = len(script)
+				continue
+			}
+			current.WriteString(script[i : i+end+2])
+			i += end + 1
+		case c == '$':
+			var tag = dollarTag(script[i:])
+			if tag == "" {
+				current.WriteByte(c)
+				continue
+			}
+			var end = strings.Index(script[i+len(tag):], tag)
+			if end < 0 {
+				current.WriteString(script[i:])
+				i = len(script)
+				continue
+			}
+			current.WriteString(script[i : i+len(tag)+end+len(tag)])
+			i += len(tag) + end + len(tag) - 1
+		case c == ';':
+			current.WriteByte(c)
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+// quoteEnd returns the index in s of the quote c that closes a string, or
+// -1 when the string is not closed.
+func quoteEnd(s string, c byte, backslashEscapes bool) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if backslashEscapes {
+				i++
+			}
+		case c:
+			return i
+		}
+	}
+	return -1
+}
+
+// dollarTag returns the PostgreSQL dollar quote ($$ or $tag$) s starts with.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$':
+			return s[:i+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9':
+		default:
+			return ""
+		}
+	}
+	return ""
+}
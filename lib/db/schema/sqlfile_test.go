@@ -0,0 +1,179 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	got := splitStatements(`-- header; with a semicolon
+CREATE TABLE "notes"(
+	"id" INTEGER, -- trailing; comment
+	"body" TEXT DEFAULT 'a;b'
+);
+/* block; comment */
+DO $$ BEGIN CREATE TYPE "mood" AS ENUM ('a'); EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+ALTER TABLE `+"`notes`"+` ADD `+"`x;y`"+` int`, false)
+
+	want := []string{
+		`CREATE TABLE "notes"(`,
+		`DO $$ BEGIN CREATE TYPE "mood" AS ENUM ('a'); EXCEPTION WHEN duplicate_object THEN NULL; END $$;`,
+		`CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;`,
+		"ALTER TABLE `notes` ADD `x;y` int",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d statements, got %d: %q", len(want), len(got), got)
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("statement %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+	if !strings.Contains(got[0], "'a;b'") || strings.Contains(got[0], "comment") {
+		t.Errorf("expected the quoted semicolon to be kept and comments dropped, got %q", got[0])
+	}
+}
+
+func TestSplitStatements_BackslashEscapes(t *testing.T) {
+	var script = `INSERT INTO notes VALUES ('it\'s;', "say \"hi\";"); SELECT '\\';`
+	got := splitStatements(script, true)
+	want := []string{`INSERT INTO notes VALUES ('it\'s;', "say \"hi\";");`, `SELECT '\\';`}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// without backslash escapes, as on PostgreSQL, a quote is doubled
+	got = splitStatements(`SELECT 'C:\'; SELECT 'it''s;';`, false)
+	if len(got) != 2 || got[1] != `SELECT 'it''s;';` {
+		t.Errorf("expected two statements, got %q", got)
+	}
+}
+
+func TestGenerateAndApplyMigrationFiles(t *testing.T) {
+	db, d := newVersionedTestDB(t)
+	dir := t.TempDir()
+	d.result = MigrationResult{
+		Queries: []string{
+			"\r\n\r\n-- Migrate Model: app.Note(notes)",
+			"CREATE TABLE IF NOT EXISTS \"notes\"(\r\n\t\"id\" INTEGER,\r\n\t\"body\" TEXT DEFAULT 'x;y'\r\n);",
+		},
+		Tail: []string{"-- create index", `CREATE INDEX "idx_notes_body" ON "notes" ("body")`},
+	}
+
+	path, err := GenerateMigrationFile(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "-- evo migration generated at ") || !strings.Contains(string(data), `("body");`) {
+		t.Fatalf("unexpected file content:\n%s", data)
+	}
+
+	// the models now match what the file creates
+	d.result = MigrationResult{}
+	drift, err := ApplyMigrationFiles(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) != 0 {
+		t.Errorf("expected no drift, got %v", drift)
+	}
+	var count int64
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE name IN ('notes', 'idx_notes_body')").Scan(&count)
+	if count != 2 {
+		t.Fatalf("expected the file to be applied, found %d objects", count)
+	}
+
+	// applied files are skipped, new ones are applied in name order
+	os.WriteFile(filepath.Join(dir, "99999999999999_seed.sql"), []byte("INSERT INTO notes (id) VALUES (1);\nINSERT INTO notes (id) VALUES (2);\n"), 0o644)
+	d.result = MigrationResult{Queries: []string{`ALTER TABLE "notes" ADD COLUMN "extra" TEXT;`}}
+	drift, err = ApplyMigrationFiles(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Raw("SELECT COUNT(*) FROM notes").Scan(&count)
+	if count != 2 {
+		t.Errorf("expected the seed file to be applied once, found %d rows", count)
+	}
+	if len(drift) != 1 {
+		t.Errorf("expected the missing column to be reported as drift, got %v", drift)
+	}
+
+	// an applied file that changed is refused
+	os.WriteFile(path, append(data, []byte("DROP TABLE notes;\n")...), 0o644)
+	if _, err := ApplyMigrationFiles(db, dir); err == nil || !strings.Contains(err.Error(), "changed after it was applied") {
+		t.Fatalf("expected the changed file to be refused, got %v", err)
+	}
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE name = 'notes'").Scan(&count)
+	if count != 1 {
+		t.Error("expected the changed file not to run")
+	}
+
+	// file rows are not versioned migrations
+	if states, _ := MigrationStatus(db); len(states) != 0 {
+		t.Errorf("expected no versioned migrations, got %+v", states)
+	}
+}
+
+func TestApplyMigrationFilesStopsAtFailure(t *testing.T) {
+	db, _ := newVersionedTestDB(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "1_broken.sql"), []byte("CREATE TABLE a (id INTEGER);\nINSERT INTO missing VALUES (1);\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "2_next.sql"), []byte("CREATE TABLE b (id INTEGER);\n"), 0o644)
+
+	if _, err := ApplyMigrationFiles(db, dir); err == nil || !strings.Contains(err.Error(), "1_broken.sql: statement 2") {
+		t.Fatalf("expected the second statement of the first file to fail, got %v", err)
+	}
+	var count int64
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE name = 'b'").Scan(&count)
+	if count != 0 {
+		t.Error("expected the run to stop at the failing file")
+	}
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE name = 'a'").Scan(&count)
+	if count != 0 {
+		t.Error("expected the failing file to be rolled back")
+	}
+	applied, _ := appliedMigrationFiles(db)
+	if len(applied) != 0 {
+		t.Errorf("expected no file to be recorded as applied, got %v", applied)
+	}
+}
+
+// mysqlDialect makes the test dialect report MySQL, whose DDL cannot be
+// rolled back.
+type mysqlDialect struct{ *sqliteDialect }
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func TestApplyMigrationFilesResumesAfterFailure(t *testing.T) {
+	db, d := newVersionedTestDB(t)
+	SetDialect(mysqlDialect{d})
+	dir := t.TempDir()
+	var path = filepath.Join(dir, "1_partial.sql")
+	os.WriteFile(path, []byte("CREATE TABLE a (id INTEGER);\nINSERT INTO missing VALUES (1);\n"), 0o644)
+
+	if _, err := ApplyMigrationFiles(db, dir); err == nil || !strings.Contains(err.Error(), "statement 2") {
+		t.Fatalf("expected the second statement to fail, got %v", err)
+	}
+	var count int64
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE name = 'a'").Scan(&count)
+	if count != 1 {
+		t.Fatal("expected the first statement to stay applied")
+	}
+
+	// the fixed file resumes after the statement that stayed applied
+	os.WriteFile(path, []byte("CREATE TABLE a (id INTEGER);\nINSERT INTO a VALUES (1);\n"), 0o644)
+	if _, err := ApplyMigrationFiles(db, dir); err != nil {
+		t.Fatal(err)
+	}
+	db.Raw("SELECT COUNT(*) FROM a").Scan(&count)
+	if count != 1 {
+		t.Errorf("expected the remaining statement to run once, found %d rows", count)
+	}
+	if applied, _ := appliedMigrationFiles(db); len(applied) != 1 {
+		t.Errorf("expected the file to be recorded as applied, got %v", applied)
+	}
+}
@@ -3,6 +3,7 @@ package schema
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"slices"
 	"sync"
 )
 
@@ -16,9 +17,10 @@ var InternalFunctions = [][]string{
 
 // MigrationResult holds the output of a dialect's GenerateMigration call.
 type MigrationResult struct {
-	Queries     []string        // CREATE/ALTER statements
-	Tail        []string        // FK constraints (deferred)
-	TableExists map[string]bool // which tables exist (for version migrations)
+	Queries     []string          // CREATE/ALTER statements
+	Tail        []string          // FK constraints (deferred)
+	TableExists map[string]bool   // which tables exist (for version migrations)
+	RenamedFrom map[string]string // new table name -> old name, for tables renamed by this migration
 }
 
 // JoinConstraint represents a foreign key relationship between two tables.
@@ -50,6 +52,9 @@ type Column struct {
 	ForeignKey    string
 	After         string
 	FullText      bool
+	RenamedFrom   string // previous column name, from the renamed_from tag
+	Generated     string // expression of a generated column, from the generated tag
+	Stored        bool   // the generated column is stored rather than virtual
 }
 
 // Columns is a slice of Column with helper methods.
@@ -79,6 +84,7 @@ type Index struct {
 	Name     string
 	Unique   bool
 	FullText bool
+	Spatial  bool
 	Columns  Columns
 }
 
@@ -95,6 +101,68 @@ func (list Indexes) Find(name string) *Index {
 	return nil
 }
 
+// Rename is a column, index or table whose name changed.
+type Rename struct {
+	From string
+	To   string
+}
+
+// TableRenamedFrom returns the previous table name of a model implementing
+// RenamedFrom() string, or an empty string.
+func TableRenamedFrom(model any) string {
+	if obj, ok := model.(interface{ RenamedFrom() string }); ok {
+		return obj.RenamedFrom()
+	}
+	return ""
+}
+
+// ColumnRenames returns the renamed_from renames that are still pending: the
+// new column does not exist yet, the old one does, and no other local column
+// claims the old name. Once applied the rename is no longer reported, which
+// keeps the migration idempotent.
+func ColumnRenames(local Columns, remote []string) []Rename {
+	var result []Rename
+	for _, column := range local {
+		if column.RenamedFrom == "" || column.RenamedFrom == column.Name {
+			continue
+		}
+		if slices.Contains(remote, column.Name) || !slices.Contains(remote, column.RenamedFrom) {
+			continue
+		}
+		if local.Find(column.RenamedFrom) != nil {
+			continue
+		}
+		result = append(result, Rename{From: column.RenamedFrom, To: column.Name})
+	}
+	return result
+}
+
+// IndexRenames pairs remote indexes missing from the model with model indexes
+// missing from the database that have the same columns and uniqueness, so they
+// can be renamed instead of dropped and recreated. A full-text index only
+// pairs with a remote full-text index; spatial indexes are left alone as
+// their remote definition cannot be compared reliably.
+func IndexRenames(local Indexes, remote Indexes) []Rename {
+	var result []Rename
+	var used = map[string]bool{}
+	for _, r := range remote {
+		if local.Find(r.Name) != nil {
+			continue
+		}
+		for _, l := range local {
+			if used[l.Name] || l.Spatial || remote.Find(l.Name) != nil {
+				continue
+			}
+			if l.Unique == r.Unique && l.FullText == r.FullText && slices.Equal(l.Columns.Keys(), r.Columns.Keys()) {
+				used[l.Name] = true
+				result = append(result, Rename{From: r.Name, To: l.Name})
+				break
+			}
+		}
+	}
+	return result
+}
+
 // --- Shared utility functions ---
 
 // CleanEnum strips whitespace outside quotes from an enum definition.
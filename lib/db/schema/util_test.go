@@ -0,0 +1,59 @@
+package schema
+
+import (
+	"testing"
+)
+
+type renamedModel struct{}
+
+func (renamedModel) RenamedFrom() string { return "old_people" }
+
+func TestColumnRenames(t *testing.T) {
+	local := Columns{
+		{Name: "id"},
+		{Name: "full_name", RenamedFrom: "name"},
+		{Name: "email", RenamedFrom: "mail"},
+		{Name: "phone", RenamedFrom: "tel"},
+		{Name: "mobile", RenamedFrom: "id"},
+	}
+
+	got := ColumnRenames(local, []string{"id", "name", "email", "tel", "phone"})
+	if len(got) != 1 || got[0] != (Rename{From: "name", To: "full_name"}) {
+		t.Fatalf("unexpected renames %+v", got)
+	}
+
+	// Once applied the rename is not reported again.
+	if got := ColumnRenames(local, []string{"id", "full_name", "email", "phone"}); len(got) != 0 {
+		t.Errorf("expected no renames after the rename was applied, got %+v", got)
+	}
+}
+
+func TestIndexRenames(t *testing.T) {
+	local := Indexes{
+		{Name: "idx_unique_full_name", Unique: true, Columns: Columns{{Name: "full_name"}}},
+		{Name: "idx_people_email", Columns: Columns{{Name: "email"}}},
+		{Name: "idx_people_created", Columns: Columns{{Name: "created_at"}}},
+		{Name: "ft_people", FullText: true, Columns: Columns{{Name: "bio"}}},
+	}
+	remote := Indexes{
+		{Name: "idx_unique_name", Unique: true, Columns: Columns{{Name: "full_name"}}},
+		{Name: "idx_email", Unique: true, Columns: Columns{{Name: "email"}}},
+		{Name: "idx_people_created", Columns: Columns{{Name: "created_at"}}},
+		{Name: "idx_bio", Columns: Columns{{Name: "bio"}}},
+		{Name: "bio", FullText: true, Columns: Columns{{Name: "bio"}}},
+	}
+
+	got := IndexRenames(local, remote)
+	if len(got) != 2 || got[0] != (Rename{From: "idx_unique_name", To: "idx_unique_full_name"}) || got[1] != (Rename{From: "bio", To: "ft_people"}) {
+		t.Fatalf("unexpected renames %+v", got)
+	}
+}
+
+func TestTableRenamedFrom(t *testing.T) {
+	if got := TableRenamedFrom(&renamedModel{}); got != "old_people" {
+		t.Errorf("expected old_people, got %q", got)
+	}
+	if got := TableRenamedFrom(struct{}{}); got != "" {
+		t.Errorf("expected no previous name, got %q", got)
+	}
+}
@@ -0,0 +1,374 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/log"
+	"gorm.io/gorm"
+)
+
+// VersionedMigration is a hand-written migration: a data backfill, a rename,
+// or anything else the model diff cannot express. Migrations are applied in
+// ascending ID order and recorded in schema_migration, so prefix IDs with a
+// sortable timestamp, for example "20261018_1200_backfill_invoice_totals".
+type VersionedMigration struct {
+	ID string
+
+	// Up applies the migration. Down reverts it; a nil Down makes the
+	// migration irreversible.
+	Up   func(tx *gorm.DB) error
+	Down func(tx *gorm.DB) error
+
+	// BeforeModels runs the migration before the model diff instead of after
+	// it, for example to rename a column before the diff would recreate it.
+	BeforeModels bool
+
+	// NoTransaction runs Up and Down outside a transaction, for statements a
+	// dialect refuses inside one such as CREATE INDEX CONCURRENTLY. Note that
+	// MySQL commits implicitly on DDL, so only the DML of a MySQL migration is
+	// atomic either way.
+	NoTransaction bool
+
+	// Connection runs the migration on the named connection instead of the
+	// primary one.
+	Connection string
+}
+
+// MigrationState describes one versioned migration as seen by the database.
+type MigrationState struct {
+	ID           string
+	BeforeModels bool
+	Applied      bool
+	AppliedAt    time.Time
+
+	// Missing is set for a migration recorded as applied that is no longer
+	// registered by the application.
+	Missing bool
+
+	// Error holds the last failure of a migration that is still pending.
+	Error string
+}
+
+var versioned []VersionedMigration
+
+// RegisterMigration registers a versioned migration that runs after the model
+// diff. down may be nil when the migration cannot be reverted.
+func RegisterMigration(id string, up, down func(tx *gorm.DB) error) {
+	RegisterVersionedMigration(VersionedMigration{ID: id, Up: up, Down: down})
+}
+
+// RegisterVersionedMigration registers a versioned migration with all options.
+func RegisterVersionedMigration(m VersionedMigration) {
+	if m.ID == "" || m.Up == nil {
+		log.Fatal("versioned migration requires an ID and an Up function", "id", m.ID)
+	}
+	if strings.HasSuffix(m.ID, sqlFileSuffix) {
+		log.Fatal("versioned migration IDs ending in "+sqlFileSuffix+" are reserved for migration files", "id", m.ID)
+	}
+	for _, existing := range versioned {
+		if existing.ID == m.ID {
+			log.Fatal("versioned migration registered twice", "id", m.ID)
+		}
+	}
+	versioned = append(versioned, m)
+	sort.SliceStable(versioned, func(i, j int) bool {
+		return versioned[i].ID < versioned[j].ID
+	})
+}
+
+// VersionedMigrations returns the registered versioned migrations in ID order.
+func VersionedMigrations() []VersionedMigration {
+	return append([]VersionedMigration(nil), versioned...)
+}
+
+// withMigrationLock runs fn on a single connection holding the dialect's
+// advisory lock. The locks are session scoped, so acquiring and releasing
+// them through the pool could land on different connections. A db already
+// pinned to a connection keeps it.
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	d := dialectFor(db)
+	if d == nil {
+		return fmt.Errorf("no migration dialect registered for %s", db.Dialector.Name())
+	}
+	var locked = func(conn *gorm.DB) error {
+		conn = conn.Session(&gorm.Session{})
+		if err := d.BootstrapHistoryTable(conn); err != nil {
+			log.Error("failed to bootstrap schema_migration table", "error", err)
+			return err
+		}
+		if err := d.AcquireMigrationLock(conn); err != nil {
+			log.Error("failed to acquire migration lock", "error", err)
+			return err
+		}
+		defer d.ReleaseMigrationLock(conn)
+		return fn(conn)
+	}
+	if pinned(db) {
+		return locked(db)
+	}
+	return db.Connection(locked)
+}
+
+type versionedRecord struct {
+	ID           int64
+	MigrationID  string
+	Status       string
+	ErrorMessage *string
+	CreatedAt    time.Time
+}
+
+// versionedHistory reads the versioned rows of schema_migration, oldest first.
+func versionedHistory(db *gorm.DB) ([]versionedRecord, error) {
+	var records []versionedRecord
+	err := db.Raw("SELECT id, migration_id, status, error_message, created_at FROM schema_migration WHERE migration_id IS NOT NULL AND migration_id NOT LIKE ? ORDER BY id", "%"+sqlFileSuffix).
+		Scan(&records).Error
+	return records, err
+}
+
+// appliedMigrations returns the IDs recorded as applied, in the order they
+// were applied, and when.
+func appliedMigrations(db *gorm.DB) ([]string, map[string]time.Time, error) {
+	records, err := versionedHistory(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	var order []string
+	at := map[string]time.Time{}
+	for _, record := range records {
+		if record.Status != "success" {
+			continue
+		}
+		if _, ok := at[record.MigrationID]; !ok {
+			order = append(order, record.MigrationID)
+		}
+		at[record.MigrationID] = record.CreatedAt
+	}
+	return order, at, nil
+}
+
+func recordVersioned(db *gorm.DB, id, status, errorMessage string) error {
+	var errMsg *string
+	if errorMessage != "" {
+		errMsg = &errorMessage
+	}
+	return db.Exec("INSERT INTO schema_migration (hash, status, executed_queries, error_message, migration_id, created_at) VALUES (?,?,?,?,?,?)",
+		Generate32CharHash(id), status, 1, errMsg, id, time.Now().Format("2006-01-02 15:04:05")).Error
+}
+
+func findVersioned(id string) (VersionedMigration, bool) {
+	for _, m := range versioned {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return VersionedMigration{}, false
+}
+
+// runVersioned applies the pending migrations of one phase, stopping at the
+// first failure.
+func runVersioned(conn *gorm.DB, beforeModels bool) error {
+	_, applied, err := appliedMigrations(conn)
+	if err != nil {
+		return err
+	}
+	for _, m := range connectionVersioned(conn) {
+		if m.BeforeModels != beforeModels {
+			continue
+		}
+		if _, ok := applied[m.ID]; ok {
+			continue
+		}
+		if err := applyVersioned(conn, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyVersioned(conn *gorm.DB, m VersionedMigration) error {
+	log.Info("applying migration", "id", m.ID)
+	run := func(tx *gorm.DB) error {
+		if err := m.Up(tx); err != nil {
+			return err
+		}
+		return recordVersioned(tx, m.ID, "success", "")
+	}
+	var err error
+	if m.NoTransaction {
+		err = run(conn)
+	} else {
+		err = conn.Transaction(run)
+	}
+	if err != nil {
+		if recordErr := recordVersioned(conn, m.ID, "failed", err.Error()); recordErr != nil {
+			log.Error("failed to record migration history", "error", recordErr)
+		}
+		return fmt.Errorf("migration %s: %w", m.ID, err)
+	}
+	return nil
+}
+
+func revertVersioned(conn *gorm.DB, id string) error {
+	m, ok := findVersioned(id)
+	if !ok {
+		return fmt.Errorf("migration %s is applied but no longer registered", id)
+	}
+	if m.Down == nil {
+		return fmt.Errorf("migration %s cannot be rolled back: it has no Down function", id)
+	}
+	log.Info("rolling back migration", "id", id)
+	run := func(tx *gorm.DB) error {
+		if err := m.Down(tx); err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM schema_migration WHERE migration_id = ?", id).Error
+	}
+	var err error
+	if m.NoTransaction {
+		err = run(conn)
+	} else {
+		err = conn.Transaction(run)
+	}
+	if err != nil {
+		return fmt.Errorf("rollback of migration %s: %w", id, err)
+	}
+	return nil
+}
+
+// RollbackMigrations reverts the last n applied versioned migrations, most
+// recent first. The model diff is not involved.
+func RollbackMigrations(db *gorm.DB, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		order, _, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(order) - 1; i >= 0 && n > 0; i, n = i-1, n-1 {
+			if err := revertVersioned(conn, order[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateTo brings the versioned migrations to the state where exactly those
+// with an ID up to and including id are applied: later ones are rolled back,
+// earlier pending ones are applied. The model diff is not involved.
+func MigrateTo(db *gorm.DB, id string) error {
+	if _, ok := findVersioned(id); !ok {
+		return fmt.Errorf("migration %s is not registered", id)
+	}
+	return withMigrationLock(db, func(conn *gorm.DB) error {
+		order, applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(order) - 1; i >= 0; i-- {
+			if order[i] > id {
+				if err := revertVersioned(conn, order[i]); err != nil {
+					return err
+				}
+			}
+		}
+		for _, m := range connectionVersioned(conn) {
+			if _, ok := applied[m.ID]; ok || m.ID > id {
+				continue
+			}
+			if err := applyVersioned(conn, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrationStatus reports every registered versioned migration, and every
+// applied one that is no longer registered, in ID order.
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	d := dialectFor(db)
+	if d == nil {
+		return nil, fmt.Errorf("no migration dialect registered for %s", db.Dialector.Name())
+	}
+	if err := d.BootstrapHistoryTable(db); err != nil {
+		return nil, err
+	}
+	records, err := versionedHistory(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]*MigrationState{}
+	for _, m := range connectionVersioned(db) {
+		states[m.ID] = &MigrationState{ID: m.ID, BeforeModels: m.BeforeModels}
+	}
+	for _, record := range records {
+		state := states[record.MigrationID]
+		if state == nil {
+			state = &MigrationState{ID: record.MigrationID, Missing: true}
+			states[record.MigrationID] = state
+		}
+		if record.Status == "success" {
+			state.Applied, state.AppliedAt, state.Error = true, record.CreatedAt, ""
+		} else if !state.Applied && record.ErrorMessage != nil {
+			state.Error = *record.ErrorMessage
+		}
+	}
+
+	var result []MigrationState
+	for _, state := range states {
+		if state.Missing && !state.Applied {
+			continue
+		}
+		result = append(result, *state)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// PrintMigrationStatus prints the state of every versioned migration.
+func PrintMigrationStatus(db *gorm.DB) error {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	if len(states) == 0 {
+		fmt.Println("-- No versioned migrations registered.")
+		return nil
+	}
+	var pending int
+	for _, state := range states {
+		var line strings.Builder
+		switch {
+		case state.Applied:
+			line.WriteString(fmt.Sprintf("%-30s", "applied  "+state.AppliedAt.Format("2006-01-02 15:04:05")))
+		case state.Error != "":
+			line.WriteString(fmt.Sprintf("%-30s", "failed"))
+			pending++
+		default:
+			line.WriteString(fmt.Sprintf("%-30s", "pending"))
+			pending++
+		}
+		line.WriteString(state.ID)
+		if state.BeforeModels {
+			line.WriteString(" (before models)")
+		}
+		if state.Missing {
+			line.WriteString(" (not registered)")
+		}
+		if state.Error != "" {
+			line.WriteString(": " + state.Error)
+		}
+		fmt.Println(line.String())
+	}
+	fmt.Printf("-- %d applied, %d pending\n", len(states)-pending, pending)
+	return nil
+}
@@ -0,0 +1,213 @@
+package schema
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqliteDialect is just enough of a dialect to run the migration machinery
+// against SQLite: a fixed model diff, a history table and a counting lock.
+type sqliteDialect struct {
+	Dialect
+	locks, unlocks int
+	result         MigrationResult
+}
+
+func (d *sqliteDialect) Name() string                          { return "sqlite" }
+func (d *sqliteDialect) Quote(name string) string              { return `"` + name + `"` }
+func (d *sqliteDialect) GetCurrentDatabase(db *gorm.DB) string { return "main" }
+func (d *sqliteDialect) GenerateMigration(db *gorm.DB, database string, stmts []*gorm.Statement, models []any) MigrationResult {
+	return d.result
+}
+func (d *sqliteDialect) AcquireMigrationLock(db *gorm.DB) error { d.locks++; return nil }
+func (d *sqliteDialect) ReleaseMigrationLock(db *gorm.DB)       { d.unlocks++ }
+func (d *sqliteDialect) BootstrapHistoryTable(db *gorm.DB) error {
+	return db.Exec(`CREATE TABLE IF NOT EXISTS schema_migration (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  hash CHAR(32) NOT NULL,
+  status VARCHAR(10) NOT NULL,
+  executed_queries INT NOT NULL DEFAULT 0,
+  error_message TEXT,
+  migration_id VARCHAR(255),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`).Error
+}
+
+func newVersionedTestDB(t *testing.T) (*gorm.DB, *sqliteDialect) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &sqliteDialect{}
+	previous := GetDialect()
+	SetDialect(d)
+	ResetMigrations()
+	t.Cleanup(func() {
+		SetDialect(previous)
+		ResetMigrations()
+	})
+	return db, d
+}
+
+func exec(query string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error { return tx.Exec(query).Error }
+}
+
+func registerNotes() {
+	RegisterMigration("002_seed", exec("INSERT INTO notes (body) VALUES ('hello')"), exec("DELETE FROM notes"))
+	RegisterVersionedMigration(VersionedMigration{
+		ID:           "001_create",
+		Up:           exec("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)"),
+		Down:         exec("DROP TABLE notes"),
+		BeforeModels: true,
+	})
+	RegisterMigration("003_upper", exec("UPDATE notes SET body = UPPER(body)"), exec("UPDATE notes SET body = LOWER(body)"))
+}
+
+func applied(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	order, _, err := appliedMigrations(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func TestDoMigrationAppliesVersionedMigrationsInOrder(t *testing.T) {
+	db, d := newVersionedTestDB(t)
+	registerNotes()
+
+	if err := DoMigration(db); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(t, db); len(got) != 3 || got[0] != "001_create" || got[2] != "003_upper" {
+		t.Fatalf("unexpected applied migrations %v", got)
+	}
+	var body string
+	db.Raw("SELECT body FROM notes").Scan(&body)
+	if body != "HELLO" {
+		t.Errorf("expected the migrations to run in ID order, got %q", body)
+	}
+	if d.locks != 1 || d.unlocks != 1 {
+		t.Errorf("expected the lock to be held once, got %d/%d", d.locks, d.unlocks)
+	}
+
+	// A second run applies nothing.
+	if err := DoMigration(db); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Raw("SELECT COUNT(*) FROM notes").Scan(&count)
+	if count != 1 {
+		t.Errorf("expected the migrations to run once, got %d rows", count)
+	}
+}
+
+func TestFailedMigrationRollsBackAndIsRecorded(t *testing.T) {
+	db, _ := newVersionedTestDB(t)
+	RegisterMigration("001_create", exec("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)"), nil)
+	RegisterMigration("002_broken", func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT INTO notes (body) VALUES ('partial')").Error; err != nil {
+			return err
+		}
+		return errors.New("backfill failed")
+	}, nil)
+
+	if err := DoMigration(db); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+	var count int64
+	db.Raw("SELECT COUNT(*) FROM notes").Scan(&count)
+	if count != 0 {
+		t.Errorf("expected the failed migration to be rolled back, found %d rows", count)
+	}
+
+	states, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || !states[0].Applied || states[1].Applied || states[1].Error != "backfill failed" {
+		t.Errorf("unexpected status %+v", states)
+	}
+}
+
+func TestRollbackMigrations(t *testing.T) {
+	db, _ := newVersionedTestDB(t)
+	registerNotes()
+	if err := DoMigration(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RollbackMigrations(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(t, db); len(got) != 1 || got[0] != "001_create" {
+		t.Fatalf("expected only 001_create to remain, got %v", got)
+	}
+	var count int64
+	db.Raw("SELECT COUNT(*) FROM notes").Scan(&count)
+	if count != 0 {
+		t.Errorf("expected 002_seed to be reverted, found %d rows", count)
+	}
+}
+
+func TestRollbackRefusesIrreversibleMigration(t *testing.T) {
+	db, _ := newVersionedTestDB(t)
+	RegisterMigration("001_create", exec("CREATE TABLE notes (id INTEGER PRIMARY KEY)"), nil)
+	if err := DoMigration(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := RollbackMigrations(db, 1); err == nil {
+		t.Error("expected a migration without Down to refuse rollback")
+	}
+	if got := applied(t, db); len(got) != 1 {
+		t.Errorf("expected the migration to stay applied, got %v", got)
+	}
+}
+
+func TestMigrateTo(t *testing.T) {
+	db, _ := newVersionedTestDB(t)
+	registerNotes()
+
+	if err := MigrateTo(db, "002_seed"); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(t, db); len(got) != 2 || got[1] != "002_seed" {
+		t.Fatalf("expected migrations up to 002_seed, got %v", got)
+	}
+
+	if err := MigrateTo(db, "001_create"); err != nil {
+		t.Fatal(err)
+	}
+	if got := applied(t, db); len(got) != 1 {
+		t.Fatalf("expected 002_seed to be rolled back, got %v", got)
+	}
+
+	if err := MigrateTo(db, "999_unknown"); err == nil {
+		t.Error("expected an unknown target to be refused")
+	}
+}
+
+func TestMigrationStatusReportsUnregisteredMigrations(t *testing.T) {
+	db, _ := newVersionedTestDB(t)
+	RegisterMigration("001_create", exec("CREATE TABLE notes (id INTEGER PRIMARY KEY)"), nil)
+	if err := DoMigration(db); err != nil {
+		t.Fatal(err)
+	}
+	ResetMigrations()
+	RegisterMigration("002_next", exec("SELECT 1"), nil)
+
+	states, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || !states[0].Missing || !states[0].Applied || states[1].Applied {
+		t.Errorf("unexpected status %+v", states)
+	}
+}
@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"strings"
+)
+
+// View is implemented by the models of database views. Their migration
+// creates or replaces the view instead of a table:
+//
+//	type ActiveUser struct {
+//	    ID    uint
+//	    Email string
+//	}
+//
+//	func (ActiveUser) ViewDefinition() string {
+//	    return "SELECT id, email FROM users WHERE deleted_at IS NULL"
+//	}
+type View interface {
+	ViewDefinition() string
+}
+
+// MaterializedView is implemented by the view models stored as materialized
+// views, on the databases supporting them.
+type MaterializedView interface {
+	View
+	Materialized() bool
+}
+
+// ViewOf returns the SELECT statement of a view model without its trailing
+// semicolon, whether it is materialized, and false when model is not a view.
+func ViewOf(model any) (definition string, materialized bool, ok bool) {
+	view, ok := model.(View)
+	if !ok {
+		return "", false, false
+	}
+	definition = strings.TrimSuffix(strings.TrimSpace(view.ViewDefinition()), ";")
+	if m, isMaterialized := model.(MaterializedView); isMaterialized {
+		materialized = m.Materialized()
+	}
+	return definition, materialized, true
+}
+
+// ViewComment returns the comment a view is created with, carrying the hash
+// of its definition, so that the definition can be compared with the one of
+// the model without parsing the one the database reports.
+func ViewComment(definition string, materialized bool) string {
+	if materialized {
+		definition = "materialized:" + definition
+	}
+	return "evo:" + Generate32CharHash(definition)
+}
@@ -0,0 +1,244 @@
+// Package search runs full-text searches on the indexes created by the
+// fulltext tag, without a search engine: MATCH ... AGAINST on MySQL, and a
+// generated tsvector column queried with websearch_to_tsquery on
+// PostgreSQL.
+package search
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// RankColumn is the column the relevance of a row is selected as.
+	RankColumn = "search_rank"
+
+	// SnippetColumn is the column the highlighted snippet is selected as.
+	SnippetColumn = "search_snippet"
+)
+
+// Options configures Match.
+type Options struct {
+	// Language is the PostgreSQL text search configuration; the one the
+	// index was migrated with by default, see schema.SetFullTextLanguage.
+	Language string
+
+	// Snippet is the column highlighted into the search_snippet column, with
+	// the matching words wrapped in <mark> tags and the rest escaped as HTML
+	// on PostgreSQL. Empty selects no snippet.
+	Snippet string
+
+	// Boolean searches in MySQL boolean mode, where the query uses the +, -
+	// and * operators, instead of natural language mode.
+	Boolean bool
+}
+
+// Match returns the scope selecting the rows matching query on columns, most
+// relevant first. The columns must be those of a full-text index, in the
+// order of their fields:
+//
+//	type Article struct {
+//	    ID    uint
+//	    Title string `gorm:"fulltext"`
+//	    Body  string `gorm:"type:text;fulltext"`
+//	    Rank  float64 `gorm:"->;column:search_rank;-:migration"`
+//	}
+//
+//	db.Scopes(search.Match([]string{"title", "body"}, "postgres -mysql")).Find(&articles)
+//
+// Unless the query selects columns of its own, the rank is selected as
+// search_rank, and the snippet, when configured, as search_snippet. An
+// empty query matches every row. Other databases fall back to LIKE on each
+// word, without ranking.
+func Match(columns []string, query string, options ...Options) func(db *gorm.DB) *gorm.DB {
+	var opts Options
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		query := strings.TrimSpace(query)
+		if query == "" || len(columns) == 0 {
+			return db
+		}
+		var condition, rank, snippet clause.Expr
+		switch db.Dialector.Name() {
+		case "mysql":
+			condition, rank, snippet = mysqlMatch(db, columns, query, opts)
+		case "postgres":
+			condition, rank, snippet = postgresMatch(db, columns, query, opts)
+		default:
+			condition, rank, snippet = likeMatch(db, columns, query, opts)
+		}
+
+		db = db.Where(condition)
+		if len(db.Statement.Selects) == 0 && db.Statement.Clauses["SELECT"].Expression == nil {
+			var sql = "*, " + rank.SQL + " AS " + RankColumn
+			var vars = append([]any(nil), rank.Vars...)
+			if opts.Snippet != "" {
+				sql += ", " + snippet.SQL + " AS " + SnippetColumn
+				vars = append(vars, snippet.Vars...)
+			}
+			db = db.Select(sql, vars...)
+		}
+		if rank.SQL != "0" {
+			db = db.Order(clause.OrderBy{Expression: clause.Expr{SQL: rank.SQL + " DESC", Vars: rank.Vars, WithoutParentheses: true}})
+		}
+		return db
+	}
+}
+
+func mysqlMatch(db *gorm.DB, columns []string, query string, opts Options) (condition, rank, snippet clause.Expr) {
+	var quoted = make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = db.Statement.Quote(column)
+	}
+	var mode = " IN NATURAL LANGUAGE MODE"
+	if opts.Boolean {
+		mode = " IN BOOLEAN MODE"
+	}
+	var match = "MATCH(" + strings.Join(quoted, ",") + ") AGAINST (?" + mode + ")"
+	condition = clause.Expr{SQL: match, Vars: []any{query}}
+	rank = clause.Expr{SQL: match, Vars: []any{query}}
+	if opts.Snippet != "" {
+		// MySQL has no headline function, see Highlight
+		snippet = clause.Expr{SQL: db.Statement.Quote(opts.Snippet)}
+	}
+	return
+}
+
+func postgresMatch(db *gorm.DB, columns []string, query string, opts Options) (condition, rank, snippet clause.Expr) {
+	var language = opts.Language
+	if language == "" {
+		language = schema.FullTextLanguage()
+	}
+	var tsquery = "websearch_to_tsquery(" + schema.QuoteLiteral(language) + "::regconfig, ?)"
+	var vector = db.Statement.Quote(schema.SearchVectorColumn(columns))
+	condition = clause.Expr{SQL: vector + " @@ " + tsquery, Vars: []any{query}}
+	rank = clause.Expr{SQL: "ts_rank(" + vector + ", " + tsquery + ")", Vars: []any{query}}
+	if opts.Snippet != "" {
+		var text = "replace(replace(" + db.Statement.Quote(opts.Snippet) + "::text, '" + startMark + "', ''), '" + stopMark + "', '')"
+		snippet = clause.Expr{
+			SQL: escapeMarked("ts_headline(" + schema.QuoteLiteral(language) + "::regconfig, " + text + ", " + tsquery +
+				", 'StartSel=" + startMark + ", StopSel=" + stopMark + ", MaxWords=35, MinWords=15')"),
+			Vars: []any{query},
+		}
+	}
+	return
+}
+
+// startMark and stopMark delimit the words ts_headline highlights, until
+// escapeMarked swaps them for the <mark> tags.
+const (
+	startMark = "\x02"
+	stopMark  = "\x03"
+)
+
+// escapeMarked returns the SQL escaping the text of expr as HTML, the way
+// Highlight does, with its startMark and stopMark turned into <mark> tags,
+// so that the markup stored in a column is never returned as is.
+func escapeMarked(expr string) string {
+	for _, r := range [][2]string{
+		{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&#34;"}, {"'", "&#39;"},
+		{startMark, "<mark>"}, {stopMark, "</mark>"},
+	} {
+		expr = "replace(" + expr + ", " + schema.QuoteLiteral(r[0]) + ", " + schema.QuoteLiteral(r[1]) + ")"
+	}
+	return expr
+}
+
+// likeEscaper escapes the LIKE wildcards with '!'.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func likeMatch(db *gorm.DB, columns []string, query string, opts Options) (condition, rank, snippet clause.Expr) {
+	var words []string
+	for _, term := range Terms(query) {
+		var either []string
+		for _, column := range columns {
+			either = append(either, db.Statement.Quote(column)+" LIKE ? ESCAPE '!'")
+			condition.Vars = append(condition.Vars, "%"+likeEscaper.Replace(term)+"%")
+		}
+		words = append(words, "("+strings.Join(either, " OR ")+")")
+	}
+	if len(words) == 0 {
+		words = []string{"1 = 1"}
+	}
+	condition.SQL = strings.Join(words, " AND ")
+	rank = clause.Expr{SQL: "0"}
+	if opts.Snippet != "" {
+		snippet = clause.Expr{SQL: db.Statement.Quote(opts.Snippet)}
+	}
+	return
+}
+
+var termPattern = regexp.MustCompile(`-?"[^"]*"|\S+`)
+
+// Terms returns the words and quoted phrases a query searches for, without
+// the excluded ones, the operators and the OR keyword.
+func Terms(query string) []string {
+	var terms []string
+	for _, token := range termPattern.FindAllString(query, -1) {
+		if strings.HasPrefix(token, "-") || strings.EqualFold(token, "or") {
+			continue
+		}
+		token = strings.Trim(token, `"+~<>()*@`)
+		if strings.TrimFunc(token, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) != "" {
+			terms = append(terms, token)
+		}
+	}
+	return terms
+}
+
+// Highlight returns the fragment of text around the first words of query,
+// about words words long, with the words wrapped in <mark> tags and the
+// rest escaped as HTML. It builds the snippets of the databases without a
+// headline function, such as MySQL:
+//
+//	article.Snippet = search.Highlight(article.Snippet, q, 35)
+func Highlight(text, query string, words int) string {
+	var terms = Terms(query)
+	var fields = strings.Fields(text)
+	if words <= 0 {
+		words = 35
+	}
+	var matches = func(field string) bool {
+		var word = strings.ToLower(strings.TrimFunc(field, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }))
+		for _, term := range terms {
+			for _, part := range strings.Fields(strings.ToLower(term)) {
+				if word != "" && (word == part || strings.HasPrefix(word, part)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	var start int
+	for i, field := range fields {
+		if matches(field) {
+			start = max(0, i-words/3)
+			break
+		}
+	}
+	var end = min(len(fields), start+words)
+	var out = make([]string, 0, end-start+2)
+	if start > 0 {
+		out = append(out, "…")
+	}
+	for _, field := range fields[start:end] {
+		if matches(field) {
+			out = append(out, "<mark>"+html.EscapeString(field)+"</mark>")
+		} else {
+			out = append(out, html.EscapeString(field))
+		}
+	}
+	if end < len(fields) {
+		out = append(out, "…")
+	}
+	return strings.Join(out, " ")
+}
@@ -0,0 +1,118 @@
+package search_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getevo/evo/v2/lib/db/search"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type article struct {
+	ID      uint `gorm:"primaryKey"`
+	Title   string
+	Body    string
+	Rank    float64 `gorm:"->;column:search_rank;-:migration"`
+	Snippet string  `gorm:"->;column:search_snippet;-:migration"`
+}
+
+func dryRun(t *testing.T, dialector gorm.Dialector) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	return db
+}
+
+func TestMatch_MySQL(t *testing.T) {
+	db := dryRun(t, mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/app", SkipInitializeWithVersion: true}))
+	stmt := db.Scopes(search.Match([]string{"title", "body"}, "fast search", search.Options{Snippet: "body"})).Find(&[]article{}).Statement
+
+	want := "SELECT *, MATCH(`title`,`body`) AGAINST (? IN NATURAL LANGUAGE MODE) AS search_rank, `body` AS search_snippet FROM `articles` " +
+		"WHERE MATCH(`title`,`body`) AGAINST (? IN NATURAL LANGUAGE MODE) ORDER BY MATCH(`title`,`body`) AGAINST (? IN NATURAL LANGUAGE MODE) DESC"
+	if got := stmt.SQL.String(); got != want {
+		t.Errorf("unexpected SQL\n got: %s\nwant: %s", got, want)
+	}
+	if len(stmt.Vars) != 3 || stmt.Vars[0] != "fast search" {
+		t.Errorf("unexpected vars %v", stmt.Vars)
+	}
+
+	stmt = db.Select("id").Scopes(search.Match([]string{"title"}, "+fast -slow", search.Options{Boolean: true})).Find(&[]article{}).Statement
+	if got := stmt.SQL.String(); !strings.HasPrefix(got, "SELECT `id` FROM") || !strings.Contains(got, "IN BOOLEAN MODE") {
+		t.Errorf("expected the selected columns and boolean mode, got %s", got)
+	}
+}
+
+func TestMatch_Postgres(t *testing.T) {
+	db := dryRun(t, postgres.New(postgres.Config{DSN: "host=127.0.0.1 user=app dbname=app"}))
+	stmt := db.Scopes(search.Match([]string{"title", "body"}, `"full text" -elastic`, search.Options{Language: "german", Snippet: "body"})).Find(&[]article{}).Statement
+
+	for _, part := range []string{
+		`ts_rank("tsv_title_body", websearch_to_tsquery('german'::regconfig, $1)) AS search_rank`,
+		`ts_headline('german'::regconfig, replace(replace("body"::text, '` + "\x02" + `', ''), '` + "\x03" + `', ''), websearch_to_tsquery('german'::regconfig, $2), 'StartSel=` + "\x02" + `, StopSel=` + "\x03" + `, MaxWords=35, MinWords=15')`,
+		`, '` + "\x02" + `', '<mark>'), '` + "\x03" + `', '</mark>') AS search_snippet`,
+		`WHERE "tsv_title_body" @@ websearch_to_tsquery('german'::regconfig, $3)`,
+		`ORDER BY ts_rank("tsv_title_body", websearch_to_tsquery('german'::regconfig, $4)) DESC`,
+	} {
+		if !strings.Contains(stmt.SQL.String(), part) {
+			t.Errorf("expected %s in\n%s", part, stmt.SQL.String())
+		}
+	}
+}
+
+func TestMatch_Fallback(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "search.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.AutoMigrate(&article{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db.Create([]article{
+		{Title: "Full-text search", Body: "Search without a search engine"},
+		{Title: "Indexes", Body: "B-tree and 100% GIN indexes"},
+		{Title: "Replication", Body: "Read replicas and search"},
+	})
+
+	var found []article
+	db.Scopes(search.Match([]string{"title", "body"}, "search -engine replicas")).Order("id").Find(&found)
+	if len(found) != 1 || found[0].Title != "Replication" {
+		t.Errorf("expected the replication article, got %+v", found)
+	}
+
+	db.Scopes(search.Match([]string{"body"}, "100%", search.Options{Snippet: "body"})).Find(&found)
+	if len(found) != 1 || found[0].Snippet != "B-tree and 100% GIN indexes" {
+		t.Errorf("expected the wildcard matched literally with its snippet, got %+v", found)
+	}
+
+	db.Scopes(search.Match([]string{"title"}, "  ")).Find(&found)
+	if len(found) != 3 {
+		t.Errorf("expected an empty query to match every row, got %d", len(found))
+	}
+}
+
+func TestTerms(t *testing.T) {
+	got := search.Terms(`"full text" search -elastic or +fast* (index)`)
+	want := []string{"full text", "search", "fast", "index"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	text := "one two three four five six seven <search> engines eight nine ten eleven twelve"
+	got := search.Highlight(text, "search", 6)
+	want := "… six seven <mark>&lt;search&gt;</mark> engines eight nine …"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got = search.Highlight("no match here", "search", 10); got != "no match here" {
+		t.Errorf("expected the start of the text, got %q", got)
+	}
+}
@@ -0,0 +1,28 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestEscapeMarked(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "snippet.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	// what ts_headline returns for a stored text holding markup
+	var headline = `'<script>alert("x" & 1)</script> ` + startMark + `search` + stopMark + ` it''s'`
+
+	var snippet string
+	if err = db.Raw("SELECT " + escapeMarked(headline)).Scan(&snippet).Error; err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	var want = `&lt;script&gt;alert(&#34;x&#34; &amp; 1)&lt;/script&gt; <mark>search</mark> it&#39;s`
+	if snippet != want {
+		t.Errorf("expected %s, got %s", want, snippet)
+	}
+}
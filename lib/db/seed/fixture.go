@@ -0,0 +1,391 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	dbschema "github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/json"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrInvalidFixture is returned for fixtures that cannot be loaded.
+var ErrInvalidFixture = errors.New("seed: invalid fixture")
+
+type stateKey struct{}
+
+// state holds the labelled rows of a run.
+type state struct {
+	mu     sync.Mutex
+	labels map[string]reflect.Value
+}
+
+func withState(ctx context.Context) context.Context {
+	if ctx.Value(stateKey{}) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, stateKey{}, &state{labels: map[string]reflect.Value{}})
+}
+
+// stateOf returns the state of the run tx belongs to, adding one to tx
+// outside of Run.
+func stateOf(tx *gorm.DB) (*gorm.DB, *state) {
+	var ctx = tx.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if s, ok := ctx.Value(stateKey{}).(*state); ok {
+		return tx, s
+	}
+	ctx = withState(ctx)
+	return tx.WithContext(ctx), ctx.Value(stateKey{}).(*state)
+}
+
+// Label names a row saved by a seeder of the run of tx, so that fixtures of
+// later seeders can reference it as @name.
+func Label(tx *gorm.DB, name string, model any) {
+	var _, s = stateOf(tx)
+	var value = reflect.ValueOf(model)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	s.mu.Lock()
+	s.labels[name] = value
+	s.mu.Unlock()
+}
+
+// Ref returns a pointer to the row labelled name in the run of tx.
+func Ref(tx *gorm.DB, name string) (any, bool) {
+	var _, s = stateOf(tx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value, ok := s.labels[name]; ok {
+		return value.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+// Fixtures returns a seeder function loading the fixture files of fsys
+// matching patterns, file by file in lexical order.
+//
+//	//go:embed fixtures
+//	var fixtures embed.FS
+//
+//	seed.Register(seed.Seeder{Name: "demo", Run: seed.Fixtures(fixtures, "fixtures/*.yml")})
+func Fixtures(fsys fs.FS, patterns ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		var files []string
+		for _, pattern := range patterns {
+			matches, err := fs.Glob(fsys, pattern)
+			if err != nil {
+				return err
+			}
+			if len(matches) == 0 {
+				return fmt.Errorf("%w: no file matches %s", ErrInvalidFixture, pattern)
+			}
+			sort.Strings(matches)
+			files = append(files, matches...)
+		}
+		for _, file := range files {
+			data, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return err
+			}
+			if err = Load(tx, file, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Load upserts the rows of a fixture document, YAML or JSON, in tx. name
+// identifies the document in errors.
+//
+// The document maps model names, as registered by schema.UseModel
+// ("package.Type") or table names, to rows. Rows are either a list, or a
+// map giving each row a label. Values of the form @label are replaced by
+// the primary key of the labelled row, @label.field by one of its fields,
+// and @@ escapes a literal @. A belongs-to relation takes a reference too:
+//
+//	users.User:
+//	  user_alice:
+//	    name: Alice
+//	    email: alice@example.com
+//	blog.Post:
+//	  - title: Hello
+//	    author: "@user_alice"
+//
+// Each row is matched to the stored one by its primary key, or else by a
+// unique key, and inserted or updated accordingly.
+func Load(tx *gorm.DB, name string, data []byte) error {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidFixture, name, err)
+	}
+	if len(document.Content) == 0 {
+		return nil
+	}
+	var root = document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%w: %s: expected a map of models", ErrInvalidFixture, name)
+	}
+	tx, s := stateOf(tx)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		var modelName, rows = root.Content[i].Value, root.Content[i+1]
+		var model = dbschema.Find(modelName)
+		if model == nil || model.Schema == nil {
+			return fmt.Errorf("%w: %s: unknown model %s", ErrInvalidFixture, name, modelName)
+		}
+		var loader = loader{tx: tx, state: s, model: model, file: name}
+		switch rows.Kind {
+		case yaml.MappingNode:
+			for j := 0; j+1 < len(rows.Content); j += 2 {
+				if err := loader.row(rows.Content[j].Value, rows.Content[j+1]); err != nil {
+					return err
+				}
+			}
+		case yaml.SequenceNode:
+			for _, row := range rows.Content {
+				if err := loader.row("", row); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("%w: %s: rows of %s must be a list or a map", ErrInvalidFixture, name, modelName)
+		}
+	}
+	return nil
+}
+
+type loader struct {
+	tx    *gorm.DB
+	state *state
+	model *dbschema.Model
+	file  string
+}
+
+func (l loader) errorf(label, format string, args ...any) error {
+	var where = l.file + ": " + l.model.Name
+	if label != "" {
+		where += "." + label
+	}
+	return fmt.Errorf("%w: %s: %s", ErrInvalidFixture, where, fmt.Sprintf(format, args...))
+}
+
+// row upserts one row and labels it.
+func (l loader) row(label string, node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return l.errorf(label, "expected a map of fields")
+	}
+	var ctx = l.tx.Statement.Context
+	var sch = l.model.Schema
+	var values = map[*schema.Field]any{}
+	var columns []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var key = node.Content[i].Value
+		var raw any
+		if err := node.Content[i+1].Decode(&raw); err != nil {
+			return l.errorf(label, "%s: %v", key, err)
+		}
+		value, err := l.resolve(raw)
+		if err != nil {
+			return l.errorf(label, "%s: %v", key, err)
+		}
+
+		if relation := findRelation(sch, key); relation != nil {
+			target, ok := value.(reflect.Value)
+			if !ok || target.Type() != relation.FieldSchema.ModelType {
+				return l.errorf(label, "%s expects a reference to a %s", key, relation.FieldSchema.Name)
+			}
+			for _, reference := range relation.References {
+				v, _ := reference.PrimaryKey.ValueOf(ctx, target)
+				values[reference.ForeignKey] = v
+				columns = append(columns, reference.ForeignKey.DBName)
+			}
+			continue
+		}
+		var field = findField(sch, key)
+		if field == nil {
+			return l.errorf(label, "unknown field %s", key)
+		}
+		if target, ok := value.(reflect.Value); ok {
+			if value, err = primaryKey(ctx, target); err != nil {
+				return l.errorf(label, "%s: %v", key, err)
+			}
+		}
+		switch value.(type) {
+		case map[string]any, []any:
+			if value, err = json.Marshal(value); err != nil {
+				return l.errorf(label, "%s: %v", key, err)
+			}
+		}
+		values[field] = value
+		columns = append(columns, field.DBName)
+	}
+
+	var row = reflect.New(sch.ModelType).Elem()
+	for field, value := range values {
+		if err := field.Set(ctx, row, value); err != nil {
+			return l.errorf(label, "%s: %v", field.Name, err)
+		}
+	}
+
+	conditions, err := l.key(row, values)
+	if err != nil {
+		return l.errorf(label, "%v", err)
+	}
+	var stored = reflect.New(sch.ModelType)
+	err = l.tx.Unscoped().Where(conditions).Take(stored.Interface()).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = l.tx.Create(row.Addr().Interface()).Error
+	case err == nil:
+		// Update the stored row so that its version, and the fields the
+		// fixture leaves out, are kept.
+		row = stored.Elem()
+		for field, value := range values {
+			if err = field.Set(ctx, row, value); err != nil {
+				return l.errorf(label, "%s: %v", field.Name, err)
+			}
+		}
+		err = l.tx.Unscoped().Model(row.Addr().Interface()).Select(columns).Updates(row.Addr().Interface()).Error
+	}
+	if err != nil {
+		return fmt.Errorf("seed: %s: %s.%s: %w", l.file, l.model.Name, label, err)
+	}
+
+	if label != "" {
+		l.state.mu.Lock()
+		l.state.labels[label] = row
+		l.state.mu.Unlock()
+	}
+	return nil
+}
+
+// key returns the condition matching the stored row: the primary key when
+// the fixture sets it, or else the first unique key it sets.
+func (l loader) key(row reflect.Value, values map[*schema.Field]any) (map[string]any, error) {
+	var ctx = l.tx.Statement.Context
+	var sch = l.model.Schema
+	var keys [][]*schema.Field
+	if len(sch.PrimaryFields) > 0 {
+		keys = append(keys, sch.PrimaryFields)
+	}
+	for _, index := range sch.ParseIndexes() {
+		if index.Class != "UNIQUE" {
+			continue
+		}
+		var fields []*schema.Field
+		for _, option := range index.Fields {
+			fields = append(fields, option.Field)
+		}
+		keys = append(keys, fields)
+	}
+	for _, field := range sch.Fields {
+		if field.Unique {
+			keys = append(keys, []*schema.Field{field})
+		}
+	}
+
+next:
+	for _, key := range keys {
+		var conditions = map[string]any{}
+		for _, field := range key {
+			if _, ok := values[field]; !ok {
+				continue next
+			}
+			v, zero := field.ValueOf(ctx, row)
+			if zero && field.PrimaryKey {
+				continue next
+			}
+			conditions[field.DBName] = v
+		}
+		return conditions, nil
+	}
+	return nil, errors.New("the row sets neither its primary key nor a unique key")
+}
+
+// resolve replaces a reference by the labelled row.
+func (l loader) resolve(raw any) (any, error) {
+	text, ok := raw.(string)
+	if !ok || !strings.HasPrefix(text, "@") {
+		return raw, nil
+	}
+	if strings.HasPrefix(text, "@@") {
+		return text[1:], nil
+	}
+	var label, path, _ = strings.Cut(text[1:], ".")
+	l.state.mu.Lock()
+	target, ok := l.state.labels[label]
+	l.state.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown label %s, define it before referencing it", label)
+	}
+	if path == "" {
+		return target, nil
+	}
+	var stmt = l.tx.Session(&gorm.Session{NewDB: true}).Model(target.Addr().Interface()).Statement
+	if err := stmt.Parse(target.Addr().Interface()); err != nil {
+		return nil, err
+	}
+	var field = findField(stmt.Schema, path)
+	if field == nil {
+		return nil, fmt.Errorf("label %s has no field %s", label, path)
+	}
+	v, _ := field.ValueOf(l.tx.Statement.Context, target)
+	return v, nil
+}
+
+// primaryKey returns the primary key of a labelled row.
+func primaryKey(ctx context.Context, target reflect.Value) (any, error) {
+	var model = dbschema.Find(target.Interface())
+	if model == nil || model.Schema == nil {
+		return nil, fmt.Errorf("%s is not a registered model", target.Type())
+	}
+	if len(model.Schema.PrimaryFields) != 1 {
+		return nil, fmt.Errorf("%s has no single primary key, reference a field instead", model.Name)
+	}
+	v, _ := model.Schema.PrimaryFields[0].ValueOf(ctx, target)
+	return v, nil
+}
+
+// findField returns the field of sch named key, by column, Go or JSON name.
+func findField(sch *schema.Schema, key string) *schema.Field {
+	if field, ok := sch.FieldsByDBName[key]; ok {
+		return field
+	}
+	if field, ok := sch.FieldsByName[key]; ok && field.DBName != "" {
+		return field
+	}
+	for _, field := range sch.Fields {
+		if field.DBName != "" && jsonName(field) == key {
+			return field
+		}
+	}
+	return nil
+}
+
+// findRelation returns the belongs-to relation of sch named key, by Go name
+// in any case or by JSON name.
+func findRelation(sch *schema.Schema, key string) *schema.Relationship {
+	for _, relation := range sch.Relationships.BelongsTo {
+		if strings.EqualFold(relation.Name, key) || jsonName(relation.Field) == key {
+			return relation
+		}
+	}
+	return nil
+}
+
+func jsonName(field *schema.Field) string {
+	var name, _, _ = strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
@@ -0,0 +1,185 @@
+// Package seed fills databases with reference and demo data. Applications
+// register seeders, which may depend on each other and be restricted to some
+// environments, and run them with --seed or --seed=<name>. Fixture files in
+// YAML or JSON describe rows by model, and are upserted on their primary or
+// unique keys so seeding twice leaves the same data.
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/getevo/evo/v2/lib/log"
+	"github.com/getevo/evo/v2/lib/settings"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownSeeder is returned when a seeder to run, or a dependency, is not
+// registered.
+var ErrUnknownSeeder = errors.New("seed: unknown seeder")
+
+// Seeder is a named unit of seed data.
+type Seeder struct {
+	// Name identifies the seeder on the command line and in DependsOn.
+	Name string
+
+	// DependsOn lists the seeders to run before this one.
+	DependsOn []string
+
+	// Env lists the environments the seeder runs in, see Environment. An
+	// empty list runs everywhere, which suits reference data; demo data
+	// should list its environments so it never lands in production.
+	Env []string
+
+	// Run seeds the data in tx, the transaction of the seeder.
+	Run func(tx *gorm.DB) error
+}
+
+var (
+	mu       sync.RWMutex
+	seeders  = map[string]Seeder{}
+	ordering []string
+)
+
+// Register registers seeders. It panics when a name is empty or already
+// registered.
+//
+//	seed.Register(seed.Seeder{
+//	    Name:      "demo",
+//	    DependsOn: []string{"countries"},
+//	    Env:       []string{"dev", "staging"},
+//	    Run:       seed.Fixtures(fixtures, "fixtures/demo/*.yml"),
+//	})
+func Register(list ...Seeder) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, seeder := range list {
+		if seeder.Name == "" {
+			panic("seed: seeder without name")
+		}
+		if _, ok := seeders[seeder.Name]; ok {
+			panic("seed: seeder " + seeder.Name + " registered twice")
+		}
+		seeders[seeder.Name] = seeder
+		ordering = append(ordering, seeder.Name)
+	}
+}
+
+// Seeders returns the registered seeders in registration order.
+func Seeders() []Seeder {
+	mu.RLock()
+	defer mu.RUnlock()
+	var result = make([]Seeder, len(ordering))
+	for i, name := range ordering {
+		result[i] = seeders[name]
+	}
+	return result
+}
+
+// Reset unregisters every seeder.
+func Reset() {
+	mu.Lock()
+	seeders = map[string]Seeder{}
+	ordering = nil
+	mu.Unlock()
+}
+
+// Environment returns the environment of the application, read from the
+// APP.ENV setting, or an empty string when it is not set.
+func Environment() string {
+	return strings.ToLower(strings.TrimSpace(settings.Get("APP.ENV", "").String()))
+}
+
+// Allowed reports whether the seeder runs in env. Without an environment
+// only the seeders running everywhere are allowed.
+func (s Seeder) Allowed(env string) bool {
+	if env == "" {
+		return len(s.Env) == 0
+	}
+	return len(s.Env) == 0 || slices.ContainsFunc(s.Env, func(e string) bool {
+		return strings.EqualFold(e, env)
+	})
+}
+
+// Run runs the named seeders after their dependencies, or every seeder
+// allowed in the current environment without names. Each seeder runs in
+// its own transaction; fixture labels are shared by all the seeders of the
+// run. Naming a seeder that is not allowed in the environment, directly or
+// as a dependency, is an error.
+func Run(ctx context.Context, db *gorm.DB, names ...string) error {
+	var env = Environment()
+	plan, err := Plan(env, names...)
+	if err != nil {
+		return err
+	}
+	var session = db.WithContext(withState(ctx))
+	for _, seeder := range plan {
+		log.Info("seed: running seeder", "name", seeder.Name, "env", env)
+		if seeder.Run == nil {
+			continue
+		}
+		if err := session.Transaction(seeder.Run); err != nil {
+			return fmt.Errorf("seed: %s: %w", seeder.Name, err)
+		}
+	}
+	return nil
+}
+
+// Plan returns the seeders Run would run in env, dependencies first.
+func Plan(env string, names ...string) ([]Seeder, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var roots = names
+	if len(roots) == 0 {
+		for _, name := range ordering {
+			if seeders[name].Allowed(env) {
+				roots = append(roots, name)
+			}
+		}
+	}
+
+	var plan []Seeder
+	var state = map[string]int{} // 1 visiting, 2 done
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("seed: dependency cycle %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		seeder, ok := seeders[name]
+		if !ok {
+			if len(path) > 0 {
+				return fmt.Errorf("%w: %s, required by %s", ErrUnknownSeeder, name, path[len(path)-1])
+			}
+			return fmt.Errorf("%w: %s", ErrUnknownSeeder, name)
+		}
+		if !seeder.Allowed(env) && env == "" {
+			return fmt.Errorf("seed: seeder %s only runs in %s and APP.ENV is not set", name, strings.Join(seeder.Env, ", "))
+		}
+		if !seeder.Allowed(env) {
+			return fmt.Errorf("seed: seeder %s does not run in %s, only in %s", name, env, strings.Join(seeder.Env, ", "))
+		}
+		state[name] = 1
+		for _, dependency := range seeder.DependsOn {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		plan = append(plan, seeder)
+		return nil
+	}
+	for _, name := range roots {
+		if err := visit(strings.TrimSpace(name), nil); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,197 @@
+package seed_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/seed"
+	"github.com/getevo/evo/v2/lib/settings"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type User struct {
+	ID    uint   `gorm:"primaryKey;autoIncrement"`
+	Email string `gorm:"uniqueIndex;size:255"`
+	Name  string `json:"display_name"`
+	Admin bool
+}
+
+type Post struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement"`
+	Slug     string `gorm:"uniqueIndex;size:255"`
+	Title    string
+	AuthorID uint
+	Author   User
+	Editor   string
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "seed.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.AutoMigrate(&User{}, &Post{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if schema.Find("seed_test.User") == nil {
+		schema.UseModel(db, User{}, Post{})
+	}
+	t.Cleanup(seed.Reset)
+	return db
+}
+
+var fixtures = fstest.MapFS{
+	"fixtures/01_users.yml": {Data: []byte(`
+seed_test.User:
+  user_alice:
+    email: alice@example.com
+    display_name: Alice
+    admin: true
+  user_bob:
+    email: bob@example.com
+    Name: Bob
+`)},
+	"fixtures/02_posts.json": {Data: []byte(`{
+  "posts": {
+    "post_hello": {"slug": "hello", "title": "Hello", "author": "@user_alice", "editor": "@user_bob.email"},
+    "post_mail": {"slug": "mail", "title": "@@home", "author_id": "@user_bob"}
+  }
+}`)},
+}
+
+func TestFixturesAreIdempotent(t *testing.T) {
+	db := openDB(t)
+	seed.Register(seed.Seeder{Name: "demo", Run: seed.Fixtures(fixtures, "fixtures/*")})
+
+	for i := 0; i < 2; i++ {
+		if err := seed.Run(context.Background(), db); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+	var users []User
+	db.Order("id").Find(&users)
+	if len(users) != 2 || users[0].Name != "Alice" || !users[0].Admin || users[1].Name != "Bob" {
+		t.Fatalf("unexpected users %+v", users)
+	}
+	var posts []Post
+	db.Order("id").Find(&posts)
+	if len(posts) != 2 {
+		t.Fatalf("expected 2 posts, got %+v", posts)
+	}
+	if posts[0].AuthorID != users[0].ID || posts[0].Editor != "bob@example.com" {
+		t.Errorf("references not resolved: %+v", posts[0])
+	}
+	if posts[1].AuthorID != users[1].ID || posts[1].Title != "@home" {
+		t.Errorf("unexpected post %+v", posts[1])
+	}
+
+	// A changed fixture updates the row matched by its unique key.
+	db.Model(&User{}).Where("email = ?", "bob@example.com").Update("admin", true)
+	err := seed.Load(db, "update.yml", []byte("users:\n  - email: bob@example.com\n    Name: Robert\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bob User
+	db.Where("email = ?", "bob@example.com").Take(&bob)
+	if bob.ID != users[1].ID || bob.Name != "Robert" || !bob.Admin {
+		t.Errorf("expected Bob renamed and his other fields kept, got %+v", bob)
+	}
+}
+
+func TestInvalidFixtures(t *testing.T) {
+	db := openDB(t)
+	for _, document := range []string{
+		"unknown.Model:\n  - id: 1\n",
+		"users:\n  - Name: nobody\n",
+		"users:\n  - email: x@example.com\n    unknown: 1\n",
+		"posts:\n  - slug: x\n    author: \"@missing\"\n",
+		"- users\n",
+	} {
+		if err := seed.Load(db, "bad.yml", []byte(document)); !errors.Is(err, seed.ErrInvalidFixture) {
+			t.Errorf("%q: expected ErrInvalidFixture, got %v", document, err)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	openDB(t)
+	var run = func(tx *gorm.DB) error { return nil }
+	seed.Register(
+		seed.Seeder{Name: "demo", DependsOn: []string{"users"}, Env: []string{"dev", "staging"}, Run: run},
+		seed.Seeder{Name: "countries", Run: run},
+		seed.Seeder{Name: "users", DependsOn: []string{"countries"}, Run: run},
+	)
+
+	var names = func(plan []seed.Seeder) string {
+		var result []string
+		for _, seeder := range plan {
+			result = append(result, seeder.Name)
+		}
+		return strings.Join(result, ",")
+	}
+	if plan, err := seed.Plan("dev"); err != nil || names(plan) != "countries,users,demo" {
+		t.Errorf("dev: unexpected plan %s, %v", names(plan), err)
+	}
+	if plan, err := seed.Plan("production"); err != nil || names(plan) != "countries,users" {
+		t.Errorf("production: unexpected plan %s, %v", names(plan), err)
+	}
+	if _, err := seed.Plan("production", "demo"); err == nil {
+		t.Error("expected demo to be refused in production")
+	}
+	if plan, err := seed.Plan(""); err != nil || names(plan) != "countries,users" {
+		t.Errorf("no environment: unexpected plan %s, %v", names(plan), err)
+	}
+	if _, err := seed.Plan("", "demo"); err == nil {
+		t.Error("expected demo to be refused without an environment")
+	}
+	if plan, err := seed.Plan("production", "users"); err != nil || names(plan) != "countries,users" {
+		t.Errorf("unexpected plan %s, %v", names(plan), err)
+	}
+	if _, err := seed.Plan("dev", "nope"); !errors.Is(err, seed.ErrUnknownSeeder) {
+		t.Errorf("expected ErrUnknownSeeder, got %v", err)
+	}
+
+	seed.Register(
+		seed.Seeder{Name: "a", DependsOn: []string{"b"}},
+		seed.Seeder{Name: "b", DependsOn: []string{"a"}},
+	)
+	if _, err := seed.Plan("dev", "a"); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+}
+
+func TestRunUsesTheEnvironment(t *testing.T) {
+	db := openDB(t)
+	settings.Set("APP.ENV", "production")
+	defer settings.Set("APP.ENV", "")
+
+	var ran bool
+	seed.Register(seed.Seeder{Name: "demo", Env: []string{"dev"}, Run: func(tx *gorm.DB) error {
+		ran = true
+		return nil
+	}})
+	if err := seed.Run(context.Background(), db); err != nil || ran {
+		t.Errorf("expected demo skipped in production, got ran=%v, %v", ran, err)
+	}
+	if err := seed.Run(context.Background(), db, "demo"); err == nil || ran {
+		t.Errorf("expected demo refused in production, got ran=%v, %v", ran, err)
+	}
+
+	settings.Set("APP.ENV", "")
+	if env := seed.Environment(); env != "" {
+		t.Errorf("expected no default environment, got %q", env)
+	}
+	if err := seed.Run(context.Background(), db); err != nil || ran {
+		t.Errorf("expected demo skipped without an environment, got ran=%v, %v", ran, err)
+	}
+}
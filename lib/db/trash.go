@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
+	"github.com/getevo/evo/v2/lib/log"
+	"github.com/getevo/evo/v2/lib/scheduler"
+)
+
+// PurgeLock is the name of the lock taken by the scheduled purge, so that a
+// single instance runs it at a time.
+const PurgeLock = "evo:purge_trash"
+
+// PurgeTrash hard deletes the rows of the registered models soft deleted for
+// longer than their purge_after retention, batch rows per statement, each on
+// the connection of its model. A model failing to purge is logged and does
+// not stop the others.
+func PurgeTrash(ctx context.Context, batch int) error {
+	for _, model := range Models() {
+		if model.Schema == nil {
+			continue
+		}
+		if retention, err := types.PurgeAfter(model.Schema); err != nil || retention == 0 {
+			if err != nil {
+				log.Error("unable to purge soft-deleted rows", "table", model.Table, "error", err)
+			}
+			continue
+		}
+		var conn = db
+		if name := schema.ModelConnection(model.Sample); name != "" {
+			if conn = GetConnection(name); conn == nil {
+				log.Error("unable to purge soft-deleted rows", "table", model.Table, "error", "connection "+name+" is not registered")
+				continue
+			}
+		}
+		purged, err := types.PurgeTrashed(conn.WithContext(ctx), model.Sample, batch)
+		if err != nil {
+			log.Error("unable to purge soft-deleted rows", "table", model.Table, "error", err)
+		}
+		if purged > 0 {
+			log.Info("purged soft-deleted rows", "table", model.Table, "rows", purged)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// SchedulePurge starts the scheduler job running PurgeTrash at the times
+// matching every, such as "03:00:00" for every night at 3. The instance
+// holding PurgeLock runs it, the others skip that run.
+func SchedulePurge(every string, batch int) *scheduler.Job {
+	var job = scheduler.CreateJob(PurgeLock, every, func(job *scheduler.Job) error {
+		var ctx = context.Background()
+		lock, ok, err := TryLock(ctx, PurgeLock)
+		if err != nil || !ok {
+			return err
+		}
+		defer lock.Release()
+		return PurgeTrash(ctx, batch)
+	})
+	job.OnError = func(job *scheduler.Job, err error) {
+		log.Error("soft delete purge failed", "error", err)
+	}
+	job.Start()
+	return job
+}
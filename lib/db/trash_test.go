@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
+	"gorm.io/gorm"
+)
+
+type archivedEvent struct {
+	ID               uint
+	types.SoftDelete `gorm:"purge_after:1d"`
+}
+
+func TestPurgeTrashOnModelConnection(t *testing.T) {
+	primary, archive := openLockTestDB(t), openLockTestDB(t)
+	if err := archive.AutoMigrate(&archivedEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	var stmt = &gorm.Statement{DB: archive}
+	if err := stmt.Parse(&archivedEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	previous, models := db, schema.Models
+	db, schema.Models = primary, []schema.Model{{Sample: &archivedEvent{}, Table: stmt.Table, Schema: stmt.Schema}}
+	RegisterConnection("archive", archive)
+	schema.SetModelConnection("archive", &archivedEvent{})
+	t.Cleanup(func() {
+		db, schema.Models = previous, models
+		schema.SetModelConnection("", &archivedEvent{})
+		connectionsMu.Lock()
+		delete(connections, "archive")
+		connectionsMu.Unlock()
+	})
+
+	var event archivedEvent
+	event.Set(time.Now().AddDate(0, 0, -2))
+	archive.Create(&event)
+
+	if err := PurgeTrash(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	archive.Unscoped().Model(&archivedEvent{}).Count(&n)
+	if n != 0 {
+		t.Errorf("expected the event purged on its connection, got %d left", n)
+	}
+}
@@ -0,0 +1,354 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrDivisionByZero is returned by Decimal.Div for a zero divisor.
+var ErrDivisionByZero = errors.New("decimal division by zero")
+
+const (
+	// maxDecimalExponent bounds the exponent NewDecimal accepts, so that
+	// "1e30000000" does not allocate a number of 30 million digits.
+	maxDecimalExponent = 1000
+
+	// maxDecimalScale bounds the digits after the decimal point NewDecimal
+	// accepts.
+	maxDecimalScale = 100
+)
+
+// Decimal is an exact decimal number of arbitrary precision, for amounts that
+// must not suffer the rounding of float64. The zero value is 0:
+//
+//	type Invoice struct {
+//	    ID    uint
+//	    Total types.Decimal `gorm:"precision:18;scale:2"`
+//	}
+//
+// The migrators create it as DECIMAL(p,s) on MySQL, DECIMAL(20,4) without the
+// precision and scale tags, and as NUMERIC(p,s) on PostgreSQL, unconstrained
+// without tags. It is encoded as a JSON string, and decoded from a string or
+// a number.
+type Decimal struct {
+	// value is the number multiplied by 10^scale.
+	value *big.Int
+	scale int32
+}
+
+var bigTen = big.NewInt(10)
+
+// NewDecimal parses s, such as "-12.50" or "1.5e3", as a Decimal.
+func NewDecimal(s string) (Decimal, error) {
+	var d Decimal
+	var text = strings.TrimSpace(s)
+	var exp int64
+	if i := strings.IndexAny(text, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(text[i+1:], 10, 32)
+		if err != nil {
+			return d, fmt.Errorf("invalid decimal %q", s)
+		}
+		if e > maxDecimalExponent || e < -maxDecimalExponent {
+			return d, fmt.Errorf("decimal exponent out of range %q", s)
+		}
+		text, exp = text[:i], e
+	}
+	var digits = text
+	if dot := strings.IndexByte(text, '.'); dot >= 0 {
+		digits = text[:dot] + text[dot+1:]
+		exp -= int64(len(text) - dot - 1)
+	}
+	var unsigned = strings.TrimLeft(digits, "+-")
+	if unsigned == "" || len(digits)-len(unsigned) > 1 || strings.Trim(unsigned, "0123456789") != "" {
+		return d, fmt.Errorf("invalid decimal %q", s)
+	}
+	if -exp > maxDecimalScale {
+		return d, fmt.Errorf("decimal scale out of range %q", s)
+	}
+	value, _ := new(big.Int).SetString(digits, 10)
+	if exp > 0 {
+		value.Mul(value, pow10(int32(exp)))
+		exp = 0
+	}
+	return Decimal{value: value, scale: int32(-exp)}, nil
+}
+
+// MustDecimal is NewDecimal panicking on an invalid s.
+func MustDecimal(s string) Decimal {
+	d, err := NewDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// NewDecimalFromInt returns value × 10^-scale, so that
+// NewDecimalFromInt(1999, 2) is 19.99.
+func NewDecimalFromInt(value int64, scale int32) Decimal {
+	return Decimal{value: big.NewInt(value), scale: scale}.normalize()
+}
+
+// NewDecimalFromFloat returns the shortest decimal representing f.
+func NewDecimalFromFloat(f float64) Decimal {
+	d, _ := NewDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	return d
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+func (d Decimal) int() *big.Int {
+	if d.value == nil {
+		return new(big.Int)
+	}
+	return d.value
+}
+
+// normalize makes negative scales 0.
+func (d Decimal) normalize() Decimal {
+	if d.scale < 0 {
+		return Decimal{value: new(big.Int).Mul(d.int(), pow10(-d.scale))}
+	}
+	return d
+}
+
+// rescale returns the value of d at a larger scale.
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale <= d.scale {
+		return d.int()
+	}
+	return new(big.Int).Mul(d.int(), pow10(scale-d.scale))
+}
+
+// Scale returns the number of digits after the decimal point.
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Add returns d + o.
+func (d Decimal) Add(o Decimal) Decimal {
+	var scale = max(d.scale, o.scale)
+	return Decimal{value: new(big.Int).Add(d.rescale(scale), o.rescale(scale)), scale: scale}
+}
+
+// Sub returns d - o.
+func (d Decimal) Sub(o Decimal) Decimal {
+	var scale = max(d.scale, o.scale)
+	return Decimal{value: new(big.Int).Sub(d.rescale(scale), o.rescale(scale)), scale: scale}
+}
+
+// Mul returns d × o, exactly.
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{value: new(big.Int).Mul(d.int(), o.int()), scale: d.scale + o.scale}
+}
+
+// Div returns d / o rounded half to even to places digits after the
+// decimal point. A negative places rounds to tens, hundreds, and so on, as
+// in Round.
+func (d Decimal) Div(o Decimal, places int32) (Decimal, error) {
+	if o.Sign() == 0 {
+		return Decimal{}, ErrDivisionByZero
+	}
+	var scale = max(d.scale, o.scale)
+	var num, den = d.rescale(scale), o.rescale(scale)
+	if places >= 0 {
+		num = new(big.Int).Mul(num, pow10(places))
+	} else {
+		den = new(big.Int).Mul(den, pow10(-places))
+	}
+	return Decimal{value: quoHalfEven(num, den), scale: places}.normalize(), nil
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{value: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+// Abs returns |d|.
+func (d Decimal) Abs() Decimal {
+	return Decimal{value: new(big.Int).Abs(d.int()), scale: d.scale}
+}
+
+// Round returns d rounded half to even (banker's rounding) to places digits
+// after the decimal point, so that 2.345 rounds to 2.34 and 2.355 to 2.36. A
+// negative places rounds to tens, hundreds, and so on.
+func (d Decimal) Round(places int32) Decimal {
+	if places >= d.scale {
+		return Decimal{value: d.rescale(places), scale: places}
+	}
+	return Decimal{value: quoHalfEven(d.int(), pow10(d.scale-places)), scale: places}.normalize()
+}
+
+// Truncate returns d with the digits after places dropped.
+func (d Decimal) Truncate(places int32) Decimal {
+	if places >= d.scale {
+		return Decimal{value: d.rescale(places), scale: places}
+	}
+	return Decimal{value: new(big.Int).Quo(d.int(), pow10(d.scale-places)), scale: places}.normalize()
+}
+
+// quoHalfEven returns num / den rounded half to even.
+func quoHalfEven(num, den *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	var twice = new(big.Int).Abs(r)
+	twice.Lsh(twice, 1)
+	var cmp = twice.Cmp(new(big.Int).Abs(den))
+	if cmp > 0 || (cmp == 0 && q.Bit(0) == 1) {
+		if num.Sign()*den.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+// Cmp returns -1, 0 or +1 as d is less than, equal to or greater than o.
+func (d Decimal) Cmp(o Decimal) int {
+	var scale = max(d.scale, o.scale)
+	return d.rescale(scale).Cmp(o.rescale(scale))
+}
+
+// Equal reports whether d and o are the same number, whatever their scale.
+func (d Decimal) Equal(o Decimal) bool {
+	return d.Cmp(o) == 0
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of d.
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// IsZero reports whether d is 0.
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Rat returns d as a big.Rat.
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.int(), pow10(d.scale))
+}
+
+// Float64 returns the nearest float64 to d.
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+// String returns d with Scale digits after the decimal point.
+func (d Decimal) String() string {
+	var digits = new(big.Int).Abs(d.int()).String()
+	var sign = ""
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		return sign + digits
+	}
+	if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	var point = len(digits) - int(d.scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// StringFixed returns d rounded half to even to places digits after the
+// decimal point.
+func (d Decimal) StringFixed(places int32) string {
+	return d.Round(places).String()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	var text = string(b)
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(b, &text); err != nil {
+			return err
+		}
+	}
+	value, err := NewDecimal(text)
+	if err != nil {
+		return err
+	}
+	*d = value
+	return nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (d *Decimal) Scan(src any) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*d = Decimal{}
+	case []byte:
+		*d, err = NewDecimal(string(v))
+	case string:
+		*d, err = NewDecimal(v)
+	case int64:
+		*d = NewDecimalFromInt(v, 0)
+	case float64:
+		*d = NewDecimalFromFloat(v)
+	default:
+		err = fmt.Errorf("failed to scan decimal value: %v", src)
+	}
+	return err
+}
+
+// Value implements the driver.Valuer interface.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// GormDataType gorm common data type.
+func (Decimal) GormDataType() string {
+	return "decimal"
+}
+
+// GormDBDataType gorm db data type.
+func (Decimal) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return DecimalType(field, "DECIMAL")
+	case "postgres":
+		if field.Precision == 0 {
+			return "NUMERIC"
+		}
+		return DecimalType(field, "NUMERIC")
+	case "sqlserver":
+		return DecimalType(field, "DECIMAL")
+	case "sqlite":
+		return "TEXT"
+	default:
+		return ""
+	}
+}
+
+// DecimalType returns the name of a decimal column type with the precision
+// and scale of field, DECIMAL(20,4) when it has none.
+func DecimalType(field *schema.Field, name string) string {
+	var precision, scale = field.Precision, field.Scale
+	if precision == 0 {
+		precision, scale = 20, 4
+	}
+	return fmt.Sprintf("%s(%d,%d)", name, precision, scale)
+}
@@ -0,0 +1,174 @@
+package types_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/getevo/evo/v2/lib/db/types"
+)
+
+func TestDecimalParse(t *testing.T) {
+	cases := map[string]string{
+		"12.50":   "12.50",
+		"-0.05":   "-0.05",
+		"+3":      "3",
+		".5":      "0.5",
+		"1.5e3":   "1500",
+		"12.5E-2": "0.125",
+		"007.10":  "7.10",
+	}
+	for input, expected := range cases {
+		d, err := types.NewDecimal(input)
+		if err != nil || d.String() != expected {
+			t.Errorf("%q: expected %s, got %s, %v", input, expected, d, err)
+		}
+	}
+	for _, input := range []string{"", "-", "1.2.3", "1-2", "--1", "abc", "1e", "1e30000000", "1e-2147483647", "1e-101", "0." + strings.Repeat("1", 101)} {
+		if _, err := types.NewDecimal(input); err == nil {
+			t.Errorf("expected %q to be invalid", input)
+		}
+	}
+	if s := (types.Decimal{}).String(); s != "0" {
+		t.Errorf("expected the zero value to be 0, got %s", s)
+	}
+	if s := types.NewDecimalFromInt(1999, 2).String(); s != "19.99" {
+		t.Errorf("expected 19.99, got %s", s)
+	}
+	if s := types.NewDecimalFromFloat(0.1).String(); s != "0.1" {
+		t.Errorf("expected 0.1, got %s", s)
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	a, b := types.MustDecimal("0.1"), types.MustDecimal("0.2")
+	if sum := a.Add(b); !sum.Equal(types.MustDecimal("0.3")) {
+		t.Errorf("expected 0.3, got %s", sum)
+	}
+	if diff := a.Sub(types.MustDecimal("1.25")); diff.String() != "-1.15" {
+		t.Errorf("expected -1.15, got %s", diff)
+	}
+	if product := types.MustDecimal("19.99").Mul(types.MustDecimal("3")); product.String() != "59.97" {
+		t.Errorf("expected 59.97, got %s", product)
+	}
+	if quotient, err := types.MustDecimal("10").Div(types.MustDecimal("3"), 4); err != nil || quotient.String() != "3.3333" {
+		t.Errorf("expected 3.3333, got %s, %v", quotient, err)
+	}
+	if quotient, _ := types.MustDecimal("-2").Div(types.MustDecimal("3"), 2); quotient.String() != "-0.67" {
+		t.Errorf("expected -0.67, got %s", quotient)
+	}
+	if quotient, _ := types.MustDecimal("1234").Div(types.MustDecimal("1"), -2); quotient.String() != "1200" {
+		t.Errorf("expected 1200, got %s", quotient)
+	}
+	if quotient, _ := types.MustDecimal("12.5").Div(types.MustDecimal("0.1"), -1); quotient.String() != "120" {
+		t.Errorf("expected 120, got %s", quotient)
+	}
+	if _, err := a.Div(types.Decimal{}, 2); !errors.Is(err, types.ErrDivisionByZero) {
+		t.Errorf("expected ErrDivisionByZero, got %v", err)
+	}
+	if a.Cmp(b) != -1 || b.Cmp(a) != 1 || !types.MustDecimal("1.50").Equal(types.MustDecimal("1.5")) {
+		t.Error("unexpected comparison")
+	}
+	if types.MustDecimal("-1").Abs().String() != "1" || types.MustDecimal("1").Neg().Sign() != -1 {
+		t.Error("unexpected sign")
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	cases := [][3]string{
+		{"2.345", "2", "2.34"},
+		{"2.355", "2", "2.36"},
+		{"2.3451", "2", "2.35"},
+		{"-2.345", "2", "-2.34"},
+		{"-2.355", "2", "-2.36"},
+		{"0.5", "0", "0"},
+		{"1.5", "0", "2"},
+		{"1.2", "3", "1.200"},
+	}
+	if got := types.MustDecimal("125").Round(-1).String(); got != "120" {
+		t.Errorf("125 rounded to -1: expected 120, got %s", got)
+	}
+	if got := types.MustDecimal("135.7").Round(-1).String(); got != "140" {
+		t.Errorf("135.7 rounded to -1: expected 140, got %s", got)
+	}
+	if got := types.MustDecimal("-1299").Truncate(-2).String(); got != "-1200" {
+		t.Errorf("-1299 truncated to -2: expected -1200, got %s", got)
+	}
+	for _, c := range cases {
+		places := int32(c[1][0] - '0')
+		if got := types.MustDecimal(c[0]).Round(places).String(); got != c[2] {
+			t.Errorf("%s rounded to %d: expected %s, got %s", c[0], places, c[2], got)
+		}
+	}
+	if got := types.MustDecimal("-2.359").Truncate(2).String(); got != "-2.35" {
+		t.Errorf("expected -2.35, got %s", got)
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var value struct {
+		Price types.Decimal `json:"price"`
+	}
+	if err := json.Unmarshal([]byte(`{"price":12.10}`), &value); err != nil || value.Price.String() != "12.10" {
+		t.Fatalf("expected 12.10 from a number, got %s, %v", value.Price, err)
+	}
+	if err := json.Unmarshal([]byte(`{"price":"-0.001"}`), &value); err != nil || value.Price.String() != "-0.001" {
+		t.Fatalf("expected -0.001 from a string, got %s, %v", value.Price, err)
+	}
+	if err := json.Unmarshal([]byte(`{"price":"abc"}`), &value); err == nil {
+		t.Error("expected an invalid decimal to fail")
+	}
+	if err := json.Unmarshal([]byte(`{"price":"1e30000000"}`), &value); err == nil {
+		t.Error("expected a huge exponent to fail")
+	}
+	if err := json.Unmarshal([]byte(`{"price":1e-2147483647}`), &value); err == nil {
+		t.Error("expected a huge scale to fail")
+	}
+	b, _ := json.Marshal(value)
+	if string(b) != `{"price":"-0.001"}` {
+		t.Errorf("expected the decimal as a string, got %s", b)
+	}
+}
+
+type ledgerEntry struct {
+	ID     uint
+	Amount types.Decimal `gorm:"precision:30;scale:10"`
+	Total  types.Money   `gorm:"embedded;embeddedPrefix:total_"`
+}
+
+func TestDecimalDatabase(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&ledgerEntry{}); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := ledgerEntry{Amount: types.MustDecimal("12345678901234567890.0123456789"), Total: types.MustMoney("10.5", "eur")}
+	db.Create(&entry)
+	var loaded ledgerEntry
+	if err := db.First(&loaded, entry.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Amount.String() != "12345678901234567890.0123456789" {
+		t.Errorf("expected the exact amount back, got %s", loaded.Amount)
+	}
+	if !loaded.Total.Equal(types.MustMoney("10.50", "EUR")) {
+		t.Errorf("expected 10.50 EUR back, got %s", loaded.Total)
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	stmt.Parse(&ledgerEntry{})
+	if got := types.DecimalType(stmt.Schema.LookUpField("amount"), "DECIMAL"); got != "DECIMAL(30,10)" {
+		t.Errorf("expected DECIMAL(30,10), got %s", got)
+	}
+	if got := types.DecimalType(stmt.Schema.LookUpField("total_amount"), "NUMERIC"); got != "NUMERIC(19,4)" {
+		t.Errorf("expected NUMERIC(19,4), got %s", got)
+	}
+}
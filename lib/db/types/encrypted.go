@@ -0,0 +1,616 @@
+package types
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	dbschema "github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/json"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrNoEncryptionKey is returned when encrypting without a key ring.
+	ErrNoEncryptionKey = errors.New("encryption: no key configured")
+
+	// ErrUnknownEncryptionKey is returned when decrypting a value encrypted
+	// with a key missing from the key ring.
+	ErrUnknownEncryptionKey = errors.New("encryption: unknown key")
+
+	// ErrDecryption is returned for values that cannot be decrypted.
+	ErrDecryption = errors.New("encryption: unable to decrypt value")
+
+	// ErrNoBlindIndexKey is returned when computing a blind index without a
+	// blind index key.
+	ErrNoBlindIndexKey = errors.New("encryption: no blind index key configured")
+)
+
+// KeyRing holds the AES-256 keys of encrypted columns. The active key
+// encrypts new values; the others only decrypt the values written before a
+// rotation.
+type KeyRing struct {
+	active string
+	keys   map[string]cipher.AEAD
+	blind  []byte
+}
+
+var (
+	keyRingMu sync.RWMutex
+	keyRing   *KeyRing
+)
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ParseKeyRing returns the key ring of keys, a comma separated list of
+// id:base64 pairs of 32 byte keys, the first one being the active key.
+// blindKey, base64 encoded, keys the blind indexes; it may be empty when no
+// blind index is used, and must never change once indexes are stored.
+//
+//	types.ParseKeyRing("k2:8yBm...=,k1:Q0xa...=", blindKey)
+func ParseKeyRing(keys, blindKey string) (*KeyRing, error) {
+	var ring = &KeyRing{keys: map[string]cipher.AEAD{}}
+	for _, pair := range strings.Split(keys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok || !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("encryption: invalid key %q, expected id:base64", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encryption: key %s must be 32 bytes, base64 encoded", id)
+		}
+		if err = ring.Add(id, key); err != nil {
+			return nil, err
+		}
+	}
+	if ring.active == "" {
+		return nil, ErrNoEncryptionKey
+	}
+	if blindKey != "" {
+		key, err := base64.StdEncoding.DecodeString(blindKey)
+		if err != nil || len(key) < 32 {
+			return nil, errors.New("encryption: the blind index key must be at least 32 bytes, base64 encoded")
+		}
+		ring.blind = key
+	}
+	return ring, nil
+}
+
+// Add adds a 32 byte key to the ring. The first key added is the active one.
+func (ring *KeyRing) Add(id string, key []byte) error {
+	if _, ok := ring.keys[id]; ok {
+		return fmt.Errorf("encryption: duplicate key %s", id)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	if ring.keys == nil {
+		ring.keys = map[string]cipher.AEAD{}
+	}
+	ring.keys[id] = aead
+	if ring.active == "" {
+		ring.active = id
+	}
+	return nil
+}
+
+// Active returns the ID of the key encrypting new values.
+func (ring *KeyRing) Active() string {
+	return ring.active
+}
+
+// SetKeyRing sets the key ring of the encrypted columns. evo sets it from
+// the Database.EncryptionKeys and Database.BlindIndexKey settings.
+func SetKeyRing(ring *KeyRing) {
+	keyRingMu.Lock()
+	keyRing = ring
+	keyRingMu.Unlock()
+}
+
+func currentKeyRing() (*KeyRing, error) {
+	keyRingMu.RLock()
+	defer keyRingMu.RUnlock()
+	if keyRing == nil {
+		return nil, ErrNoEncryptionKey
+	}
+	return keyRing, nil
+}
+
+// Encrypted is a column stored encrypted with AES-256-GCM. Value encrypts
+// Val with the active key of the key ring, and Scan decrypts it, so the
+// application only sees the plaintext:
+//
+//	type Customer struct {
+//	    ID       uint `gorm:"primaryKey"`
+//	    Email    types.Encrypted[string]
+//	    EmailIdx types.BlindIndex `gorm:"blind_index:Email;index"`
+//	    APIKeys  types.Encrypted[[]string]
+//	}
+//
+// Stored values are prefixed with the ID of their key, so that
+// RotateEncryption can re-encrypt them once a new key is active. Strings
+// and byte slices are encrypted as is, other types as JSON. Encrypted
+// values marshal to JSON as null unless revealed, see Reveal.
+type Encrypted[T any] struct {
+	Val    T
+	keyID  string
+	reveal bool
+	// sealed is the stored value Scan decrypted to opened
+	sealed string
+	opened string
+}
+
+// NewEncrypted returns an encrypted column holding v.
+func NewEncrypted[T any](v T) Encrypted[T] {
+	return Encrypted[T]{Val: v}
+}
+
+// Data returns the plaintext value.
+func (e Encrypted[T]) Data() T {
+	return e.Val
+}
+
+// KeyID returns the ID of the key the value was read with, or an empty
+// string for a value not read from the database.
+func (e Encrypted[T]) KeyID() string {
+	return e.keyID
+}
+
+// Reveal returns a copy of e marshalling its plaintext to JSON.
+func (e Encrypted[T]) Reveal() Encrypted[T] {
+	e.reveal = true
+	return e
+}
+
+// plaintext returns the bytes encrypted for e.
+func (e Encrypted[T]) plaintext() ([]byte, error) {
+	switch v := any(e.Val).(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	}
+	return json.Marshal(e.Val)
+}
+
+// Ciphertext returns the value as stored, so that the history of a model
+// can record the column without revealing it.
+func (e Encrypted[T]) Ciphertext() (string, error) {
+	value, err := e.Value()
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// Value implements driver.Valuer, encrypting the value with the active key.
+// A value read from the database and left unchanged keeps its ciphertext
+// until the active key changes.
+func (e Encrypted[T]) Value() (driver.Value, error) {
+	ring, err := currentKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	data, err := e.plaintext()
+	if err != nil {
+		return nil, err
+	}
+	if e.sealed != "" && e.keyID == ring.active && string(data) == e.opened {
+		return e.sealed, nil
+	}
+	var aead = ring.keys[ring.active]
+	var nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	var sealed = aead.Seal(nonce, nonce, data, []byte(ring.active))
+	return ring.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Scan implements sql.Scanner, decrypting the value with the key it was
+// encrypted with.
+func (e *Encrypted[T]) Scan(value any) error {
+	var stored string
+	switch v := value.(type) {
+	case nil:
+		*e = Encrypted[T]{}
+		return nil
+	case []byte:
+		stored = string(v)
+	case string:
+		stored = v
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrDecryption, value)
+	}
+	ring, err := currentKeyRing()
+	if err != nil {
+		return err
+	}
+	id, encoded, ok := strings.Cut(stored, ":")
+	if !ok {
+		return ErrDecryption
+	}
+	aead, ok := ring.keys[id]
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownEncryptionKey, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return ErrDecryption
+	}
+	data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return ErrDecryption
+	}
+
+	var result = Encrypted[T]{keyID: id, reveal: e.reveal, sealed: stored, opened: string(data)}
+	switch p := any(&result.Val).(type) {
+	case *string:
+		*p = string(data)
+	case *[]byte:
+		*p = data
+	default:
+		if err = json.Unmarshal(data, &result.Val); err != nil {
+			return fmt.Errorf("%w: %v", ErrDecryption, err)
+		}
+	}
+	*e = result
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. It returns null unless the value
+// was revealed, so that secrets do not leak into API responses.
+func (e Encrypted[T]) MarshalJSON() ([]byte, error) {
+	if !e.reveal {
+		return []byte("null"), nil
+	}
+	return json.Marshal(e.Val)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading the plaintext.
+func (e *Encrypted[T]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &e.Val)
+}
+
+// GormDataType gorm common data type.
+func (Encrypted[T]) GormDataType() string {
+	return "string"
+}
+
+// GormDBDataType gorm db data type.
+func (Encrypted[T]) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return "TEXT"
+}
+
+// ColumnDefinition migrates the column as text, whatever the size of the
+// plaintext.
+func (Encrypted[T]) ColumnDefinition(column *dbschema.Column) {
+	column.Type = "text"
+	column.Size = 0
+}
+
+// wrap returns a value written to the column as an Encrypted[T], so that a
+// plaintext given to a map update is encrypted.
+func (Encrypted[T]) wrap(value any) (any, bool) {
+	switch v := value.(type) {
+	case nil, Encrypted[T], *Encrypted[T]:
+		return value, true
+	case T:
+		return Encrypted[T]{Val: v}, true
+	}
+	return nil, false
+}
+
+// encryptedValue is implemented by every Encrypted type.
+type encryptedValue interface {
+	driver.Valuer
+	KeyID() string
+	plaintext() ([]byte, error)
+	wrap(value any) (any, bool)
+}
+
+// BlindIndex is a keyed hash (HMAC-SHA256) of an encrypted column, allowing
+// equality lookups without decrypting. The BlindIndexes plugin, which evo
+// registers, fills it on create and update from the column named by its
+// blind_index tag setting:
+//
+//	EmailIdx types.BlindIndex `gorm:"blind_index:Email;index"`
+//
+//	db.Where("email_idx = ?", types.MustBlindIndexOf("alice@example.com")).First(&customer)
+//
+// The index matches the exact plaintext; normalize values, such as e-mail
+// addresses, before storing them.
+type BlindIndex string
+
+// GormDataType gorm common data type.
+func (BlindIndex) GormDataType() string {
+	return "string"
+}
+
+// ColumnDefinition migrates the column as the 64 hex digits of the hash.
+func (BlindIndex) ColumnDefinition(column *dbschema.Column) {
+	column.Type = "char(64)"
+	column.Size = 64
+}
+
+// BlindIndexOf returns the blind index of value: a string, a []byte, an
+// Encrypted column, or any other value as JSON, as encrypted.
+func BlindIndexOf(value any) (BlindIndex, error) {
+	ring, err := currentKeyRing()
+	if err != nil {
+		return "", err
+	}
+	if ring.blind == nil {
+		return "", ErrNoBlindIndexKey
+	}
+	var data []byte
+	switch v := value.(type) {
+	case encryptedValue:
+		data, err = v.plaintext()
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return "", err
+	}
+	var mac = hmac.New(sha256.New, ring.blind)
+	mac.Write(data)
+	return BlindIndex(hex.EncodeToString(mac.Sum(nil))), nil
+}
+
+// MustBlindIndexOf is BlindIndexOf panicking on error.
+func MustBlindIndexOf(value any) BlindIndex {
+	index, err := BlindIndexOf(value)
+	if err != nil {
+		panic(err)
+	}
+	return index
+}
+
+// BlindIndexes is the plugin filling the BlindIndex columns. It also
+// encrypts the plaintext values given to map updates of Encrypted columns.
+type BlindIndexes struct{}
+
+// Name implements gorm.Plugin.
+func (BlindIndexes) Name() string {
+	return "evo:blind_index"
+}
+
+// Initialize implements gorm.Plugin.
+func (BlindIndexes) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("evo:blind_index", fillBlindIndexes); err != nil {
+		return err
+	}
+	return db.Callback().Update().Before("gorm:update").Register("evo:blind_index", fillBlindIndexes)
+}
+
+// destIsModel reports whether the statement writes its model, rather than
+// the values of an Updates. Creating a slice makes both the same slice,
+// which cannot be compared with ==.
+func destIsModel(stmt *gorm.Statement) bool {
+	var dest, model = reflect.ValueOf(stmt.Dest), reflect.ValueOf(stmt.Model)
+	if !dest.IsValid() || !model.IsValid() || dest.Type() != model.Type() {
+		return false
+	}
+	switch dest.Kind() {
+	case reflect.Slice, reflect.Map:
+		return dest.Pointer() == model.Pointer() && dest.Len() == model.Len()
+	}
+	return dest.Type().Comparable() && stmt.Dest == stmt.Model
+}
+
+// fillBlindIndexes sets the blind indexes of the model from their sources,
+// and selects them when their source is selected.
+func fillBlindIndexes(db *gorm.DB) {
+	var stmt = db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return
+	}
+	if dest, ok := stmt.Dest.(map[string]any); ok && !destIsModel(stmt) {
+		if err := encryptMap(stmt.Schema, dest); err != nil {
+			db.AddError(err)
+			return
+		}
+	}
+	var pairs [][2]*schema.Field
+	for _, field := range stmt.Schema.Fields {
+		name, ok := field.TagSettings["BLIND_INDEX"]
+		if !ok {
+			continue
+		}
+		source := stmt.Schema.LookUpField(name)
+		if source == nil {
+			db.AddError(fmt.Errorf("encryption: blind index %s: unknown field %s", field.Name, name))
+			return
+		}
+		pairs = append(pairs, [2]*schema.Field{field, source})
+	}
+	if len(pairs) == 0 {
+		return
+	}
+
+	var fill = func(ctx context.Context, rv reflect.Value) {
+		for _, pair := range pairs {
+			var index, source = pair[0], pair[1]
+			value, zero := source.ValueOf(ctx, rv)
+			if zero {
+				continue
+			}
+			hash, err := BlindIndexOf(value)
+			if err != nil {
+				db.AddError(err)
+				return
+			}
+			if err = index.Set(ctx, rv, hash); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	}
+	// Updates reads the new values from its argument rather than the model
+	var target = stmt.ReflectValue
+	if !destIsModel(stmt) {
+		switch dest := stmt.Dest.(type) {
+		case map[string]any:
+			for _, pair := range pairs {
+				value, ok := dest[pair[1].Name]
+				if !ok {
+					value, ok = dest[pair[1].DBName]
+				}
+				if !ok {
+					continue
+				}
+				hash, err := BlindIndexOf(value)
+				if err != nil {
+					db.AddError(err)
+					return
+				}
+				dest[pair[0].DBName] = hash
+			}
+			target = reflect.Value{}
+		default:
+			if rv := reflect.Indirect(reflect.ValueOf(dest)); rv.Kind() == reflect.Struct && rv.Type() == stmt.Schema.ModelType && rv.CanAddr() {
+				target = rv
+			}
+		}
+	}
+	switch target.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < target.Len(); i++ {
+			fill(stmt.Context, reflect.Indirect(target.Index(i)))
+		}
+	case reflect.Struct:
+		fill(stmt.Context, target)
+	}
+
+	if len(stmt.Selects) > 0 {
+		for _, pair := range pairs {
+			var selected bool
+			for _, s := range stmt.Selects {
+				if s == "*" || s == pair[1].Name || s == pair[1].DBName {
+					selected = true
+				}
+			}
+			if selected {
+				stmt.Selects = append(stmt.Selects, pair[0].DBName)
+			}
+		}
+	}
+}
+
+// encryptMap replaces the plaintext values of the Encrypted columns of a map
+// update with their Encrypted form, which the column stores encrypted.
+func encryptMap(s *schema.Schema, dest map[string]any) error {
+	for _, field := range s.Fields {
+		column, ok := reflect.New(field.IndirectFieldType).Elem().Interface().(encryptedValue)
+		if !ok || field.DBName == "" {
+			continue
+		}
+		for _, key := range []string{field.Name, field.DBName} {
+			value, ok := dest[key]
+			if !ok {
+				continue
+			}
+			if dest[key], ok = column.wrap(value); !ok {
+				return fmt.Errorf("encryption: %s: cannot store a %T in %s", field.Name, value, field.FieldType)
+			}
+		}
+	}
+	return nil
+}
+
+// RotateEncryption re-encrypts with the active key the encrypted columns of
+// models stored with an older key, batchSize rows at a time, and returns the
+// number of rows updated. Keep the old keys in the ring until it is done.
+// Rows are updated without hooks, and models without a single primary key
+// are skipped.
+func RotateEncryption(ctx context.Context, db *gorm.DB, batchSize int, models ...any) (int64, error) {
+	ring, err := currentKeyRing()
+	if err != nil {
+		return 0, err
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	var total int64
+	for _, model := range models {
+		var stmt = &gorm.Statement{DB: db}
+		if err = stmt.Parse(model); err != nil {
+			return total, err
+		}
+		var fields []*schema.Field
+		for _, field := range stmt.Schema.Fields {
+			if _, ok := reflect.New(field.IndirectFieldType).Elem().Interface().(encryptedValue); ok && field.DBName != "" {
+				fields = append(fields, field)
+			}
+		}
+		var pk = stmt.Schema.PrioritizedPrimaryField
+		if len(fields) == 0 || pk == nil || len(stmt.Schema.PrimaryFields) != 1 {
+			continue
+		}
+
+		var last any
+		for {
+			var rows = reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+			var query = db.WithContext(ctx).Unscoped().Model(model).Order(pk.DBName).Limit(batchSize)
+			if last != nil {
+				query = query.Where(pk.DBName+" > ?", last)
+			}
+			if err = query.Find(rows.Interface()).Error; err != nil {
+				return total, fmt.Errorf("encryption: rotating %s: %w", stmt.Schema.Table, err)
+			}
+			var slice = rows.Elem()
+			for i := 0; i < slice.Len(); i++ {
+				var row = slice.Index(i)
+				var columns = map[string]any{}
+				for _, field := range fields {
+					value, _ := field.ValueOf(ctx, row)
+					if v, ok := value.(encryptedValue); ok && v.KeyID() != "" && v.KeyID() != ring.active {
+						if columns[field.DBName], err = v.Value(); err != nil {
+							return total, err
+						}
+					}
+				}
+				last, _ = pk.ValueOf(ctx, row)
+				if len(columns) == 0 {
+					continue
+				}
+				err = db.WithContext(ctx).Table(stmt.Schema.Table).Where(pk.DBName+" = ?", last).UpdateColumns(columns).Error
+				if err != nil {
+					return total, fmt.Errorf("encryption: rotating %s: %w", stmt.Schema.Table, err)
+				}
+				total++
+			}
+			if slice.Len() < batchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,223 @@
+package types_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/getevo/evo/v2/lib/db/types"
+	"github.com/getevo/json"
+)
+
+type testCustomer struct {
+	ID       uint `gorm:"primaryKey;autoIncrement"`
+	Name     string
+	Email    types.Encrypted[string]
+	EmailIdx types.BlindIndex `gorm:"blind_index:Email;index"`
+	Tokens   types.Encrypted[[]string]
+}
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func setKeys(t *testing.T, keys string) {
+	t.Helper()
+	ring, err := types.ParseKeyRing(keys, testKey(9))
+	if err != nil {
+		t.Fatalf("key ring: %v", err)
+	}
+	types.SetKeyRing(ring)
+	t.Cleanup(func() { types.SetKeyRing(nil) })
+}
+
+func openEncryptedDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "encrypted.db")), &gorm.Config{
+		Logger:  logger.Default.LogMode(logger.Silent),
+		Plugins: map[string]gorm.Plugin{types.BlindIndexes{}.Name(): types.BlindIndexes{}},
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&testCustomer{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestParseKeyRing(t *testing.T) {
+	ring, err := types.ParseKeyRing("k2:"+testKey(2)+", k1:"+testKey(1), "")
+	if err != nil || ring.Active() != "k2" {
+		t.Fatalf("expected k2 active, got %v, %v", ring, err)
+	}
+	for _, keys := range []string{"", "k1", "k1:short", "k 1:" + testKey(1), "k1:" + testKey(1) + ",k1:" + testKey(2)} {
+		if _, err := types.ParseKeyRing(keys, ""); err == nil {
+			t.Errorf("%q: expected an error", keys)
+		}
+	}
+}
+
+func TestEncrypted_RoundTrip(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1))
+	db := openEncryptedDB(t)
+
+	customer := testCustomer{Name: "alice", Email: types.NewEncrypted("alice@example.com"), Tokens: types.NewEncrypted([]string{"a", "b"})}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	var stored string
+	db.Raw("SELECT email FROM test_customers WHERE id = ?", customer.ID).Scan(&stored)
+	if !strings.HasPrefix(stored, "k1:") || strings.Contains(stored, "alice") {
+		t.Fatalf("expected the email encrypted with k1, got %q", stored)
+	}
+
+	var loaded testCustomer
+	if err := db.First(&loaded, customer.ID).Error; err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if loaded.Email.Data() != "alice@example.com" || loaded.Email.KeyID() != "k1" {
+		t.Errorf("unexpected email %q with key %q", loaded.Email.Data(), loaded.Email.KeyID())
+	}
+	if got := loaded.Tokens.Data(); len(got) != 2 || got[1] != "b" {
+		t.Errorf("unexpected tokens %v", got)
+	}
+}
+
+func TestEncrypted_UnknownKey(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1))
+	db := openEncryptedDB(t)
+	db.Create(&testCustomer{Email: types.NewEncrypted("bob@example.com")})
+
+	setKeys(t, "k2:"+testKey(2))
+	var loaded testCustomer
+	if err := db.First(&loaded).Error; !errors.Is(err, types.ErrUnknownEncryptionKey) {
+		t.Fatalf("expected ErrUnknownEncryptionKey, got %v", err)
+	}
+}
+
+func TestEncrypted_JSON(t *testing.T) {
+	var e = types.NewEncrypted("secret")
+	data, _ := json.Marshal(map[string]any{"value": e})
+	if string(data) != `{"value":null}` {
+		t.Errorf("expected the value hidden, got %s", data)
+	}
+	data, _ = json.Marshal(map[string]any{"value": e.Reveal()})
+	if string(data) != `{"value":"secret"}` {
+		t.Errorf("expected the revealed value, got %s", data)
+	}
+
+	var decoded types.Encrypted[string]
+	if err := json.Unmarshal([]byte(`"plain"`), &decoded); err != nil || decoded.Data() != "plain" {
+		t.Errorf("expected the plaintext, got %q, %v", decoded.Data(), err)
+	}
+}
+
+func TestBlindIndex_Lookup(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1))
+	db := openEncryptedDB(t)
+
+	customer := testCustomer{Name: "carol", Email: types.NewEncrypted("carol@example.com")}
+	db.Create(&customer)
+	db.Create(&testCustomer{Name: "dave", Email: types.NewEncrypted("dave@example.com")})
+
+	var found testCustomer
+	err := db.Where("email_idx = ?", types.MustBlindIndexOf("carol@example.com")).First(&found).Error
+	if err != nil || found.ID != customer.ID {
+		t.Fatalf("expected carol, got %+v, %v", found, err)
+	}
+
+	// updating the source selects its index
+	db.Model(&found).Select("Email").Updates(&testCustomer{Email: types.NewEncrypted("carol@example.org")})
+	var count int64
+	db.Model(&testCustomer{}).Where("email_idx = ?", types.MustBlindIndexOf("carol@example.org")).Count(&count)
+	if count != 1 {
+		t.Errorf("expected the index updated with the email, got %d matches", count)
+	}
+
+	db.Model(&found).Updates(map[string]any{"email": types.NewEncrypted("carol@example.net")})
+	db.Model(&testCustomer{}).Where("email_idx = ?", types.MustBlindIndexOf("carol@example.net")).Count(&count)
+	if count != 1 {
+		t.Errorf("expected the index updated from the map, got %d matches", count)
+	}
+}
+
+func TestBlindIndex_CreateSlice(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1))
+	db := openEncryptedDB(t)
+	customers := []testCustomer{
+		{Name: "erin", Email: types.NewEncrypted("erin@example.com")},
+		{Name: "frank", Email: types.NewEncrypted("frank@example.com")},
+	}
+	if err := db.Create(customers).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	var found testCustomer
+	if err := db.Where("email_idx = ?", types.MustBlindIndexOf("frank@example.com")).First(&found).Error; err != nil || found.Name != "frank" {
+		t.Errorf("expected frank found by blind index, got %+v, %v", found, err)
+	}
+}
+
+func TestEncryptedMapUpdate(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1))
+	db := openEncryptedDB(t)
+	customer := testCustomer{Name: "dave", Email: types.NewEncrypted("dave@example.com")}
+	db.Create(&customer)
+
+	if err := db.Model(&customer).Updates(map[string]any{"email": "plain@example.com", "Tokens": []string{"t1"}}).Error; err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	var raw string
+	db.Table("test_customers").Select("email").Where("id = ?", customer.ID).Scan(&raw)
+	if strings.Contains(raw, "plain") || !strings.HasPrefix(raw, "k1:") {
+		t.Errorf("expected the email stored encrypted, got %q", raw)
+	}
+	var loaded testCustomer
+	if err := db.First(&loaded, customer.ID).Error; err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if loaded.Email.Val != "plain@example.com" || len(loaded.Tokens.Val) != 1 || loaded.EmailIdx != types.MustBlindIndexOf("plain@example.com") {
+		t.Errorf("unexpected row %+v", loaded)
+	}
+
+	if err := db.Model(&customer).Update("email", 42).Error; err == nil {
+		t.Error("expected a value of another type to fail")
+	}
+}
+
+func TestRotateEncryption(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1))
+	db := openEncryptedDB(t)
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		db.Create(&testCustomer{Email: types.NewEncrypted(email), Tokens: types.NewEncrypted([]string{email})})
+	}
+
+	setKeys(t, "k2:"+testKey(2)+",k1:"+testKey(1))
+	db.Create(&testCustomer{Email: types.NewEncrypted("d@example.com")})
+
+	n, err := types.RotateEncryption(context.Background(), db, 2, &testCustomer{})
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 rows rotated, got %d, %v", n, err)
+	}
+
+	setKeys(t, "k2:"+testKey(2))
+	var customers []testCustomer
+	if err := db.Order("id").Find(&customers).Error; err != nil {
+		t.Fatalf("load with the new key only: %v", err)
+	}
+	if len(customers) != 4 || customers[0].Email.Data() != "a@example.com" || customers[0].Tokens.Data()[0] != "a@example.com" {
+		t.Errorf("unexpected customers after rotation %+v", customers)
+	}
+	if n, _ = types.RotateEncryption(context.Background(), db, 2, &testCustomer{}); n != 0 {
+		t.Errorf("expected nothing left to rotate, got %d", n)
+	}
+}
@@ -0,0 +1,268 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrCurrencyMismatch is returned by the operations on Money of different
+	// currencies.
+	ErrCurrencyMismatch = errors.New("money currencies do not match")
+	// ErrUnknownCurrency is returned for a currency code missing from the
+	// ISO 4217 list and not registered with RegisterCurrency.
+	ErrUnknownCurrency = errors.New("unknown currency")
+)
+
+// currencies maps the ISO 4217 codes to their number of minor units.
+var currencies = map[string]int32{
+	"AED": 2, "AFN": 2, "ALL": 2, "AMD": 2, "ANG": 2, "AOA": 2, "ARS": 2, "AUD": 2, "AWG": 2, "AZN": 2,
+	"BAM": 2, "BBD": 2, "BDT": 2, "BGN": 2, "BHD": 3, "BIF": 0, "BMD": 2, "BND": 2, "BOB": 2, "BOV": 2,
+	"BRL": 2, "BSD": 2, "BTN": 2, "BWP": 2, "BYN": 2, "BZD": 2, "CAD": 2, "CDF": 2, "CHE": 2, "CHF": 2,
+	"CHW": 2, "CLF": 4, "CLP": 0, "CNY": 2, "COP": 2, "COU": 2, "CRC": 2, "CUP": 2, "CVE": 2, "CZK": 2,
+	"DJF": 0, "DKK": 2, "DOP": 2, "DZD": 2, "EGP": 2, "ERN": 2, "ETB": 2, "EUR": 2, "FJD": 2, "FKP": 2,
+	"GBP": 2, "GEL": 2, "GHS": 2, "GIP": 2, "GMD": 2, "GNF": 0, "GTQ": 2, "GYD": 2, "HKD": 2, "HNL": 2,
+	"HTG": 2, "HUF": 2, "IDR": 2, "ILS": 2, "INR": 2, "IQD": 3, "IRR": 2, "ISK": 0, "JMD": 2, "JOD": 3,
+	"JPY": 0, "KES": 2, "KGS": 2, "KHR": 2, "KMF": 0, "KPW": 2, "KRW": 0, "KWD": 3, "KYD": 2, "KZT": 2,
+	"LAK": 2, "LBP": 2, "LKR": 2, "LRD": 2, "LSL": 2, "LYD": 3, "MAD": 2, "MDL": 2, "MGA": 2, "MKD": 2,
+	"MMK": 2, "MNT": 2, "MOP": 2, "MRU": 2, "MUR": 2, "MVR": 2, "MWK": 2, "MXN": 2, "MXV": 2, "MYR": 2,
+	"MZN": 2, "NAD": 2, "NGN": 2, "NIO": 2, "NOK": 2, "NPR": 2, "NZD": 2, "OMR": 3, "PAB": 2, "PEN": 2,
+	"PGK": 2, "PHP": 2, "PKR": 2, "PLN": 2, "PYG": 0, "QAR": 2, "RON": 2, "RSD": 2, "RUB": 2, "RWF": 0,
+	"SAR": 2, "SBD": 2, "SCR": 2, "SDG": 2, "SEK": 2, "SGD": 2, "SHP": 2, "SLE": 2, "SOS": 2, "SRD": 2,
+	"SSP": 2, "STN": 2, "SVC": 2, "SYP": 2, "SZL": 2, "THB": 2, "TJS": 2, "TMT": 2, "TND": 3, "TOP": 2,
+	"TRY": 2, "TTD": 2, "TWD": 2, "TZS": 2, "UAH": 2, "UGX": 0, "USD": 2, "USN": 2, "UYI": 0, "UYU": 2,
+	"UYW": 4, "UZS": 2, "VED": 2, "VES": 2, "VND": 0, "VUV": 0, "WST": 2, "XAF": 0, "XCD": 2, "XCG": 2,
+	"XOF": 0, "XPF": 0, "YER": 2, "ZAR": 2, "ZMW": 2, "ZWG": 2,
+}
+
+var currenciesMu sync.RWMutex
+
+// RegisterCurrency adds a currency, or changes the minor units of one, such
+// as a loyalty point or crypto currency.
+func RegisterCurrency(code string, minorUnits int32) {
+	currenciesMu.Lock()
+	defer currenciesMu.Unlock()
+	currencies[strings.ToUpper(code)] = minorUnits
+}
+
+// MinorUnits returns the number of digits after the decimal point of a
+// currency, 2 for EUR and 0 for JPY, and false for an unknown currency.
+func MinorUnits(currency string) (int32, bool) {
+	currenciesMu.RLock()
+	defer currenciesMu.RUnlock()
+	units, ok := currencies[strings.ToUpper(currency)]
+	return units, ok
+}
+
+// Money is an amount in a currency, rounded to the minor units of the
+// currency by its constructors and operations. Stored as two columns, it is
+// embedded in a model:
+//
+//	type Order struct {
+//	    ID    uint
+//	    Total types.Money `gorm:"embedded;embeddedPrefix:total_"`
+//	}
+//
+// Operations on amounts of different currencies fail with
+// ErrCurrencyMismatch. Rounding is half to even (banker's rounding).
+type Money struct {
+	Amount   Decimal `gorm:"precision:19;scale:4" json:"amount"`
+	Currency string  `gorm:"size:3" json:"currency"`
+}
+
+// NewMoney parses amount in currency, rounded to its minor units.
+func NewMoney(amount string, currency string) (Money, error) {
+	value, err := NewDecimal(amount)
+	if err != nil {
+		return Money{}, err
+	}
+	return MoneyFromDecimal(value, currency)
+}
+
+// MustMoney is NewMoney panicking on an invalid amount or currency.
+func MustMoney(amount string, currency string) Money {
+	m, err := NewMoney(amount, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// MoneyFromDecimal returns amount in currency, rounded to its minor units.
+func MoneyFromDecimal(amount Decimal, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	units, ok := MinorUnits(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return Money{Amount: amount.Round(units), Currency: currency}, nil
+}
+
+// MoneyFromMinor returns the amount of minor units of currency, so that
+// MoneyFromMinor(1999, "EUR") is 19.99 EUR.
+func MoneyFromMinor(minor int64, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	units, ok := MinorUnits(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return Money{Amount: NewDecimalFromInt(minor, units), Currency: currency}, nil
+}
+
+// ParseMoney parses "12.50 EUR", or "EUR 12.50", as a Money.
+func ParseMoney(s string) (Money, error) {
+	var parts = strings.Fields(s)
+	if len(parts) != 2 {
+		return Money{}, fmt.Errorf("invalid money %q", s)
+	}
+	if _, err := NewDecimal(parts[0]); err != nil {
+		parts[0], parts[1] = parts[1], parts[0]
+	}
+	return NewMoney(parts[0], parts[1])
+}
+
+// units returns the minor units of the currency of m, 2 when unknown.
+func (m Money) units() int32 {
+	if units, ok := MinorUnits(m.Currency); ok {
+		return units
+	}
+	return 2
+}
+
+func (m Money) same(o Money) error {
+	if !strings.EqualFold(m.Currency, o.Currency) {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return nil
+}
+
+// Add returns m + o.
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.same(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount.Add(o.Amount).Round(m.units()), Currency: m.Currency}, nil
+}
+
+// Sub returns m - o.
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.same(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount.Sub(o.Amount).Round(m.units()), Currency: m.Currency}, nil
+}
+
+// Mul returns m × factor rounded to the minor units, such as a quantity or
+// a tax rate.
+func (m Money) Mul(factor Decimal) Money {
+	return Money{Amount: m.Amount.Mul(factor).Round(m.units()), Currency: m.Currency}
+}
+
+// Neg returns -m.
+func (m Money) Neg() Money {
+	return Money{Amount: m.Amount.Neg(), Currency: m.Currency}
+}
+
+// Round returns m rounded half to even to the minor units of its currency.
+func (m Money) Round() Money {
+	return Money{Amount: m.Amount.Round(m.units()), Currency: m.Currency}
+}
+
+// Cmp compares m and o like Decimal.Cmp.
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.same(o); err != nil {
+		return 0, err
+	}
+	return m.Amount.Cmp(o.Amount), nil
+}
+
+// Equal reports whether m and o are the same amount in the same currency.
+func (m Money) Equal(o Money) bool {
+	return m.same(o) == nil && m.Amount.Equal(o.Amount)
+}
+
+// IsZero reports whether the amount is 0.
+func (m Money) IsZero() bool {
+	return m.Amount.IsZero()
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of the amount.
+func (m Money) Sign() int {
+	return m.Amount.Sign()
+}
+
+// Minor returns the amount in minor units, 1999 for 19.99 EUR.
+func (m Money) Minor() *big.Int {
+	return m.Round().Amount.int()
+}
+
+// Allocate splits m in parts proportional to ratios without losing minor
+// units: the units left over after rounding down go one by one to the first
+// parts, so that allocating 100.00 EUR by 1:1:1 gives 33.34, 33.33 and 33.33.
+func (m Money) Allocate(ratios ...int64) ([]Money, error) {
+	var total = new(big.Int)
+	for _, ratio := range ratios {
+		if ratio < 0 {
+			return nil, fmt.Errorf("negative allocation ratio %d", ratio)
+		}
+		total.Add(total, big.NewInt(ratio))
+	}
+	if total.Sign() == 0 {
+		return nil, errors.New("allocation ratios add up to 0")
+	}
+
+	var units = m.units()
+	var minor = m.Minor()
+	var left = new(big.Int).Set(minor)
+	var parts = make([]*big.Int, len(ratios))
+	for i, ratio := range ratios {
+		parts[i] = new(big.Int).Mul(minor, big.NewInt(ratio))
+		parts[i].Quo(parts[i], total)
+		left.Sub(left, parts[i])
+	}
+	var step = big.NewInt(int64(left.Sign()))
+	for i := 0; left.Sign() != 0; i = (i + 1) % len(parts) {
+		if ratios[i] == 0 {
+			continue
+		}
+		parts[i].Add(parts[i], step)
+		left.Sub(left, step)
+	}
+
+	var result = make([]Money, len(parts))
+	for i, part := range parts {
+		result[i] = Money{Amount: Decimal{value: part, scale: units}, Currency: m.Currency}
+	}
+	return result, nil
+}
+
+// Split divides m in n parts differing by at most one minor unit.
+func (m Money) Split(n int) ([]Money, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("cannot split in %d parts", n)
+	}
+	var ratios = make([]int64, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+	return m.Allocate(ratios...)
+}
+
+// String returns the amount with the minor units of its currency followed by
+// the currency, such as "12.50 EUR".
+func (m Money) String() string {
+	return strings.TrimSpace(m.Amount.StringFixed(m.units()) + " " + m.Currency)
+}
+
+// MarshalJSON implements json.Marshaler, with the amount as a decimal string
+// rounded to the minor units of the currency, such as "19.99".
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Amount.StringFixed(m.units()), m.Currency})
+}
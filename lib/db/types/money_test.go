@@ -0,0 +1,107 @@
+package types_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/getevo/evo/v2/lib/db/types"
+)
+
+func TestNewMoney(t *testing.T) {
+	m, err := types.NewMoney("10.005", "eur")
+	if err != nil || m.String() != "10.00 EUR" {
+		t.Fatalf("expected 10.00 EUR, got %s, %v", m, err)
+	}
+	if m, _ := types.NewMoney("1234.5", "JPY"); m.String() != "1234 JPY" {
+		t.Errorf("expected 1234 JPY, got %s", m)
+	}
+	if m, _ := types.NewMoney("1.2345", "KWD"); m.String() != "1.234 KWD" {
+		t.Errorf("expected 1.234 KWD, got %s", m)
+	}
+	if _, err := types.NewMoney("1", "XYZ"); !errors.Is(err, types.ErrUnknownCurrency) {
+		t.Errorf("expected ErrUnknownCurrency, got %v", err)
+	}
+	if m, err := types.MoneyFromMinor(1999, "USD"); err != nil || m.String() != "19.99 USD" || m.Minor().Int64() != 1999 {
+		t.Errorf("expected 19.99 USD, got %s, %v", m, err)
+	}
+	for _, s := range []string{"12.50 EUR", "EUR 12.50"} {
+		if m, err := types.ParseMoney(s); err != nil || !m.Equal(types.MustMoney("12.5", "EUR")) {
+			t.Errorf("%q: expected 12.50 EUR, got %s, %v", s, m, err)
+		}
+	}
+
+	types.RegisterCurrency("pts", 0)
+	if units, ok := types.MinorUnits("PTS"); !ok || units != 0 {
+		t.Errorf("expected the registered currency, got %d, %t", units, ok)
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	price := types.MustMoney("19.99", "EUR")
+	sum, err := price.Add(types.MustMoney("0.01", "EUR"))
+	if err != nil || sum.String() != "20.00 EUR" {
+		t.Errorf("expected 20.00 EUR, got %s, %v", sum, err)
+	}
+	if _, err := price.Add(types.MustMoney("1", "USD")); !errors.Is(err, types.ErrCurrencyMismatch) {
+		t.Errorf("expected ErrCurrencyMismatch, got %v", err)
+	}
+	if diff, _ := price.Sub(types.MustMoney("20", "EUR")); diff.String() != "-0.01 EUR" || diff.Sign() != -1 {
+		t.Errorf("expected -0.01 EUR, got %s", diff)
+	}
+	// 19.99 × 0.075 = 1.499250 and 2.5 × 0.01 = 0.025, rounded half to even
+	if tax := price.Mul(types.MustDecimal("0.075")); tax.String() != "1.50 EUR" {
+		t.Errorf("expected 1.50 EUR, got %s", tax)
+	}
+	if m := types.MustMoney("2.5", "EUR").Mul(types.MustDecimal("0.01")); m.String() != "0.02 EUR" {
+		t.Errorf("expected banker's rounding to 0.02 EUR, got %s", m)
+	}
+	if cmp, err := price.Cmp(sum); err != nil || cmp != -1 {
+		t.Errorf("expected -1, got %d, %v", cmp, err)
+	}
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	parts, err := types.MustMoney("100", "EUR").Split(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"33.34 EUR", "33.33 EUR", "33.33 EUR"}
+	for i, part := range parts {
+		if part.String() != expected[i] {
+			t.Errorf("part %d: expected %s, got %s", i, expected[i], part)
+		}
+	}
+
+	parts, _ = types.MustMoney("0.05", "USD").Allocate(70, 30)
+	if parts[0].String() != "0.04 USD" || parts[1].String() != "0.01 USD" {
+		t.Errorf("expected 0.04 and 0.01, got %s and %s", parts[0], parts[1])
+	}
+
+	parts, _ = types.MustMoney("-10", "EUR").Allocate(0, 1, 2)
+	total := types.MustMoney("0", "EUR")
+	for _, part := range parts {
+		total, _ = total.Add(part)
+	}
+	if !total.Equal(types.MustMoney("-10", "EUR")) || !parts[0].IsZero() || parts[1].String() != "-3.34 EUR" || parts[2].String() != "-6.66 EUR" {
+		t.Errorf("unexpected allocation %v", parts)
+	}
+
+	if _, err := types.MustMoney("1", "EUR").Allocate(0, 0); err == nil {
+		t.Error("expected ratios adding up to 0 to fail")
+	}
+	if _, err := types.MustMoney("1", "EUR").Split(0); err == nil {
+		t.Error("expected a split in 0 parts to fail")
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	b, _ := json.Marshal(types.MustMoney("7", "EUR"))
+	if string(b) != `{"amount":"7.00","currency":"EUR"}` {
+		t.Errorf("unexpected JSON %s", b)
+	}
+	var m types.Money
+	if err := json.Unmarshal([]byte(`{"amount":12.5,"currency":"USD"}`), &m); err != nil || !m.Equal(types.MustMoney("12.50", "USD")) {
+		t.Errorf("expected 12.50 USD, got %s, %v", m, err)
+	}
+}
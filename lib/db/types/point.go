@@ -0,0 +1,408 @@
+package types
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	dbschema "github.com/getevo/evo/v2/lib/db/schema"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrSpatialUnsupported is added to the queries using the geospatial scopes
+// on a database without spatial support.
+var ErrSpatialUnsupported = errors.New("geospatial queries are not supported")
+
+// DistanceColumn is the column OrderByDistance selects the distance as.
+const DistanceColumn = "distance"
+
+// earthRadius is the mean radius of the earth in meters.
+const earthRadius = 6371008.8
+
+// srid is the spatial reference system of the points, WGS 84.
+const srid = 4326
+
+// Point is a position on the earth in WGS 84 (SRID 4326) degrees:
+//
+//	type Store struct {
+//	    ID       uint
+//	    Location types.Point `gorm:"spatial"`
+//	}
+//
+// The migrators create it as POINT SRID 4326 on MySQL, and on PostgreSQL as a
+// geography(Point,4326) column when PostGIS is enabled, a plain point column
+// otherwise, with a spatial index when tagged spatial. It is encoded in JSON
+// as a GeoJSON point, longitude first.
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// NewPoint returns the point at latitude lat and longitude lng.
+func NewPoint(lat, lng float64) Point {
+	return Point{Lat: lat, Lng: lng}
+}
+
+// Valid reports whether the latitude is within -90 and 90 and the longitude
+// within -180 and 180.
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// Distance returns the great-circle distance in meters between p and o.
+func (p Point) Distance(o Point) float64 {
+	var lat1, lat2 = radians(p.Lat), radians(o.Lat)
+	var dLat, dLng = lat2 - lat1, radians(o.Lng - p.Lng)
+	var h = math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// String returns p as WKT, such as "POINT(2.2945 48.8584)".
+func (p Point) String() string {
+	return "POINT(" + strconv.FormatFloat(p.Lng, 'f', -1, 64) + " " + strconv.FormatFloat(p.Lat, 'f', -1, 64) + ")"
+}
+
+type geoJSONPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// MarshalJSON implements json.Marshaler, as a GeoJSON point.
+func (p Point) MarshalJSON() ([]byte, error) {
+	return json.Marshal(geoJSONPoint{Type: "Point", Coordinates: []float64{p.Lng, p.Lat}})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, from a GeoJSON point.
+func (p *Point) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var value geoJSONPoint
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	if value.Type != "Point" || len(value.Coordinates) < 2 {
+		return fmt.Errorf("invalid GeoJSON point: %s", b)
+	}
+	*p = Point{Lat: value.Coordinates[1], Lng: value.Coordinates[0]}
+	return nil
+}
+
+// Scan implements the sql.Scanner interface. It reads the MySQL internal
+// format, (E)WKB, hex encoded or not as returned by PostGIS, WKT and the
+// (x,y) text of the PostgreSQL point.
+func (p *Point) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*p = Point{}
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("failed to scan point value: %v", src)
+	}
+	point, err := parsePoint(b)
+	if err != nil {
+		return err
+	}
+	*p = point
+	return nil
+}
+
+func parsePoint(b []byte) (Point, error) {
+	var text = strings.TrimSpace(string(b))
+	switch {
+	case strings.HasPrefix(text, "("):
+		var x, y float64
+		if _, err := fmt.Sscanf(text, "(%g,%g)", &x, &y); err != nil {
+			return Point{}, fmt.Errorf("invalid point %q", text)
+		}
+		return Point{Lat: y, Lng: x}, nil
+	case strings.HasPrefix(strings.ToUpper(text), "SRID=") || strings.HasPrefix(strings.ToUpper(text), "POINT"):
+		return parseWKT(text)
+	}
+	if decoded, err := hex.DecodeString(text); err == nil && len(decoded) >= 21 {
+		b = decoded
+	}
+	if len(b) == 25 && !hasSRID(b) {
+		// MySQL: the SRID followed by the WKB
+		return parseWKB(b[4:])
+	}
+	return parseWKB(b)
+}
+
+// hasSRID reports whether b is an EWKB geometry with a SRID.
+func hasSRID(b []byte) bool {
+	if len(b) < 5 || b[0] > 1 {
+		return false
+	}
+	return wkbOrder(b[0]).Uint32(b[1:5])&0x20000000 != 0
+}
+
+func wkbOrder(flag byte) binary.ByteOrder {
+	if flag == 0 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// parseWKB parses a WKB or EWKB point.
+func parseWKB(b []byte) (Point, error) {
+	if len(b) < 21 || b[0] > 1 {
+		return Point{}, errors.New("invalid WKB point")
+	}
+	var order = wkbOrder(b[0])
+	var kind = order.Uint32(b[1:5])
+	var offset = 5
+	if kind&0x20000000 != 0 {
+		offset += 4
+	}
+	if kind&0xffff != 1 || len(b) < offset+16 {
+		return Point{}, errors.New("invalid WKB point")
+	}
+	var x = math.Float64frombits(order.Uint64(b[offset:]))
+	var y = math.Float64frombits(order.Uint64(b[offset+8:]))
+	return Point{Lat: y, Lng: x}, nil
+}
+
+// parseWKT parses a WKT or EWKT point, such as "SRID=4326;POINT(2.29 48.85)".
+func parseWKT(text string) (Point, error) {
+	if i := strings.IndexByte(text, ';'); i >= 0 {
+		text = text[i+1:]
+	}
+	var start, end = strings.IndexByte(text, '('), strings.LastIndexByte(text, ')')
+	if !strings.HasPrefix(strings.ToUpper(text), "POINT") || start < 0 || end < start {
+		return Point{}, fmt.Errorf("invalid WKT point %q", text)
+	}
+	var coordinates = strings.Fields(text[start+1 : end])
+	if len(coordinates) < 2 {
+		return Point{}, fmt.Errorf("invalid WKT point %q", text)
+	}
+	x, err := strconv.ParseFloat(coordinates[0], 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("invalid WKT point %q", text)
+	}
+	y, err := strconv.ParseFloat(coordinates[1], 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("invalid WKT point %q", text)
+	}
+	return Point{Lat: y, Lng: x}, nil
+}
+
+// geometry is a MySQL geometry value. As a driver.Valuer it is bound as one
+// variable where GORM expands the other slices.
+type geometry []byte
+
+// Value implements the driver.Valuer interface.
+func (g geometry) Value() (driver.Value, error) {
+	return []byte(g), nil
+}
+
+// mysqlGeometry returns the points, longitude first, as a geometry in the
+// MySQL internal format: the SRID followed by the WKB, a point for one point
+// and a polygon for more.
+func mysqlGeometry(points ...Point) geometry {
+	var buf bytes.Buffer
+	var write = func(v any) {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	write(uint32(srid))
+	buf.WriteByte(1)
+	if len(points) == 1 {
+		write(uint32(1))
+	} else {
+		write(uint32(3))
+		write(uint32(1))
+		write(uint32(len(points)))
+	}
+	for _, p := range points {
+		write(p.Lng)
+		write(p.Lat)
+	}
+	return geometry(buf.Bytes())
+}
+
+// GormValue implements gorm.Valuer, writing p in the format of the column
+// the migrators create.
+func (p Point) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	return pointExpr(db, p)
+}
+
+// pointExpr returns the expression of p in the dialect of db.
+func pointExpr(db *gorm.DB, p Point) clause.Expr {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return clause.Expr{SQL: "?", Vars: []any{mysqlGeometry(p)}}
+	case "postgres":
+		if dbschema.PostGIS() {
+			return clause.Expr{SQL: "ST_GeogFromText(?)", Vars: []any{"SRID=4326;" + p.String()}}
+		}
+		return clause.Expr{SQL: "point(?, ?)", Vars: []any{p.Lng, p.Lat}}
+	default:
+		return clause.Expr{SQL: "?", Vars: []any{p.String()}}
+	}
+}
+
+// GormDataType gorm common data type.
+func (Point) GormDataType() string {
+	return "point"
+}
+
+// GormDBDataType gorm db data type.
+func (Point) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql":
+		// the SRID attribute exists since MySQL 8.0.3, and not on MariaDB
+		if dbschema.MySQLAtLeast("8.0.3", "") {
+			return "POINT SRID 4326"
+		}
+		return "POINT"
+	case "postgres":
+		if dbschema.PostGIS() {
+			return "geography(Point,4326)"
+		}
+		return "point"
+	default:
+		return "TEXT"
+	}
+}
+
+// WithinRadius returns the scope selecting the rows whose point column is at
+// most meters away from center:
+//
+//	db.Scopes(types.WithinRadius("location", types.NewPoint(48.8584, 2.2945), 500)).Find(&stores)
+func WithinRadius(column string, center Point, meters float64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		var quoted = db.Statement.Quote(column)
+		switch {
+		case db.Dialector.Name() == "mysql":
+			return db.Where("ST_Distance_Sphere("+quoted+", ?) <= ?", mysqlGeometry(center), meters)
+		case db.Dialector.Name() == "postgres" && dbschema.PostGIS():
+			return db.Where("ST_DWithin("+quoted+", ST_GeogFromText(?), ?)", "SRID=4326;"+center.String(), meters)
+		case db.Dialector.Name() == "postgres":
+			var distance = haversine(quoted, center)
+			// the bounding box of the circle uses the index of the column
+			if southWest, northEast, ok := radiusBox(center, meters); ok {
+				db = db.Where(boxCondition(quoted, southWest, northEast))
+			}
+			return db.Where(clause.Expr{SQL: distance.SQL + " <= ?", Vars: append(distance.Vars, meters)})
+		default:
+			return unsupported(db)
+		}
+	}
+}
+
+// WithinBox returns the scope selecting the rows whose point column is in
+// the box between the southWest and northEast corners. The box must not cross
+// the antimeridian.
+func WithinBox(column string, southWest, northEast Point) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		var quoted = db.Statement.Quote(column)
+		switch {
+		case db.Dialector.Name() == "mysql":
+			var polygon = mysqlGeometry(southWest, Point{Lat: southWest.Lat, Lng: northEast.Lng}, northEast,
+				Point{Lat: northEast.Lat, Lng: southWest.Lng}, southWest)
+			return db.Where("MBRContains(?, "+quoted+")", polygon)
+		case db.Dialector.Name() == "postgres" && dbschema.PostGIS():
+			return db.Where("ST_Intersects("+quoted+", ST_MakeEnvelope(?, ?, ?, ?, 4326)::geography)",
+				southWest.Lng, southWest.Lat, northEast.Lng, northEast.Lat)
+		case db.Dialector.Name() == "postgres":
+			return db.Where(boxCondition(quoted, southWest, northEast))
+		default:
+			return unsupported(db)
+		}
+	}
+}
+
+// OrderByDistance returns the scope ordering the rows by the distance of
+// their point column to from, nearest first. Unless the query selects columns
+// of its own, the distance in meters is selected as the distance column:
+//
+//	type StoreDistance struct {
+//	    Store
+//	    Distance float64 `gorm:"->;-:migration"`
+//	}
+func OrderByDistance(column string, from Point) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		var quoted = db.Statement.Quote(column)
+		var distance, order clause.Expr
+		switch {
+		case db.Dialector.Name() == "mysql":
+			distance = clause.Expr{SQL: "ST_Distance_Sphere(" + quoted + ", ?)", Vars: []any{mysqlGeometry(from)}}
+			order = distance
+		case db.Dialector.Name() == "postgres" && dbschema.PostGIS():
+			var point = "SRID=4326;" + from.String()
+			distance = clause.Expr{SQL: "ST_Distance(" + quoted + ", ST_GeogFromText(?))", Vars: []any{point}}
+			// <-> walks the index of the column
+			order = clause.Expr{SQL: quoted + " <-> ST_GeogFromText(?)", Vars: []any{point}}
+		case db.Dialector.Name() == "postgres":
+			distance = haversine(quoted, from)
+			order = distance
+		default:
+			return unsupported(db)
+		}
+		if len(db.Statement.Selects) == 0 && db.Statement.Clauses["SELECT"].Expression == nil {
+			db = db.Select("*, "+distance.SQL+" AS "+DistanceColumn, distance.Vars...)
+		}
+		return db.Order(clause.OrderBy{Expression: clause.Expr{SQL: order.SQL, Vars: order.Vars, WithoutParentheses: true}})
+	}
+}
+
+func unsupported(db *gorm.DB) *gorm.DB {
+	db.AddError(fmt.Errorf("%w on %s", ErrSpatialUnsupported, db.Dialector.Name()))
+	return db
+}
+
+// haversine returns the great-circle distance in meters between the plain
+// PostgreSQL point column and p, the column holding the longitude in [0] and
+// the latitude in [1].
+func haversine(column string, p Point) clause.Expr {
+	return clause.Expr{
+		SQL: "2 * " + strconv.FormatFloat(earthRadius, 'f', -1, 64) + " * asin(least(1, sqrt(" +
+			"power(sin(radians(" + column + "[1] - ?) / 2), 2) + " +
+			"cos(radians(?)) * cos(radians(" + column + "[1])) * power(sin(radians(" + column + "[0] - ?) / 2), 2))))",
+		Vars: []any{p.Lat, p.Lat, p.Lng},
+	}
+}
+
+// boxCondition returns the condition of a plain PostgreSQL point column in
+// a box, which a gist index answers.
+func boxCondition(column string, southWest, northEast Point) clause.Expr {
+	return clause.Expr{
+		SQL:  column + " <@ box(point(?, ?), point(?, ?))",
+		Vars: []any{southWest.Lng, southWest.Lat, northEast.Lng, northEast.Lat},
+	}
+}
+
+// radiusBox returns the box around the circle of radius meters around
+// center, and false when it contains a pole or crosses the antimeridian.
+func radiusBox(center Point, meters float64) (southWest, northEast Point, ok bool) {
+	var angle = meters / earthRadius
+	var dLat = angle * 180 / math.Pi
+	var sin = math.Sin(angle) / math.Cos(radians(center.Lat))
+	if center.Lat-dLat <= -90 || center.Lat+dLat >= 90 || sin >= 1 {
+		return
+	}
+	var dLng = math.Asin(sin) * 180 / math.Pi
+	if center.Lng-dLng < -180 || center.Lng+dLng > 180 {
+		return
+	}
+	return Point{Lat: center.Lat - dLat, Lng: center.Lng - dLng}, Point{Lat: center.Lat + dLat, Lng: center.Lng + dLng}, true
+}
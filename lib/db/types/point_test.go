@@ -0,0 +1,176 @@
+package types_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type store struct {
+	ID       uint
+	Name     string
+	Location types.Point `gorm:"spatial"`
+}
+
+var eiffelTower = types.NewPoint(48.8584, 2.2945)
+
+func TestPointDistance(t *testing.T) {
+	var louvre = types.NewPoint(48.8606, 2.3376)
+	if d := eiffelTower.Distance(louvre); math.Abs(d-3165) > 10 {
+		t.Errorf("expected about 3165m, got %f", d)
+	}
+	if d := eiffelTower.Distance(eiffelTower); d != 0 {
+		t.Errorf("expected 0, got %f", d)
+	}
+	if !eiffelTower.Valid() || types.NewPoint(91, 0).Valid() || types.NewPoint(0, -181).Valid() {
+		t.Error("unexpected validity")
+	}
+}
+
+func TestPointJSON(t *testing.T) {
+	b, _ := json.Marshal(eiffelTower)
+	if string(b) != `{"type":"Point","coordinates":[2.2945,48.8584]}` {
+		t.Errorf("unexpected GeoJSON %s", b)
+	}
+	var p types.Point
+	if err := json.Unmarshal(b, &p); err != nil || p != eiffelTower {
+		t.Errorf("expected the point back, got %v, %v", p, err)
+	}
+	if err := json.Unmarshal([]byte(`{"type":"LineString","coordinates":[[1,2],[3,4]]}`), &p); err == nil {
+		t.Error("expected a line string to fail")
+	}
+}
+
+func TestPointScan(t *testing.T) {
+	cases := map[string]any{
+		"wkt":            "POINT(2.2945 48.8584)",
+		"ewkt":           "SRID=4326;POINT(2.2945 48.8584)",
+		"postgres point": []byte("(2.2945,48.8584)"),
+		// PostGIS geography, hex encoded EWKB
+		"ewkb": "0101000020E61000004260E5D0225B024076711B0DE06D4840",
+		// MySQL, the SRID then the WKB
+		"mysql": []byte{0xE6, 0x10, 0, 0, 1, 1, 0, 0, 0, 0x42, 0x60, 0xE5, 0xD0, 0x22, 0x5B, 0x02, 0x40, 0x76, 0x71, 0x1B, 0x0D, 0xE0, 0x6D, 0x48, 0x40},
+		// WKB, big endian
+		"wkb": []byte{0, 0, 0, 0, 1, 0x40, 0x02, 0x5B, 0x22, 0xD0, 0xE5, 0x60, 0x42, 0x40, 0x48, 0x6D, 0xE0, 0x0D, 0x1B, 0x71, 0x76},
+	}
+	for name, src := range cases {
+		var p types.Point
+		if err := p.Scan(src); err != nil || p != eiffelTower {
+			t.Errorf("%s: expected %v, got %v, %v", name, eiffelTower, p, err)
+		}
+	}
+	var p types.Point
+	if err := p.Scan("LINESTRING(1 2, 3 4)"); err == nil {
+		t.Error("expected a line string to fail")
+	}
+}
+
+func TestPointDatabase(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&store{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&store{Name: "paris", Location: eiffelTower})
+	var loaded store
+	if err := db.First(&loaded).Error; err != nil || loaded.Location != eiffelTower {
+		t.Errorf("expected the point back, got %v, %v", loaded.Location, err)
+	}
+
+	var stores []store
+	err = db.Scopes(types.WithinRadius("location", eiffelTower, 100)).Find(&stores).Error
+	if !errors.Is(err, types.ErrSpatialUnsupported) {
+		t.Errorf("expected ErrSpatialUnsupported on sqlite, got %v", err)
+	}
+}
+
+func dryRun(t *testing.T, dialector gorm.Dialector) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPointScopes(t *testing.T) {
+	var mysqlDB = dryRun(t, mysql.New(mysql.Config{DSN: "user:pass@tcp(localhost:3306)/db", SkipInitializeWithVersion: true}))
+	var postgresDB = dryRun(t, postgres.New(postgres.Config{DSN: "host=localhost user=user dbname=db"}))
+	var southWest, northEast = types.NewPoint(48.8, 2.2), types.NewPoint(48.9, 2.4)
+
+	cases := []struct {
+		name     string
+		db       *gorm.DB
+		postGIS  bool
+		scope    func(*gorm.DB) *gorm.DB
+		expected []string
+	}{
+		{"mysql radius", mysqlDB, false, types.WithinRadius("location", eiffelTower, 500),
+			[]string{"ST_Distance_Sphere(`location`, ?) <= ?"}},
+		{"mysql box", mysqlDB, false, types.WithinBox("location", southWest, northEast),
+			[]string{"MBRContains(?, `location`)"}},
+		{"mysql order", mysqlDB, false, types.OrderByDistance("location", eiffelTower),
+			[]string{"SELECT *, ST_Distance_Sphere(`location`, ?) AS distance", "ORDER BY ST_Distance_Sphere(`location`, ?)"}},
+		{"postgis radius", postgresDB, true, types.WithinRadius("location", eiffelTower, 500),
+			[]string{`ST_DWithin("location", ST_GeogFromText($1), $2)`}},
+		{"postgis box", postgresDB, true, types.WithinBox("location", southWest, northEast),
+			[]string{`ST_Intersects("location", ST_MakeEnvelope($1, $2, $3, $4, 4326)::geography)`}},
+		{"postgis order", postgresDB, true, types.OrderByDistance("location", eiffelTower),
+			[]string{`ST_Distance("location", ST_GeogFromText($1)) AS distance`, `ORDER BY "location" <-> ST_GeogFromText($2)`}},
+		{"point radius", postgresDB, false, types.WithinRadius("location", eiffelTower, 500),
+			[]string{`"location" <@ box(point($1, $2), point($3, $4)) AND 2 * 6371008.8 * asin(`}},
+		{"point box", postgresDB, false, types.WithinBox("location", southWest, northEast),
+			[]string{`"location" <@ box(point($1, $2), point($3, $4))`}},
+		{"point order", postgresDB, false, types.OrderByDistance("location", eiffelTower),
+			[]string{`ORDER BY 2 * 6371008.8 * asin(least(1, sqrt(power(sin(radians("location"[1] - $4) / 2), 2)`}},
+	}
+	defer schema.SetPostGIS(false)
+	for _, c := range cases {
+		schema.SetPostGIS(c.postGIS)
+		var sql = c.db.Scopes(c.scope).Find(&[]store{}).Statement.SQL.String()
+		for _, expected := range c.expected {
+			if !strings.Contains(sql, expected) {
+				t.Errorf("%s: expected %s in %s", c.name, expected, sql)
+			}
+		}
+	}
+
+	schema.SetPostGIS(true)
+	var sql = postgresDB.Create(&store{Location: eiffelTower}).Statement.SQL.String()
+	if !strings.Contains(sql, "VALUES ($1,ST_GeogFromText($2))") {
+		t.Errorf("expected the PostGIS point, got %s", sql)
+	}
+	schema.SetPostGIS(false)
+	sql = postgresDB.Create(&store{Location: eiffelTower}).Statement.SQL.String()
+	if !strings.Contains(sql, "VALUES ($1,point($2, $3))") {
+		t.Errorf("expected the plain point, got %s", sql)
+	}
+}
+
+func TestPointDataType(t *testing.T) {
+	var mysqlDB = dryRun(t, mysql.New(mysql.Config{DSN: "user:pass@tcp(localhost:3306)/db", SkipInitializeWithVersion: true}))
+	defer schema.SetMySQLServer("")
+
+	for server, expected := range map[string]string{
+		"8.0.36":              "POINT SRID 4326",
+		"5.7.44-log":          "POINT",
+		"10.11.6-MariaDB-log": "POINT",
+	} {
+		schema.SetMySQLServer(server)
+		if got := (types.Point{}).GormDBDataType(mysqlDB, nil); got != expected {
+			t.Errorf("%s: expected %s, got %s", server, expected, got)
+		}
+	}
+}
@@ -106,8 +106,17 @@ func (sd softDeleteQueryClause) ModifyStatement(stmt *gorm.Statement) {
 		return
 	}
 
-	// Wrap existing OR conditions in AND to avoid logic errors when combined
-	// with the soft-delete predicate (mirrors gorm.SoftDeleteQueryClause).
+	wrapOrConditions(stmt)
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: sd.Field.DBName}, Value: nil},
+	}})
+	stmt.Clauses["soft_delete_enabled"] = clause.Clause{}
+}
+
+// wrapOrConditions wraps existing OR conditions in AND to avoid logic errors
+// when they are combined with another predicate (mirrors
+// gorm.SoftDeleteQueryClause).
+func wrapOrConditions(stmt *gorm.Statement) {
 	if c, ok := stmt.Clauses["WHERE"]; ok {
 		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) >= 1 {
 			for _, expr := range where.Exprs {
@@ -120,11 +129,6 @@ func (sd softDeleteQueryClause) ModifyStatement(stmt *gorm.Statement) {
 			}
 		}
 	}
-
-	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
-		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: sd.Field.DBName}, Value: nil},
-	}})
-	stmt.Clauses["soft_delete_enabled"] = clause.Clause{}
 }
 
 // ---- update clause -------------------------------------------------------
@@ -190,6 +194,9 @@ func (sd softDeleteDeleteClause) ModifyStatement(stmt *gorm.Statement) {
 		}
 	}
 
+	// WithTrashed lifts the guard for queries only; a soft delete keeps
+	// the deleted_at of the rows already deleted.
+	delete(stmt.Clauses, "soft_delete_enabled")
 	softDeleteQueryClause{Field: sd.Field}.ModifyStatement(stmt)
 	stmt.AddClauseIfNotExists(clause.Update{})
 	stmt.Build(stmt.DB.Callback().Update().Clauses...)
@@ -0,0 +1,491 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// cascadeBatch is the number of parent rows whose children are soft deleted
+// by one statement.
+const cascadeBatch = 500
+
+const cascadeKey = "evo:soft_delete_cascade"
+
+// SoftDeletes is the GORM plugin cascading soft deletes to the has_one and
+// has_many associations tagged soft_delete:cascade, when their model is soft
+// deleted too:
+//
+//	type Post struct {
+//	    ID       uint
+//	    Comments []Comment `gorm:"foreignKey:PostID;soft_delete:cascade"`
+//	    types.SoftDelete
+//	}
+//
+// The children take the deleted_at of their parent, which is how Restore
+// tells them from the children deleted on their own. evo registers the
+// plugin for its connections.
+type SoftDeletes struct{}
+
+// Name implements gorm.Plugin.
+func (SoftDeletes) Name() string {
+	return "evo:soft_delete"
+}
+
+// Initialize implements gorm.Plugin.
+func (SoftDeletes) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Delete().After("gorm:delete_before_associations").Before("gorm:delete").Register("evo:soft_delete_parents", collectSoftDeleted); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register(cascadeKey, cascadeSoftDelete)
+}
+
+// WithTrashed is a scope including the soft-deleted rows in a query, without
+// turning deletes into hard deletes the way Unscoped does:
+//
+//	db.Scopes(types.WithTrashed).Find(&posts)
+func WithTrashed(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(trashedClause{})
+}
+
+// OnlyTrashed is a scope limiting a query to the soft-deleted rows.
+func OnlyTrashed(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(trashedClause{only: true})
+}
+
+type trashedClause struct {
+	only bool
+}
+
+func (trashedClause) Name() string               { return "" }
+func (trashedClause) Build(clause.Builder)       {}
+func (trashedClause) MergeClause(*clause.Clause) {}
+
+func (t trashedClause) ModifyStatement(stmt *gorm.Statement) {
+	stmt.Clauses["soft_delete_enabled"] = clause.Clause{}
+	if t.only {
+		stmt.AddClause(clause.Where{Exprs: []clause.Expression{trashedExpr{}}})
+	}
+}
+
+// trashedExpr renders deleted_at IS NOT NULL once the model is known.
+type trashedExpr struct{}
+
+func (trashedExpr) Build(builder clause.Builder) {
+	var name = "deleted_at"
+	if stmt, ok := builder.(*gorm.Statement); ok {
+		if field := softDeleteField(stmt.Schema); field != nil {
+			name = field.DBName
+		}
+	}
+	builder.WriteQuoted(clause.Column{Table: clause.CurrentTable, Name: name})
+	builder.WriteString(" IS NOT NULL")
+}
+
+// Restore undeletes the soft-deleted rows of value matching its primary key
+// and conds, along with the children soft deleted with them through a
+// soft_delete:cascade association:
+//
+//	types.Restore(db, &post)
+//	types.Restore(db, &Post{}, "author_id = ?", 7)
+//
+// It runs in a transaction and reports the number of rows of value restored.
+func Restore(tx *gorm.DB, value any, conds ...any) *gorm.DB {
+	tx = tx.Session(&gorm.Session{NewDB: true})
+	var stmt = &gorm.Statement{DB: tx, Context: tx.Statement.Context}
+	if err := stmt.Parse(value); err != nil {
+		tx.AddError(err)
+		return tx
+	}
+	field := softDeleteField(stmt.Schema)
+	if field == nil {
+		tx.AddError(fmt.Errorf("%s has no soft delete column", stmt.Schema.Name))
+		return tx
+	}
+
+	_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, reflect.ValueOf(value), stmt.Schema.PrimaryFields)
+	column, values := schema.ToQueryValues(clause.CurrentTable, stmt.Schema.PrimaryFieldDBNames, queryValues)
+	if len(values) == 0 && len(conds) == 0 && !tx.AllowGlobalUpdate {
+		tx.AddError(gorm.ErrMissingWhereClause)
+		return tx
+	}
+	var scope = func(q *gorm.DB) *gorm.DB {
+		if len(values) > 0 {
+			q = q.Where(clause.IN{Column: column, Values: values})
+		}
+		if len(conds) > 0 {
+			q = q.Where(conds[0], conds[1:]...)
+		}
+		return q
+	}
+
+	var result *gorm.DB
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		result = restoreTree(tx, stmt.Schema, field, scope, 1)
+		return result.Error
+	})
+	if result == nil {
+		tx.AddError(err)
+		return tx
+	}
+	if err != nil && result.Error == nil {
+		result.AddError(err)
+	}
+	return result
+}
+
+// restoreTree restores the children of the rows of s matched by scope before
+// the rows themselves, while their deleted_at can still be compared. scope
+// adds its conditions to a query of s, which refers to s by the name in its
+// Statement.Table.
+func restoreTree(tx *gorm.DB, s *schema.Schema, field *schema.Field, scope func(*gorm.DB) *gorm.DB, depth int) *gorm.DB {
+	for _, rel := range cascadeRelationships(s) {
+		childField := softDeleteField(rel.FieldSchema)
+		if childField == nil {
+			continue
+		}
+		var alias = "p" + strconv.Itoa(depth)
+		var childScope = func(q *gorm.DB) *gorm.DB {
+			var child = q.Statement.Table
+			parents := unscopedModel(tx, s).Table(q.Statement.Quote(s.Table) + " AS " + alias).Select("1")
+			parents = parents.Where(joinExpr(rel, alias, child)).
+				Where(clause.Expr{SQL: "? = ?", Vars: []any{clause.Column{Table: alias, Name: field.DBName}, clause.Column{Table: child, Name: childField.DBName}}}).
+				Where(clause.Neq{Column: clause.Column{Table: alias, Name: field.DBName}, Value: nil})
+			return q.Where("EXISTS (?)", scope(parents))
+		}
+		if result := restoreTree(tx, rel.FieldSchema, childField, childScope, depth+1); result.Error != nil {
+			return result
+		}
+	}
+
+	var q = unscopedModel(tx, s).Table(s.Table)
+	q = scope(q).Where(clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: nil})
+	return q.UpdateColumns(restoredColumns(s, field))
+}
+
+// unscopedModel starts a query of s ignoring its soft delete column, with a
+// model for conditions on the primary key.
+func unscopedModel(tx *gorm.DB, s *schema.Schema) *gorm.DB {
+	return tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(reflect.New(s.ModelType).Interface())
+}
+
+// joinExpr matches the rows of the child table of rel, named child, with
+// their parent row, named alias.
+func joinExpr(rel *schema.Relationship, alias, child string) clause.Expression {
+	var exprs []clause.Expression
+	for _, ref := range rel.References {
+		if ref.OwnPrimaryKey {
+			exprs = append(exprs, clause.Expr{SQL: "? = ?", Vars: []any{
+				clause.Column{Table: alias, Name: ref.PrimaryKey.DBName},
+				clause.Column{Table: child, Name: ref.ForeignKey.DBName},
+			}})
+		} else if ref.PrimaryValue != "" {
+			exprs = append(exprs, clause.Eq{Column: clause.Column{Table: child, Name: ref.ForeignKey.DBName}, Value: ref.PrimaryValue})
+		}
+	}
+	return clause.And(exprs...)
+}
+
+func restoredColumns(s *schema.Schema, field *schema.Field) map[string]any {
+	var columns = map[string]any{field.DBName: nil}
+	if deleted := s.LookUpField("Deleted"); deleted != nil {
+		columns[deleted.DBName] = false
+	}
+	return columns
+}
+
+// collectSoftDeleted reads the key columns of the rows a soft delete is about
+// to update, for cascadeSoftDelete to find their children.
+func collectSoftDeleted(tx *gorm.DB) {
+	var stmt = tx.Statement
+	if tx.Error != nil || stmt.Schema == nil || stmt.Unscoped || tx.DryRun {
+		return
+	}
+	field := softDeleteField(stmt.Schema)
+	if field == nil {
+		return
+	}
+	columns := parentColumns(stmt.Schema)
+	if len(columns) == 0 {
+		return
+	}
+
+	var q = tx.Session(&gorm.Session{NewDB: true}).Model(reflect.New(stmt.Schema.ModelType).Interface()).Table(stmt.Table).Select(columns)
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			q = q.Clauses(clause.Where{Exprs: append([]clause.Expression(nil), where.Exprs...)})
+		}
+	}
+	for _, value := range []reflect.Value{stmt.ReflectValue, reflect.ValueOf(stmt.Model)} {
+		if !value.IsValid() || (value.Kind() == reflect.Pointer && value.IsNil()) {
+			continue
+		}
+		_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, value, stmt.Schema.PrimaryFields)
+		column, values := schema.ToQueryValues(clause.CurrentTable, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			q = q.Where(clause.IN{Column: column, Values: values})
+		}
+	}
+
+	var rows []map[string]any
+	if err := q.Find(&rows).Error; err != nil {
+		tx.AddError(err)
+		return
+	}
+	tx.InstanceSet(cascadeKey, rows)
+}
+
+// cascadeSoftDelete soft deletes the children of the rows collected by
+// collectSoftDeleted with the deleted_at of the statement.
+func cascadeSoftDelete(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(cascadeKey)
+	if !ok || tx.Error != nil || tx.RowsAffected == 0 {
+		return
+	}
+	field := softDeleteField(tx.Statement.Schema)
+	c, ok := tx.Statement.Clauses["SET"]
+	if !ok {
+		return
+	}
+	set, _ := c.Expression.(clause.Set)
+	for _, assignment := range set {
+		if assignment.Column.Name == field.DBName {
+			if err := softDeleteChildren(tx.Session(&gorm.Session{NewDB: true}), tx.Statement.Schema, value.([]map[string]any), assignment.Value); err != nil {
+				tx.AddError(err)
+			}
+			return
+		}
+	}
+}
+
+func softDeleteChildren(tx *gorm.DB, s *schema.Schema, parents []map[string]any, deletedAt any) error {
+	for _, rel := range cascadeRelationships(s) {
+		field := softDeleteField(rel.FieldSchema)
+		if field == nil {
+			continue
+		}
+		var set = map[string]any{field.DBName: deletedAt}
+		if deleted := rel.FieldSchema.LookUpField("Deleted"); deleted != nil {
+			set[deleted.DBName] = true
+		}
+		var notDeleted = clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: nil}
+		var columns = parentColumns(rel.FieldSchema)
+
+		for start := 0; start < len(parents); start += cascadeBatch {
+			var cond = childrenExpr(rel, parents[start:min(start+cascadeBatch, len(parents))])
+			var children []map[string]any
+			if len(columns) > 0 {
+				if err := tx.Table(rel.FieldSchema.Table).Select(columns).Where(cond).Where(notDeleted).Find(&children).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Table(rel.FieldSchema.Table).Where(cond).Where(notDeleted).UpdateColumns(set).Error; err != nil {
+				return err
+			}
+			if len(children) > 0 {
+				if err := softDeleteChildren(tx, rel.FieldSchema, children, deletedAt); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// childrenExpr matches the rows of the child table of rel belonging to one
+// of parents.
+func childrenExpr(rel *schema.Relationship, parents []map[string]any) clause.Expression {
+	var own, exprs []clause.Expression
+	var keys []*schema.Reference
+	for _, ref := range rel.References {
+		if ref.OwnPrimaryKey {
+			keys = append(keys, ref)
+		} else if ref.PrimaryValue != "" {
+			exprs = append(exprs, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: ref.ForeignKey.DBName}, Value: ref.PrimaryValue})
+		}
+	}
+	if len(keys) == 1 {
+		var values = make([]any, len(parents))
+		for i, parent := range parents {
+			values[i] = parent[keys[0].PrimaryKey.DBName]
+		}
+		return clause.And(append(exprs, clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: keys[0].ForeignKey.DBName}, Values: values})...)
+	}
+	for _, parent := range parents {
+		var match []clause.Expression
+		for _, ref := range keys {
+			match = append(match, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: ref.ForeignKey.DBName}, Value: parent[ref.PrimaryKey.DBName]})
+		}
+		own = append(own, clause.And(match...))
+	}
+	return clause.And(append(exprs, clause.Or(own...))...)
+}
+
+// parentColumns returns the columns of s its cascading children refer to.
+func parentColumns(s *schema.Schema) []string {
+	var columns []string
+	for _, rel := range cascadeRelationships(s) {
+		for _, ref := range rel.References {
+			if ref.OwnPrimaryKey && !slices.Contains(columns, ref.PrimaryKey.DBName) {
+				columns = append(columns, ref.PrimaryKey.DBName)
+			}
+		}
+	}
+	return columns
+}
+
+// cascadeRelationships returns the has_one and has_many associations of s
+// tagged soft_delete:cascade.
+func cascadeRelationships(s *schema.Schema) []*schema.Relationship {
+	if s == nil {
+		return nil
+	}
+	var list []*schema.Relationship
+	for _, rel := range append(append([]*schema.Relationship(nil), s.Relationships.HasOne...), s.Relationships.HasMany...) {
+		if strings.EqualFold(rel.Field.TagSettings["SOFT_DELETE"], "cascade") {
+			list = append(list, rel)
+		}
+	}
+	return list
+}
+
+var softDeletedAtType = reflect.TypeOf(SoftDeletedAt{})
+
+// softDeleteField returns the SoftDeletedAt field of s, nil if it has none.
+func softDeleteField(s *schema.Schema) *schema.Field {
+	if s == nil {
+		return nil
+	}
+	for _, field := range s.Fields {
+		if field.DBName != "" && field.FieldType == softDeletedAtType {
+			return field
+		}
+	}
+	return nil
+}
+
+// PurgeAfter returns the retention of the soft-deleted rows of a model, set
+// with the purge_after tag of its SoftDelete or SoftDeletedAt field, and 0
+// when they are kept forever:
+//
+//	type Session struct {
+//	    ID uint
+//	    types.SoftDelete `gorm:"purge_after:90d"`
+//	}
+//
+// The retention is a time.Duration or a number of days such as 90d.
+func PurgeAfter(s *schema.Schema) (time.Duration, error) {
+	field := softDeleteField(s)
+	if field == nil || field.TagSettings["PURGE_AFTER"] == "" {
+		return 0, nil
+	}
+	var value = strings.TrimSpace(field.TagSettings["PURGE_AFTER"])
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("%s: invalid purge_after %q", s.Name, value)
+}
+
+// PurgeTrashed hard deletes the rows of model soft deleted for longer than
+// its purge_after retention, batch rows per statement, and returns the number
+// of rows deleted. The soft-deleted children of the rows through
+// soft_delete:cascade associations are deleted first, so that their foreign
+// keys do not block the delete; a live child still does.
+func PurgeTrashed(tx *gorm.DB, model any, batch int) (int64, error) {
+	var stmt = &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return 0, err
+	}
+	retention, err := PurgeAfter(stmt.Schema)
+	if err != nil || retention == 0 {
+		return 0, err
+	}
+	if len(stmt.Schema.PrimaryFields) == 0 {
+		return 0, fmt.Errorf("%s: purge_after needs a primary key", stmt.Schema.Name)
+	}
+	if batch <= 0 {
+		batch = 1000
+	}
+
+	var field = softDeleteField(stmt.Schema)
+	var cutoff = SoftDeletedAt{Valid: true, Time: tx.NowFunc().Add(-retention)}
+	var columns = slices.Clone(stmt.Schema.PrimaryFieldDBNames)
+	for _, column := range parentColumns(stmt.Schema) {
+		if !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	var total int64
+	for {
+		var rows []map[string]any
+		err := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(model).Select(columns).
+			Where(clause.Lt{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: cutoff}).
+			Limit(batch).Find(&rows).Error
+		if err != nil {
+			return total, err
+		}
+		if len(rows) == 0 {
+			return total, nil
+		}
+		if err = purgeChildren(tx.Session(&gorm.Session{NewDB: true}), stmt.Schema, rows); err != nil {
+			return total, err
+		}
+
+		var queryValues = make([][]any, len(rows))
+		for i, row := range rows {
+			for _, name := range stmt.Schema.PrimaryFieldDBNames {
+				queryValues[i] = append(queryValues[i], row[name])
+			}
+		}
+		column, values := schema.ToQueryValues(clause.CurrentTable, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		result := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Where(clause.IN{Column: column, Values: values}).Delete(reflect.New(stmt.Schema.ModelType).Interface())
+		total += result.RowsAffected
+		if result.Error != nil {
+			return total, result.Error
+		}
+		if len(rows) < batch {
+			return total, nil
+		}
+	}
+}
+
+// purgeChildren hard deletes the soft-deleted rows of the soft_delete:cascade
+// associations of parents, deepest first.
+func purgeChildren(tx *gorm.DB, s *schema.Schema, parents []map[string]any) error {
+	for _, rel := range cascadeRelationships(s) {
+		field := softDeleteField(rel.FieldSchema)
+		if field == nil {
+			continue
+		}
+		var trashed = clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: nil}
+		var columns = parentColumns(rel.FieldSchema)
+
+		for start := 0; start < len(parents); start += cascadeBatch {
+			var cond = childrenExpr(rel, parents[start:min(start+cascadeBatch, len(parents))])
+			if len(columns) > 0 {
+				var children []map[string]any
+				if err := tx.Table(rel.FieldSchema.Table).Select(columns).Where(cond).Where(trashed).Find(&children).Error; err != nil {
+					return err
+				}
+				if err := purgeChildren(tx, rel.FieldSchema, children); err != nil {
+					return err
+				}
+			}
+			if err := tx.Unscoped().Where(cond).Where(trashed).Delete(reflect.New(rel.FieldSchema.ModelType).Interface()).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
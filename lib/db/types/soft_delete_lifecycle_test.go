@@ -0,0 +1,275 @@
+package types_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+
+	"github.com/getevo/evo/v2/lib/db/types"
+)
+
+type blogPost struct {
+	ID       uint
+	Title    string
+	Comments []blogComment `gorm:"foreignKey:PostID;soft_delete:cascade"`
+	Cover    blogCover     `gorm:"foreignKey:PostID;soft_delete:cascade"`
+	types.SoftDelete
+}
+
+type blogComment struct {
+	ID      uint
+	PostID  uint
+	Body    string
+	Replies []blogReply `gorm:"foreignKey:CommentID;soft_delete:cascade"`
+	types.SoftDelete
+}
+
+type blogReply struct {
+	ID        uint
+	CommentID uint
+	types.SoftDelete
+}
+
+type blogCover struct {
+	ID     uint
+	PostID uint
+	Image  string
+	types.SoftDelete
+}
+
+type auditEntry struct {
+	ID               uint
+	types.SoftDelete `gorm:"purge_after:30d"`
+}
+
+func openLifecycleDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "soft.db")), &gorm.Config{
+		Logger:  logger.Default.LogMode(logger.Silent),
+		Plugins: map[string]gorm.Plugin{types.SoftDeletes{}.Name(): types.SoftDeletes{}},
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&blogPost{}, &blogComment{}, &blogReply{}, &blogCover{}, &auditEntry{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func seedPost(t *testing.T, db *gorm.DB, title string) blogPost {
+	t.Helper()
+	post := blogPost{Title: title, Cover: blogCover{Image: "cover.png"}, Comments: []blogComment{
+		{Body: "first", Replies: []blogReply{{}, {}}},
+		{Body: "second"},
+	}}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	return post
+}
+
+func countLive(db *gorm.DB, model any) int64 {
+	var n int64
+	db.Model(model).Count(&n)
+	return n
+}
+
+func TestSoftDeleteCascade(t *testing.T) {
+	db := openLifecycleDB(t)
+	post := seedPost(t, db, "one")
+	other := seedPost(t, db, "two")
+
+	if err := db.Delete(&blogPost{}, post.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := countLive(db, &blogComment{}); n != 2 {
+		t.Errorf("expected the comments of the other post only, got %d", n)
+	}
+	if n := countLive(db, &blogReply{}); n != 2 {
+		t.Errorf("expected the replies cascaded through the comments, got %d live", n)
+	}
+	if n := countLive(db, &blogCover{}); n != 1 {
+		t.Errorf("expected the has_one cover cascaded, got %d live", n)
+	}
+
+	var deletedPost blogPost
+	var deletedReply blogReply
+	db.Unscoped().First(&deletedPost, post.ID)
+	db.Unscoped().First(&deletedReply, post.Comments[0].Replies[0].ID)
+	if !deletedReply.Deleted || !deletedReply.DeletedAt.Time.Equal(deletedPost.DeletedAt.Time) {
+		t.Errorf("expected the reply deleted with the post, got %+v and %+v", deletedReply.SoftDelete, deletedPost.SoftDelete)
+	}
+
+	if err := db.Unscoped().Delete(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := countLive(db, &blogComment{}); n != 2 {
+		t.Errorf("expected a hard delete not to cascade, got %d live comments", n)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	db := openLifecycleDB(t)
+	post := seedPost(t, db, "one")
+
+	// deleted on its own before the post
+	db.Delete(&blogComment{}, post.Comments[1].ID)
+	time.Sleep(10 * time.Millisecond)
+	db.Delete(&post)
+
+	result := types.Restore(db, &post)
+	if result.Error != nil || result.RowsAffected != 1 {
+		t.Fatalf("expected one post restored, got %d, %v", result.RowsAffected, result.Error)
+	}
+	var restored blogPost
+	if err := db.First(&restored, post.ID).Error; err != nil || restored.Deleted || restored.DeletedAt.Valid {
+		t.Fatalf("expected the post restored, got %+v, %v", restored.SoftDelete, err)
+	}
+	if n := countLive(db, &blogComment{}); n != 1 {
+		t.Errorf("expected only the comment deleted with the post restored, got %d", n)
+	}
+	if n := countLive(db, &blogReply{}); n != 2 {
+		t.Errorf("expected the replies restored, got %d", n)
+	}
+	if n := countLive(db, &blogCover{}); n != 1 {
+		t.Errorf("expected the cover restored, got %d", n)
+	}
+
+	if err := types.Restore(db, &blogPost{}).Error; err != gorm.ErrMissingWhereClause {
+		t.Errorf("expected ErrMissingWhereClause, got %v", err)
+	}
+	if err := types.Restore(db, &blogPost{}, "title = ?", "one").Error; err != nil {
+		t.Errorf("expected restoring a live row to do nothing, got %v", err)
+	}
+}
+
+func TestTrashedScopes(t *testing.T) {
+	db := openLifecycleDB(t)
+	seedPost(t, db, "one")
+	gone := seedPost(t, db, "two")
+	db.Delete(&gone)
+
+	var posts []blogPost
+	db.Scopes(types.WithTrashed).Order("id").Find(&posts)
+	if len(posts) != 2 {
+		t.Errorf("expected 2 posts with the trashed ones, got %d", len(posts))
+	}
+	db.Scopes(types.OnlyTrashed).Find(&posts)
+	if len(posts) != 1 || posts[0].ID != gone.ID {
+		t.Errorf("expected only the trashed post, got %+v", posts)
+	}
+	var n int64
+	db.Model(&blogComment{}).Scopes(types.OnlyTrashed).Where("body = ?", "first").Count(&n)
+	if n != 1 {
+		t.Errorf("expected one trashed first comment, got %d", n)
+	}
+
+	// a delete in the scope stays soft
+	if err := db.Scopes(types.WithTrashed).Where("title = ?", "one").Delete(&blogPost{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	db.Unscoped().Model(&blogPost{}).Count(&n)
+	if n != 2 || countLive(db, &blogPost{}) != 0 {
+		t.Errorf("expected a soft delete, got %d rows", n)
+	}
+
+	// and leaves the rows already deleted as they were
+	var before, after blogPost
+	db.Unscoped().First(&before, gone.ID)
+	time.Sleep(10 * time.Millisecond)
+	result := db.Scopes(types.WithTrashed).Where("title IN ?", []string{"one", "two"}).Where("id > ?", 0).Delete(&blogPost{})
+	db.Unscoped().First(&after, gone.ID)
+	if result.Error != nil || result.RowsAffected != 0 || !after.DeletedAt.Time.Equal(before.DeletedAt.Time) {
+		t.Errorf("expected the trashed posts untouched, got %d rows, %v and %s", result.RowsAffected, result.Error, after.DeletedAt.Time)
+	}
+}
+
+func TestPurgeTrashed(t *testing.T) {
+	db := openLifecycleDB(t)
+
+	retention, err := types.PurgeAfter(schemaOf(t, db, &auditEntry{}))
+	if err != nil || retention != 30*24*time.Hour {
+		t.Fatalf("expected 30 days, got %s, %v", retention, err)
+	}
+	if retention, _ := types.PurgeAfter(schemaOf(t, db, &blogPost{})); retention != 0 {
+		t.Errorf("expected no retention without the tag, got %s", retention)
+	}
+
+	for i := 0; i < 7; i++ {
+		var entry auditEntry
+		switch {
+		case i < 5:
+			entry.Set(time.Now().AddDate(0, 0, -40))
+		case i == 5:
+			entry.Set(time.Now().AddDate(0, 0, -10))
+		}
+		entry.Deleted = entry.DeletedAt.Valid
+		db.Create(&entry)
+	}
+
+	purged, err := types.PurgeTrashed(db, &auditEntry{}, 2)
+	if err != nil || purged != 5 {
+		t.Fatalf("expected 5 rows purged, got %d, %v", purged, err)
+	}
+	var n int64
+	db.Unscoped().Model(&auditEntry{}).Count(&n)
+	if n != 2 {
+		t.Errorf("expected the recent and live rows kept, got %d", n)
+	}
+	if purged, err := types.PurgeTrashed(db, &blogPost{}, 2); purged != 0 || err != nil {
+		t.Errorf("expected nothing purged without retention, got %d, %v", purged, err)
+	}
+}
+
+func schemaOf(t *testing.T, db *gorm.DB, model any) *schema.Schema {
+	t.Helper()
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		t.Fatal(err)
+	}
+	return stmt.Schema
+}
+
+type forumThread struct {
+	ID               uint
+	Messages         []forumMessage `gorm:"foreignKey:ThreadID;constraint:OnDelete:RESTRICT;soft_delete:cascade"`
+	types.SoftDelete `gorm:"purge_after:30d"`
+}
+
+type forumMessage struct {
+	ID       uint
+	ThreadID uint
+	types.SoftDelete
+}
+
+func TestPurgeTrashedChildren(t *testing.T) {
+	db := openLifecycleDB(t)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.Exec("PRAGMA foreign_keys = ON")
+	if err := db.AutoMigrate(&forumThread{}, &forumMessage{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	thread := forumThread{Messages: []forumMessage{{}, {}}}
+	db.Create(&thread)
+	db.Delete(&thread)
+	var old = time.Now().AddDate(0, 0, -40)
+	db.Unscoped().Model(&forumThread{}).Where("id = ?", thread.ID).UpdateColumn("deleted_at", old)
+
+	purged, err := types.PurgeTrashed(db, &forumThread{}, 10)
+	if err != nil || purged != 1 {
+		t.Fatalf("expected the thread purged, got %d, %v", purged, err)
+	}
+	var n int64
+	db.Unscoped().Model(&forumMessage{}).Count(&n)
+	if n != 0 {
+		t.Errorf("expected the trashed messages purged first, got %d left", n)
+	}
+}
@@ -0,0 +1,19 @@
+package types
+
+// Tenant scopes a model to a tenant when embedded. With lib/tenant in row
+// mode, queries, updates and deletes of the model only see the rows of the
+// tenant on the query context, and created rows are assigned to it.
+//
+//	type Invoice struct {
+//	    ID uint
+//	    types.Tenant
+//	    Total float64
+//	}
+type Tenant struct {
+	TenantID string `gorm:"column:tenant_id;size:64;index;not null" json:"tenant_id"`
+}
+
+// TenantColumn returns the column holding the tenant of the row.
+func (Tenant) TenantColumn() string {
+	return "tenant_id"
+}
@@ -0,0 +1,151 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	dbschema "github.com/getevo/evo/v2/lib/db/schema"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrStaleObject is returned by updates of a versioned row that was changed
+// or deleted since it was read.
+var ErrStaleObject = errors.New("stale object: the row was changed since it was read")
+
+// Version is an optimistic locking column. Every update increments it in
+// the database, and updates of a loaded row (with its primary key set) only
+// apply while the column still holds the version that was read:
+//
+//	type Invoice struct {
+//	    ID      uint `gorm:"primaryKey"`
+//	    Amount  int64
+//	    Version types.Version
+//	}
+//
+// A stale update fails with ErrStaleObject once the Versioning plugin is
+// registered, which evo does for its connections. Use db.Unscoped() to
+// update without the version check.
+type Version int64
+
+// Int64 returns the version number.
+func (v Version) Int64() int64 {
+	return int64(v)
+}
+
+// UpdateClauses implements schema.UpdateClausesInterface.
+func (Version) UpdateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{versionUpdateClause{Field: f}}
+}
+
+// ColumnDefinition migrates the column with a default of 0 unless the field
+// sets its own.
+func (Version) ColumnDefinition(column *dbschema.Column) {
+	if column.Default == "" {
+		column.Default = "0"
+	}
+}
+
+const versionKey = "evo:version"
+
+// versionCheck is the version an update of a loaded row expects.
+type versionCheck struct {
+	field   *schema.Field
+	current Version
+}
+
+type versionUpdateClause struct {
+	Field *schema.Field
+}
+
+func (versionUpdateClause) Name() string               { return "" }
+func (versionUpdateClause) Build(clause.Builder)       {}
+func (versionUpdateClause) MergeClause(*clause.Clause) {}
+
+func (v versionUpdateClause) ModifyStatement(stmt *gorm.Statement) {
+	if _, ok := stmt.Clauses["version_enabled"]; ok || stmt.SQL.Len() > 0 {
+		return
+	}
+	if !stmt.Unscoped && loaded(stmt) {
+		value, _ := v.Field.ValueOf(stmt.Context, stmt.ReflectValue)
+		if current, ok := value.(Version); ok {
+			wrapOrConditions(stmt)
+			stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+				clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: v.Field.DBName}, Value: int64(current)},
+			}})
+			stmt.DB.InstanceSet(versionKey, versionCheck{field: v.Field, current: current})
+		}
+	}
+
+	// The assignments are built here, rather than by the update callback,
+	// to replace the version written by the statement with the increment.
+	var set clause.Set
+	for _, assignment := range callbacks.ConvertToAssignments(stmt) {
+		if assignment.Column.Name != v.Field.DBName {
+			set = append(set, assignment)
+		}
+	}
+	if len(set) == 0 {
+		return
+	}
+	set = append(set, clause.Assignment{
+		Column: clause.Column{Name: v.Field.DBName},
+		Value:  clause.Expr{SQL: "? + 1", Vars: []any{clause.Column{Name: v.Field.DBName}}},
+	})
+	stmt.AddClause(set)
+	stmt.Clauses["version_enabled"] = clause.Clause{}
+}
+
+// loaded reports whether the statement updates a row that was read, i.e. a
+// single struct with its primary key set.
+func loaded(stmt *gorm.Statement) bool {
+	if stmt.ReflectValue.Kind() != reflect.Struct || len(stmt.Schema.PrimaryFields) == 0 {
+		return false
+	}
+	for _, field := range stmt.Schema.PrimaryFields {
+		if _, zero := field.ValueOf(stmt.Context, stmt.ReflectValue); zero {
+			return false
+		}
+	}
+	return true
+}
+
+// Versioning is the GORM plugin reporting stale updates of Version columns
+// as ErrStaleObject and keeping the version of the updated struct current.
+type Versioning struct{}
+
+// Name implements gorm.Plugin.
+func (Versioning) Name() string {
+	return "evo:version"
+}
+
+// Initialize implements gorm.Plugin.
+func (Versioning) Initialize(db *gorm.DB) error {
+	return db.Callback().Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("evo:version", checkVersion)
+}
+
+func checkVersion(tx *gorm.DB) {
+	var stmt = tx.Statement
+	if _, ok := stmt.Clauses["version_enabled"]; !ok {
+		return
+	}
+	// The clauses belong to this execution only.
+	delete(stmt.Clauses, "version_enabled")
+	delete(stmt.Clauses, "SET")
+
+	value, ok := tx.InstanceGet(versionKey)
+	if !ok || tx.Error != nil || tx.DryRun {
+		return
+	}
+	var check = value.(versionCheck)
+	if tx.RowsAffected == 0 {
+		tx.AddError(fmt.Errorf("%w: %s version %d", ErrStaleObject, stmt.Table, check.current))
+		return
+	}
+	if stmt.ReflectValue.CanAddr() {
+		tx.AddError(check.field.Set(stmt.Context, stmt.ReflectValue, check.current+1))
+	}
+}
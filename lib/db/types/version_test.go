@@ -0,0 +1,151 @@
+package types_test
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+
+	dbschema "github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
+)
+
+type testInvoice struct {
+	ID      uint `gorm:"primaryKey;autoIncrement"`
+	Amount  int64
+	Note    string
+	Version types.Version
+}
+
+func openVersionDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "version.db")), &gorm.Config{
+		Logger:  logger.Default.LogMode(logger.Silent),
+		Plugins: map[string]gorm.Plugin{types.Versioning{}.Name(): types.Versioning{}},
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&testInvoice{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func loadInvoice(t *testing.T, db *gorm.DB, id uint) testInvoice {
+	t.Helper()
+	var invoice testInvoice
+	if err := db.First(&invoice, id).Error; err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return invoice
+}
+
+func TestVersion_IncrementsOnUpdate(t *testing.T) {
+	db := openVersionDB(t)
+
+	invoice := testInvoice{Amount: 100}
+	db.Create(&invoice)
+	if invoice.Version != 0 {
+		t.Fatalf("expected version 0 after create, got %d", invoice.Version)
+	}
+
+	invoice.Amount = 200
+	if err := db.Save(&invoice).Error; err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := db.Model(&invoice).Updates(map[string]any{"amount": 300}).Error; err != nil {
+		t.Fatalf("updates: %v", err)
+	}
+	if err := db.Model(&invoice).UpdateColumns(testInvoice{Note: "paid"}).Error; err != nil {
+		t.Fatalf("update columns: %v", err)
+	}
+	if invoice.Version != 3 {
+		t.Errorf("expected the struct at version 3, got %d", invoice.Version)
+	}
+	stored := loadInvoice(t, db, invoice.ID)
+	if stored.Version != 3 || stored.Amount != 300 || stored.Note != "paid" {
+		t.Errorf("unexpected row %+v", stored)
+	}
+}
+
+func TestVersion_StaleUpdateFails(t *testing.T) {
+	db := openVersionDB(t)
+
+	db.Create(&testInvoice{Amount: 100})
+	first := loadInvoice(t, db, 1)
+	second := loadInvoice(t, db, 1)
+
+	first.Amount = 150
+	if err := db.Save(&first).Error; err != nil {
+		t.Fatalf("first save: %v", err)
+	}
+
+	second.Amount = 175
+	err := db.Save(&second).Error
+	if !errors.Is(err, types.ErrStaleObject) {
+		t.Fatalf("expected ErrStaleObject from Save, got %v", err)
+	}
+	if err := db.Model(&second).Update("amount", 175).Error; !errors.Is(err, types.ErrStaleObject) {
+		t.Fatalf("expected ErrStaleObject from Update, got %v", err)
+	}
+	if err := db.Model(&second).UpdateColumns(map[string]any{"amount": 175}).Error; !errors.Is(err, types.ErrStaleObject) {
+		t.Fatalf("expected ErrStaleObject from UpdateColumns, got %v", err)
+	}
+
+	var count int64
+	db.Model(&testInvoice{}).Count(&count)
+	if count != 1 {
+		t.Errorf("stale save must not insert a row, got %d rows", count)
+	}
+	if stored := loadInvoice(t, db, 1); stored.Amount != 150 || stored.Version != 1 {
+		t.Errorf("stale update was applied: %+v", stored)
+	}
+}
+
+func TestVersion_BulkAndUnscopedUpdates(t *testing.T) {
+	db := openVersionDB(t)
+
+	db.Create(&testInvoice{Amount: 1})
+	db.Create(&testInvoice{Amount: 2})
+	if err := db.Model(&testInvoice{}).Where("amount > ?", 0).Update("note", "bulk").Error; err != nil {
+		t.Fatalf("bulk update: %v", err)
+	}
+	if stored := loadInvoice(t, db, 2); stored.Version != 1 {
+		t.Errorf("expected bulk update to increment the version, got %d", stored.Version)
+	}
+
+	stale := testInvoice{ID: 1, Amount: 9}
+	if err := db.Unscoped().Model(&stale).Update("amount", 9).Error; err != nil {
+		t.Fatalf("unscoped update: %v", err)
+	}
+	if stored := loadInvoice(t, db, 1); stored.Amount != 9 || stored.Version != 2 {
+		t.Errorf("unexpected row after unscoped update %+v", stored)
+	}
+}
+
+func TestVersion_MigratesWithDefault(t *testing.T) {
+	s, err := schema.Parse(&testInvoice{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if field := s.LookUpField("version"); field == nil || field.DefaultValue != "" {
+		t.Errorf("expected the parsed field left as is, got %+v", field)
+	}
+
+	var column = dbschema.Column{Name: "version"}
+	types.Version(0).ColumnDefinition(&column)
+	if column.Default != "0" {
+		t.Errorf("expected the version column to default to 0, got %q", column.Default)
+	}
+	column.Default = "1"
+	types.Version(0).ColumnDefinition(&column)
+	if column.Default != "1" {
+		t.Errorf("expected the default of the field kept, got %q", column.Default)
+	}
+}
@@ -0,0 +1,392 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getevo/json"
+)
+
+// ClientConfig configures a Client. Every field is optional.
+type ClientConfig struct {
+	// Name and Version identify the client to the server. Name defaults to
+	// "evo-mcp-client".
+	Name    string
+	Version string
+
+	// Token is sent as a bearer token on every HTTP request.
+	Token string
+
+	// Headers are added to every HTTP request.
+	Headers map[string]string
+
+	// HTTPClient performs HTTP requests. http.DefaultClient is used when nil.
+	HTTPClient HTTPDoer
+
+	// Timeout bounds every call that is given a context without a deadline.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	// OnProgress, when set, asks the server to report progress of tool calls
+	// and receives each report as it arrives.
+	OnProgress func(ProgressParams)
+}
+
+// Client calls tools on a remote MCP server. It negotiates the newest protocol
+// revision both sides support, so the same client talks to legacy
+// (initialize-based) and modern (stateless) servers.
+//
+// A Client is safe for concurrent use once Connect has returned.
+type Client struct {
+	transport Transport
+	config    ClientConfig
+	nextID    atomic.Int64
+
+	mu        sync.Mutex
+	connected bool
+
+	// Version is the protocol revision negotiated by Connect.
+	Version string
+	// ServerInfo identifies the server, when it reported itself.
+	ServerInfo *Implementation
+	// Capabilities are the features the server advertised.
+	Capabilities Capabilities
+	// Instructions is the server's guidance for using its tools, if any.
+	Instructions string
+}
+
+// ToolError is returned by CallTool when the tool ran and reported a failure
+// (a result with isError set). Result holds the full result.
+type ToolError struct {
+	Tool   string
+	Result *CallToolResult
+}
+
+// Error implements the error interface.
+func (e *ToolError) Error() string {
+	var parts []string
+	for _, c := range e.Result.Content {
+		if c.Type == "text" && c.Text != "" {
+			parts = append(parts, c.Text)
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("mcp: tool %s failed", e.Tool)
+	}
+	return fmt.Sprintf("mcp: tool %s failed: %s", e.Tool, strings.Join(parts, "; "))
+}
+
+// NewClient returns a client that speaks over transport. Connect must be
+// called before any other method.
+func NewClient(transport Transport, config ...ClientConfig) *Client {
+	c := &Client{transport: transport}
+	if len(config) > 0 {
+		c.config = config[0]
+	}
+	if c.config.Name == "" {
+		c.config.Name = "evo-mcp-client"
+	}
+	return c
+}
+
+// NewHTTPClient returns a client for the Streamable HTTP endpoint at url.
+func NewHTTPClient(url string, config ...ClientConfig) *Client {
+	t := NewHTTPTransport(url)
+	if len(config) > 0 {
+		t.Token = config[0].Token
+		t.Headers = config[0].Headers
+		t.Client = config[0].HTTPClient
+	}
+	return NewClient(t, config...)
+}
+
+// NewStdioClient starts cmd and returns a client speaking to it over stdio.
+func NewStdioClient(cmd *exec.Cmd, config ...ClientConfig) (*Client, error) {
+	t, err := NewStdioTransport(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(t, config...), nil
+}
+
+// Connect negotiates a protocol revision with the server.
+//
+// A modern server is probed first with `server/discover`. If it rejects the
+// method or the revision, the client falls back to the legacy `initialize`
+// handshake. A refused credential is returned as is.
+func (c *Client) Connect(ctx context.Context) error {
+	ctx, cancel := c.bound(ctx)
+	defer cancel()
+
+	err := c.discover(ctx)
+	if err == nil {
+		return nil
+	}
+	var rpcErr *Error
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && (statusErr.Status == http.StatusUnauthorized || statusErr.Status == http.StatusForbidden) {
+		return err
+	}
+	if !errors.As(err, &rpcErr) && statusErr == nil {
+		return err
+	}
+	return c.initialize(ctx)
+}
+
+func (c *Client) discover(ctx context.Context) error {
+	var result DiscoverResult
+	if err := c.call(ctx, LatestVersion, MethodDiscover, struct {
+		Meta *Meta `json:"_meta,omitempty"`
+	}{Meta: c.meta(LatestVersion, nil)}, &result); err != nil {
+		return err
+	}
+	version := ""
+	for _, v := range result.SupportedVersions {
+		if IsModern(v) && IsSupportedVersion(v) && v > version {
+			version = v
+		}
+	}
+	if version == "" {
+		return &Error{Code: CodeUnsupportedProtocolVersion, Message: "server supports no modern revision"}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Version = version
+	c.Capabilities = result.Capabilities
+	c.Instructions = result.Instructions
+	if result.Meta != nil {
+		c.ServerInfo = result.Meta.ServerInfo
+	}
+	c.connected = true
+	return nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	var result InitializeResult
+	if err := c.call(ctx, LatestLegacyVersion, MethodInitialize, InitializeParams{
+		ProtocolVersion: LatestLegacyVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      c.implementation(),
+	}, &result); err != nil {
+		return err
+	}
+	if !IsSupportedVersion(result.ProtocolVersion) || IsModern(result.ProtocolVersion) {
+		return fmt.Errorf("mcp: server chose unsupported protocol version %q", result.ProtocolVersion)
+	}
+	if err := c.notify(ctx, result.ProtocolVersion, MethodInitialized); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Version = result.ProtocolVersion
+	c.Capabilities = result.Capabilities
+	c.Instructions = result.Instructions
+	info := result.ServerInfo
+	c.ServerInfo = &info
+	c.connected = true
+	return nil
+}
+
+// ListTools returns every tool the server offers, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]*ToolDefinition, error) {
+	version, err := c.version()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.bound(ctx)
+	defer cancel()
+
+	var tools []*ToolDefinition
+	cursor := ""
+	for {
+		var result ListToolsResult
+		params := ListToolsParams{Cursor: cursor, Meta: c.meta(version, nil)}
+		if err := c.call(ctx, version, MethodToolsList, params, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" || result.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool invokes the named tool with args, which may be any value that
+// encodes to a JSON object, or nil. A result with isError set is returned
+// together with a *ToolError.
+func (c *Client) CallTool(ctx context.Context, name string, args any) (*CallToolResult, error) {
+	version, err := c.version()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.bound(ctx)
+	defer cancel()
+
+	params := CallToolParams{Name: name}
+	if args != nil {
+		raw, err := json.Marshal(args)
+		if err != nil {
+			return nil, fmt.Errorf("mcp: unable to encode arguments of %s: %w", name, err)
+		}
+		params.Arguments = raw
+	}
+
+	id := c.nextID.Add(1)
+	var progressToken any
+	if c.config.OnProgress != nil {
+		progressToken = id
+	}
+	params.Meta = c.meta(version, progressToken)
+
+	var result CallToolResult
+	if err := c.send(ctx, version, id, MethodToolsCall, params, &result); err != nil {
+		return nil, err
+	}
+	if result.IsError {
+		return &result, &ToolError{Tool: name, Result: &result}
+	}
+	return &result, nil
+}
+
+// CallToolInto invokes the named tool and decodes its result into dst.
+func (c *Client) CallToolInto(ctx context.Context, name string, args any, dst any) error {
+	result, err := c.CallTool(ctx, name, args)
+	if err != nil {
+		return err
+	}
+	return result.Decode(dst)
+}
+
+// Ping checks that the server is responsive.
+func (c *Client) Ping(ctx context.Context) error {
+	version, err := c.version()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.bound(ctx)
+	defer cancel()
+	var result EmptyResult
+	return c.call(ctx, version, MethodPing, struct {
+		Meta *Meta `json:"_meta,omitempty"`
+	}{Meta: c.meta(version, nil)}, &result)
+}
+
+// Close releases the transport. For a stdio client this stops the server.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.connected = false
+	c.mu.Unlock()
+	return c.transport.Close()
+}
+
+// Decode unmarshals the result into dst. Structured content is preferred; a
+// result that only carries text is decoded from the first text block, which
+// servers use to mirror structured content for older clients.
+func (r *CallToolResult) Decode(dst any) error {
+	if r.StructuredContent != nil {
+		raw, err := json.Marshal(r.StructuredContent)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(raw, dst)
+	}
+	for _, c := range r.Content {
+		if c.Type == "text" {
+			if err := json.Unmarshal([]byte(c.Text), dst); err != nil {
+				return fmt.Errorf("mcp: tool result is not JSON: %w", err)
+			}
+			return nil
+		}
+	}
+	return errors.New("mcp: tool result carries no decodable content")
+}
+
+func (c *Client) version() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return "", errors.New("mcp: client is not connected")
+	}
+	return c.Version, nil
+}
+
+func (c *Client) bound(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok && c.config.Timeout > 0 {
+		return context.WithTimeout(ctx, c.config.Timeout)
+	}
+	return ctx, func() {}
+}
+
+func (c *Client) implementation() *Implementation {
+	return &Implementation{Name: c.config.Name, Version: c.config.Version}
+}
+
+// meta builds the `_meta` object for a request. Legacy servers get one only
+// when there is a progress token to carry.
+func (c *Client) meta(version string, progressToken any) *Meta {
+	if !IsModern(version) {
+		if progressToken == nil {
+			return nil
+		}
+		return &Meta{ProgressToken: progressToken}
+	}
+	return &Meta{
+		ProtocolVersion: version,
+		ClientInfo:      c.implementation(),
+		ProgressToken:   progressToken,
+	}
+}
+
+func (c *Client) call(ctx context.Context, version, method string, params, result any) error {
+	return c.send(ctx, version, c.nextID.Add(1), method, params, result)
+}
+
+func (c *Client) send(ctx context.Context, version string, id int64, method string, params, result any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("mcp: unable to encode %s params: %w", method, err)
+	}
+	req := &Request{JSONRPC: "2.0", ID: id, Method: method, Params: raw}
+	msg, err := c.transport.Send(ctx, version, req, c.dispatch)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		return fmt.Errorf("mcp: no response to %s", method)
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if err := json.Unmarshal(msg.Result, result); err != nil {
+		return fmt.Errorf("mcp: unable to decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+func (c *Client) notify(ctx context.Context, version, method string) error {
+	_, err := c.transport.Send(ctx, version, &Request{JSONRPC: "2.0", Method: method}, nil)
+	return err
+}
+
+// dispatch hands server-initiated messages to the configured callbacks.
+func (c *Client) dispatch(msg *Message) {
+	if msg.Method == MethodProgress && c.config.OnProgress != nil {
+		var params ProgressParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			c.config.OnProgress(params)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getevo/json"
+)
+
+// fakeServer is a minimal MCP server used to exercise the client. legacy makes
+// it reject server/discover the way a pre-2026 server does.
+type fakeServer struct {
+	legacy bool
+	stream bool
+
+	mu      sync.Mutex
+	headers []http.Header
+	methods []string
+}
+
+func (s *fakeServer) handle(req *Request) any {
+	switch req.Method {
+	case MethodDiscover:
+		return DiscoverResult{
+			ResultType:        ResultTypeComplete,
+			SupportedVersions: []string{"2099-01-01", Version20260728, Version20251125},
+			Capabilities:      Capabilities{Tools: &ToolsCapability{}},
+			Instructions:      "be nice",
+			Meta:              &Meta{ServerInfo: &Implementation{Name: "fake", Version: "1"}},
+		}
+	case MethodInitialize:
+		return InitializeResult{
+			ProtocolVersion: Version20250618,
+			Capabilities:    Capabilities{Tools: &ToolsCapability{}},
+			ServerInfo:      Implementation{Name: "fake-legacy", Version: "1"},
+		}
+	case MethodToolsList:
+		var params ListToolsParams
+		_ = json.Unmarshal(req.Params, &params)
+		if params.Cursor == "" {
+			return ListToolsResult{Tools: []*ToolDefinition{{Name: "add"}}, NextCursor: "page2"}
+		}
+		return ListToolsResult{Tools: []*ToolDefinition{{Name: "fail"}}}
+	case MethodToolsCall:
+		var params struct {
+			Name      string `json:"name"`
+			Arguments struct{ A, B int }
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		if params.Name == "fail" {
+			return CallToolResult{Content: []Content{Text("boom")}, IsError: true}
+		}
+		sum := map[string]int{"sum": params.Arguments.A + params.Arguments.B}
+		return CallToolResult{Content: []Content{Text(fmt.Sprint(sum["sum"]))}, StructuredContent: sum}
+	case MethodPing:
+		return EmptyResult{}
+	}
+	return nil
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	s.headers = append(s.headers, r.Header.Clone())
+	s.methods = append(s.methods, req.Method)
+	s.mu.Unlock()
+
+	if req.IsNotification() {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if s.legacy && req.Method == MethodDiscover {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(UnsupportedVersion(req.ID, r.Header.Get(HeaderProtocolVersion)))
+		return
+	}
+	w.Header().Set(HeaderSessionID, "session-1")
+
+	response := Result(req.ID, s.handle(&req))
+	if !s.stream || req.Method != MethodToolsCall {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	var params CallToolParams
+	_ = json.Unmarshal(req.Params, &params)
+	w.Header().Set("Content-Type", "text/event-stream")
+	for i := 1; i <= 2; i++ {
+		progress, _ := json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"method":  MethodProgress,
+			"params":  ProgressParams{ProgressToken: params.Meta.ProgressToken, Progress: float64(i), Total: 2},
+		})
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", progress)
+	}
+	raw, _ := json.Marshal(response)
+	fmt.Fprintf(w, "data: %s\n\n", raw)
+}
+
+func TestClientNegotiatesModernVersion(t *testing.T) {
+	server := &fakeServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := NewHTTPClient(ts.URL, ClientConfig{Token: "t0k"})
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// An unknown future revision advertised by the server must be ignored.
+	if c.Version != Version20260728 {
+		t.Errorf("expected %s, got %s", Version20260728, c.Version)
+	}
+	if c.ServerInfo == nil || c.ServerInfo.Name != "fake" || c.Instructions != "be nice" {
+		t.Errorf("server details not captured: %+v %q", c.ServerInfo, c.Instructions)
+	}
+
+	var out struct{ Sum int }
+	if err := c.CallToolInto(context.Background(), "add", map[string]int{"a": 2, "b": 3}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Sum != 5 {
+		t.Errorf("expected 5, got %d", out.Sum)
+	}
+
+	last := server.headers[len(server.headers)-1]
+	if last.Get("Authorization") != "Bearer t0k" {
+		t.Errorf("bearer token not sent: %q", last.Get("Authorization"))
+	}
+	if last.Get(HeaderMethod) != MethodToolsCall || last.Get(HeaderName) != "add" {
+		t.Errorf("routing headers not mirrored: %v", last)
+	}
+	if last.Get(HeaderSessionID) != "session-1" {
+		t.Errorf("session id not echoed: %q", last.Get(HeaderSessionID))
+	}
+}
+
+func TestClientFallsBackToInitialize(t *testing.T) {
+	server := &fakeServer{legacy: true}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := NewHTTPClient(ts.URL)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != Version20250618 {
+		t.Errorf("expected the server's choice %s, got %s", Version20250618, c.Version)
+	}
+	want := []string{MethodDiscover, MethodInitialize, MethodInitialized}
+	if strings.Join(server.methods, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, server.methods)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.headers[len(server.headers)-1].Get(HeaderProtocolVersion); got != Version20250618 {
+		t.Errorf("expected negotiated version header, got %q", got)
+	}
+}
+
+func TestClientListToolsFollowsCursor(t *testing.T) {
+	ts := httptest.NewServer(&fakeServer{})
+	defer ts.Close()
+
+	c := NewHTTPClient(ts.URL)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tools, err := c.ListTools(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 2 || tools[0].Name != "add" || tools[1].Name != "fail" {
+		t.Errorf("expected both pages, got %+v", tools)
+	}
+}
+
+func TestClientToolErrorIsReturned(t *testing.T) {
+	ts := httptest.NewServer(&fakeServer{})
+	defer ts.Close()
+
+	c := NewHTTPClient(ts.URL)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.CallTool(context.Background(), "fail", nil)
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) {
+		t.Fatalf("expected a ToolError, got %v", err)
+	}
+	if result == nil || !result.IsError || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("unexpected result %+v / %v", result, err)
+	}
+}
+
+func TestClientReadsProgressFromEventStream(t *testing.T) {
+	ts := httptest.NewServer(&fakeServer{stream: true})
+	defer ts.Close()
+
+	var progress []float64
+	c := NewHTTPClient(ts.URL, ClientConfig{OnProgress: func(p ProgressParams) {
+		progress = append(progress, p.Progress)
+	}})
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var out struct{ Sum int }
+	if err := c.CallToolInto(context.Background(), "add", map[string]int{"a": 1, "b": 1}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Sum != 2 {
+		t.Errorf("expected 2, got %d", out.Sum)
+	}
+	if len(progress) != 2 || progress[1] != 2 {
+		t.Errorf("expected two progress reports, got %v", progress)
+	}
+}
+
+func TestClientRequiresConnect(t *testing.T) {
+	c := NewHTTPClient("http://127.0.0.1:1")
+	if _, err := c.ListTools(context.Background()); err == nil {
+		t.Error("expected an error before Connect")
+	}
+}
+
+func TestClientOverStdio(t *testing.T) {
+	server := &fakeServer{legacy: true}
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+
+	// The server side of the pipe: one JSON-RPC message per line, with a
+	// progress notification ahead of every tool result.
+	go func() {
+		scanner := bufio.NewScanner(serverIn)
+		for scanner.Scan() {
+			var req Request
+			if json.Unmarshal(scanner.Bytes(), &req) != nil || req.IsNotification() {
+				continue
+			}
+			if req.Method == MethodDiscover {
+				raw, _ := json.Marshal(Failure(req.ID, CodeMethodNotFound, "Method not found"))
+				fmt.Fprintf(serverOut, "%s\n", raw)
+				continue
+			}
+			if req.Method == MethodToolsCall {
+				var params CallToolParams
+				_ = json.Unmarshal(req.Params, &params)
+				raw, _ := json.Marshal(map[string]any{
+					"jsonrpc": "2.0",
+					"method":  MethodProgress,
+					"params":  ProgressParams{ProgressToken: params.Meta.ProgressToken, Progress: 1},
+				})
+				fmt.Fprintf(serverOut, "%s\n", raw)
+			}
+			raw, _ := json.Marshal(Result(req.ID, server.handle(&req)))
+			fmt.Fprintf(serverOut, "%s\n", raw)
+		}
+		serverOut.Close()
+	}()
+
+	progressed := make(chan struct{}, 1)
+	c := NewClient(NewStreamTransport(clientIn, clientOut, clientOut.Close), ClientConfig{
+		Timeout:    5 * time.Second,
+		OnProgress: func(ProgressParams) { progressed <- struct{}{} },
+	})
+	defer c.Close()
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != Version20250618 {
+		t.Errorf("expected %s, got %s", Version20250618, c.Version)
+	}
+	var out struct{ Sum int }
+	if err := c.CallToolInto(context.Background(), "add", map[string]int{"a": 4, "b": 5}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Sum != 9 {
+		t.Errorf("expected 9, got %d", out.Sum)
+	}
+	select {
+	case <-progressed:
+	default:
+		t.Error("expected a progress report over stdio")
+	}
+}
@@ -0,0 +1,493 @@
+package mcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getevo/json"
+)
+
+// WellKnownProtectedResource is the path of the OAuth 2.0 Protected Resource
+// Metadata document (RFC 9728) an MCP server publishes so clients can find
+// its authorization server.
+const WellKnownProtectedResource = "/.well-known/oauth-protected-resource"
+
+// ProtectedResourceMetadata is the RFC 9728 metadata document.
+type ProtectedResourceMetadata struct {
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported"`
+	ResourceName           string   `json:"resource_name,omitempty"`
+}
+
+// Claims are the validated claims of a JWT access token.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	ClientID  string
+	Scopes    []string
+
+	// Raw holds every claim of the token, including the ones above.
+	Raw map[string]any
+}
+
+// HasScope reports whether the token was granted scope.
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenError describes why an access token was refused. It maps to the
+// `invalid_token` error of RFC 6750.
+type TokenError struct {
+	Description string
+}
+
+// Error implements the error interface.
+func (e *TokenError) Error() string {
+	return "mcp: invalid access token: " + e.Description
+}
+
+func invalidToken(format string, args ...any) error {
+	return &TokenError{Description: fmt.Sprintf(format, args...)}
+}
+
+// TokenValidator validates JWT access tokens issued by an OAuth 2.1
+// authorization server, verifying the signature against the server's JWKS and
+// checking issuer, audience and expiry.
+//
+// Keys are cached. An unknown key id triggers a refresh, at most once per
+// RefreshInterval, so that key rotation is picked up without a restart.
+type TokenValidator struct {
+	// Issuers lists the accepted `iss` values.
+	Issuers []string
+
+	// Audience is the canonical URI of this resource server. A token whose
+	// `aud` does not contain it was issued for somebody else and is refused.
+	Audience string
+
+	// JWKSURL is where the signing keys are published. When empty it is read
+	// from the authorization server metadata of the first issuer.
+	JWKSURL string
+
+	// Client fetches metadata and keys. http.DefaultClient is used when nil.
+	Client HTTPDoer
+
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+
+	// RefreshInterval is the minimum time between two key fetches. It
+	// defaults to one minute.
+	RefreshInterval time.Duration
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	fetched  time.Time
+	fetching *jwksFetch
+	now      func() time.Time
+}
+
+// Validate verifies token and returns its claims. Every refusal is a
+// *TokenError except a failure to fetch the signing keys.
+func (v *TokenValidator) Validate(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("not a JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+		Typ string `json:"typ"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidToken("malformed header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed signature")
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, invalidToken("malformed claims")
+	}
+	claims := claimsFrom(raw)
+	if err := v.check(claims, raw); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *TokenValidator) check(claims *Claims, raw map[string]any) error {
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+
+	if claims.ExpiresAt.IsZero() {
+		return invalidToken("missing exp")
+	}
+	if now.After(claims.ExpiresAt.Add(v.Leeway)) {
+		return invalidToken("token expired")
+	}
+	if nbf, ok := raw["nbf"].(float64); ok && now.Add(v.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return invalidToken("token not yet valid")
+	}
+
+	issued := false
+	for _, issuer := range v.Issuers {
+		if strings.TrimSuffix(issuer, "/") == strings.TrimSuffix(claims.Issuer, "/") {
+			issued = true
+			break
+		}
+	}
+	if !issued {
+		return invalidToken("unexpected issuer %q", claims.Issuer)
+	}
+
+	for _, aud := range claims.Audience {
+		if strings.TrimSuffix(aud, "/") == strings.TrimSuffix(v.Audience, "/") {
+			return nil
+		}
+	}
+	return invalidToken("token was not issued for %s", v.Audience)
+}
+
+func claimsFrom(raw map[string]any) *Claims {
+	c := &Claims{Raw: raw}
+	c.Issuer, _ = raw["iss"].(string)
+	c.Subject, _ = raw["sub"].(string)
+	c.ClientID, _ = raw["client_id"].(string)
+	if c.ClientID == "" {
+		c.ClientID, _ = raw["azp"].(string)
+	}
+	if exp, ok := raw["exp"].(float64); ok {
+		c.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	switch aud := raw["aud"].(type) {
+	case string:
+		c.Audience = []string{aud}
+	case []any:
+		for _, item := range aud {
+			if s, ok := item.(string); ok {
+				c.Audience = append(c.Audience, s)
+			}
+		}
+	}
+	// RFC 9068 uses a space separated `scope`; some servers send `scp` as a
+	// list instead.
+	switch scope := raw["scope"].(type) {
+	case string:
+		c.Scopes = strings.Fields(scope)
+	}
+	if scp, ok := raw["scp"].([]any); ok && len(c.Scopes) == 0 {
+		for _, item := range scp {
+			if s, ok := item.(string); ok {
+				c.Scopes = append(c.Scopes, s)
+			}
+		}
+	}
+	return c
+}
+
+// key returns the public key for kid, fetching the key set when it is not
+// cached yet or when kid is unknown.
+func (v *TokenValidator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	if key, ok := v.lookup(kid); ok {
+		v.mu.Unlock()
+		return key, nil
+	}
+	interval := v.RefreshInterval
+	if interval == 0 {
+		interval = time.Minute
+	}
+	if v.keys != nil && time.Since(v.fetched) < interval {
+		v.mu.Unlock()
+		return nil, invalidToken("unknown signing key %q", kid)
+	}
+	// The keys are fetched without holding the lock, once for all the
+	// tokens waiting for them.
+	call := v.fetching
+	if call == nil {
+		call = &jwksFetch{done: make(chan struct{})}
+		v.fetching = call
+		url := v.JWKSURL
+		v.mu.Unlock()
+
+		keys, url, err := v.fetch(ctx, url)
+		v.mu.Lock()
+		if err == nil {
+			v.keys, v.fetched, v.JWKSURL = keys, time.Now(), url
+		}
+		call.err = err
+		v.fetching = nil
+		close(call.done)
+		v.mu.Unlock()
+	} else {
+		v.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, invalidToken("unknown signing key %q", kid)
+}
+
+// jwksFetch is a key set fetch in flight.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func (v *TokenValidator) lookup(kid string) (crypto.PublicKey, bool) {
+	if key, ok := v.keys[kid]; ok {
+		return key, true
+	}
+	// A token without kid is acceptable only when there is a single key.
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// fetch downloads the key set published at url, discovering the URL from
+// the first issuer when empty, and returns the keys with the URL.
+func (v *TokenValidator) fetch(ctx context.Context, url string) (map[string]crypto.PublicKey, string, error) {
+	if url == "" {
+		if len(v.Issuers) == 0 {
+			return nil, "", errors.New("mcp: no JWKS URL and no issuer to discover it from")
+		}
+		discovered, err := v.discoverJWKS(ctx, v.Issuers[0])
+		if err != nil {
+			return nil, "", err
+		}
+		url = discovered
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, url, &set); err != nil {
+		return nil, "", fmt.Errorf("mcp: unable to fetch JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, url, nil
+}
+
+// discoverJWKS reads jwks_uri from the issuer's RFC 8414 metadata, falling back
+// to the OpenID Connect discovery document.
+func (v *TokenValidator) discoverJWKS(ctx context.Context, issuer string) (string, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	var lastErr error
+	for _, suffix := range []string{"/.well-known/oauth-authorization-server", "/.well-known/openid-configuration"} {
+		var metadata struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(ctx, issuer+suffix, &metadata); err != nil {
+			lastErr = err
+			continue
+		}
+		if metadata.JWKSURI != "" {
+			return metadata.JWKSURI, nil
+		}
+	}
+	return "", fmt.Errorf("mcp: unable to discover jwks_uri of %s: %v", issuer, lastErr)
+}
+
+func (v *TokenValidator) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Status: resp.StatusCode, Body: string(body)}
+	}
+	return json.Unmarshal(body, dst)
+}
+
+// jwk is one entry of a JSON Web Key Set (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("malformed Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// verifySignature checks a JWS signature. Only asymmetric algorithms are
+// accepted: a resource server never shares a secret with the issuer, and
+// accepting "none" or HMAC would let anyone mint tokens.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var h hash.Hash
+	var id crypto.Hash
+	switch alg[len(alg)-min(len(alg), 3):] {
+	case "256":
+		h, id = sha256.New(), crypto.SHA256
+	case "384":
+		h, id = sha512.New384(), crypto.SHA384
+	case "512":
+		h, id = sha512.New(), crypto.SHA512
+	}
+
+	switch {
+	case alg == "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if ok && ed25519.Verify(pub, signed, signature) {
+			return nil
+		}
+	case h != nil && strings.HasPrefix(alg, "RS"):
+		pub, ok := key.(*rsa.PublicKey)
+		h.Write(signed)
+		if ok && rsa.VerifyPKCS1v15(pub, id, h.Sum(nil), signature) == nil {
+			return nil
+		}
+	case h != nil && strings.HasPrefix(alg, "PS"):
+		pub, ok := key.(*rsa.PublicKey)
+		h.Write(signed)
+		if ok && rsa.VerifyPSS(pub, id, h.Sum(nil), signature, nil) == nil {
+			return nil
+		}
+	case h != nil && strings.HasPrefix(alg, "ES"):
+		// each algorithm is bound to one curve, and r and s are padded to
+		// its size
+		pub, ok := key.(*ecdsa.PublicKey)
+		curve := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}[alg]
+		if !ok || curve == nil || pub.Curve != curve || len(signature) != 2*((curve.Params().BitSize+7)/8) {
+			break
+		}
+		h.Write(signed)
+		half := len(signature) / 2
+		r := new(big.Int).SetBytes(signature[:half])
+		s := new(big.Int).SetBytes(signature[half:])
+		if ecdsa.Verify(pub, h.Sum(nil), r, s) {
+			return nil
+		}
+	default:
+		return invalidToken("unsupported algorithm %q", alg)
+	}
+	return invalidToken("bad signature")
+}
+
+func decodeSegment(segment string, dst any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dst)
+}
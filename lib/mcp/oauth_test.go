@@ -0,0 +1,263 @@
+package mcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getevo/json"
+)
+
+const (
+	testIssuer   = "https://auth.example.com"
+	testAudience = "https://api.example.com/mcp"
+)
+
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	fetches atomic.Int32
+	server  *httptest.Server
+
+	// while stalled, the key set is only served once released is closed
+	stalled  atomic.Bool
+	released chan struct{}
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	k := &testKeys{released: make(chan struct{})}
+	var err error
+	if k.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if k.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": k.server.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		k.fetches.Add(1)
+		if k.stalled.Load() {
+			<-k.released
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64(k.rsa.N.Bytes()), "e": b64(big.NewInt(int64(k.rsa.E)).Bytes())},
+			{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(k.ec.X.FillBytes(make([]byte, 32))), "y": b64(k.ec.Y.FillBytes(make([]byte, 32)))},
+		}})
+	})
+	k.server = httptest.NewServer(mux)
+	t.Cleanup(k.server.Close)
+	return k
+}
+
+func (k *testKeys) validator() *TokenValidator {
+	return &TokenValidator{Issuers: []string{testIssuer}, Audience: testAudience, JWKSURL: k.server.URL + "/jwks"}
+}
+
+func (k *testKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "at+jwt"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "ES384":
+		// the P-256 key with the hash of ES384
+		var r, s *big.Int
+		digest := sha512.Sum384([]byte(signed))
+		r, s, err = ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		signature = append(r.FillBytes(make([]byte, 48)), s.FillBytes(make([]byte, 48))...)
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":       testIssuer,
+		"sub":       "user-42",
+		"aud":       []string{testAudience},
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"scope":     "invoice.read invoice.write",
+		"client_id": "cli",
+	}
+}
+
+func TestTokenValidatorAcceptsValidTokens(t *testing.T) {
+	k := newTestKeys(t)
+	v := k.validator()
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa1", "ES256": "ec1"}[alg]
+		claims, err := v.Validate(context.Background(), k.sign(t, alg, kid, validClaims()))
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if claims.Subject != "user-42" || claims.ClientID != "cli" || !claims.HasScope("invoice.write") || claims.HasScope("admin") {
+			t.Errorf("%s: unexpected claims %+v", alg, claims)
+		}
+	}
+	if k.fetches.Load() != 1 {
+		t.Errorf("expected the key set to be cached, fetched %d times", k.fetches.Load())
+	}
+}
+
+func TestTokenValidatorRejectsBadTokens(t *testing.T) {
+	k := newTestKeys(t)
+
+	mutate := func(change func(map[string]any)) map[string]any {
+		c := validClaims()
+		change(c)
+		return c
+	}
+	cases := map[string]string{
+		"expired":       k.sign(t, "RS256", "rsa1", mutate(func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() })),
+		"no exp":        k.sign(t, "RS256", "rsa1", mutate(func(c map[string]any) { delete(c, "exp") })),
+		"not yet valid": k.sign(t, "RS256", "rsa1", mutate(func(c map[string]any) { c["nbf"] = time.Now().Add(time.Hour).Unix() })),
+		"wrong issuer":  k.sign(t, "RS256", "rsa1", mutate(func(c map[string]any) { c["iss"] = "https://evil.example" })),
+		"wrong aud":     k.sign(t, "RS256", "rsa1", mutate(func(c map[string]any) { c["aud"] = "https://other.example/mcp" })),
+		"hmac":          k.sign(t, "HS256", "rsa1", validClaims()),
+		"unknown kid":   k.sign(t, "RS256", "nope", validClaims()),
+		"key mismatch":  k.sign(t, "RS256", "ec1", validClaims()),
+		"garbage":       "not.a.token",
+	}
+	cases["curve mismatch"] = k.sign(t, "ES384", "ec1", validClaims())
+	padded := strings.Split(k.sign(t, "ES256", "ec1", validClaims()), ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(padded[2])
+	signature = append(append([]byte{0}, signature[:32]...), append([]byte{0}, signature[32:]...)...)
+	padded[2] = base64.RawURLEncoding.EncodeToString(signature)
+	cases["padded signature"] = strings.Join(padded, ".")
+	tampered := strings.Split(k.sign(t, "RS256", "rsa1", validClaims()), ".")
+	payload, _ := json.Marshal(mutate(func(c map[string]any) { c["scope"] = "admin" }))
+	tampered[1] = base64.RawURLEncoding.EncodeToString(payload)
+	cases["tampered"] = strings.Join(tampered, ".")
+
+	v := k.validator()
+	for name, token := range cases {
+		_, err := v.Validate(context.Background(), token)
+		var tokenErr *TokenError
+		if !errors.As(err, &tokenErr) {
+			t.Errorf("%s: expected a TokenError, got %v", name, err)
+		}
+	}
+}
+
+func TestTokenValidatorDiscoversJWKS(t *testing.T) {
+	k := newTestKeys(t)
+	v := &TokenValidator{Issuers: []string{k.server.URL}, Audience: testAudience}
+
+	claims := validClaims()
+	claims["iss"] = k.server.URL
+	if _, err := v.Validate(context.Background(), k.sign(t, "RS256", "rsa1", claims)); err != nil {
+		t.Fatal(err)
+	}
+	if v.JWKSURL != k.server.URL+"/jwks" {
+		t.Errorf("expected jwks_uri from metadata, got %q", v.JWKSURL)
+	}
+}
+
+func TestTokenValidatorRefreshesOnUnknownKidAtMostOncePerInterval(t *testing.T) {
+	k := newTestKeys(t)
+	v := k.validator()
+
+	for i := 0; i < 3; i++ {
+		_, _ = v.Validate(context.Background(), k.sign(t, "RS256", "rotated", validClaims()))
+	}
+	if k.fetches.Load() != 1 {
+		t.Errorf("expected a single fetch within the refresh interval, got %d", k.fetches.Load())
+	}
+}
+
+func TestTokenValidatorFetchesKeysOutsideTheLock(t *testing.T) {
+	k := newTestKeys(t)
+	v := k.validator()
+	v.RefreshInterval = time.Nanosecond
+	if _, err := v.Validate(context.Background(), k.sign(t, "RS256", "rsa1", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+
+	var release sync.Once
+	t.Cleanup(func() { release.Do(func() { close(k.released) }) })
+	k.stalled.Store(true)
+	rotated := k.sign(t, "RS256", "rotated", validClaims())
+	known := k.sign(t, "RS256", "rsa1", validClaims())
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = v.Validate(context.Background(), rotated)
+		}()
+	}
+	for k.fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// a known key is served while the key set is being fetched
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.Validate(context.Background(), known)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("validation waited for the key set fetch")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	release.Do(func() { close(k.released) })
+	wg.Wait()
+	if k.fetches.Load() != 2 {
+		t.Errorf("expected the waiting tokens to share the fetch, got %d fetches", k.fetches.Load())
+	}
+}
+
+func TestTokenValidatorLeeway(t *testing.T) {
+	k := newTestKeys(t)
+	v := k.validator()
+	v.Leeway = time.Minute
+	v.now = func() time.Time { return time.Now().Add(time.Hour + 30*time.Second) }
+
+	if _, err := v.Validate(context.Background(), k.sign(t, "RS256", "rsa1", validClaims())); err != nil {
+		t.Errorf("expected the token to pass within the leeway, got %v", err)
+	}
+}
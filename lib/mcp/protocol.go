@@ -1,9 +1,10 @@
 // Package mcp implements the wire protocol of the Model Context Protocol (MCP)
-// over Streamable HTTP, independent of any transport or web framework.
+// over Streamable HTTP, independent of any web framework, together with a
+// client for calling remote MCP servers (see Client).
 //
 // The package is deliberately free of dependencies on the root evo package so
-// that the root package can import it. Transport wiring, tool registration and
-// authentication live in the root package (see evo.mcp.go).
+// that the root package can import it. Server-side wiring, tool registration
+// and authentication live in the root package (see evo.mcp.go).
 //
 // Two protocol eras are supported:
 //
@@ -84,6 +85,7 @@ const (
 	MethodToolsList   = "tools/list"
 	MethodToolsCall   = "tools/call"
 	MethodPing        = "ping"
+	MethodProgress    = "notifications/progress"
 )
 
 // HTTP headers defined by the Streamable HTTP transport.
@@ -178,6 +180,10 @@ type Meta struct {
 	ClientInfo         *Implementation `json:"io.modelcontextprotocol/clientInfo,omitempty"`
 	ClientCapabilities map[string]any  `json:"io.modelcontextprotocol/clientCapabilities,omitempty"`
 	ServerInfo         *Implementation `json:"io.modelcontextprotocol/serverInfo,omitempty"`
+
+	// ProgressToken asks the server to report progress of this request as
+	// notifications/progress messages carrying the same token.
+	ProgressToken any `json:"progressToken,omitempty"`
 }
 
 // Implementation identifies a client or server by name and version.
@@ -242,17 +248,25 @@ type ToolDefinition struct {
 	Annotations  *Annotations `json:"annotations,omitempty"`
 }
 
+// ListToolsParams are the params of a `tools/list` request.
+type ListToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+	Meta   *Meta  `json:"_meta,omitempty"`
+}
+
 // ListToolsResult answers a `tools/list` request. ResultType is populated only
-// for modern clients.
+// for modern clients. NextCursor is set when the server paginates.
 type ListToolsResult struct {
 	ResultType string            `json:"resultType,omitempty"`
 	Tools      []*ToolDefinition `json:"tools"`
+	NextCursor string            `json:"nextCursor,omitempty"`
 }
 
 // CallToolParams are the params of a `tools/call` request.
 type CallToolParams struct {
 	Name      string          `json:"name"`
 	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Meta      *Meta           `json:"_meta,omitempty"`
 }
 
 // Content is one unstructured content block of a tool result. Only the fields
@@ -297,6 +311,15 @@ type CallToolResult struct {
 	IsError           bool      `json:"isError,omitempty"`
 }
 
+// ProgressParams are the params of a `notifications/progress` message. Total
+// is zero when the sender does not know it.
+type ProgressParams struct {
+	ProgressToken any     `json:"progressToken"`
+	Progress      float64 `json:"progress"`
+	Total         float64 `json:"total,omitempty"`
+	Message       string  `json:"message,omitempty"`
+}
+
 // EmptyResult answers `ping`, which carries no payload.
 type EmptyResult struct {
 	ResultType string `json:"resultType,omitempty"`
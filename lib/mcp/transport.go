@@ -0,0 +1,417 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/getevo/json"
+)
+
+// Message is any JSON-RPC 2.0 message a client can receive: a response to one
+// of its requests, or a notification or request the server initiated. Result
+// is kept raw so the caller decodes it into the shape it expects.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      any             `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// IsResponse reports whether the message answers a request rather than
+// initiating one.
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && m.ID != nil
+}
+
+// Transport carries JSON-RPC messages between a Client and one server.
+//
+// Send delivers req under the negotiated protocol revision and blocks until the
+// matching response arrives. Messages the server sends in the meantime, such as
+// progress notifications, are handed to notify. A notification (req without an
+// id) returns a nil message once it has been delivered.
+type Transport interface {
+	Send(ctx context.Context, version string, req *Request, notify func(*Message)) (*Message, error)
+	Close() error
+}
+
+// StatusError is returned by HTTPTransport when the server refuses the
+// credentials (401 or 403), or answers with another non-2xx status and no
+// JSON-RPC error in the body.
+type StatusError struct {
+	Status int
+	Body   string
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("mcp: server answered HTTP %d: %s", e.Status, strings.TrimSpace(e.Body))
+}
+
+// HTTPDoer is the subset of *http.Client a transport needs. Tests substitute an
+// in-process implementation to reach a server without opening a socket.
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+var _ HTTPDoer = (*http.Client)(nil)
+
+// HTTPTransport speaks the Streamable HTTP transport: every message is a POST
+// to one endpoint, answered with plain JSON or with an SSE stream that ends in
+// the response.
+type HTTPTransport struct {
+	// URL is the MCP endpoint, for example https://host/mcp.
+	URL string
+
+	// Token, when set, is sent as "Authorization: Bearer <token>".
+	Token string
+
+	// Headers are added to every request.
+	Headers map[string]string
+
+	// Client performs the requests. http.DefaultClient is used when nil.
+	Client HTTPDoer
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+// NewHTTPTransport returns a transport for the endpoint at url.
+func NewHTTPTransport(url string) *HTTPTransport {
+	return &HTTPTransport{URL: url}
+}
+
+// Send implements Transport.
+func (t *HTTPTransport) Send(ctx context.Context, version string, req *Request, notify func(*Message)) (*Message, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: unable to encode request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	if t.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	for key, value := range t.Headers {
+		httpReq.Header.Set(key, value)
+	}
+	if version != "" {
+		httpReq.Header.Set(HeaderProtocolVersion, version)
+	}
+	// The modern transport mirrors routing information into headers so that
+	// a gateway can act on it without parsing the body.
+	if IsModern(version) {
+		httpReq.Header.Set(HeaderMethod, req.Method)
+		if req.Method == MethodToolsCall {
+			var params CallToolParams
+			_ = json.Unmarshal(req.Params, &params)
+			httpReq.Header.Set(HeaderName, encodeHeader(params.Name))
+		}
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		httpReq.Header.Set(HeaderSessionID, t.sessionID)
+	}
+	t.mu.Unlock()
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if id := resp.Header.Get(HeaderSessionID); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		raw, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{Status: resp.StatusCode, Body: string(raw)}
+	}
+
+	if req.IsNotification() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode >= 300 {
+			return nil, &StatusError{Status: resp.StatusCode}
+		}
+		return nil, nil
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return readEventStream(resp.Body, req.ID, notify)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var msg Message
+	if err := json.Unmarshal(raw, &msg); err != nil || (msg.Result == nil && msg.Error == nil) {
+		if resp.StatusCode >= 300 {
+			return nil, &StatusError{Status: resp.StatusCode, Body: string(raw)}
+		}
+		return nil, fmt.Errorf("mcp: malformed response: %s", strings.TrimSpace(string(raw)))
+	}
+	return &msg, nil
+}
+
+// Close implements Transport. The HTTP transport holds no connection of its
+// own, so closing only forgets the session.
+func (t *HTTPTransport) Close() error {
+	t.mu.Lock()
+	t.sessionID = ""
+	t.mu.Unlock()
+	return nil
+}
+
+// readEventStream consumes an SSE response until the message answering id
+// arrives. Every other message on the stream goes to notify.
+func readEventStream(body io.Reader, id any, notify func(*Message)) (*Message, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var data []string
+	dispatch := func() *Message {
+		if len(data) == 0 {
+			return nil
+		}
+		payload := strings.Join(data, "\n")
+		data = data[:0]
+		var msg Message
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			return nil
+		}
+		if msg.IsResponse() && sameID(msg.ID, id) {
+			return &msg
+		}
+		if notify != nil {
+			notify(&msg)
+		}
+		return nil
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if msg := dispatch(); msg != nil {
+				return msg, nil
+			}
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// event, id, retry and comment lines carry nothing a client needs.
+	}
+	if msg := dispatch(); msg != nil {
+		return msg, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("mcp: event stream ended without a response")
+}
+
+// StdioTransport speaks newline-delimited JSON-RPC over a pair of streams,
+// normally the stdin and stdout of a server subprocess.
+type StdioTransport struct {
+	writer io.Writer
+	closer func() error
+
+	mu      sync.Mutex
+	writeMu sync.Mutex
+	pending map[string]*pendingCall
+	err     error
+	done    chan struct{}
+}
+
+type pendingCall struct {
+	response chan *Message
+	notify   func(*Message)
+}
+
+// NewStdioTransport starts cmd and speaks to it over its stdin and stdout.
+// Anything the server writes to stderr goes wherever cmd.Stderr points.
+func NewStdioTransport(cmd *exec.Cmd) (*StdioTransport, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("mcp: unable to start %s: %w", cmd.Path, err)
+	}
+	return NewStreamTransport(stdout, stdin, func() error {
+		_ = stdin.Close()
+		return cmd.Wait()
+	}), nil
+}
+
+// NewStreamTransport speaks newline-delimited JSON-RPC, reading from r and
+// writing to w. closer, when not nil, runs on Close.
+func NewStreamTransport(r io.Reader, w io.Writer, closer func() error) *StdioTransport {
+	t := &StdioTransport{
+		writer:  w,
+		closer:  closer,
+		pending: map[string]*pendingCall{},
+		done:    make(chan struct{}),
+	}
+	go t.read(r)
+	return t
+}
+
+// read routes every incoming line to the call waiting for it.
+func (t *StdioTransport) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			continue
+		}
+
+		t.mu.Lock()
+		if msg.IsResponse() {
+			key := idKey(msg.ID)
+			if call, ok := t.pending[key]; ok {
+				delete(t.pending, key)
+				call.response <- &msg
+			}
+			t.mu.Unlock()
+			continue
+		}
+		// Progress carries the token of the request it belongs to, which this
+		// client always sets to the request id.
+		var target *pendingCall
+		if msg.Method == MethodProgress {
+			var params ProgressParams
+			_ = json.Unmarshal(msg.Params, &params)
+			target = t.pending[idKey(params.ProgressToken)]
+		}
+		t.mu.Unlock()
+		if target != nil && target.notify != nil {
+			target.notify(&msg)
+		}
+	}
+
+	t.mu.Lock()
+	t.err = scanner.Err()
+	if t.err == nil {
+		t.err = io.EOF
+	}
+	close(t.done)
+	t.mu.Unlock()
+}
+
+// Send implements Transport. The version is negotiated in-band on stdio, so it
+// is not used here.
+func (t *StdioTransport) Send(ctx context.Context, version string, req *Request, notify func(*Message)) (*Message, error) {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("mcp: unable to encode request: %w", err)
+	}
+
+	var call *pendingCall
+	if !req.IsNotification() {
+		call = &pendingCall{response: make(chan *Message, 1), notify: notify}
+		t.mu.Lock()
+		if t.err != nil {
+			t.mu.Unlock()
+			return nil, fmt.Errorf("mcp: server stream closed: %w", t.err)
+		}
+		t.pending[idKey(req.ID)] = call
+		t.mu.Unlock()
+	}
+
+	t.writeMu.Lock()
+	_, err = t.writer.Write(append(raw, '\n'))
+	t.writeMu.Unlock()
+	if err != nil {
+		t.forget(req.ID)
+		return nil, err
+	}
+	if call == nil {
+		return nil, nil
+	}
+
+	select {
+	case msg := <-call.response:
+		return msg, nil
+	case <-t.done:
+		t.forget(req.ID)
+		return nil, fmt.Errorf("mcp: server stream closed: %w", t.err)
+	case <-ctx.Done():
+		t.forget(req.ID)
+		return nil, ctx.Err()
+	}
+}
+
+func (t *StdioTransport) forget(id any) {
+	if id == nil {
+		return
+	}
+	t.mu.Lock()
+	delete(t.pending, idKey(id))
+	t.mu.Unlock()
+}
+
+// Close implements Transport.
+func (t *StdioTransport) Close() error {
+	if t.closer != nil {
+		return t.closer()
+	}
+	return nil
+}
+
+// idKey normalises a JSON-RPC id for comparison. Numbers decode as float64, so
+// an int64 sent and a float64 received must still match.
+func idKey(id any) string {
+	switch v := id.(type) {
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(id)
+}
+
+func sameID(a, b any) bool {
+	return idKey(a) == idKey(b)
+}
+
+// encodeHeader wraps a header value that cannot be sent as plain ASCII in the
+// =?base64?...?= sentinel the transport defines.
+func encodeHeader(value string) string {
+	for i := 0; i < len(value); i++ {
+		if value[i] < 0x20 || value[i] > 0x7e {
+			return "=?base64?" + base64.StdEncoding.EncodeToString([]byte(value)) + "?="
+		}
+	}
+	return value
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/getevo/evo/v2/lib/args"
 	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
 	"github.com/getevo/evo/v2/lib/log"
 	"gorm.io/gorm"
 )
@@ -42,7 +43,8 @@ func fromStatementToTable(stmt *gorm.Statement) ddlTable {
 		if strings.Contains(datatype, "enum") {
 			datatype = schema.CleanEnum(datatype)
 		} else {
-			datatype = strings.Split(datatype, " ")[0]
+			// decimal(10, 2) is a single type
+			datatype = strings.Split(strings.ReplaceAll(datatype, ", ", ","), " ")[0]
 		}
 
 		switch datatype {
@@ -52,6 +54,12 @@ func fromStatementToTable(stmt *gorm.Statement) ddlTable {
 			datatype = "bigint(20)"
 		case "datetime(3)":
 			datatype = "timestamp"
+		case "decimal":
+			datatype = types.DecimalType(field, "decimal")
+		case "point":
+			if schema.MySQLAtLeast("8.0.3", "") {
+				datatype = "point srid 4326"
+			}
 		case "longtext":
 			// GORM defaults string without size to longtext; use varchar(255) instead
 			if _, hasType := field.TagSettings["TYPE"]; !hasType {
@@ -118,6 +126,10 @@ func fromStatementToTable(stmt *gorm.Statement) ddlTable {
 			column.Collate = v
 		}
 
+		if v, ok := field.TagSettings["RENAMED_FROM"]; ok {
+			column.RenamedFrom = v
+		}
+
 		if _, ok := field.TagSettings["FULLTEXT"]; ok {
 			column.FullText = true
 		}
@@ -126,11 +138,21 @@ func fromStatementToTable(stmt *gorm.Statement) ddlTable {
 			column.OnUpdate = v
 		}
 
+		if v, ok := field.TagSettings["GENERATED"]; ok && v != "" {
+			column.Generated = v
+			_, column.Stored = field.TagSettings["STORED"]
+			column.Default = ""
+			column.AutoIncrement = false
+			if _, ok := field.TagSettings["NOT NULL"]; !ok && !field.PrimaryKey {
+				column.Nullable = true
+			}
+		}
+
 		var nullable = false
 		if _, ok := field.TagSettings["NULLABLE"]; ok {
 			nullable = true
 		}
-		if field.FieldType.Kind() == reflect.Ptr || nullable {
+		if (field.FieldType.Kind() == reflect.Ptr || nullable) && column.Generated == "" {
 			if _, ok := field.TagSettings["NOT NULL"]; !ok {
 				column.Nullable = true
 				if column.Type == "TIMESTAMP" && column.Default == "0000-00-00 00:00:00" {
@@ -149,7 +171,7 @@ func fromStatementToTable(stmt *gorm.Statement) ddlTable {
 			column.Nullable = true
 		}
 
-		if (column.Type == "TIMESTAMP" || column.Type == "timestamp") && column.Default == "" && !column.Nullable {
+		if (column.Type == "TIMESTAMP" || column.Type == "timestamp") && column.Default == "" && !column.Nullable && column.Generated == "" {
 			column.Default = "CURRENT_TIMESTAMP"
 		}
 
@@ -161,6 +183,10 @@ func fromStatementToTable(stmt *gorm.Statement) ddlTable {
 			})
 		}
 
+		if _, ok := field.TagSettings["SPATIAL"]; ok {
+			t.Index = append(t.Index, schema.SpatialIndex(column.Name, column, 64))
+		}
+
 		var r = field.IndirectFieldType
 		for r.Kind() == reflect.Ptr {
 			r = r.Elem()
@@ -181,12 +207,20 @@ func fromStatementToTable(stmt *gorm.Statement) ddlTable {
 
 	}
 
+	t.Checks = schema.ParseChecks(stmt, 64)
+	t.View, t.Materialized, t.IsView = schema.ViewOf(stmt.Model)
+
+	if index := schema.FullTextIndex(t.Name, t.Columns, 64); index != nil {
+		t.Index = append(t.Index, *index)
+	}
+
 	for _, index := range stmt.Schema.ParseIndexes() {
 
 		var idx = schema.Index{
 			Name:     schema.SafeIndexName(index.Name, 64),
 			Unique:   index.Class == "UNIQUE",
 			FullText: index.Class == "FULLTEXT",
+			Spatial:  index.Class == "SPATIAL",
 		}
 		var skip bool
 		for _, opt := range index.Fields {
@@ -204,6 +238,17 @@ func fromStatementToTable(stmt *gorm.Statement) ddlTable {
 		t.Index = append(t.Index, idx)
 	}
 
+	// MySQL only builds spatial indexes on NOT NULL columns
+	t.Index = slices.DeleteFunc(t.Index, func(index schema.Index) bool {
+		for _, c := range index.Columns {
+			if col := t.Columns.Find(c.Name); index.Spatial && col != nil && col.Nullable {
+				log.Error("spatial index on a nullable column, skipping index; add the not null tag", "table", t.Name, "column", c.Name, "index", index.Name)
+				return true
+			}
+		}
+		return false
+	})
+
 	return t
 }
 
@@ -216,13 +261,17 @@ type ddlTable struct {
 	Name       string
 	Charset    string
 	Collate    string
+	Checks     schema.Checks
+	// View is the SELECT statement of a view model, see schema.View
+	View         string
+	Materialized bool
+	IsView       bool
 }
 
 func getCreateQuery(t ddlTable) []string {
 	var queries []string
 	var query = "CREATE TABLE IF NOT EXISTS " + quote(t.Name) + "("
 	var primaryKeys []string
-	var fullTextIndexes []string
 	for idx := range t.Columns {
 		var field = t.Columns[idx]
 		query += "\r\n\t"
@@ -234,43 +283,54 @@ func getCreateQuery(t ddlTable) []string {
 		if idx < len(t.Columns)-1 {
 			query += ","
 		}
-		if t.Columns[idx].FullText {
-			fullTextIndexes = append(fullTextIndexes, quote(field.Name))
-		}
 	}
 	if len(primaryKeys) > 0 {
 		query += ","
 		query += "\r\n\t" + "PRIMARY KEY (" + strings.Join(primaryKeys, ",") + ")"
 	}
-	if len(fullTextIndexes) > 0 {
-		query += ","
-		query += "\r\n\t" + "FULLTEXT (" + strings.Join(fullTextIndexes, ",") + ")"
+	for _, check := range t.Checks {
+		query += ",\r\n\t" + checkDefinition(check)
 	}
 
 	query += "\r\n) DEFAULT CHARSET=" + t.Charset + " COLLATE=" + t.Collate + " ENGINE=" + t.Engine + " COMMENT '0.0.0';"
 	queries = append(queries, query)
 
 	for _, index := range t.Index {
-		query = "CREATE "
-		if index.Unique {
-			query += "UNIQUE "
-		}
-		if index.FullText {
-			query += "FULLTEXT "
-		}
-		var keys = index.Columns.Keys()
-		for idx := range keys {
-			keys[idx] = quote(keys[idx])
-		}
-		query += "INDEX `" + index.Name + "` ON `" + t.Name + "` (" + strings.Join(keys, ",") + ");"
-		queries = append(queries, query)
+		queries = append(queries, createIndexQuery(index, t.Name))
 	}
 	return queries
 }
 
+// createIndexQuery returns the CREATE INDEX statement of index.
+func createIndexQuery(index schema.Index, table string) string {
+	var query = "CREATE "
+	if index.Unique {
+		query += "UNIQUE "
+	}
+	if index.FullText {
+		query += "FULLTEXT "
+	}
+	if index.Spatial {
+		query += "SPATIAL "
+	}
+	var keys = index.Columns.Keys()
+	for idx := range keys {
+		keys[idx] = quote(keys[idx])
+	}
+	return query + "INDEX `" + index.Name + "` ON `" + table + "` (" + strings.Join(keys, ",") + ");"
+}
+
+// checkDefinition returns the definition of a CHECK constraint.
+func checkDefinition(check schema.Check) string {
+	return "CONSTRAINT " + quote(check.Name) + " CHECK (" + check.Expression + ")"
+}
+
 func getFieldQuery(field *schema.Column) string {
 	var query = quote(field.Name)
 	query += " " + fieldType(field.Type)
+	if field.Generated != "" {
+		return query + generatedQuery(field)
+	}
 	if field.AutoIncrement {
 		query += " AUTO_INCREMENT"
 	}
@@ -313,6 +373,54 @@ func getFieldQuery(field *schema.Column) string {
 	return query
 }
 
+// generatedQuery returns the definition of a generated column following its
+// type; MySQL expects the comment after the nullability there.
+func generatedQuery(field *schema.Column) string {
+	var query string
+	if len(field.Charset) > 0 {
+		query += " CHARACTER SET " + field.Charset
+	}
+	if len(field.Collate) > 0 {
+		query += " COLLATE " + field.Collate
+	}
+	query += " GENERATED ALWAYS AS (" + field.Generated + ")"
+	if field.Stored {
+		query += " STORED"
+	} else {
+		query += " VIRTUAL"
+	}
+	if field.Nullable {
+		query += " NULL"
+	} else {
+		query += " NOT NULL"
+	}
+	if len(field.Comment) > 0 {
+		query += " COMMENT " + strconv.Quote(field.Comment)
+	}
+	return query
+}
+
+// generatedDiff reports whether the generated column field no longer
+// matches the column r, which then has to be dropped and added again.
+func generatedDiff(field schema.Column, r *remoteColumn) (string, bool) {
+	var expression = getString(r.Generation)
+	if field.Generated == "" && expression == "" {
+		return "", false
+	}
+	if field.Generated == "" {
+		return fmt.Sprintf("-- column %s is no longer generated. old:%s", field.Name, expression), true
+	}
+	if expression == "" {
+		return fmt.Sprintf("-- column %s becomes generated. new:%s", field.Name, field.Generated), true
+	}
+	var extra = strings.ToUpper(r.Extra)
+	var stored = strings.Contains(extra, "STORED") || strings.Contains(extra, "PERSISTENT")
+	if stored != field.Stored || schema.NormalizeExpression(field.Generated) != schema.NormalizeExpression(expression) {
+		return fmt.Sprintf("-- column %s generated expression does not match. new:%s old:%s", field.Name, field.Generated, expression), true
+	}
+	return "", false
+}
+
 func getDiff(local ddlTable, remote remoteTable) []string {
 	var queries []string
 	var afterPK []string
@@ -328,6 +436,10 @@ func getDiff(local ddlTable, remote remoteTable) []string {
 		queries = append(queries, fmt.Sprintf("ALTER TABLE `%s` ENGINE=%s;", quote(local.Name), local.Engine))
 	}
 
+	var renames []string
+	renames, remote = renameColumns(local, remote)
+	queries = append(queries, renames...)
+
 	for idx := range local.Columns {
 		var field = local.Columns[idx]
 		if field.PrimaryKey {
@@ -342,6 +454,14 @@ func getDiff(local ddlTable, remote remoteTable) []string {
 			}
 			queries = append(queries, fmt.Sprintf("--  column %s does not exists", field.Name))
 			queries = append(queries, "ALTER TABLE "+quote(local.Name)+" ADD "+getFieldQuery(&field)+position+";")
+		} else if comment, changed := generatedDiff(field, r); changed {
+			var position = ""
+			if idx > 0 {
+				position = " AFTER " + quote(local.Columns[idx-1].Name)
+			}
+			queries = append(queries, comment)
+			queries = append(queries, "ALTER TABLE "+quote(local.Name)+" DROP COLUMN "+quote(field.Name)+";")
+			queries = append(queries, "ALTER TABLE "+quote(local.Name)+" ADD "+getFieldQuery(&field)+position+";")
 		} else {
 			var diff = false
 
@@ -350,7 +470,7 @@ func getDiff(local ddlTable, remote remoteTable) []string {
 				diff = true
 			}
 
-			if fieldType(strings.ToLower(field.Type)) != fieldType(strings.ToLower(r.ColumnType)) {
+			if comparableType(field.Type) != comparableType(r.ColumnType) {
 				queries = append(queries, fmt.Sprintf("-- column %s type does not match. new:%s old:%s", field.Name, fieldType(field.Type), strings.ToLower(r.ColumnType)))
 				diff = true
 			}
@@ -445,20 +565,13 @@ func getDiff(local ddlTable, remote remoteTable) []string {
 		queries = append(queries, "ALTER TABLE "+quote(local.Name)+" ADD PRIMARY KEY("+strings.Join(local.PrimaryKey.Keys(), ",")+");")
 	}
 	queries = append(queries, afterPK...)
+	renames, remote = renameIndexes(local, remote)
+	queries = append(queries, renames...)
 	for _, index := range local.Index {
 		var r = remote.Indexes.Find(index.Name)
 		if r == nil {
-			var query = "CREATE "
-			if index.Unique {
-				query += "UNIQUE "
-			}
-			var keys = index.Columns.Keys()
-			for idx := range keys {
-				keys[idx] = quote(keys[idx])
-			}
-			query += "INDEX `" + index.Name + "` ON `" + local.Name + "` (" + strings.Join(keys, ",") + ");"
 			queries = append(queries, "-- append not existing index")
-			queries = append(queries, query)
+			queries = append(queries, createIndexQuery(index, local.Name))
 		} else {
 			var changed = false
 			if r.Unique != index.Unique {
@@ -479,16 +592,7 @@ func getDiff(local ddlTable, remote remoteTable) []string {
 			}
 			if changed {
 				queries = append(queries, "DROP INDEX "+quote(index.Name)+" ON "+quote(local.Name)+";")
-				var query = "CREATE "
-				if index.Unique {
-					query += "UNIQUE "
-				}
-				var keys = index.Columns.Keys()
-				for idx := range keys {
-					keys[idx] = quote(keys[idx])
-				}
-				query += "INDEX `" + index.Name + "` ON `" + local.Name + "` (" + strings.Join(keys, ",") + ");"
-				queries = append(queries, query)
+				queries = append(queries, createIndexQuery(index, local.Name))
 			}
 		}
 
@@ -501,9 +605,56 @@ func getDiff(local ddlTable, remote remoteTable) []string {
 			}
 		}
 	}
+	return append(queries, checksDiff(local, remote)...)
+}
+
+// checksDiff adds the missing CHECK constraints of local, replaces the
+// changed ones and drops the ones created from a removed check tag.
+func checksDiff(local ddlTable, remote remoteTable) []string {
+	var queries []string
+	for _, check := range local.Checks {
+		var r = remote.Checks.Find(check.Name)
+		if r == nil {
+			queries = append(queries, fmt.Sprintf("-- check constraint %s does not exists", check.Name))
+			queries = append(queries, "ALTER TABLE "+quote(local.Name)+" ADD "+checkDefinition(check)+";")
+		} else if schema.NormalizeExpression(check.Expression) != schema.NormalizeExpression(r.Expression) {
+			queries = append(queries, fmt.Sprintf("-- check constraint %s does not match. new:%s old:%s", check.Name, check.Expression, r.Expression))
+			queries = append(queries, "ALTER TABLE "+quote(local.Name)+" DROP CONSTRAINT "+quote(r.Name)+";")
+			queries = append(queries, "ALTER TABLE "+quote(local.Name)+" ADD "+checkDefinition(check)+";")
+		}
+	}
+	for _, check := range remote.Checks {
+		if local.Checks.Find(check.Name) == nil && schema.ManagedCheck(check.Name) {
+			queries = append(queries, "-- drop unnecessary check constraint")
+			queries = append(queries, "ALTER TABLE "+quote(local.Name)+" DROP CONSTRAINT "+quote(check.Name)+";")
+		}
+	}
 	return queries
 }
 
+// getViewQuery creates or replaces the view local when its definition
+// differs from the one of the database, nil when it has none. MySQL has no
+// materialized views; they are created as plain views.
+func getViewQuery(local ddlTable, remote *remoteView, is remoteTables) []string {
+	if remote != nil && schema.NormalizeExpression(local.View) == schema.NormalizeExpression(remote.Definition) {
+		return nil
+	}
+	if is.GetTable(local.Name) != nil {
+		log.Warning("a table has the name of the view, skipping view", "view", local.Name)
+		return []string{fmt.Sprintf("-- table %s exists, drop it to create the view", local.Name)}
+	}
+	var queries []string
+	if local.Materialized {
+		queries = append(queries, "-- materialized views are not supported, creating a plain view")
+	}
+	if remote == nil {
+		queries = append(queries, fmt.Sprintf("-- view %s does not exists", local.Name))
+	} else {
+		queries = append(queries, fmt.Sprintf("-- view %s definition does not match", local.Name))
+	}
+	return append(queries, "CREATE OR REPLACE VIEW "+quote(local.Name)+" AS "+local.View+";")
+}
+
 func getConstraintsQuery(local ddlTable, constraints []remoteConstraint, is remoteTables) []string {
 	var queries []string
 	for idx := range local.Columns {
@@ -565,14 +716,8 @@ func generateMigration(db *gorm.DB, database string, stmts []*gorm.Statement, mo
 	// Detect engine
 	var ver string
 	db.Raw("SELECT VERSION();").Scan(&ver)
-	ver = strings.ToLower(ver)
-	switch {
-	case strings.Contains(ver, "mariadb"):
-		engine = "mariadb"
-	default:
-		engine = "mysql"
-	}
-	schema.SetConfig("mysql_engine", engine)
+	schema.SetMySQLServer(ver)
+	engine, _ = schema.GetConfig("mysql_engine")
 
 	// Introspect remote schema
 	var is remoteTables
@@ -614,9 +759,10 @@ func generateMigration(db *gorm.DB, database string, stmts []*gorm.Statement, mo
 		}
 		if _, ok := indexMap[item.Table+item.Name]; !ok {
 			indexMap[item.Table+item.Name] = remoteIndex{
-				Name:   item.Name,
-				Table:  item.Table,
-				Unique: !item.NonUnique,
+				Name:     item.Name,
+				Table:    item.Table,
+				Unique:   !item.NonUnique,
+				FullText: item.IndexType == "FULLTEXT",
 			}
 		}
 		var m = indexMap[item.Table+item.Name]
@@ -638,12 +784,44 @@ func generateMigration(db *gorm.DB, database string, stmts []*gorm.Statement, mo
 		}
 	}
 
+	var checks []remoteCheck
+	db.Raw(`SELECT TC.TABLE_NAME, CC.CONSTRAINT_NAME, CC.CHECK_CLAUSE
+		FROM information_schema.TABLE_CONSTRAINTS TC
+		JOIN information_schema.CHECK_CONSTRAINTS CC
+		  ON CC.CONSTRAINT_SCHEMA = TC.CONSTRAINT_SCHEMA AND CC.CONSTRAINT_NAME = TC.CONSTRAINT_NAME
+		WHERE TC.CONSTRAINT_TYPE = 'CHECK' AND TC.TABLE_SCHEMA = ?`, database).Scan(&checks)
+	for _, item := range checks {
+		if tbl := is.GetTable(item.Table); tbl != nil && tbl.Checks.Find(item.Name) == nil {
+			tbl.Checks = append(tbl.Checks, schema.Check{Name: item.Name, Expression: item.Expression})
+		}
+	}
+
+	var views []remoteView
+	db.Raw(`SELECT TABLE_NAME, VIEW_DEFINITION FROM information_schema.VIEWS WHERE TABLE_SCHEMA = ?`, database).Scan(&views)
+
+	// Rename tables declared with RenamedFrom() before anything refers to them
+	result.RenamedFrom = renameTables(stmts, is, constraints)
+
 	// Mark which tables exist
 	for _, t := range is {
 		result.TableExists[t.Table] = true
 	}
 
-	// Generate DDL for each model
+	// Point foreign keys at renamed columns before any model creates them, as
+	// a model may reference a column renamed on another one
+	var locals = make([]ddlTable, len(stmts))
+	for idx, stmt := range stmts {
+		if stmt.Schema == nil {
+			continue
+		}
+		locals[idx] = fromStatementToTable(stmt)
+		if tbl := is.GetTable(stmt.Schema.Table); tbl != nil {
+			renameConstraints(constraints, tbl.Table, schema.ColumnRenames(locals[idx].Columns, tbl.Columns.Keys()))
+		}
+	}
+
+	// Generate DDL for each model; views follow the tables they select from
+	var viewQueries []string
 	for idx, stmt := range stmts {
 		if stmt.Schema == nil {
 			continue
@@ -655,16 +833,33 @@ func generateMigration(db *gorm.DB, database string, stmts []*gorm.Statement, mo
 			}
 		}
 
-		local := fromStatementToTable(stmt)
+		local := locals[idx]
+		if local.IsView {
+			var remote *remoteView
+			for i := range views {
+				if views[i].Table == local.Name {
+					remote = &views[i]
+				}
+			}
+			if q := getViewQuery(local, remote, is); len(q) > 0 {
+				viewQueries = append(viewQueries, "\r\n\r\n-- Migrate View: "+stmt.Schema.ModelType.PkgPath()+"."+stmt.Schema.ModelType.Name()+"("+local.Name+")")
+				viewQueries = append(viewQueries, q...)
+			}
+			continue
+		}
 		tbl := is.GetTable(stmt.Schema.Table)
 
 		var q []string
+		if from, ok := result.RenamedFrom[local.Name]; ok {
+			q = append(q, fmt.Sprintf("-- table renamed from %s", from))
+			q = append(q, "RENAME TABLE "+quote(from)+" TO "+quote(local.Name)+";")
+		}
 		if tbl != nil {
 			tbl.Model = models[idx]
 			tbl.Reflect = reflect.ValueOf(tbl.Model)
-			q = getDiff(local, *tbl)
+			q = append(q, getDiff(local, *tbl)...)
 		} else {
-			q = getCreateQuery(local)
+			q = append(q, getCreateQuery(local)...)
 		}
 
 		result.Tail = append(result.Tail, getConstraintsQuery(local, constraints, is)...)
@@ -673,6 +868,7 @@ func generateMigration(db *gorm.DB, database string, stmts []*gorm.Statement, mo
 			result.Queries = append(result.Queries, q...)
 		}
 	}
+	result.Queries = append(result.Queries, viewQueries...)
 
 	return result
 }
@@ -696,6 +892,13 @@ func fieldType(t string) string {
 	return t
 }
 
+// comparableType returns t as information_schema reports it, without the
+// SRID attribute of spatial columns.
+func comparableType(t string) string {
+	t, _, _ = strings.Cut(fieldType(strings.ToLower(t)), " srid ")
+	return t
+}
+
 func getString(v *string) string {
 	if v == nil {
 		return ""
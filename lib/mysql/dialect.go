@@ -27,14 +27,29 @@ func (m *MySQLDialect) ReleaseMigrationLock(db *gorm.DB) {
 }
 
 func (m *MySQLDialect) BootstrapHistoryTable(db *gorm.DB) error {
-	return db.Exec(`CREATE TABLE IF NOT EXISTS ` + "`schema_migration`" + ` (
+	err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + "`schema_migration`" + ` (
   ` + "`id`" + ` BIGINT AUTO_INCREMENT PRIMARY KEY,
   ` + "`hash`" + ` CHAR(32) NOT NULL,
   ` + "`status`" + ` ENUM('success','failed') NOT NULL,
   ` + "`executed_queries`" + ` INT NOT NULL DEFAULT 0,
   ` + "`error_message`" + ` TEXT,
+  ` + "`migration_id`" + ` VARCHAR(255) NULL,
   ` + "`created_at`" + ` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 ) ENGINE=InnoDB;`).Error
+	if err != nil {
+		return err
+	}
+
+	// Tables created before versioned migrations lack migration_id.
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'schema_migration' AND COLUMN_NAME = 'migration_id'").
+		Scan(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return db.Exec("ALTER TABLE `schema_migration` ADD COLUMN `migration_id` VARCHAR(255) NULL AFTER `error_message`").Error
+	}
+	return nil
 }
 
 // MySQLDialect implements schema.Dialect for MySQL/MariaDB.
@@ -2,7 +2,6 @@ package mysql
 
 import (
 	"fmt"
-	"strings"
 
 	dbpkg "github.com/getevo/evo/v2/lib/db"
 	"github.com/getevo/evo/v2/lib/db/schema"
@@ -28,11 +27,7 @@ func (Driver) Open(config dbpkg.DriverConfig, gormConfig *gorm.Config) (*gorm.DB
 	// here to set the shared config used by types.JSON.GormValue and other helpers.
 	var ver string
 	db.Raw("SELECT VERSION()").Scan(&ver)
-	if strings.Contains(strings.ToLower(ver), "mariadb") {
-		schema.SetConfig("mysql_engine", "mariadb")
-	} else {
-		schema.SetConfig("mysql_engine", "mysql")
-	}
+	schema.SetMySQLServer(ver)
 	return db, nil
 }
 
@@ -0,0 +1,132 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"gorm.io/gorm"
+)
+
+// renameColumns returns the RENAME COLUMN statements for the pending
+// renamed_from tags of local, and a copy of remote in which those columns
+// already carry their new names so the rest of the diff sees them as existing.
+// Servers older than MySQL 8.0 and MariaDB 10.5.2 get CHANGE COLUMN with the
+// full column definition instead.
+func renameColumns(local ddlTable, remote remoteTable) ([]string, remoteTable) {
+	renames := schema.ColumnRenames(local.Columns, remote.Columns.Keys())
+	if len(renames) == 0 {
+		return nil, remote
+	}
+	var renameColumn = schema.MySQLAtLeast("8.0", "10.5.2")
+	var queries []string
+	for _, r := range renames {
+		queries = append(queries, fmt.Sprintf("-- column %s renamed from %s", r.To, r.From))
+		if renameColumn {
+			queries = append(queries, "ALTER TABLE "+quote(local.Name)+" RENAME COLUMN "+quote(r.From)+" TO "+quote(r.To)+";")
+		} else {
+			queries = append(queries, "ALTER TABLE "+quote(local.Name)+" CHANGE COLUMN "+quote(r.From)+" "+getFieldQuery(local.Columns.Find(r.To))+";")
+		}
+	}
+	remote.Columns = renameRemoteColumns(remote.Columns, renames)
+	remote.PrimaryKey = renameRemoteColumns(remote.PrimaryKey, renames)
+	var indexes = make(remoteIndexes, len(remote.Indexes))
+	for idx, index := range remote.Indexes {
+		index.Columns = renameRemoteColumns(index.Columns, renames)
+		indexes[idx] = index
+	}
+	remote.Indexes = indexes
+	return queries, remote
+}
+
+func renameRemoteColumns(columns remoteColumns, renames []schema.Rename) remoteColumns {
+	var result = make(remoteColumns, len(columns))
+	copy(result, columns)
+	for idx := range result {
+		for _, r := range renames {
+			if result[idx].Name == r.From {
+				result[idx].Name = r.To
+			}
+		}
+	}
+	return result
+}
+
+// renameIndexes returns the RENAME INDEX statements for remote indexes that
+// only differ from a model index by name, and a copy of remote using the new
+// names, so renamed columns and tables keep their indexes.
+func renameIndexes(local ddlTable, remote remoteTable) ([]string, remoteTable) {
+	var existing schema.Indexes
+	for _, index := range remote.Indexes {
+		if strings.HasPrefix(strings.ToLower(index.Name), "fk_") {
+			continue
+		}
+		var columns schema.Columns
+		for _, c := range index.Columns {
+			columns = append(columns, schema.Column{Name: c.Name})
+		}
+		existing = append(existing, schema.Index{Name: index.Name, Unique: index.Unique, FullText: index.FullText, Columns: columns})
+	}
+	renames := schema.IndexRenames(local.Index, existing)
+	if len(renames) == 0 {
+		return nil, remote
+	}
+	var queries []string
+	var indexes = make(remoteIndexes, len(remote.Indexes))
+	copy(indexes, remote.Indexes)
+	for _, r := range renames {
+		queries = append(queries, fmt.Sprintf("-- index %s renamed from %s", r.To, r.From))
+		queries = append(queries, "ALTER TABLE "+quote(local.Name)+" RENAME INDEX "+quote(r.From)+" TO "+quote(r.To)+";")
+		indexes.Find(r.From).Name = r.To
+	}
+	remote.Indexes = indexes
+	return queries, remote
+}
+
+// renameConstraints points the introspected foreign keys at renamed tables
+// and columns, which the database carries over on rename, so they are not
+// created a second time.
+func renameConstraints(constraints []remoteConstraint, table string, renames []schema.Rename) {
+	for idx := range constraints {
+		var c = &constraints[idx]
+		for _, r := range renames {
+			if c.Table == table && c.Column == r.From {
+				c.Column = r.To
+			}
+			if c.ReferencedTable == table && c.ReferencedColumn == r.From {
+				c.ReferencedColumn = r.To
+			}
+		}
+	}
+}
+
+// renameTables renames the remote tables of models implementing
+// RenamedFrom() string whose new table does not exist yet, and returns the
+// renamed tables as new name -> old name.
+func renameTables(stmts []*gorm.Statement, is remoteTables, constraints []remoteConstraint) map[string]string {
+	var renamed = map[string]string{}
+	for _, stmt := range stmts {
+		if stmt.Schema == nil {
+			continue
+		}
+		from := schema.TableRenamedFrom(stmt.Model)
+		if from == "" || from == stmt.Schema.Table || is.GetTable(stmt.Schema.Table) != nil {
+			continue
+		}
+		tbl := is.GetTable(from)
+		if tbl == nil {
+			continue
+		}
+		tbl.Table = stmt.Schema.Table
+		for idx := range constraints {
+			if constraints[idx].Table == from {
+				constraints[idx].Table = tbl.Table
+			}
+			if constraints[idx].ReferencedTable == from {
+				constraints[idx].ReferencedTable = tbl.Table
+			}
+		}
+		renamed[tbl.Table] = from
+	}
+	return renamed
+}
@@ -3,6 +3,8 @@ package mysql
 import (
 	"reflect"
 	"strings"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
 )
 
 // --- Remote introspection types (MySQL information_schema) ---
@@ -19,6 +21,7 @@ type remoteTable struct {
 	Charset       string        `json:"charset" gorm:"column:TABLE_CHARSET"`
 	Columns       remoteColumns `json:"columns" gorm:"-"`
 	Indexes       remoteIndexes `json:"indexes" gorm:"-"`
+	Checks        schema.Checks `json:"checks" gorm:"-"`
 	Model         any           `json:"-" gorm:"-"`
 	Reflect       reflect.Value `json:"-" gorm:"-"`
 	PrimaryKey    []remoteColumn `json:"primary_key" gorm:"-"`
@@ -53,6 +56,7 @@ type remoteColumn struct {
 	ColumnKey       string  `json:"column_key" gorm:"column:COLUMN_KEY"`
 	Extra           string  `json:"extra" gorm:"column:EXTRA"`
 	Comment         string  `json:"comment" gorm:"column:COLUMN_COMMENT"`
+	Generation      *string `json:"generation_expression" gorm:"column:GENERATION_EXPRESSION"`
 }
 
 type remoteColumns []remoteColumn
@@ -83,19 +87,32 @@ type remoteConstraint struct {
 	Database         string `gorm:"column:REFERENCED_TABLE_SCHEMA" json:"database"`
 }
 
+type remoteCheck struct {
+	Table      string `gorm:"column:TABLE_NAME"`
+	Name       string `gorm:"column:CONSTRAINT_NAME"`
+	Expression string `gorm:"column:CHECK_CLAUSE"`
+}
+
+type remoteView struct {
+	Table      string `gorm:"column:TABLE_NAME"`
+	Definition string `gorm:"column:VIEW_DEFINITION"`
+}
+
 type remoteIndexStat struct {
 	Database   string `gorm:"column:TABLE_SCHEMA"`
 	Table      string `gorm:"column:TABLE_NAME"`
 	NonUnique  bool   `gorm:"column:NON_UNIQUE"`
 	Name       string `gorm:"column:INDEX_NAME"`
 	ColumnName string `gorm:"column:COLUMN_NAME"`
+	IndexType  string `gorm:"column:INDEX_TYPE"`
 }
 
 type remoteIndex struct {
-	Name    string
-	Table   string
-	Unique  bool
-	Columns remoteColumns
+	Name     string
+	Table    string
+	Unique   bool
+	FullText bool
+	Columns  remoteColumns
 }
 
 type remoteIndexes []remoteIndex
@@ -0,0 +1,63 @@
+// Package outbox publishes pubsub events reliably. Publish writes the event
+// to the outbox table inside the transaction of the change it announces, so
+// both commit or neither does, and the relay publishes the committed events
+// through pubsub, retrying until they are delivered.
+package outbox
+
+import (
+	"errors"
+	"time"
+
+	"github.com/getevo/json"
+	"gorm.io/gorm"
+)
+
+// ErrEmptyTopic is returned by Publish without topic.
+var ErrEmptyTopic = errors.New("outbox: empty topic")
+
+// Message is an event waiting in, or delivered from, the outbox.
+type Message struct {
+	ID          uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Topic       string     `gorm:"column:topic;size:255;not null" json:"topic"`
+	Payload     []byte     `gorm:"column:payload" json:"payload"`
+	Attempts    int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	LastError   string     `gorm:"column:last_error;size:1024" json:"last_error,omitempty"`
+	CreatedAt   time.Time  `gorm:"column:created_at" json:"created_at"`
+	AvailableAt time.Time  `gorm:"column:available_at;index:idx_outbox_pending,priority:2" json:"available_at"`
+	DeliveredAt *time.Time `gorm:"column:delivered_at;index:idx_outbox_pending,priority:1" json:"delivered_at,omitempty"`
+}
+
+// TableName implements gorm's Tabler.
+func (Message) TableName() string {
+	return "outbox"
+}
+
+// Publish writes an event to the outbox in tx, the transaction of the change
+// it announces. The relay publishes it once tx commits. payload is sent as
+// is when it is a []byte or a string, and as JSON otherwise.
+//
+//	err := db.Transaction(func(tx *gorm.DB) error {
+//	    if err := tx.Create(&order).Error; err != nil {
+//	        return err
+//	    }
+//	    return outbox.Publish(tx, "orders.created", order)
+//	})
+func Publish(tx *gorm.DB, topic string, payload any) error {
+	if topic == "" {
+		return ErrEmptyTopic
+	}
+	var data []byte
+	switch v := payload.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	var now = time.Now()
+	return tx.Create(&Message{Topic: topic, Payload: data, CreatedAt: now, AvailableAt: now}).Error
+}
@@ -0,0 +1,197 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/outbox"
+	"github.com/getevo/evo/v2/lib/pubsub"
+	"github.com/getevo/evo/v2/lib/serializer"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeBus records the published messages and fails while failing is set.
+type fakeBus struct {
+	mu        sync.Mutex
+	published []string
+	failing   bool
+}
+
+func (b *fakeBus) Name() string     { return "fake" }
+func (b *fakeBus) Register() error  { return nil }
+func (b *fakeBus) SetPrefix(string) {}
+func (b *fakeBus) Subscribe(string, func(string, []byte, pubsub.Interface), ...any) {
+}
+func (b *fakeBus) Publish(topic string, message any, params ...any) error {
+	return b.PublishBytes(topic, message.([]byte))
+}
+func (b *fakeBus) PublishBytes(topic string, message []byte, params ...any) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failing {
+		return errors.New("broker down")
+	}
+	b.published = append(b.published, topic+":"+string(message))
+	return nil
+}
+func (b *fakeBus) SetSerializer(serializer.Interface) {}
+func (b *fakeBus) Serializer() serializer.Interface   { return serializer.JSON }
+func (b *fakeBus) Marshal(v any) ([]byte, error)      { return nil, nil }
+func (b *fakeBus) Unmarshal(data []byte, v any) error { return nil }
+func (b *fakeBus) messages() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.published...)
+}
+func (b *fakeBus) setFailing(failing bool) { b.mu.Lock(); b.failing = failing; b.mu.Unlock() }
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "outbox.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.AutoMigrate(&outbox.Message{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestPublishJoinsTheTransaction(t *testing.T) {
+	db := openDB(t)
+
+	_ = db.Transaction(func(tx *gorm.DB) error {
+		if err := outbox.Publish(tx, "orders.created", map[string]int{"id": 1}); err != nil {
+			t.Fatal(err)
+		}
+		return errors.New("rollback")
+	})
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return outbox.Publish(tx, "orders.created", []byte(`{"id":2}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = outbox.Publish(db, "", "x"); !errors.Is(err, outbox.ErrEmptyTopic) {
+		t.Errorf("expected ErrEmptyTopic, got %v", err)
+	}
+
+	var messages []outbox.Message
+	db.Find(&messages)
+	if len(messages) != 1 || string(messages[0].Payload) != `{"id":2}` {
+		t.Fatalf("expected only the committed event, got %+v", messages)
+	}
+}
+
+func TestRelayDeliversAndRetries(t *testing.T) {
+	db := openDB(t)
+	bus := &fakeBus{failing: true}
+	relay := outbox.NewRelay(db, outbox.Config{
+		PubSub:    bus,
+		BatchSize: 2,
+		Backoff:   func(int) time.Duration { return time.Hour },
+	})
+	ctx := context.Background()
+
+	for _, payload := range []string{"a", "b", "c"} {
+		if err := outbox.Publish(db, "events", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := relay.RunOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("expected a batch of 2, got %d, %v", n, err)
+	}
+	var failed outbox.Message
+	db.First(&failed)
+	if failed.Attempts != 1 || failed.LastError != "broker down" || failed.DeliveredAt != nil || time.Until(failed.AvailableAt) < 50*time.Minute {
+		t.Errorf("failed event not rescheduled: %+v", failed)
+	}
+
+	// The failed events wait for their backoff; the third is due.
+	bus.setFailing(false)
+	if n, err := relay.RunOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("expected the third event only, got %d, %v", n, err)
+	}
+	db.Model(&outbox.Message{}).Where("delivered_at IS NULL").Update("available_at", time.Now().Add(-time.Second))
+	if n, err := relay.RunOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("expected the retried events, got %d, %v", n, err)
+	}
+	if got := bus.messages(); len(got) != 3 || got[0] != "events:c" || got[1] != "events:a" {
+		t.Errorf("unexpected deliveries %v", got)
+	}
+	if pending, _ := relay.Pending(ctx); pending != 0 {
+		t.Errorf("expected no pending event, got %d", pending)
+	}
+	if n, _ := relay.RunOnce(ctx); n != 0 {
+		t.Errorf("delivered events relayed again: %d", n)
+	}
+}
+
+func TestMaxAttemptsAndLag(t *testing.T) {
+	db := openDB(t)
+	bus := &fakeBus{failing: true}
+	relay := outbox.NewRelay(db, outbox.Config{
+		PubSub:      bus,
+		MaxAttempts: 1,
+		Backoff:     func(int) time.Duration { return 0 },
+	})
+	ctx := context.Background()
+
+	if lag, err := relay.Lag(ctx); err != nil || lag != 0 {
+		t.Fatalf("expected no lag on an empty outbox, got %s, %v", lag, err)
+	}
+	outbox.Publish(db, "events", "x")
+	db.Model(&outbox.Message{}).Where("1 = 1").Update("created_at", time.Now().Add(-2*time.Hour))
+
+	relay.RunOnce(ctx)
+	if n, _ := relay.RunOnce(ctx); n != 0 {
+		t.Errorf("expected no retry after MaxAttempts, got %d", n)
+	}
+	if lag, _ := relay.Lag(ctx); lag != 0 {
+		t.Errorf("expected a dead-lettered event not to lag, got %s", lag)
+	}
+	pending, _ := relay.Pending(ctx)
+	dead, _ := relay.DeadLettered(ctx)
+	if pending != 0 || dead != 1 {
+		t.Errorf("expected 0 pending and 1 dead-lettered, got %d and %d", pending, dead)
+	}
+
+	outbox.Publish(db, "events", "y")
+	db.Model(&outbox.Message{}).Where("attempts = 0").Update("created_at", time.Now().Add(-time.Hour))
+	if lag, _ := relay.Lag(ctx); lag < time.Hour || lag > 2*time.Hour-time.Minute {
+		t.Errorf("expected a lag of an hour, got %s", lag)
+	}
+	if err := relay.HealthCheck(time.Minute)(); err == nil {
+		t.Error("expected the health check to fail")
+	}
+	if err := relay.HealthCheck(2 * time.Hour)(); err != nil {
+		t.Errorf("expected the health check to pass, got %v", err)
+	}
+}
+
+func TestRelayStartStop(t *testing.T) {
+	db := openDB(t)
+	bus := &fakeBus{}
+	relay := outbox.NewRelay(db, outbox.Config{PubSub: bus, Interval: 10 * time.Millisecond})
+	relay.Start()
+	defer relay.Stop()
+
+	outbox.Publish(db, "events", "x")
+	deadline := time.Now().Add(2 * time.Second)
+	for len(bus.messages()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("event not relayed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	relay.Stop()
+}
@@ -0,0 +1,267 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/log"
+	"github.com/getevo/evo/v2/lib/pubsub"
+	"github.com/getevo/evo/v2/lib/shutdown"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Config configures a relay.
+type Config struct {
+	// PubSub publishes the events. Defaults to the default pubsub driver.
+	PubSub pubsub.Interface
+
+	// Interval is how often the outbox is polled, 1s by default.
+	Interval time.Duration
+
+	// BatchSize is the number of events claimed per transaction, 100 by
+	// default.
+	BatchSize int
+
+	// MaxAttempts stops retrying an event after that many failed attempts;
+	// it then stays in the outbox, undelivered, for inspection. 0 retries
+	// forever.
+	MaxAttempts int
+
+	// Backoff returns the delay before the next attempt after the given
+	// number of failed attempts. Defaults to doubling from 1s up to 10m.
+	Backoff func(attempts int) time.Duration
+
+	// Retention deletes delivered events older than that. 0 keeps them.
+	Retention time.Duration
+}
+
+// Relay publishes the events of the outbox. Several relays, in one or many
+// processes, can share an outbox: each claims its batch with SELECT ... FOR
+// UPDATE SKIP LOCKED on PostgreSQL and MySQL 8. Events are delivered at
+// least once, in order per relay but not across relays.
+type Relay struct {
+	db      *gorm.DB
+	config  Config
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+	cleaned time.Time
+}
+
+// NewRelay returns a relay for the outbox of conn and registers Message for
+// migration.
+func NewRelay(conn *gorm.DB, c Config) *Relay {
+	if c.Interval <= 0 {
+		c.Interval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.Backoff == nil {
+		c.Backoff = backoff
+	}
+	schema.UseModel(conn, Message{})
+	return &Relay{db: conn, config: c, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+func backoff(attempts int) time.Duration {
+	return min(time.Second<<min(attempts-1, 10), 10*time.Minute)
+}
+
+// Start polls the outbox in the background until Stop, or until the
+// application shuts down.
+func (r *Relay) Start() {
+	if r.started.Swap(true) {
+		return
+	}
+	shutdown.Register(r.Stop)
+	go func() {
+		defer close(r.done)
+		var ticker = time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+		for {
+			r.drain()
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the relay and waits for the batch in flight.
+func (r *Relay) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+		if r.started.Load() {
+			<-r.done
+		}
+	})
+}
+
+// drain relays batches until the outbox has no event due.
+func (r *Relay) drain() {
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		n, err := r.RunOnce(context.Background())
+		if err != nil {
+			log.Error("outbox: relay failed", "error", err)
+			return
+		}
+		if n < r.config.BatchSize {
+			break
+		}
+	}
+	if r.config.Retention > 0 && time.Since(r.cleaned) > time.Minute {
+		r.cleaned = time.Now()
+		err := r.db.Where("delivered_at < ?", time.Now().Add(-r.config.Retention)).Delete(&Message{}).Error
+		if err != nil {
+			log.Error("outbox: cleanup failed", "error", err)
+		}
+	}
+}
+
+// RunOnce claims one batch of due events, publishes them and records the
+// outcome, returning the number of events claimed.
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	var driver = r.config.PubSub
+	if driver == nil {
+		if len(pubsub.Drivers()) == 0 {
+			return 0, errors.New("outbox: no pubsub driver")
+		}
+		driver = pubsub.Use(pubsub.DriverName())
+	}
+	var claimed int
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var now = time.Now()
+		var query = tx.Where("delivered_at IS NULL AND available_at <= ?", now).Order("id").Limit(r.config.BatchSize)
+		if r.config.MaxAttempts > 0 {
+			query = query.Where("attempts < ?", r.config.MaxAttempts)
+		}
+		if lock, ok := claimLock(tx); ok {
+			query = query.Clauses(lock)
+		}
+		var batch []Message
+		if err := query.Find(&batch).Error; err != nil {
+			return err
+		}
+		claimed = len(batch)
+		for _, message := range batch {
+			var update map[string]any
+			if err := driver.PublishBytes(message.Topic, message.Payload); err != nil {
+				var attempts = message.Attempts + 1
+				update = map[string]any{
+					"attempts":     attempts,
+					"last_error":   truncate(err.Error(), 1024),
+					"available_at": time.Now().Add(r.config.Backoff(attempts)),
+				}
+				log.Warning("outbox: publish failed", "id", message.ID, "topic", message.Topic, "attempts", attempts, "error", err)
+			} else {
+				update = map[string]any{"delivered_at": time.Now(), "last_error": ""}
+			}
+			if err := tx.Model(&Message{}).Where("id = ?", message.ID).Updates(update).Error; err != nil {
+				return fmt.Errorf("outbox: event %d: %w", message.ID, err)
+			}
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+// claimLock returns the lock claiming a batch: FOR UPDATE SKIP LOCKED,
+// which does not wait for the rows locked by other relays, and a plain FOR
+// UPDATE on MySQL before 8.0.1 and MariaDB before 10.6, which do not
+// support it. Other databases take no row lock.
+func claimLock(tx *gorm.DB) (clause.Locking, bool) {
+	var lock = clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}
+	switch tx.Dialector.Name() {
+	case "postgres":
+		return lock, true
+	case "mysql":
+		if !schema.MySQLAtLeast("8.0.1", "10.6") {
+			lock.Options = ""
+		}
+		return lock, true
+	}
+	return lock, false
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// Lag returns how long the oldest undelivered event has been waiting, 0
+// when the outbox is empty. Events that exhausted MaxAttempts are not
+// counted, see DeadLettered.
+func (r *Relay) Lag(ctx context.Context) (time.Duration, error) {
+	var oldest Message
+	err := r.undelivered(ctx).Order("id").Take(&oldest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(oldest.CreatedAt), nil
+}
+
+// Pending returns the number of undelivered events still retried.
+func (r *Relay) Pending(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.undelivered(ctx).Count(&count).Error
+	return count, err
+}
+
+// DeadLettered returns the number of undelivered events that exhausted
+// MaxAttempts and are no longer retried.
+func (r *Relay) DeadLettered(ctx context.Context) (int64, error) {
+	var count int64
+	if r.config.MaxAttempts <= 0 {
+		return 0, nil
+	}
+	err := r.db.WithContext(ctx).Model(&Message{}).Where("delivered_at IS NULL AND attempts >= ?", r.config.MaxAttempts).Count(&count).Error
+	return count, err
+}
+
+// undelivered queries the undelivered events still retried.
+func (r *Relay) undelivered(ctx context.Context) *gorm.DB {
+	var query = r.db.WithContext(ctx).Model(&Message{}).Where("delivered_at IS NULL")
+	if r.config.MaxAttempts > 0 {
+		query = query.Where("attempts < ?", r.config.MaxAttempts)
+	}
+	return query
+}
+
+// HealthCheck returns a check failing while the oldest undelivered event
+// has waited longer than maxLag:
+//
+//	evo.OnHealthCheck(relay.HealthCheck(time.Minute))
+func (r *Relay) HealthCheck(maxLag time.Duration) func() error {
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		lag, err := r.Lag(ctx)
+		if err != nil {
+			return fmt.Errorf("outbox: %w", err)
+		}
+		if lag > maxLag {
+			return fmt.Errorf("outbox: lag of %s exceeds %s", lag.Round(time.Second), maxLag)
+		}
+		return nil
+	}
+}
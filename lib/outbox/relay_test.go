@@ -0,0 +1,43 @@
+package outbox
+
+import (
+	"testing"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+func TestClaimLock(t *testing.T) {
+	var open = func(dialector gorm.Dialector) *gorm.DB {
+		db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	var mysqlDB = open(mysql.New(mysql.Config{DSN: "user:pass@tcp(localhost:3306)/db", SkipInitializeWithVersion: true}))
+	var postgresDB = open(postgres.New(postgres.Config{DSN: "host=localhost user=user dbname=db"}))
+	defer schema.SetMySQLServer("")
+
+	for _, tt := range []struct {
+		db      *gorm.DB
+		server  string
+		options string
+	}{
+		{postgresDB, "", clause.LockingOptionsSkipLocked},
+		{mysqlDB, "8.0.36", clause.LockingOptionsSkipLocked},
+		{mysqlDB, "5.7.44-log", ""},
+		{mysqlDB, "10.11.6-MariaDB", clause.LockingOptionsSkipLocked},
+		{mysqlDB, "10.5.23-MariaDB", ""},
+	} {
+		schema.SetMySQLServer(tt.server)
+		lock, ok := claimLock(tt.db)
+		if !ok || lock.Strength != clause.LockingStrengthUpdate || lock.Options != tt.options {
+			t.Errorf("%s %s: unexpected lock %+v, %t", tt.db.Dialector.Name(), tt.server, lock, ok)
+		}
+	}
+}
@@ -56,10 +56,17 @@ func (p *PGDialect) getConstraintsQuery(local pgDdlTable, constraints []pgConstr
 			if field.FKOnUpdate != "" {
 				onUpdate = field.FKOnUpdate
 			}
-			queries = append(queries, fmt.Sprintf(
-				"ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(%s) ON DELETE %s ON UPDATE %s;",
+			query := fmt.Sprintf(
+				"ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s(%s) ON DELETE %s ON UPDATE %s",
 				p.Quote(local.Name), p.Quote(name), p.Quote(field.Name),
-				p.Quote(referencedTable), p.Quote(referencedCol), onDelete, onUpdate))
+				p.Quote(referencedTable), p.Quote(referencedCol), onDelete, onUpdate)
+			if is.GetTable(local.Name) == nil {
+				queries = append(queries, query+";")
+				continue
+			}
+			// Existing rows are checked by VALIDATE, which does not block writes
+			queries = append(queries, query+" NOT VALID;")
+			queries = append(queries, fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s;", p.Quote(local.Name), p.Quote(name)))
 		}
 	}
 	return queries
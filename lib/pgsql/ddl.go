@@ -9,6 +9,8 @@ import (
 
 	"github.com/getevo/evo/v2/lib/args"
 	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
+	"github.com/getevo/evo/v2/lib/log"
 	"gorm.io/gorm"
 )
 
@@ -28,7 +30,8 @@ func (p *PGDialect) fromStatementToTable(stmt *gorm.Statement) pgDdlTable {
 		if strings.Contains(datatype, "enum") {
 			datatype = schema.CleanEnum(datatype)
 		} else {
-			datatype = strings.Split(datatype, " ")[0]
+			// decimal(10, 2) is a single type
+			datatype = strings.Split(strings.ReplaceAll(datatype, ", ", ","), " ")[0]
 		}
 
 		// PG type mapping — do NOT convert to MySQL types
@@ -37,6 +40,15 @@ func (p *PGDialect) fromStatementToTable(stmt *gorm.Statement) pgDdlTable {
 			datatype = "timestamp"
 		case "bigint unsigned":
 			datatype = "bigint"
+		case "decimal":
+			datatype = "numeric"
+			if field.Precision > 0 {
+				datatype = types.DecimalType(field, "numeric")
+			}
+		case "point":
+			if schema.PostGIS() {
+				datatype = "geography(Point,4326)"
+			}
 		case "text":
 			// GORM defaults string without size to text; use varchar(255) instead
 			if _, hasType := field.TagSettings["TYPE"]; !hasType {
@@ -85,6 +97,10 @@ func (p *PGDialect) fromStatementToTable(stmt *gorm.Statement) pgDdlTable {
 			column.FKOnUpdate = v
 		}
 
+		if v, ok := field.TagSettings["RENAMED_FROM"]; ok {
+			column.RenamedFrom = v
+		}
+
 		if _, ok := field.TagSettings["FULLTEXT"]; ok {
 			column.FullText = true
 		}
@@ -94,11 +110,22 @@ func (p *PGDialect) fromStatementToTable(stmt *gorm.Statement) pgDdlTable {
 			column.OnUpdate = v
 		}
 
+		// PG generated columns are always stored
+		if v, ok := field.TagSettings["GENERATED"]; ok && v != "" {
+			column.Generated = v
+			column.Stored = true
+			column.Default = ""
+			column.AutoIncrement = false
+			if _, ok := field.TagSettings["NOT NULL"]; !ok && !field.PrimaryKey {
+				column.Nullable = true
+			}
+		}
+
 		var nullable = false
 		if _, ok := field.TagSettings["NULLABLE"]; ok {
 			nullable = true
 		}
-		if field.FieldType.Kind() == reflect.Ptr || nullable {
+		if (field.FieldType.Kind() == reflect.Ptr || nullable) && column.Generated == "" {
 			if _, ok := field.TagSettings["NOT NULL"]; !ok {
 				column.Nullable = true
 				// PG doesn't support 0000-00-00 — use NULL
@@ -117,7 +144,7 @@ func (p *PGDialect) fromStatementToTable(stmt *gorm.Statement) pgDdlTable {
 		}
 
 		// For non-nullable timestamps without default, use CURRENT_TIMESTAMP (not 0000-00-00)
-		if (strings.ToLower(column.Type) == "timestamp" || strings.ToLower(column.Type) == "timestamptz") && column.Default == "" && !column.Nullable {
+		if (strings.ToLower(column.Type) == "timestamp" || strings.ToLower(column.Type) == "timestamptz") && column.Default == "" && !column.Nullable && column.Generated == "" {
 			column.Default = "CURRENT_TIMESTAMP"
 		}
 		// Replace any remaining 0000-00-00 with NULL
@@ -137,6 +164,10 @@ func (p *PGDialect) fromStatementToTable(stmt *gorm.Statement) pgDdlTable {
 			})
 		}
 
+		if _, ok := field.TagSettings["SPATIAL"]; ok {
+			t.Index = append(t.Index, schema.SpatialIndex(t.Name+"_"+column.Name, column, 63))
+		}
+
 		var r = field.IndirectFieldType
 		for r.Kind() == reflect.Ptr {
 			r = r.Elem()
@@ -155,11 +186,19 @@ func (p *PGDialect) fromStatementToTable(stmt *gorm.Statement) pgDdlTable {
 		}
 	}
 
+	t.Checks = schema.ParseChecks(stmt, 63)
+	t.View, t.Materialized, t.IsView = schema.ViewOf(stmt.Model)
+
+	if index := schema.FullTextIndex(t.Name, t.Columns, 63); index != nil {
+		t.Index = append(t.Index, *index)
+	}
+
 	for _, index := range stmt.Schema.ParseIndexes() {
 		var idx = schema.Index{
 			Name:     schema.SafeIndexName(index.Name, 63),
 			Unique:   index.Class == "UNIQUE",
 			FullText: index.Class == "FULLTEXT",
+			Spatial:  index.Class == "SPATIAL",
 		}
 		var skip bool
 		for _, opt := range index.Fields {
@@ -198,7 +237,6 @@ func (p *PGDialect) getCreateQuery(t pgDdlTable) []string {
 	// CREATE TABLE
 	var query = `CREATE TABLE IF NOT EXISTS ` + p.Quote(t.Name) + `(`
 	var primaryKeys []string
-	var fullTextColumns []string
 	var onUpdateColumns []schema.Column
 
 	for idx := range t.Columns {
@@ -212,17 +250,22 @@ func (p *PGDialect) getCreateQuery(t pgDdlTable) []string {
 		if idx < len(t.Columns)-1 {
 			query += ","
 		}
-		if field.FullText {
-			fullTextColumns = append(fullTextColumns, p.Quote(field.Name))
-		}
 		if field.OnUpdate != "" {
 			onUpdateColumns = append(onUpdateColumns, field)
 		}
 	}
+	for _, index := range t.Index {
+		if index.FullText {
+			query += ",\r\n\t" + p.searchVectorQuery(index)
+		}
+	}
 	if len(primaryKeys) > 0 {
 		query += ","
 		query += "\r\n\t" + "PRIMARY KEY (" + strings.Join(primaryKeys, ",") + ")"
 	}
+	for _, check := range t.Checks {
+		query += ",\r\n\t" + p.checkDefinition(check)
+	}
 	query += "\r\n);"
 	queries = append(queries, query)
 
@@ -242,17 +285,6 @@ func (p *PGDialect) getCreateQuery(t pgDdlTable) []string {
 		queries = append(queries, p.createIndexSQL(index, t.Name))
 	}
 
-	// Post-CREATE: fulltext index on inline columns
-	if len(fullTextColumns) > 0 {
-		var cols []string
-		for _, c := range fullTextColumns {
-			cols = append(cols, fmt.Sprintf(`to_tsvector('english', %s)`, c))
-		}
-		idxName := "ft_" + t.Name
-		queries = append(queries, fmt.Sprintf(`CREATE INDEX %s ON %s USING gin(%s);`,
-			p.Quote(idxName), p.Quote(t.Name), strings.Join(cols, " || ' ' || ")))
-	}
-
 	// Post-CREATE: ON UPDATE triggers
 	for _, col := range onUpdateColumns {
 		queries = append(queries, p.getUpdateTriggerStatements(t.Name, col.Name)...)
@@ -267,6 +299,10 @@ func (p *PGDialect) getDiff(local pgDdlTable, remote pgRemoteTable) []string {
 	var afterPK []string
 	var primaryKeys []string
 
+	var renames []string
+	renames, remote = p.renameColumns(local, remote)
+	queries = append(queries, renames...)
+
 	// Check for new ENUM types needed
 	for _, col := range local.Columns {
 		if strings.HasPrefix(strings.ToLower(col.Type), "enum(") {
@@ -299,7 +335,7 @@ func (p *PGDialect) getDiff(local pgDdlTable, remote pgRemoteTable) []string {
 			queries = append(queries, fmt.Sprintf("-- column %s does not exist", field.Name))
 			addQuery := p.getFieldQuery(&field, &local)
 			// PG: when adding NOT NULL column to existing table, add DEFAULT for the zero value
-			if !field.Nullable && field.Default == "" && !field.AutoIncrement {
+			if !field.Nullable && field.Default == "" && !field.AutoIncrement && field.Generated == "" {
 				zeroDefault := p.zeroDefault(field.Type)
 				if zeroDefault != "" {
 					addQuery += " DEFAULT " + zeroDefault
@@ -307,6 +343,11 @@ func (p *PGDialect) getDiff(local pgDdlTable, remote pgRemoteTable) []string {
 			}
 			queries = append(queries, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;",
 				p.Quote(local.Name), addQuery))
+		} else if comment, changed := generatedDiff(field, r); changed {
+			// PG cannot alter the expression of a generated column
+			queries = append(queries, comment)
+			queries = append(queries, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", p.Quote(local.Name), p.Quote(field.Name)))
+			queries = append(queries, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", p.Quote(local.Name), p.getFieldQuery(&field, &local)))
 		} else {
 			// Column exists — check for differences
 			var alterStatements []string
@@ -414,7 +455,7 @@ func (p *PGDialect) getDiff(local pgDdlTable, remote pgRemoteTable) []string {
 		}
 
 		if args.Exists("--strict") {
-			var found = false
+			var found = p.isSearchVector(local, column.Name)
 			for _, lc := range local.Columns {
 				if lc.Name == column.Name {
 					found = true
@@ -450,25 +491,54 @@ func (p *PGDialect) getDiff(local pgDdlTable, remote pgRemoteTable) []string {
 	}
 	queries = append(queries, afterPK...)
 
+	// Generated tsvector columns of the full-text indexes
+	for _, index := range local.Index {
+		if !index.FullText {
+			continue
+		}
+		var name = schema.SearchVectorColumn(index.Columns.Keys())
+		var column = remote.Columns.GetColumn(name)
+		if column != nil && !searchVectorLanguage(column) {
+			// PG cannot alter the expression of a generated column; dropping
+			// it drops the indexes built on it too
+			queries = append(queries, fmt.Sprintf("-- column %s text search configuration does not match. new:%s old:%s",
+				name, schema.FullTextLanguage(), getStringPtr(column.Generation)))
+			queries = append(queries, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", p.Quote(local.Name), p.Quote(name)))
+			remote.Indexes = remote.Indexes.without(name)
+			column = nil
+		}
+		if column == nil {
+			queries = append(queries, fmt.Sprintf("-- column %s does not exist", name))
+			queries = append(queries, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", p.Quote(local.Name), p.searchVectorQuery(index)))
+		}
+	}
+
 	// Index handling
+	renames, remote = p.renameIndexes(local, remote)
+	queries = append(queries, renames...)
 	for _, index := range local.Index {
 		r := remote.Indexes.Find(index.Name)
 		if r == nil {
-			// Index doesn't exist — create
+			// Index doesn't exist — create without blocking writes
 			queries = append(queries, "-- append not existing index")
-			queries = append(queries, p.createIndexSQL(index, local.Name))
+			queries = append(queries, p.createIndexConcurrentlySQL(index, local.Name))
 		} else {
 			var changed = false
 			if r.Unique != index.Unique {
 				changed = true
 				queries = append(queries, fmt.Sprintf("-- index unique flag not match. new:%t old:%t", index.Unique, r.Unique))
 			}
-			if len(r.Columns) != len(index.Columns) {
+			var columns = index.Columns.Keys()
+			if index.FullText {
+				// the index is built on the generated tsvector column
+				columns = []string{schema.SearchVectorColumn(columns)}
+			}
+			if len(r.Columns) != len(columns) {
 				queries = append(queries, fmt.Sprintf("-- index columns does not match"))
 				changed = true
 			} else {
-				for i, n := range index.Columns {
-					if n.Name != r.Columns[i].Name {
+				for i, n := range columns {
+					if n != r.Columns[i].Name {
 						queries = append(queries, fmt.Sprintf("-- index columns does not match"))
 						changed = true
 						break
@@ -477,8 +547,8 @@ func (p *PGDialect) getDiff(local pgDdlTable, remote pgRemoteTable) []string {
 			}
 			if changed {
 				// PG: DROP INDEX without ON table
-				queries = append(queries, fmt.Sprintf("DROP INDEX IF EXISTS %s;", p.Quote(index.Name)))
-				queries = append(queries, p.createIndexSQL(index, local.Name))
+				queries = append(queries, fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s;", p.Quote(index.Name)))
+				queries = append(queries, p.createIndexConcurrentlySQL(index, local.Name))
 			}
 		}
 	}
@@ -488,7 +558,7 @@ func (p *PGDialect) getDiff(local pgDdlTable, remote pgRemoteTable) []string {
 		if local.Index.Find(index.Name) == nil {
 			if !strings.HasPrefix(index.Name, "fk_") {
 				queries = append(queries, "-- drop unnecessary index")
-				queries = append(queries, fmt.Sprintf("DROP INDEX IF EXISTS %s;", p.Quote(index.Name)))
+				queries = append(queries, fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s;", p.Quote(index.Name)))
 			}
 		}
 	}
@@ -500,6 +570,96 @@ func (p *PGDialect) getDiff(local pgDdlTable, remote pgRemoteTable) []string {
 		}
 	}
 
+	return append(queries, p.checksDiff(local, remote)...)
+}
+
+// generatedDiff reports whether the generated column field no longer
+// matches the column r, which then has to be dropped and added again.
+func generatedDiff(field schema.Column, r *pgRemoteColumn) (string, bool) {
+	var expression = getStringPtr(r.Generation)
+	if field.Generated == "" && expression == "" {
+		return "", false
+	}
+	if field.Generated == "" {
+		return fmt.Sprintf("-- column %s is no longer generated. old:%s", field.Name, expression), true
+	}
+	if expression == "" {
+		return fmt.Sprintf("-- column %s becomes generated. new:%s", field.Name, field.Generated), true
+	}
+	if schema.NormalizeExpression(field.Generated) != schema.NormalizeExpression(expression) {
+		return fmt.Sprintf("-- column %s generated expression does not match. new:%s old:%s", field.Name, field.Generated, expression), true
+	}
+	return "", false
+}
+
+// checkDefinition returns the definition of a CHECK constraint.
+func (p *PGDialect) checkDefinition(check schema.Check) string {
+	return "CONSTRAINT " + p.Quote(check.Name) + " CHECK (" + check.Expression + ")"
+}
+
+// checksDiff adds the missing CHECK constraints of local, replaces the
+// changed ones and drops the ones created from a removed check tag. New
+// constraints are added NOT VALID and validated separately, which checks
+// the existing rows without blocking writes.
+func (p *PGDialect) checksDiff(local pgDdlTable, remote pgRemoteTable) []string {
+	var queries []string
+	var add = func(check schema.Check) {
+		queries = append(queries, fmt.Sprintf("ALTER TABLE %s ADD %s NOT VALID;", p.Quote(local.Name), p.checkDefinition(check)))
+		queries = append(queries, fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s;", p.Quote(local.Name), p.Quote(check.Name)))
+	}
+	for _, check := range local.Checks {
+		var r = remote.Checks.Find(check.Name)
+		if r == nil {
+			queries = append(queries, fmt.Sprintf("-- check constraint %s does not exist", check.Name))
+			add(check)
+		} else if schema.NormalizeExpression(check.Expression) != schema.NormalizeExpression(r.Expression) {
+			queries = append(queries, fmt.Sprintf("-- check constraint %s does not match. new:%s old:%s", check.Name, check.Expression, r.Expression))
+			queries = append(queries, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s;", p.Quote(local.Name), p.Quote(r.Name)))
+			add(check)
+		}
+	}
+	for _, check := range remote.Checks {
+		if local.Checks.Find(check.Name) == nil && schema.ManagedCheck(check.Name) {
+			queries = append(queries, "-- drop unnecessary check constraint")
+			queries = append(queries, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s;", p.Quote(local.Name), p.Quote(check.Name)))
+		}
+	}
+	return queries
+}
+
+// getViewQuery creates the view local, or recreates it when the hash of its
+// definition differs from the one in the comment of the database view.
+func (p *PGDialect) getViewQuery(local pgDdlTable, remote *pgRemoteView, is pgRemoteTables) []string {
+	var comment = schema.ViewComment(local.View, local.Materialized)
+	if remote != nil && remote.Comment == comment {
+		return nil
+	}
+	if is.GetTable(local.Name) != nil {
+		log.Warning("a table has the name of the view, skipping view", "view", local.Name)
+		return []string{fmt.Sprintf("-- table %s exists, drop it to create the view", local.Name)}
+	}
+	var kind = "VIEW"
+	if local.Materialized {
+		kind = "MATERIALIZED VIEW"
+	}
+	var queries []string
+	if remote == nil {
+		queries = append(queries, fmt.Sprintf("-- view %s does not exist", local.Name))
+	} else {
+		var remoteKind = "VIEW"
+		if remote.Kind == "m" {
+			remoteKind = "MATERIALIZED VIEW"
+		}
+		if remoteKind != kind {
+			queries = append(queries, fmt.Sprintf("-- view %s kind does not match. new:%s old:%s", local.Name, kind, remoteKind))
+		} else {
+			queries = append(queries, fmt.Sprintf("-- view %s definition does not match", local.Name))
+		}
+		// CREATE OR REPLACE VIEW cannot drop or rename columns
+		queries = append(queries, fmt.Sprintf("DROP %s IF EXISTS %s;", remoteKind, p.Quote(local.Name)))
+	}
+	queries = append(queries, fmt.Sprintf("CREATE %s %s AS %s;", kind, p.Quote(local.Name), local.View))
+	queries = append(queries, fmt.Sprintf("COMMENT ON %s %s IS %s;", kind, p.Quote(local.Name), schema.QuoteLiteral(comment)))
 	return queries
 }
 
@@ -507,6 +667,10 @@ func (p *PGDialect) getDiff(local pgDdlTable, remote pgRemoteTable) []string {
 func (p *PGDialect) getFieldQuery(field *schema.Column, t *pgDdlTable) string {
 	colType := p.pgColumnType(field, t)
 
+	if field.Generated != "" {
+		return p.Quote(field.Name) + " " + colType + " GENERATED ALWAYS AS (" + field.Generated + ") STORED" + p.nullClause(field)
+	}
+
 	// Auto-increment PK uses BIGSERIAL/SERIAL
 	if field.AutoIncrement {
 		lower := strings.ToLower(colType)
@@ -557,16 +721,34 @@ func (p *PGDialect) nullClause(field *schema.Column) string {
 	return " NOT NULL"
 }
 
-// createIndexSQL generates CREATE INDEX SQL for an index.
-func (p *PGDialect) createIndexSQL(index schema.Index, tableName string) string {
-	if index.FullText {
-		var cols []string
-		for _, c := range index.Columns {
-			cols = append(cols, fmt.Sprintf(`to_tsvector('english', %s)`, p.Quote(c.Name)))
+// searchVectorQuery returns the definition of the generated tsvector column
+// a full-text index is built on.
+func (p *PGDialect) searchVectorQuery(index schema.Index) string {
+	var columns = index.Columns.Keys()
+	return fmt.Sprintf("%s tsvector GENERATED ALWAYS AS (%s) STORED",
+		p.Quote(schema.SearchVectorColumn(columns)), schema.SearchVectorExpression(schema.FullTextLanguage(), columns, p.Quote))
+}
+
+// searchVectorLanguage reports whether the generated tsvector column is
+// computed with the configured text search configuration.
+func searchVectorLanguage(column *pgRemoteColumn) bool {
+	var expression = strings.ToLower(getStringPtr(column.Generation))
+	return expression == "" || strings.Contains(expression, strings.ToLower(schema.QuoteLiteral(schema.FullTextLanguage()))+"::regconfig")
+}
+
+// isSearchVector reports whether column is the generated tsvector column of
+// a full-text index of t.
+func (p *PGDialect) isSearchVector(t pgDdlTable, column string) bool {
+	for _, index := range t.Index {
+		if index.FullText && schema.SearchVectorColumn(index.Columns.Keys()) == column {
+			return true
 		}
-		return fmt.Sprintf(`CREATE INDEX %s ON %s USING gin(%s);`,
-			p.Quote(index.Name), p.Quote(tableName), strings.Join(cols, " || ' ' || "))
 	}
+	return false
+}
+
+// createIndexSQL generates CREATE INDEX SQL for an index.
+func (p *PGDialect) createIndexSQL(index schema.Index, tableName string) string {
 	q := "CREATE "
 	if index.Unique {
 		q += "UNIQUE "
@@ -575,10 +757,30 @@ func (p *PGDialect) createIndexSQL(index schema.Index, tableName string) string
 	for _, c := range index.Columns {
 		keys = append(keys, p.Quote(c.Name))
 	}
-	q += fmt.Sprintf("INDEX %s ON %s (%s);", p.Quote(index.Name), p.Quote(tableName), strings.Join(keys, ","))
+	var method string
+	switch {
+	case index.FullText:
+		// the index is built on the generated tsvector column
+		method = " USING gin"
+		keys = []string{p.Quote(schema.SearchVectorColumn(index.Columns.Keys()))}
+	case index.Spatial:
+		method = " USING gist"
+	}
+	q += fmt.Sprintf("INDEX %s ON %s%s (%s);", p.Quote(index.Name), p.Quote(tableName), method, strings.Join(keys, ","))
 	return q
 }
 
+// createIndexConcurrentlySQL generates CREATE INDEX CONCURRENTLY SQL for an
+// index on an existing table, which builds it without blocking writes. It
+// cannot run inside a transaction.
+func (p *PGDialect) createIndexConcurrentlySQL(index schema.Index, tableName string) string {
+	q := p.createIndexSQL(index, tableName)
+	if index.Unique {
+		return strings.Replace(q, "CREATE UNIQUE INDEX ", "CREATE UNIQUE INDEX CONCURRENTLY ", 1)
+	}
+	return strings.Replace(q, "CREATE INDEX ", "CREATE INDEX CONCURRENTLY ", 1)
+}
+
 // getUpdateTriggerStatements generates trigger function and trigger DDL for ON UPDATE columns.
 func (p *PGDialect) getUpdateTriggerStatements(tableName, columnName string) []string {
 	var stmts []string
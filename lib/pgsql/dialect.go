@@ -35,6 +35,15 @@ func (p *PGDialect) Schema() string {
 	return p.schema
 }
 
+// schemaOf returns the schema a migration on db works in: the one set with
+// schema.InSchema, or the configured one.
+func (p *PGDialect) schemaOf(db *gorm.DB) string {
+	if name, ok := schema.SchemaOf(db); ok {
+		return name
+	}
+	return p.Schema()
+}
+
 func (p *PGDialect) Name() string {
 	return "postgres"
 }
@@ -59,7 +68,7 @@ func (p *PGDialect) GetTableVersion(db *gorm.DB, database, tableName string) str
 		FROM pg_class c
 		JOIN pg_namespace n ON n.oid = c.relnamespace
 		WHERE c.relname = ? AND n.nspname = ? AND c.relkind = 'r'
-	`, tableName, p.Schema()).Scan(&comment).Error; err != nil {
+	`, tableName, p.schemaOf(db)).Scan(&comment).Error; err != nil {
 		log.Error("failed to get table version", "error", err, "table", tableName)
 		return "0.0.0"
 	}
@@ -89,7 +98,7 @@ func (p *PGDialect) GetJoinConstraints(db *gorm.DB, database string) []schema.Jo
 		JOIN pg_attribute ref_att ON ref_att.attrelid = con.confrelid AND ref_att.attnum = ANY(con.confkey)
 		WHERE con.contype = 'f'
 		  AND ns.nspname = ?
-	`, p.Schema()).Scan(&raw)
+	`, p.schemaOf(db)).Scan(&raw)
 	var result []schema.JoinConstraint
 	for _, c := range raw {
 		result = append(result, schema.JoinConstraint{
@@ -103,6 +112,9 @@ func (p *PGDialect) GetJoinConstraints(db *gorm.DB, database string) []schema.Jo
 }
 
 func (p *PGDialect) GenerateMigration(db *gorm.DB, database string, stmts []*gorm.Statement, models []any) schema.MigrationResult {
+	// each script creates the trigger functions it needs, as the previous
+	// one may have targeted another schema
+	p.triggerFuncExists = make(map[string]bool)
 	return p.generateMigration(db, database, stmts, models)
 }
 
@@ -117,12 +129,18 @@ func (p *PGDialect) ReleaseMigrationLock(db *gorm.DB) {
 }
 
 func (p *PGDialect) BootstrapHistoryTable(db *gorm.DB) error {
-	return db.Exec(`CREATE TABLE IF NOT EXISTS "schema_migration" (
+	err := db.Exec(`CREATE TABLE IF NOT EXISTS "schema_migration" (
   "id" BIGSERIAL PRIMARY KEY,
   "hash" CHAR(32) NOT NULL,
   "status" VARCHAR(10) NOT NULL,
   "executed_queries" INT NOT NULL DEFAULT 0,
   "error_message" TEXT,
+  "migration_id" VARCHAR(255),
   "created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );`).Error
+	if err != nil {
+		return err
+	}
+	// Tables created before versioned migrations lack migration_id.
+	return db.Exec(`ALTER TABLE "schema_migration" ADD COLUMN IF NOT EXISTS "migration_id" VARCHAR(255)`).Error
 }
@@ -61,6 +61,10 @@ func (p *PGDialect) normalizeType(t string) string {
 	case "decimal":
 		return "numeric"
 	}
+	// geography(Point,4326) is reported as geography
+	if strings.HasPrefix(t, "geography(") || strings.HasPrefix(t, "geometry(") {
+		return t[:strings.IndexByte(t, '(')]
+	}
 	// Normalize decimal(p,s) -> numeric(p,s)
 	if strings.HasPrefix(t, "decimal(") {
 		return "numeric" + t[7:]
@@ -1,6 +1,9 @@
 package pgsql
 
 import (
+	"strings"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
 	"gorm.io/gorm"
 )
 
@@ -18,7 +21,7 @@ func (p *PGDialect) introspectTables(db *gorm.DB, database string) pgRemoteTable
 		WHERE table_schema = ?
 		  AND table_catalog = ?
 		  AND table_type = 'BASE TABLE'
-	`, p.Schema(), database).Scan(&is)
+	`, p.schemaOf(db), database).Scan(&is)
 	return is
 }
 
@@ -68,7 +71,10 @@ func (p *PGDialect) introspectColumns(db *gorm.DB, database string) pgRemoteColu
 		           WHEN c.column_default LIKE 'nextval(%%' THEN 'auto_increment'
 		           ELSE ''
 		       END                            AS extra,
-		       COALESCE(col_description(cls.oid, c.ordinal_position), '') AS column_comment
+		       COALESCE(col_description(cls.oid, c.ordinal_position), '') AS column_comment,
+		       CASE
+		           WHEN c.is_generated = 'ALWAYS' THEN c.generation_expression
+		       END                            AS generation_expression
 		FROM information_schema.columns c
 		LEFT JOIN pg_class cls
 		       ON cls.relname = c.table_name AND cls.relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = ?)
@@ -83,7 +89,7 @@ func (p *PGDialect) introspectColumns(db *gorm.DB, database string) pgRemoteColu
 		WHERE c.table_schema = ?
 		  AND c.table_catalog = ?
 		ORDER BY c.table_name, c.ordinal_position
-	`, p.Schema(), p.Schema(), p.Schema(), database).Scan(&columns)
+	`, p.schemaOf(db), p.schemaOf(db), p.schemaOf(db), database).Scan(&columns)
 	return columns
 }
 
@@ -104,10 +110,52 @@ func (p *PGDialect) introspectConstraints(db *gorm.DB) []pgConstraint {
 		JOIN pg_attribute ref_att ON ref_att.attrelid = con.confrelid AND ref_att.attnum = ANY(con.confkey)
 		WHERE con.contype = 'f'
 		  AND ns.nspname = ?
-	`, p.Schema()).Scan(&constraints)
+	`, p.schemaOf(db)).Scan(&constraints)
 	return constraints
 }
 
+// introspectChecks retrieves the CHECK constraints of the tables.
+func (p *PGDialect) introspectChecks(db *gorm.DB, is pgRemoteTables) {
+	var checks []pgRemoteCheck
+	db.Raw(`
+		SELECT cl.relname                     AS table_name,
+		       con.conname                    AS constraint_name,
+		       pg_get_constraintdef(con.oid)  AS definition
+		FROM pg_constraint con
+		JOIN pg_class cl ON con.conrelid = cl.oid
+		JOIN pg_namespace ns ON cl.relnamespace = ns.oid
+		WHERE con.contype = 'c'
+		  AND ns.nspname = ?
+	`, p.schemaOf(db)).Scan(&checks)
+	for _, item := range checks {
+		tbl := is.GetTable(item.Table)
+		if tbl == nil {
+			continue
+		}
+		// pg_get_constraintdef returns CHECK (<expression>) [NOT VALID]
+		var expression = strings.TrimSuffix(strings.TrimSpace(item.Definition), " NOT VALID")
+		expression = strings.TrimSpace(strings.TrimPrefix(expression, "CHECK"))
+		tbl.Checks = append(tbl.Checks, schema.Check{Name: item.Name, Expression: expression})
+	}
+}
+
+// introspectViews retrieves the views and materialized views of the
+// database.
+func (p *PGDialect) introspectViews(db *gorm.DB, database string) []pgRemoteView {
+	var views []pgRemoteView
+	db.Raw(`
+		SELECT c.relname                                        AS table_name,
+		       c.relkind::text                                  AS kind,
+		       COALESCE(obj_description(c.oid, 'pg_class'), '') AS comment
+		FROM pg_class c
+		JOIN pg_namespace ns ON c.relnamespace = ns.oid
+		WHERE c.relkind IN ('v', 'm')
+		  AND ns.nspname = ?
+		  AND current_database() = ?
+	`, p.schemaOf(db), database).Scan(&views)
+	return views
+}
+
 // introspectIndexes retrieves index metadata from the database.
 func (p *PGDialect) introspectIndexes(db *gorm.DB, database string, is pgRemoteTables) {
 	var istats []pgRemoteIndexStat
@@ -125,7 +173,7 @@ func (p *PGDialect) introspectIndexes(db *gorm.DB, database string, is pgRemoteT
 		WHERE ns.nspname = ?
 		  AND NOT ix.indisprimary
 		ORDER BY t.relname, array_position(ix.indkey, a.attnum)
-	`, database, p.Schema()).Scan(&istats)
+	`, database, p.schemaOf(db)).Scan(&istats)
 
 	var indexMap = map[string]pgRemoteIndex{}
 	for _, item := range istats {
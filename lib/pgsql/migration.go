@@ -21,15 +21,34 @@ func (p *PGDialect) generateMigration(db *gorm.DB, database string, stmts []*gor
 	// Assemble columns into tables
 	p.assembleColumns(columns, is)
 
-	// Assemble indexes
+	// Assemble indexes and checks
 	p.introspectIndexes(db, database, is)
+	p.introspectChecks(db, is)
+	views := p.introspectViews(db, database)
+
+	// Rename tables declared with RenamedFrom() before anything refers to them
+	result.RenamedFrom = renameTables(stmts, is, constraints)
+
+	// Point foreign keys at renamed columns before any model creates them, as
+	// a model may reference a column renamed on another one
+	var locals = make([]pgDdlTable, len(stmts))
+	for idx, stmt := range stmts {
+		if stmt.Schema == nil {
+			continue
+		}
+		locals[idx] = p.fromStatementToTable(stmt)
+		if tbl := is.GetTable(stmt.Schema.Table); tbl != nil {
+			renameConstraints(constraints, tbl.Table, schema.ColumnRenames(locals[idx].Columns, tbl.Columns.Keys()))
+		}
+	}
 
 	// Mark which tables exist
 	for _, t := range is {
 		result.TableExists[t.Table] = true
 	}
 
-	// Generate DDL for each model
+	// Generate DDL for each model; views follow the tables they select from
+	var viewQueries []string
 	for idx, stmt := range stmts {
 		if stmt.Schema == nil {
 			continue
@@ -41,16 +60,32 @@ func (p *PGDialect) generateMigration(db *gorm.DB, database string, stmts []*gor
 			}
 		}
 
-		local := p.fromStatementToTable(stmt)
+		local := locals[idx]
+		if local.IsView {
+			var remote *pgRemoteView
+			for i := range views {
+				if views[i].Table == local.Name {
+					remote = &views[i]
+				}
+			}
+			if q := p.getViewQuery(local, remote, is); len(q) > 0 {
+				viewQueries = append(viewQueries, "\r\n\r\n-- Migrate View: "+stmt.Schema.ModelType.PkgPath()+"."+stmt.Schema.ModelType.Name()+"("+local.Name+")")
+				viewQueries = append(viewQueries, q...)
+			}
+			continue
+		}
 		tbl := is.GetTable(stmt.Schema.Table)
 
 		var q []string
+		if from, ok := result.RenamedFrom[local.Name]; ok {
+			q = append(q, p.renameTableQuery(from, local)...)
+		}
 		if tbl != nil {
 			tbl.Model = models[idx]
 			tbl.Reflect = reflect.ValueOf(tbl.Model)
-			q = p.getDiff(local, *tbl)
+			q = append(q, p.getDiff(local, *tbl)...)
 		} else {
-			q = p.getCreateQuery(local)
+			q = append(q, p.getCreateQuery(local)...)
 		}
 
 		result.Tail = append(result.Tail, p.getConstraintsQuery(local, constraints, is)...)
@@ -59,6 +94,7 @@ func (p *PGDialect) generateMigration(db *gorm.DB, database string, stmts []*gor
 			result.Queries = append(result.Queries, q...)
 		}
 	}
+	result.Queries = append(result.Queries, viewQueries...)
 
 	return result
 }
@@ -0,0 +1,162 @@
+package pgsql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"gorm.io/gorm"
+)
+
+// renameColumns returns the RENAME COLUMN statements for the pending
+// renamed_from tags of local, and a copy of remote in which those columns
+// already carry their new names so the rest of the diff sees them as existing.
+func (p *PGDialect) renameColumns(local pgDdlTable, remote pgRemoteTable) ([]string, pgRemoteTable) {
+	renames := schema.ColumnRenames(local.Columns, remote.Columns.Keys())
+	if len(renames) == 0 {
+		return nil, remote
+	}
+	var queries []string
+	for _, r := range renames {
+		queries = append(queries, fmt.Sprintf("-- column %s renamed from %s", r.To, r.From))
+		queries = append(queries, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;",
+			p.Quote(local.Name), p.Quote(r.From), p.Quote(r.To)))
+		// the trigger function of an ON UPDATE column refers to it by name
+		if col := local.Columns.Find(r.To); col != nil && col.OnUpdate != "" {
+			queries = append(queries, fmt.Sprintf(`DROP TRIGGER IF EXISTS "set_%s_%s" ON %s;`,
+				r.From, local.Name, p.Quote(local.Name)))
+		}
+		queries = append(queries, p.renameEnumType(local.Name+"_"+r.From, local.Name+"_"+r.To)...)
+	}
+	remote.Columns = renameRemoteColumns(remote.Columns, renames)
+	remote.PrimaryKey = renameRemoteColumns(remote.PrimaryKey, renames)
+	var indexes = make(pgRemoteIndexes, len(remote.Indexes))
+	for idx, index := range remote.Indexes {
+		index.Columns = renameRemoteColumns(index.Columns, renames)
+		indexes[idx] = index
+	}
+	remote.Indexes = indexes
+	return queries, remote
+}
+
+func renameRemoteColumns(columns pgRemoteColumns, renames []schema.Rename) pgRemoteColumns {
+	var result = make(pgRemoteColumns, len(columns))
+	copy(result, columns)
+	for idx := range result {
+		for _, r := range renames {
+			if result[idx].Name == r.From {
+				result[idx].Name = r.To
+			}
+		}
+	}
+	return result
+}
+
+// renameEnumType renames the ENUM type generated for a column, whose name is
+// derived from the table and column names.
+func (p *PGDialect) renameEnumType(from, to string) []string {
+	return []string{fmt.Sprintf(
+		`DO $$ BEGIN ALTER TYPE "%s_enum" RENAME TO "%s_enum"; EXCEPTION WHEN undefined_object OR duplicate_object THEN NULL; END $$;`,
+		from, to,
+	)}
+}
+
+// renameIndexes returns the ALTER INDEX ... RENAME statements for remote
+// indexes that only differ from a model index by name, and a copy of remote
+// using the new names, so renamed columns and tables keep their indexes.
+func (p *PGDialect) renameIndexes(local pgDdlTable, remote pgRemoteTable) ([]string, pgRemoteTable) {
+	var existing schema.Indexes
+	for _, index := range remote.Indexes {
+		if strings.HasPrefix(index.Name, "fk_") {
+			continue
+		}
+		var columns schema.Columns
+		for _, c := range index.Columns {
+			columns = append(columns, schema.Column{Name: c.Name})
+		}
+		existing = append(existing, schema.Index{Name: index.Name, Unique: index.Unique, Columns: columns})
+	}
+	renames := schema.IndexRenames(local.Index, existing)
+	if len(renames) == 0 {
+		return nil, remote
+	}
+	var queries []string
+	var indexes = make(pgRemoteIndexes, len(remote.Indexes))
+	copy(indexes, remote.Indexes)
+	for _, r := range renames {
+		queries = append(queries, fmt.Sprintf("-- index %s renamed from %s", r.To, r.From))
+		queries = append(queries, fmt.Sprintf("ALTER INDEX %s RENAME TO %s;", p.Quote(r.From), p.Quote(r.To)))
+		indexes.Find(r.From).Name = r.To
+	}
+	remote.Indexes = indexes
+	return queries, remote
+}
+
+// renameTableQuery returns the statements renaming table from to local,
+// along with the objects PostgreSQL names after the table.
+func (p *PGDialect) renameTableQuery(from string, local pgDdlTable) []string {
+	var queries = []string{
+		fmt.Sprintf("-- table renamed from %s", from),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", p.Quote(from), p.Quote(local.Name)),
+		fmt.Sprintf(`DO $$ BEGIN ALTER TABLE %s RENAME CONSTRAINT "%s_pkey" TO "%s_pkey"; EXCEPTION WHEN undefined_object OR duplicate_object THEN NULL; END $$;`,
+			p.Quote(local.Name), from, local.Name),
+	}
+	for _, col := range local.Columns {
+		if strings.HasPrefix(strings.ToLower(col.Type), "enum(") {
+			queries = append(queries, p.renameEnumType(from+"_"+col.Name, local.Name+"_"+col.Name)...)
+		}
+		if col.OnUpdate != "" {
+			queries = append(queries, fmt.Sprintf(`DROP TRIGGER IF EXISTS "set_%s_%s" ON %s;`,
+				col.Name, from, p.Quote(local.Name)))
+		}
+	}
+	return queries
+}
+
+// renameConstraints points the introspected foreign keys at renamed columns,
+// which the database carries over on rename, so they are not created a
+// second time.
+func renameConstraints(constraints []pgConstraint, table string, renames []schema.Rename) {
+	for idx := range constraints {
+		var c = &constraints[idx]
+		for _, r := range renames {
+			if c.Table == table && c.Column == r.From {
+				c.Column = r.To
+			}
+			if c.ReferencedTable == table && c.ReferencedColumn == r.From {
+				c.ReferencedColumn = r.To
+			}
+		}
+	}
+}
+
+// renameTables renames the remote tables of models implementing
+// RenamedFrom() string whose new table does not exist yet, and returns the
+// renamed tables as new name -> old name.
+func renameTables(stmts []*gorm.Statement, is pgRemoteTables, constraints []pgConstraint) map[string]string {
+	var renamed = map[string]string{}
+	for _, stmt := range stmts {
+		if stmt.Schema == nil {
+			continue
+		}
+		from := schema.TableRenamedFrom(stmt.Model)
+		if from == "" || from == stmt.Schema.Table || is.GetTable(stmt.Schema.Table) != nil {
+			continue
+		}
+		tbl := is.GetTable(from)
+		if tbl == nil {
+			continue
+		}
+		tbl.Table = stmt.Schema.Table
+		for idx := range constraints {
+			if constraints[idx].Table == from {
+				constraints[idx].Table = tbl.Table
+			}
+			if constraints[idx].ReferencedTable == from {
+				constraints[idx].ReferencedTable = tbl.Table
+			}
+		}
+		renamed[tbl.Table] = from
+	}
+	return renamed
+}
@@ -16,6 +16,7 @@ type pgRemoteTable struct {
 	Collation  string          `gorm:"column:table_collation"`
 	Columns    pgRemoteColumns `gorm:"-"`
 	Indexes    pgRemoteIndexes `gorm:"-"`
+	Checks     schema.Checks   `gorm:"-"`
 	Model      any             `gorm:"-"`
 	Reflect    reflect.Value   `gorm:"-"`
 	PrimaryKey pgRemoteColumns `gorm:"-"`
@@ -51,6 +52,7 @@ type pgRemoteColumn struct {
 	ColumnKey       string  `gorm:"column:column_key"`
 	Extra           string  `gorm:"column:extra"`
 	Comment         string  `gorm:"column:column_comment"`
+	Generation      *string `gorm:"column:generation_expression"`
 }
 
 type pgRemoteColumns []pgRemoteColumn
@@ -81,6 +83,21 @@ type pgConstraint struct {
 	ReferencedColumn string `gorm:"column:referenced_column_name"`
 }
 
+// pgRemoteCheck represents a CHECK constraint retrieved from the database.
+type pgRemoteCheck struct {
+	Table      string `gorm:"column:table_name"`
+	Name       string `gorm:"column:constraint_name"`
+	Definition string `gorm:"column:definition"`
+}
+
+// pgRemoteView represents a view or materialized view retrieved from the
+// database, with the comment carrying the hash of its definition.
+type pgRemoteView struct {
+	Table   string `gorm:"column:table_name"`
+	Kind    string `gorm:"column:kind"`
+	Comment string `gorm:"column:comment"`
+}
+
 // pgRemoteIndexStat represents an index statistic retrieved from the database.
 type pgRemoteIndexStat struct {
 	Database   string `gorm:"column:table_schema"`
@@ -109,10 +126,26 @@ func (list pgRemoteIndexes) Find(name string) *pgRemoteIndex {
 	return nil
 }
 
+// without returns the indexes not built on column.
+func (list pgRemoteIndexes) without(column string) pgRemoteIndexes {
+	var result pgRemoteIndexes
+	for _, index := range list {
+		if index.Columns.GetColumn(column) == nil {
+			result = append(result, index)
+		}
+	}
+	return result
+}
+
 // pgDdlTable represents a local model definition used for DDL generation.
 type pgDdlTable struct {
 	Columns    schema.Columns
 	PrimaryKey schema.Columns
 	Index      schema.Indexes
 	Name       string
+	Checks     schema.Checks
+	// View is the SELECT statement of a view model, see schema.View
+	View         string
+	Materialized bool
+	IsView       bool
 }
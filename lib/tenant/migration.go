@@ -0,0 +1,78 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/log"
+)
+
+// Migrate brings the schema of every tenant listed by Config.Tenants up to
+// date in schema mode, creating missing schemas. Only the PerTenant models
+// are created in the tenant schemas. Each schema holds its own
+// schema_migration history. It does nothing in row mode, where the tables
+// are shared and migrated as usual.
+func Migrate(ctx context.Context) error {
+	if config.Mode != Schema {
+		return nil
+	}
+	if config.Tenants == nil {
+		return fmt.Errorf("tenant: schema mode needs Config.Tenants to migrate the tenant schemas")
+	}
+	ids, err := config.Tenants(ctx)
+	if err != nil {
+		return err
+	}
+	return MigrateSchemas(ctx, ids...)
+}
+
+// MigrateSchemas migrates the schemas of the given tenants, stopping at the
+// first failure.
+func MigrateSchemas(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		if !validID.MatchString(id) {
+			return fmt.Errorf("%w: %q", ErrInvalidTenant, id)
+		}
+		log.Info("migrating tenant schema", "tenant", id, "schema", SchemaName(id))
+		if err := db.WithContext(ctx).Exec(fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s"`, SchemaName(id))).Error; err != nil {
+			return fmt.Errorf("tenant %s: %w", id, err)
+		}
+		if err := migrateSchema(ctx, id); err != nil {
+			return fmt.Errorf("tenant %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// migrateSchema runs the migrations on a connection whose search_path
+// selects the schema of the tenant, so the unqualified DDL lands there.
+func migrateSchema(ctx context.Context, id string) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer release(conn)
+	if _, err = conn.ExecContext(ctx, "SELECT set_config('search_path', $1, false)", searchPath(id)); err != nil {
+		return err
+	}
+	var session = db.WithContext(WithoutTenant(ctx))
+	session.Statement.ConnPool = conn
+	return schema.DoMigration(schema.OnlyModels(schema.InSchema(session, SchemaName(id)), PerTenant))
+}
+
+// PerTenant reports whether model has a table in each tenant schema: it
+// embeds types.Tenant, or has a PerTenant() bool method returning true.
+// The other models are shared and stay in public, where the search_path of
+// the tenants finds them.
+func PerTenant(model any) bool {
+	if obj, ok := model.(interface{ PerTenant() bool }); ok {
+		return obj.PerTenant()
+	}
+	_, ok := model.(interface{ TenantColumn() string })
+	return ok
+}
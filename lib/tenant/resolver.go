@@ -0,0 +1,93 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Resolver finds the tenant of a request. It returns an empty id when the
+// request does not name a tenant.
+type Resolver func(c fiber.Ctx) (string, error)
+
+// Subdomain resolves the tenant from the first subdomain of the host, so
+// acme.example.com belongs to acme. offset is the number of labels of the
+// base domain and defaults to 2.
+func Subdomain(offset ...int) Resolver {
+	return func(c fiber.Ctx) (string, error) {
+		if subdomains := c.Subdomains(offset...); len(subdomains) > 0 {
+			return subdomains[0], nil
+		}
+		return "", nil
+	}
+}
+
+// Header resolves the tenant from a request header such as X-Tenant-ID.
+func Header(name string) Resolver {
+	return func(c fiber.Ctx) (string, error) {
+		return strings.TrimSpace(c.Get(name)), nil
+	}
+}
+
+// JWTClaim resolves the tenant from a claim of the bearer token. verify
+// checks the signature of the token and returns its claims; unverified
+// tokens are never trusted.
+func JWTClaim(claim string, verify func(token string) (map[string]any, error)) Resolver {
+	return func(c fiber.Ctx) (string, error) {
+		token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || token == "" {
+			return "", nil
+		}
+		claims, err := verify(strings.TrimSpace(token))
+		if err != nil {
+			return "", err
+		}
+		if value, ok := claims[claim]; ok && value != nil {
+			return fmt.Sprint(value), nil
+		}
+		return "", nil
+	}
+}
+
+// Resolve returns the tenant of the request from the configured resolvers.
+func Resolve(c fiber.Ctx) (string, error) {
+	for _, resolver := range config.Resolvers {
+		id, err := resolver(c)
+		if err != nil {
+			return "", err
+		}
+		if id != "" {
+			return id, nil
+		}
+	}
+	return "", nil
+}
+
+// Middleware resolves the tenant of each request and runs the rest of the
+// chain with it on the context, see Run. Handlers reach it through
+// c.Context().
+func Middleware() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		id, err := Resolve(c)
+		if err != nil {
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		}
+		if id == "" {
+			if config.Required {
+				return fiber.NewError(fiber.StatusBadRequest, "tenant is required")
+			}
+			return c.Next()
+		}
+		if !validID.MatchString(id) {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid tenant")
+		}
+		var parent = c.Context()
+		defer c.SetContext(parent)
+		return Run(parent, id, func(ctx context.Context) error {
+			c.SetContext(ctx)
+			return c.Next()
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package tenant
+
+import (
+	"database/sql"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	gschema "gorm.io/gorm/schema"
+)
+
+// plugin registers the callbacks isolating the tenants.
+type plugin struct{}
+
+func (plugin) Name() string {
+	return "evo:tenant"
+}
+
+func (p plugin) Initialize(conn *gorm.DB) error {
+	var callbacks = conn.Callback()
+	var steps = []struct {
+		register func(name string, fn func(*gorm.DB)) error
+		fn       func(*gorm.DB)
+	}{
+		{callbacks.Create().Before("gorm:create").Register, assign},
+		{callbacks.Query().Before("gorm:query").Register, scope},
+		{callbacks.Row().Before("gorm:row").Register, scope},
+		{callbacks.Update().Before("gorm:update").Register, scopeUpdate},
+		{callbacks.Delete().Before("gorm:delete").Register, scope},
+	}
+	for _, step := range steps {
+		if err := step.register("evo:tenant", step.fn); err != nil {
+			return err
+		}
+	}
+	var schemaSteps = []func(name string, fn func(*gorm.DB)) error{
+		callbacks.Create().Before("gorm:create").Register,
+		callbacks.Query().Before("gorm:query").Register,
+		callbacks.Row().Before("gorm:row").Register,
+		callbacks.Update().Before("gorm:update").Register,
+		callbacks.Delete().Before("gorm:delete").Register,
+		callbacks.Raw().Before("gorm:raw").Register,
+	}
+	for _, register := range schemaSteps {
+		if err := register("evo:tenant_schema", selectSchema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scopedColumns caches the tenant column of each parsed model, empty for
+// models that do not embed types.Tenant.
+var scopedColumns sync.Map
+
+// tenantField returns the tenant field of the statement model, or nil when
+// the model is not tenant scoped.
+func tenantField(stmt *gorm.Statement) *gschema.Field {
+	if stmt.Schema == nil {
+		return nil
+	}
+	column, ok := scopedColumns.Load(stmt.Schema)
+	if !ok {
+		column = ""
+		if obj, ok := reflect.New(stmt.Schema.ModelType).Interface().(interface{ TenantColumn() string }); ok {
+			column = obj.TenantColumn()
+		}
+		scopedColumns.Store(stmt.Schema, column)
+	}
+	if column == "" {
+		return nil
+	}
+	return stmt.Schema.LookUpField(column.(string))
+}
+
+// rowTenant returns the tenant the statement is scoped to in row mode, and
+// false when it is not scoped.
+func rowTenant(tx *gorm.DB) (*gschema.Field, string, bool) {
+	if config.Mode != Row || tx.Error != nil || bypassed(tx.Statement.Context) {
+		return nil, "", false
+	}
+	field := tenantField(tx.Statement)
+	if field == nil {
+		return nil, "", false
+	}
+	id, ok := FromContext(tx.Statement.Context)
+	if !ok {
+		tx.AddError(ErrNoTenant)
+		return nil, "", false
+	}
+	return field, id, true
+}
+
+// scope adds the tenant condition to reads and deletes of scoped models.
+// Raw SQL is left as written.
+func scope(tx *gorm.DB) {
+	if tx.Statement.SQL.Len() > 0 {
+		return
+	}
+	field, id, ok := rowTenant(tx)
+	if !ok {
+		return
+	}
+	if _, ok := tx.Statement.Clauses["tenant_scoped"]; ok {
+		return
+	}
+	tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: id},
+	}})
+	tx.Statement.Clauses["tenant_scoped"] = clause.Clause{}
+}
+
+// scopeUpdate scopes updates like reads and refuses to move a row to
+// another tenant.
+func scopeUpdate(tx *gorm.DB) {
+	field, id, ok := rowTenant(tx)
+	if !ok {
+		return
+	}
+	if value, ok := assignedValue(tx.Statement, field); ok && value != "" && value != id {
+		tx.AddError(ErrTenantMismatch)
+		return
+	}
+	scope(tx)
+}
+
+// assignedValue returns the tenant an update writes, if any.
+func assignedValue(stmt *gorm.Statement, field *gschema.Field) (string, bool) {
+	switch dest := stmt.Dest.(type) {
+	case map[string]any:
+		for _, key := range []string{field.DBName, field.Name} {
+			if value, ok := dest[key]; ok {
+				s, _ := value.(string)
+				return s, true
+			}
+		}
+		return "", false
+	}
+	var rv = reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	if rv.Kind() != reflect.Struct || rv.Type() != stmt.Schema.ModelType {
+		return "", false
+	}
+	value, zero := field.ValueOf(stmt.Context, rv)
+	if zero {
+		return "", false
+	}
+	s, _ := value.(string)
+	return s, true
+}
+
+// assign sets the tenant of created rows, refusing rows that already belong
+// to another tenant.
+func assign(tx *gorm.DB) {
+	field, id, ok := rowTenant(tx)
+	if !ok {
+		return
+	}
+	var set = func(rv reflect.Value) {
+		value, zero := field.ValueOf(tx.Statement.Context, rv)
+		if !zero && value != id {
+			tx.AddError(ErrTenantMismatch)
+			return
+		}
+		if err := field.Set(tx.Statement.Context, rv, id); err != nil {
+			tx.AddError(err)
+		}
+	}
+	switch rv := tx.Statement.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+}
+
+// selectSchema sends the statements of a tenant to its schema: statements
+// on the pool move to the connection of Run, and statements in a
+// transaction set its search_path first.
+func selectSchema(tx *gorm.DB) {
+	var ctx = tx.Statement.Context
+	if config.Mode != Schema || tx.Error != nil || bypassed(ctx) {
+		return
+	}
+	id, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	var conn = tenantConn(ctx)
+	switch pool := tx.Statement.ConnPool.(type) {
+	case *sql.Conn:
+		if pool != conn {
+			tx.AddError(ErrNoConnection)
+		}
+	case gorm.TxCommitter:
+		if _, err := tx.Statement.ConnPool.ExecContext(ctx, "SELECT set_config('search_path', $1, true)", searchPath(id)); err != nil {
+			tx.AddError(err)
+		}
+	default:
+		if conn == nil {
+			tx.AddError(ErrNoConnection)
+			return
+		}
+		tx.Statement.ConnPool = conn
+	}
+}
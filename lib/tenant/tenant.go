@@ -0,0 +1,174 @@
+// Package tenant serves many customers from one deployment. It resolves the
+// tenant of each request, carries it on the context and isolates the data of
+// each tenant, either by tenant_id column (row mode) or by PostgreSQL schema
+// (schema mode).
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Mode selects how the data of the tenants is isolated.
+type Mode int
+
+const (
+	// Row keeps all tenants in the same tables and scopes the models
+	// embedding types.Tenant by their tenant_id column.
+	Row Mode = iota
+
+	// Schema keeps each tenant in its own PostgreSQL schema, selected per
+	// request through the search_path.
+	Schema
+)
+
+var (
+	// ErrNoTenant is returned for queries on tenant scoped models without a
+	// tenant on the context.
+	ErrNoTenant = errors.New("tenant: no tenant on the context")
+
+	// ErrTenantMismatch is returned when a row is written for another tenant
+	// than the one on the context.
+	ErrTenantMismatch = errors.New("tenant: row belongs to another tenant")
+
+	// ErrNoConnection is returned in schema mode for queries with a tenant on
+	// the context that were not started by Run or Middleware.
+	ErrNoConnection = errors.New("tenant: no tenant connection on the context, use tenant.Run")
+
+	// ErrInvalidTenant is returned for tenant ids that are not made of
+	// letters, digits, '_' and '-'.
+	ErrInvalidTenant = errors.New("tenant: invalid tenant id")
+)
+
+// Config configures the tenant subsystem.
+type Config struct {
+	Mode Mode
+
+	// Resolvers find the tenant of a request; the first one returning a
+	// tenant wins.
+	Resolvers []Resolver
+
+	// Required rejects requests whose tenant cannot be resolved. Otherwise
+	// they run without tenant, and queries on scoped models fail.
+	Required bool
+
+	// SchemaPrefix prefixes the tenant id to name its schema. Defaults to
+	// "tenant_".
+	SchemaPrefix string
+
+	// Tenants lists the tenants whose schemas Migrate brings up to date.
+	Tenants func(ctx context.Context) ([]string, error)
+}
+
+type contextKey struct{}
+type bypassKey struct{}
+type connKey struct{}
+
+var (
+	config Config
+	db     *gorm.DB
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,63}$`)
+
+// Setup enables tenant isolation on conn with the given configuration.
+func Setup(conn *gorm.DB, c Config) error {
+	if c.Mode == Schema && conn.Dialector.Name() != "postgres" {
+		return fmt.Errorf("tenant: schema mode requires PostgreSQL, not %s", conn.Dialector.Name())
+	}
+	if c.SchemaPrefix == "" {
+		c.SchemaPrefix = "tenant_"
+	}
+	config, db = c, conn
+	return conn.Use(&plugin{})
+}
+
+// WithTenant returns a copy of ctx carrying the tenant id.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant carried by ctx.
+func FromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// WithoutTenant returns a copy of ctx whose queries are not scoped, for
+// administrative work across tenants.
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func bypassed(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, _ := ctx.Value(bypassKey{}).(bool)
+	return v
+}
+
+// SchemaName returns the PostgreSQL schema of the tenant id.
+func SchemaName(id string) string {
+	return config.SchemaPrefix + id
+}
+
+// searchPath returns the search_path of the tenant id: its own schema, then
+// public for the shared tables.
+func searchPath(id string) string {
+	return `"` + strings.ReplaceAll(SchemaName(id), `"`, `""`) + `", public`
+}
+
+// Run calls fn with a context carrying the tenant id. In schema mode the
+// queries of fn run on a connection whose search_path selects the schema of
+// the tenant; the connection goes back to the pool once fn returns.
+func Run(ctx context.Context, id string, fn func(ctx context.Context) error) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("%w: %q", ErrInvalidTenant, id)
+	}
+	ctx = WithTenant(ctx, id)
+	if config.Mode != Schema {
+		return fn(ctx)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer release(conn)
+	if _, err = conn.ExecContext(ctx, "SELECT set_config('search_path', $1, false)", searchPath(id)); err != nil {
+		return err
+	}
+	return fn(context.WithValue(ctx, connKey{}, conn))
+}
+
+// release resets the search_path of conn before returning it to the pool,
+// or discards the connection when that fails so no other tenant gets it.
+func release(conn *sql.Conn) {
+	if _, err := conn.ExecContext(context.Background(), "RESET search_path"); err != nil {
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	_ = conn.Close()
+}
+
+func tenantConn(ctx context.Context) *sql.Conn {
+	if ctx == nil {
+		return nil
+	}
+	conn, _ := ctx.Value(connKey{}).(*sql.Conn)
+	return conn
+}
@@ -0,0 +1,195 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getevo/evo/v2/lib/db/types"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type invoice struct {
+	ID uint
+	types.Tenant
+	Total int
+}
+
+type currency struct {
+	Code string `gorm:"primaryKey"`
+}
+
+func newTenantTestDB(t *testing.T, c Config) *gorm.DB {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.AutoMigrate(&invoice{}, &currency{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Setup(conn, c); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config, db = Config{}, nil })
+	return conn
+}
+
+func TestRowMode(t *testing.T) {
+	conn := newTenantTestDB(t, Config{})
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+
+	if err := conn.WithContext(acme).Create(&[]invoice{{Total: 1}, {Total: 2}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var created = invoice{Total: 3}
+	if err := conn.WithContext(globex).Create(&created).Error; err != nil {
+		t.Fatal(err)
+	}
+	if created.TenantID != "globex" {
+		t.Errorf("expected the created row to be assigned to globex, got %q", created.TenantID)
+	}
+
+	var count int64
+	conn.WithContext(acme).Model(&invoice{}).Count(&count)
+	if count != 2 {
+		t.Errorf("expected acme to see 2 invoices, got %d", count)
+	}
+	var found invoice
+	if err := conn.WithContext(acme).First(&found, created.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected the invoice of globex to be invisible to acme, got %v", err)
+	}
+	conn.WithContext(WithoutTenant(context.Background())).Model(&invoice{}).Count(&count)
+	if count != 3 {
+		t.Errorf("expected WithoutTenant to see all 3 invoices, got %d", count)
+	}
+
+	// updates and deletes only reach the rows of the tenant
+	conn.WithContext(acme).Model(&invoice{}).Where("1 = 1").Update("total", 10)
+	conn.WithContext(acme).Where("1 = 1").Delete(&invoice{})
+	var other invoice
+	conn.WithContext(globex).First(&other, created.ID)
+	if other.Total != 3 {
+		t.Errorf("expected the invoice of globex to be untouched, got total %d", other.Total)
+	}
+	conn.WithContext(WithoutTenant(context.Background())).Model(&invoice{}).Count(&count)
+	if count != 1 {
+		t.Errorf("expected only the invoice of globex to remain, got %d", count)
+	}
+
+	// rows cannot be written for another tenant
+	if err := conn.WithContext(acme).Create(&invoice{Tenant: types.Tenant{TenantID: "globex"}}).Error; !errors.Is(err, ErrTenantMismatch) {
+		t.Errorf("expected a create for another tenant to fail, got %v", err)
+	}
+	if err := conn.WithContext(acme).Model(&invoice{}).Where("1 = 1").Update("tenant_id", "globex").Error; !errors.Is(err, ErrTenantMismatch) {
+		t.Errorf("expected moving a row to another tenant to fail, got %v", err)
+	}
+
+	// scoped models need a tenant, shared ones do not
+	if err := conn.Find(&[]invoice{}).Error; !errors.Is(err, ErrNoTenant) {
+		t.Errorf("expected a query without tenant to fail, got %v", err)
+	}
+	if err := conn.Find(&[]currency{}).Error; err != nil {
+		t.Errorf("expected shared models to need no tenant, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	newTenantTestDB(t, Config{Required: true, Resolvers: []Resolver{
+		Header("X-Tenant-ID"),
+		JWTClaim("org", func(token string) (map[string]any, error) {
+			if token != "valid" {
+				return nil, errors.New("invalid token")
+			}
+			return map[string]any{"org": "initech"}, nil
+		}),
+		Subdomain(),
+	}})
+
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/", func(c fiber.Ctx) error {
+		id, _ := FromContext(c.Context())
+		return c.SendString(id)
+	})
+
+	for _, tc := range []struct {
+		name, host, header, value string
+		status                    int
+		tenant                    string
+	}{
+		{"header", "example.com", "X-Tenant-ID", "acme", 200, "acme"},
+		{"jwt", "example.com", "Authorization", "Bearer valid", 200, "initech"},
+		{"bad jwt", "example.com", "Authorization", "Bearer forged", 401, ""},
+		{"subdomain", "globex.example.com", "", "", 200, "globex"},
+		{"missing", "example.com", "", "", 400, ""},
+		{"invalid", "example.com", "X-Tenant-ID", "a;b", 400, ""},
+	} {
+		req := httptest.NewRequest("GET", "http://"+tc.host+"/", nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, resp.StatusCode)
+			continue
+		}
+		if tc.status == 200 {
+			var body = make([]byte, 64)
+			n, _ := resp.Body.Read(body)
+			if got := string(body[:n]); got != tc.tenant {
+				t.Errorf("%s: expected tenant %q, got %q", tc.name, tc.tenant, got)
+			}
+		}
+	}
+}
+
+func TestSchemaModeRequiresPostgres(t *testing.T) {
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Setup(conn, Config{Mode: Schema}); err == nil {
+		t.Error("expected schema mode to be refused on SQLite")
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	config.SchemaPrefix = "tenant_"
+	t.Cleanup(func() { config = Config{} })
+	if got := searchPath("acme"); got != `"tenant_acme", public` {
+		t.Errorf("unexpected search_path %s", got)
+	}
+}
+
+type auditLog struct {
+	ID uint
+}
+
+func (auditLog) PerTenant() bool { return true }
+
+func TestPerTenantModels(t *testing.T) {
+	if !PerTenant(&invoice{}) || !PerTenant(auditLog{}) {
+		t.Error("expected the models embedding types.Tenant or opting in to get a table per tenant")
+	}
+	// shared tables are left in public, which the search_path of the
+	// tenants falls back to
+	if PerTenant(&currency{}) {
+		t.Error("expected a shared model to stay in public")
+	}
+	config.SchemaPrefix = "tenant_"
+	t.Cleanup(func() { config = Config{} })
+	if path := searchPath("acme"); !strings.HasSuffix(path, ", public") {
+		t.Errorf("expected public after the tenant schema, got %s", path)
+	}
+}
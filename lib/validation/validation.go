@@ -84,8 +84,7 @@ func StructWithContext(ctx context.Context, input interface{}, fields ...string)
 		return nil
 	}
 
-	for idx, _ := range s.Fields {
-		field := s.Fields[idx]
+	for _, field := range validatedFields(s) {
 		if field.Tag.Get("validation") != "" {
 			var err = validateFieldWithContext(ctx, &g, field, nil)
 			if err != nil {
@@ -124,9 +123,13 @@ func StructNonZeroFieldsWithContext(ctx context.Context, input interface{}, fiel
 	}
 
 	ref = reflect.ValueOf(input)
-	for idx, _ := range s.Fields {
-		field := s.Fields[idx]
-		_, zero := field.ValueOf(ctx, ref)
+	for _, field := range validatedFields(s) {
+		var zero bool
+		if field.ValueOf != nil {
+			_, zero = field.ValueOf(ctx, ref)
+		} else {
+			zero = reflect.Indirect(ref).FieldByName(field.Name).IsZero()
+		}
 
 		if !zero && field.Tag.Get("validation") != "" {
 			var err = validateFieldWithContext(ctx, &g, field, nil)
@@ -140,6 +143,24 @@ func StructNonZeroFieldsWithContext(ctx context.Context, input interface{}, fiel
 	return errors
 }
 
+// validatedFields returns the fields of s along with the struct fields GORM
+// flattens into the columns of an embedded struct, such as a types.Money, so
+// that their own validation tag applies.
+func validatedFields(s *schema.Schema) []*schema.Field {
+	var fields = append([]*schema.Field(nil), s.Fields...)
+	var seen = map[string]bool{}
+	for _, field := range s.Fields {
+		if len(field.BindNames) < 2 || seen[field.BindNames[0]] {
+			continue
+		}
+		seen[field.BindNames[0]] = true
+		if outer, ok := s.ModelType.FieldByName(field.BindNames[0]); ok && outer.Tag.Get("validation") != "" {
+			fields = append(fields, &schema.Field{Name: outer.Name, Tag: outer.Tag, StructField: outer, FieldType: outer.Type})
+		}
+	}
+	return fields
+}
+
 func validateField(g *generic.Value, field *schema.Field) error {
 	return validateFieldWithContext(context.Background(), g, field, nil)
 }
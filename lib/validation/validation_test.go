@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/getevo/evo/v2/lib/db/types"
 	"github.com/getevo/evo/v2/lib/validation"
 	"github.com/stretchr/testify/assert"
 )
@@ -542,6 +543,78 @@ func TestIBANValidator(t *testing.T) {
 	}
 }
 
+func TestMoneyValidator(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      interface{}
+		validation string
+		wantErr    bool
+	}{
+		{"positive money", types.MustMoney("0.01", "EUR"), "money>0", false},
+		{"zero money", types.MustMoney("0", "EUR"), "money>0", true},
+		{"money pointer", ptr(types.MustMoney("-1", "EUR")), "money>=0", true},
+		{"decimal below limit", types.MustDecimal("99.99"), "money<100", false},
+		{"decimal at limit", types.MustDecimal("100.00"), "money<100", true},
+		{"exact fraction", "10.10", "money<=10.1", false},
+		{"string amount", "12.50 EUR", "money>12.49", false},
+		{"invalid amount", "abc", "money>0", true},
+		{"empty", "", "money>0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validation.Value(tt.value, tt.validation)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCurrencyValidator(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      interface{}
+		validation string
+		wantErr    bool
+	}{
+		{"known code", "JPY", "currency", false},
+		{"unknown code", "XYZ", "currency", true},
+		{"allowed money", types.MustMoney("1", "USD"), "currency(EUR,USD)", false},
+		{"money not allowed", types.MustMoney("1", "GBP"), "currency(EUR, USD)", true},
+		{"lower case code", "eur", "currency(EUR)", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validation.Value(tt.value, tt.validation)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+type orderWithMoney struct {
+	ID    uint
+	Total types.Money `gorm:"embedded;embeddedPrefix:total_" validation:"money>0,currency(EUR)"`
+}
+
+func TestEmbeddedStructValidation(t *testing.T) {
+	assert.Empty(t, validation.Struct(&orderWithMoney{Total: types.MustMoney("10", "EUR")}))
+	assert.Len(t, validation.Struct(&orderWithMoney{Total: types.MustMoney("0", "EUR")}), 1)
+	assert.Len(t, validation.Struct(&orderWithMoney{Total: types.MustMoney("10", "USD")}), 1)
+	assert.Empty(t, validation.StructNonZeroFields(&orderWithMoney{}))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
 // Test Context Support
 
 func TestStructWithContext(t *testing.T) {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/getevo/evo/v2/lib/db"
 	scm "github.com/getevo/evo/v2/lib/db/schema"
+	"github.com/getevo/evo/v2/lib/db/types"
 	"github.com/getevo/evo/v2/lib/generic"
 	"github.com/getevo/evo/v2/lib/is"
 	"gorm.io/gorm"
@@ -131,6 +132,10 @@ var Validators = map[*regexp.Regexp]func(match []string, value *generic.Value) e
 	regexp.MustCompile(`(?i)^after[-_]?now$`):                    afterNowValidator,
 	regexp.MustCompile(`(?i)^date[-_]?format\((.+)\)$`):          dateFormatValidator,
 	regexp.MustCompile(`(?i)^iban$`):                             ibanValidator,
+
+	regexp.MustCompile(`(?i)^money(>|<|<=|>=|==|!=|<>|=)([+\-]?\d+(?:\.\d+)?)$`): moneyValidator,
+	regexp.MustCompile(`(?i)^currency$`):                                         currencyValidator,
+	regexp.MustCompile(`(?i)^currency\((.+)\)$`):                                 currencyValidator,
 }
 
 func slugValidator(match []string, value *generic.Value) error {
@@ -1147,6 +1152,89 @@ func ibanValidator(match []string, value *generic.Value) error {
 	return nil
 }
 
+// moneyValidator compares the exact amount of a types.Money, types.Decimal or
+// number with a limit, such as money>0.
+func moneyValidator(match []string, value *generic.Value) error {
+	var v = value.String()
+	if v == "" || v == "<nil>" {
+		return nil
+	}
+	var amount types.Decimal
+	switch m := value.Input.(type) {
+	case types.Money:
+		amount = m.Amount
+	case *types.Money:
+		amount = m.Amount
+	case types.Decimal:
+		amount = m
+	case *types.Decimal:
+		amount = *m
+	default:
+		var err error
+		if m, parseErr := types.ParseMoney(v); parseErr == nil {
+			amount = m.Amount
+		} else if amount, err = types.NewDecimal(v); err != nil {
+			return fmt.Errorf("is not a valid amount")
+		}
+	}
+	var cmp = amount.Cmp(types.MustDecimal(match[2]))
+	switch match[1] {
+	case ">":
+		if cmp <= 0 {
+			return fmt.Errorf("must be greater than %s", match[2])
+		}
+	case ">=":
+		if cmp < 0 {
+			return fmt.Errorf("must be greater than or equal to %s", match[2])
+		}
+	case "<":
+		if cmp >= 0 {
+			return fmt.Errorf("must be less than %s", match[2])
+		}
+	case "<=":
+		if cmp > 0 {
+			return fmt.Errorf("must be less than or equal to %s", match[2])
+		}
+	case "==", "=":
+		if cmp != 0 {
+			return fmt.Errorf("must be equal to %s", match[2])
+		}
+	case "!=", "<>":
+		if cmp == 0 {
+			return fmt.Errorf("must not be equal to %s", match[2])
+		}
+	}
+	return nil
+}
+
+// currencyValidator checks that the currency of a types.Money, or a currency
+// code, is a known ISO 4217 currency, and one of the allow list of
+// currency(EUR,USD) when given.
+func currencyValidator(match []string, value *generic.Value) error {
+	var currency = value.String()
+	switch m := value.Input.(type) {
+	case types.Money:
+		currency = m.Currency
+	case *types.Money:
+		currency = m.Currency
+	}
+	if currency == "" || currency == "<nil>" {
+		return nil
+	}
+	if _, ok := types.MinorUnits(currency); !ok {
+		return fmt.Errorf("is not a valid currency")
+	}
+	if len(match) < 2 {
+		return nil
+	}
+	for _, allowed := range strings.Split(match[1], ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), currency) {
+			return nil
+		}
+	}
+	return fmt.Errorf("currency must be one of: %s", match[1])
+}
+
 // Cross-Field Validators (DB validators with access to other fields)
 
 func confirmedValidator(match []string, value *generic.Value, stmt *gorm.Statement, field *schema.Field) error {
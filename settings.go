@@ -38,6 +38,10 @@ type DatabaseConfig struct {
 	// Params will pass extra parameter to connection string
 	Params string `description:"Extra connection string parameters" default:"" json:"params" yaml:"params"`
 
+	// Replicas is a comma separated list of read replica servers. They use the
+	// credentials of the primary and serve its reads while they are healthy.
+	Replicas string `description:"Read replica servers (comma separated)" default:"" json:"replicas" yaml:"replicas"`
+
 	// MaxOpenConns indicates how many concurrent connections are allowed
 	MaxOpenConns int `description:"Max pool connections" default:"100" json:"max-open-connections" yaml:"max-open-connections"`
 
@@ -50,6 +54,48 @@ type DatabaseConfig struct {
 	// SlowQueryThreshold defines the threshold duration for query execution. If the query
 	// takes longer than this value, the driver will issue a warning.
 	SlowQueryThreshold time.Duration `description:"Slow query threshold" default:"500ms" json:"slow_query_threshold" yaml:"slow-query-threshold"`
+
+	// ExplainSlowQueries logs the EXPLAIN plan of the SELECT statements slower than
+	// SlowQueryThreshold.
+	ExplainSlowQueries bool `description:"Log the plan of slow queries" default:"false" json:"explain-slow-queries" yaml:"explain-slow-queries"`
+
+	// QueryStats collects the query count, database time and slowest statements of each
+	// request. Debug level 4 enables it, along with N+1 detection, a Server-Timing header
+	// and a log line per request.
+	QueryStats bool `description:"Collect per-request query stats" default:"false" json:"query-stats" yaml:"query-stats"`
+
+	// NPlusOneThreshold is the number of times the same statement may run in one request
+	// before an N+1 warning is logged, at debug level 4.
+	NPlusOneThreshold int `description:"Repetitions of a statement reported as N+1" default:"10" json:"n-plus-one-threshold" yaml:"n-plus-one-threshold"`
+
+	// EncryptionKeys is the key ring of the types.Encrypted columns: a comma separated
+	// list of id:base64 pairs of 32 byte keys, the first one encrypting new values. Run
+	// --encryption-rotate after putting a new key first.
+	EncryptionKeys string `description:"Encryption key ring (id:base64,...)" default:"" json:"encryption-keys" yaml:"encryption-keys"`
+
+	// BlindIndexKey is the base64 HMAC key of the types.BlindIndex columns. It must not
+	// change once indexes are stored.
+	BlindIndexKey string `description:"Blind index HMAC key (base64)" default:"" json:"blind-index-key" yaml:"blind-index-key"`
+
+	// FullTextLanguage is the PostgreSQL text search configuration of the full-text
+	// indexes and searches, see lib/db/search.
+	FullTextLanguage string `description:"Full-text search language (PostgreSQL)" default:"english" json:"fulltext-language" yaml:"fulltext-language"`
+
+	// PostGIS makes the types.Point columns PostGIS geography columns on PostgreSQL
+	// instead of plain point columns. The postgis extension must be installed.
+	PostGIS bool `description:"Use PostGIS geography columns for points (PostgreSQL)" default:"false" json:"postgis" yaml:"postgis"`
+
+	// PurgeSchedule is when the soft-deleted rows older than the purge_after retention of
+	// their model are hard deleted, as a scheduler pattern such as "03:00:00". Empty, the
+	// default, disables the purge.
+	PurgeSchedule string `description:"Soft delete purge schedule" default:"" json:"purge-schedule" yaml:"purge-schedule"`
+
+	// PurgeBatchSize is the number of rows the purge deletes per statement.
+	PurgeBatchSize int `description:"Soft delete purge batch size" default:"1000" json:"purge-batch-size" yaml:"purge-batch-size"`
+
+	// AllowDestructiveMigration lets --migration-do execute statements that may lose or
+	// rewrite data, such as dropping a column or narrowing its type.
+	AllowDestructiveMigration bool `description:"Allow destructive migration statements" default:"false" json:"allow-destructive-migration" yaml:"allow-destructive-migration"`
 }
 
 type HTTPConfig struct {